@@ -6,10 +6,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/micromdm/nanolib/log"
 	"github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/push/pacer"
 	"github.com/micromdm/nanomdm/storage"
 )
 
@@ -19,6 +21,9 @@ type PushEnqueuer struct {
 	store  storage.CommandEnqueuer
 	pusher push.Pusher
 	noPush bool
+	pacer  *pacer.Pacer
+
+	waitInterval time.Duration
 }
 
 // PushEnqueuerOptions configures the push enqueuer.
@@ -40,6 +45,15 @@ func WithNoPush() PushEnqueuerOption {
 	}
 }
 
+// WithPacer configures a push pacer for paced pushes.
+// See [PushEnqueuer.EnqueueWithPacedPush].
+func WithPacer(p *pacer.Pacer) PushEnqueuerOption {
+	return func(pe *PushEnqueuer) error {
+		pe.pacer = p
+		return nil
+	}
+}
+
 // NewPushEnqueuer creates a new push enqueuer.
 func NewPushEnqueuer(store storage.CommandEnqueuer, pusher push.Pusher, opts ...PushEnqueuerOption) (*PushEnqueuer, error) {
 	if store == nil && pusher == nil {
@@ -93,6 +107,34 @@ func (pe *PushEnqueuer) EnqueueWithPush(ctx context.Context, command *mdm.Comman
 	return r, code(r, len(ids)), nil
 }
 
+// EnqueueWithPacedPush enqueues command (if not nil) and starts a
+// paced push job for ids using pace. The push job ID is returned in the
+// API result. Push results are not returned but are available from the
+// push pacer using the job ID. A push pacer must be configured.
+// See [EnqueueWithPush] for the return value semantics.
+func (pe *PushEnqueuer) EnqueueWithPacedPush(ctx context.Context, command *mdm.Command, ids []string, pace pacer.Pace) (*APIResult, int, error) {
+	r := new(APIResult)
+
+	if pe.pacer == nil {
+		return r, 500, errors.New("no push pacer configured")
+	}
+
+	if command != nil {
+		doEnqueue(ctx, r, pe.logger, pe.store, command, ids)
+	}
+
+	if r.EnqueueError == nil {
+		// TODO: only push to non-erroring enrollment IDs
+		jobID, err := pe.pacer.Start(ids, pace)
+		if err != nil {
+			r.PushError = NewError(fmt.Errorf("starting push job: %w", err))
+		}
+		r.PushJobID = jobID
+	}
+
+	return r, code(r, len(ids)), nil
+}
+
 // code translates an [APIResult] to an interger code.
 // See [EnqueueWithPush] for specific code meanings.
 func code(r *APIResult, idCount int) int {
@@ -139,3 +181,116 @@ func (pe *PushEnqueuer) RawCommandEnqueueWithPush(ctx context.Context, rawComman
 	}
 	return pe.EnqueueWithPush(ctx, command, ids, noPush)
 }
+
+// RawCommandEnqueueWithPacedPush enqueues rawCommand and starts a paced push job for ids.
+// See [EnqueueWithPacedPush] for calling semantics.
+func (pe *PushEnqueuer) RawCommandEnqueueWithPacedPush(ctx context.Context, rawCommand []byte, ids []string, pace pacer.Pace) (*APIResult, int, error) {
+	var command *mdm.Command
+	if len(rawCommand) > 0 {
+		var err error
+		if command, err = mdm.DecodeCommand(rawCommand); err != nil {
+			return nil, 500, fmt.Errorf("decoding command: %w", err)
+		}
+	}
+	return pe.EnqueueWithPacedPush(ctx, command, ids, pace)
+}
+
+// EnqueueBatchWithPush enqueues the commands of items to their
+// enrollment IDs and can send APNs pushes. Each enrollment ID that had
+// a command successfully enqueued is pushed to only once, after all
+// commands are enqueued. The per-command results are returned in the
+// order of items. See [EnqueueWithPush] for the return integer semantics
+// which here apply to every command and enrollment ID pair.
+func (pe *PushEnqueuer) EnqueueBatchWithPush(ctx context.Context, items []*storage.EnqueueItem, noPush bool) (*BatchResult, int, error) {
+	r := &BatchResult{
+		NoPush:  noPush || pe.noPush,
+		Results: make([]*APIResult, len(items)),
+	}
+
+	if len(items) < 1 {
+		return r, 500, errors.New("no commands to enqueue")
+	}
+	for i, item := range items {
+		if item == nil || item.Command == nil {
+			return r, 500, fmt.Errorf("nil command at index %d", i)
+		}
+		if len(item.IDs) < 1 {
+			return r, 500, fmt.Errorf("no ids for command at index %d", i)
+		}
+		r.Results[i] = &APIResult{NoPush: r.NoPush}
+	}
+
+	doEnqueueBatch(ctx, r.Results, pe.logger, pe.store, items)
+
+	if !r.NoPush {
+		// push to each enrollment ID with a successfully enqueued command once
+		var ids []string
+		seen := make(map[string]struct{})
+		for i, item := range items {
+			if r.Results[i].EnqueueError != nil {
+				continue
+			}
+			for _, id := range item.IDs {
+				if _, ok := seen[id]; ok || r.Results[i].Status[id].EnqueueError != nil {
+					continue
+				}
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) > 0 {
+			pr := new(APIResult)
+			doPush(ctx, pr, pe.logger, pe.pusher, ids)
+			r.PushError = pr.PushError
+
+			// distribute the push results to each command result
+			for i, item := range items {
+				for _, id := range item.IDs {
+					pushResult, ok := pr.Status[id]
+					if !ok {
+						continue
+					}
+					if r.Results[i].Status == nil {
+						r.Results[i].Status = make(map[string]EnrollmentResult)
+					}
+					er := r.Results[i].Status[id]
+					er.PushID = pushResult.PushID
+					er.PushError = pushResult.PushError
+					r.Results[i].Status[id] = er
+				}
+			}
+		}
+	}
+
+	return r, batchCode(r, items), nil
+}
+
+// batchCode translates a [BatchResult] to an integer code.
+// See [EnqueueWithPush] for specific code meanings.
+func batchCode(r *BatchResult, items []*storage.EnqueueItem) int {
+	if r == nil || r.PushError != nil || r.EnqueueError != nil {
+		return 500
+	}
+
+	var total, errCt int
+	for i, item := range items {
+		total += len(item.IDs)
+		if r.Results[i].EnqueueError != nil {
+			errCt += len(item.IDs)
+			continue
+		}
+		for _, id := range item.IDs {
+			if er := r.Results[i].Status[id]; er.EnqueueError != nil || er.PushError != nil {
+				errCt++
+			}
+		}
+	}
+
+	if errCt < 1 {
+		return 200
+	} else if errCt < total {
+		return 207
+	}
+	return 500
+}
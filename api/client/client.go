@@ -0,0 +1,1127 @@
+// Package client is a Go client for the NanoMDM HTTP API.
+//
+// The client covers the API endpoints documented in docs/openapi.yaml:
+// the v1 API (see HandleAPIv1 in the http/api package) as well as the
+// migration and version endpoints.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/api"
+	httpapi "github.com/micromdm/nanomdm/http/api"
+	"github.com/micromdm/nanomdm/http/escrowkeyunlock"
+	"github.com/micromdm/nanomdm/push/pacer"
+	"github.com/micromdm/nanomdm/service/ddm"
+	"github.com/micromdm/nanomdm/service/webhook"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	// DefaultUsername is the default HTTP basic authentication username.
+	DefaultUsername = "nanomdm"
+
+	// DefaultAPIPrefix is the default URL path prefix of the v1 API.
+	DefaultAPIPrefix = "/v1"
+
+	EndpointPushCert        = "/pushcert"
+	EndpointPushCertCSR     = "/pushcert/csr"
+	EndpointPushCertSign    = "/pushcert/sign"
+	EndpointPush            = "/push/"
+	EndpointPushJobs        = "/pushjobs/"
+	EndpointEnqueue         = "/enqueue/"
+	EndpointEnqueueBatch    = "/enqueuebatch"
+	EndpointEnqueueWait     = "/enqueuewait/"
+	EndpointEscrowKeyUnlock = "/escrowkeyunlock"
+	EndpointProfileSign     = "/profilesign"
+	EndpointAPICredentials  = "/apicredentials/"
+	EndpointTemplates       = "/templates/"
+	EndpointDDMDeclarations = "/ddm/declarations"
+	EndpointDDMSets         = "/ddm/sets"
+	EndpointDDMEnrollments  = "/ddm/enrollments"
+	EndpointDDMStatus       = "/ddm/status"
+	EndpointEnrollTokens    = "/enrolltokens"
+	EndpointAudit           = "/audit"
+	EndpointEvents          = "/events"
+
+	// EndpointMigration, EndpointVersion, and EndpointEnroll are not
+	// prefixed by the API prefix.
+	EndpointMigration = "/migration"
+	EndpointVersion   = "/version"
+	EndpointEnroll    = "/enroll"
+)
+
+// Doer executes an HTTP request.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// StatusError is returned when the API responds with an unsuccessful HTTP status.
+type StatusError struct {
+	StatusCode int
+
+	// Err is the error returned by the API, if any.
+	Err *api.Error
+}
+
+func (e *StatusError) Error() string {
+	s := "HTTP status " + strconv.Itoa(e.StatusCode)
+	if e.Err.Valid() {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Unwrap returns the API error.
+func (e *StatusError) Unwrap() error {
+	if !e.Err.Valid() {
+		return nil
+	}
+	return e.Err
+}
+
+// Client is a NanoMDM HTTP API client.
+type Client struct {
+	baseURL   string
+	apiPrefix string
+	username  string
+	apiKey    string
+	doer      Doer
+}
+
+type Option func(*Client)
+
+// WithClient configures the HTTP client used to send requests.
+// The default is [http.DefaultClient].
+func WithClient(doer Doer) Option {
+	return func(c *Client) {
+		c.doer = doer
+	}
+}
+
+// WithUsername configures the HTTP basic authentication username.
+// The default is [DefaultUsername].
+func WithUsername(username string) Option {
+	return func(c *Client) {
+		c.username = username
+	}
+}
+
+// WithAPIPrefix configures the URL path prefix of the v1 API.
+// The default is [DefaultAPIPrefix].
+func WithAPIPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.apiPrefix = prefix
+	}
+}
+
+// New creates a new client for the NanoMDM server at baseURL
+// (e.g. "https://nanomdm.example.com") authenticating with apiKey.
+func New(baseURL, apiKey string, opts ...Option) (*Client, error) {
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	c := &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiPrefix: DefaultAPIPrefix,
+		username:  DefaultUsername,
+		apiKey:    apiKey,
+		doer:      http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// newRequest creates a new authenticated HTTP request for path.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.SetBasicAuth(c.username, c.apiKey)
+	}
+	if key, ok := ctx.Value(ctxKeyIdempotencyKey{}).(string); ok && key != "" {
+		req.Header.Set(httpapi.IdempotencyKeyHeader, key)
+	}
+	return req, nil
+}
+
+type ctxKeyIdempotencyKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx that sends key as the
+// idempotency key of enqueue requests made with it. Repeating an
+// enqueue request with the same key (e.g. retrying after a timeout)
+// returns the result of the original request without enqueueing again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKeyIdempotencyKey{}, key)
+}
+
+// do sends req and decodes a JSON response body into v (if not nil).
+// A [StatusError] is returned for non-200 HTTP responses.
+// For non-200 HTTP responses the body is still decoded into v if the
+// response is JSON and v is an API result such as an [api.APIResult].
+func (c *Client) do(req *http.Request, v interface{}) error {
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newStatusError(resp, body, v)
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding JSON: %w", err)
+	}
+	return nil
+}
+
+// resultError is an API result that distills its errors.
+// For example [api.APIResult].
+type resultError interface {
+	Error() error
+}
+
+// newStatusError creates a [StatusError] for the non-200 HTTP response
+// resp with body. The body is decoded into v if the response is JSON
+// and v is an API result such as an [api.APIResult].
+func newStatusError(resp *http.Response, body []byte, v interface{}) *StatusError {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+
+	statusErr := &StatusError{StatusCode: resp.StatusCode}
+	if r, ok := v.(resultError); ok && isJSON && json.Unmarshal(body, r) == nil {
+		if err := r.Error(); err != nil {
+			statusErr.Err = api.NewError(err)
+		}
+	} else if isJSON {
+		errResp := new(struct {
+			Error string `json:"error"`
+		})
+		if json.Unmarshal(body, errResp) == nil && errResp.Error != "" {
+			statusErr.Err = api.NewError(errors.New(errResp.Error))
+		}
+	} else if s := strings.TrimSpace(string(body)); s != "" {
+		statusErr.Err = api.NewError(errors.New(s))
+	}
+	return statusErr
+}
+
+// PushCertResponse is the APNs push certificate response.
+type PushCertResponse = httpapi.PushCertResponseJson
+
+// RetrievePushCert retrieves the topic and expiry of the stored APNs push certificate for topic.
+func (c *Client) RetrievePushCert(ctx context.Context, topic string) (*PushCertResponse, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointPushCert, url.Values{"topic": {topic}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(PushCertResponse)
+	return out, c.do(req, out)
+}
+
+// StorePushCert uploads the PEM-encoded APNs push certificate and private key.
+// If pemKey is empty then the server pairs the certificate with a
+// private key it holds from a previously generated CSR.
+func (c *Client) StorePushCert(ctx context.Context, pemCert, pemKey []byte) (*PushCertResponse, error) {
+	body := append(append(append([]byte{}, pemCert...), '\n'), pemKey...)
+	req, err := c.newRequest(ctx, http.MethodPut, c.apiPrefix+EndpointPushCert, nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	out := new(PushCertResponse)
+	return out, c.do(req, out)
+}
+
+// StorePushCertPKCS12 uploads the APNs push certificate and private key
+// in the PKCS#12 (.p12) file p12 protected by password.
+func (c *Client) StorePushCertPKCS12(ctx context.Context, p12 []byte, password string) (*PushCertResponse, error) {
+	req, err := c.newRequest(ctx, http.MethodPut, c.apiPrefix+EndpointPushCert, nil, bytes.NewReader(p12))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-pkcs12")
+	req.Header.Set(httpapi.PKCS12PasswordHeader, password)
+	out := new(PushCertResponse)
+	return out, c.do(req, out)
+}
+
+// PushCertCSRResponse is the APNs push certificate CSR response.
+type PushCertCSRResponse = httpapi.PushCertCSRResponseJson
+
+// GeneratePushCSR generates a new private key (held by the server) and
+// CSR for an APNs push certificate. The cn and email are optional.
+func (c *Client) GeneratePushCSR(ctx context.Context, cn, email string) (*PushCertCSRResponse, error) {
+	form := url.Values{}
+	if cn != "" {
+		form.Set("cn", cn)
+	}
+	if email != "" {
+		form.Set("email", email)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointPushCertCSR, nil, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	out := new(PushCertCSRResponse)
+	return out, c.do(req, out)
+}
+
+// SignPushCSR signs the PEM or DER-encoded csr with the server's MDM vendor certificate.
+func (c *Client) SignPushCSR(ctx context.Context, csr []byte) (*PushCertCSRResponse, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointPushCertSign, nil, bytes.NewReader(csr))
+	if err != nil {
+		return nil, err
+	}
+	out := new(PushCertCSRResponse)
+	return out, c.do(req, out)
+}
+
+// PushOption configures push and enqueue requests.
+type PushOption func(url.Values)
+
+// WithNoPush skips sending APNs pushes when enqueueing commands.
+func WithNoPush() PushOption {
+	return func(v url.Values) {
+		v.Set("nopush", "1")
+	}
+}
+
+// WithNoSign skips signing the profile of InstallProfile commands
+// when the server has a profile signer configured.
+func WithNoSign() PushOption {
+	return func(v url.Values) {
+		v.Set("nosign", "1")
+	}
+}
+
+// WithNoSync skips enqueueing DeclarativeManagement commands to the
+// affected enrollments when changing Declarative Management declarations,
+// sets, or assignments.
+func WithNoSync() PushOption {
+	return func(v url.Values) {
+		v.Set("nosync", "1")
+	}
+}
+
+// WithPace starts a paced push job for the pushes.
+// The job ID is returned in the PushJobID field of the API result.
+func WithPace(pace pacer.Pace) PushOption {
+	return func(v url.Values) {
+		if pace.Rate > 0 {
+			v.Set("pace_rate", strconv.Itoa(pace.Rate))
+		}
+		if pace.Duration > 0 {
+			v.Set("pace_duration", pace.Duration.String())
+		}
+	}
+}
+
+func idsPath(endpoint string, ids []string) (string, error) {
+	if len(ids) < 1 {
+		return "", errors.New("no ids")
+	}
+	escaped := make([]string, len(ids))
+	for i, id := range ids {
+		escaped[i] = url.PathEscape(id)
+	}
+	return endpoint + strings.Join(escaped, ","), nil
+}
+
+func pushQuery(opts []PushOption) url.Values {
+	v := url.Values{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Push sends APNs push notifications to enrollment ids.
+// The API result is returned even if an error is returned.
+func (c *Client) Push(ctx context.Context, ids []string, opts ...PushOption) (*api.APIResult, error) {
+	path, err := idsPath(c.apiPrefix+EndpointPush, ids)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, pushQuery(opts), nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(api.APIResult)
+	return out, c.do(req, out)
+}
+
+// Enqueue enqueues the raw MDM command plist rawCommand to enrollment
+// ids and (unless disabled) sends APNs push notifications.
+// The API result is returned even if an error is returned.
+func (c *Client) Enqueue(ctx context.Context, ids []string, rawCommand []byte, opts ...PushOption) (*api.APIResult, error) {
+	path, err := idsPath(c.apiPrefix+EndpointEnqueue, ids)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, pushQuery(opts), bytes.NewReader(rawCommand))
+	if err != nil {
+		return nil, err
+	}
+	out := new(api.APIResult)
+	return out, c.do(req, out)
+}
+
+// EnqueueEncryptedProfile enqueues the raw InstallProfile command
+// plist rawCommand to enrollment ids with its profile encrypted to the
+// identity certificate of each enrollment and (unless disabled) sends
+// APNs push notifications. Each enrollment gets its own command with a
+// unique CommandUUID. Pacing is not supported.
+// The batch result is returned even if an error is returned.
+func (c *Client) EnqueueEncryptedProfile(ctx context.Context, ids []string, rawCommand []byte, opts ...PushOption) (*api.BatchResult, error) {
+	path, err := idsPath(c.apiPrefix+EndpointEnqueue, ids)
+	if err != nil {
+		return nil, err
+	}
+	query := pushQuery(opts)
+	query.Set("encrypt", "1")
+	req, err := c.newRequest(ctx, http.MethodPut, path, query, bytes.NewReader(rawCommand))
+	if err != nil {
+		return nil, err
+	}
+	out := new(api.BatchResult)
+	return out, c.do(req, out)
+}
+
+// EnqueueJSON enqueues the JSON representation of an MDM command
+// dictionary jsonCommand to enrollment ids and (unless disabled) sends
+// APNs push notifications. The server converts the command to a plist
+// and generates its CommandUUID if omitted.
+// See mdm.CommandFromJSON for the JSON representation.
+// The API result is returned even if an error is returned.
+func (c *Client) EnqueueJSON(ctx context.Context, ids []string, jsonCommand []byte, opts ...PushOption) (*api.APIResult, error) {
+	path, err := idsPath(c.apiPrefix+EndpointEnqueue, ids)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, pushQuery(opts), bytes.NewReader(jsonCommand))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(api.APIResult)
+	return out, c.do(req, out)
+}
+
+// EnqueueBatch enqueues the MDM command of each of items to its
+// enrollment IDs and (unless disabled) sends APNs push notifications
+// to each affected enrollment once. Pacing is not supported.
+// The batch result is returned even if an error is returned.
+func (c *Client) EnqueueBatch(ctx context.Context, items []*storage.EnqueueItem, opts ...PushOption) (*api.BatchResult, error) {
+	batch := &httpapi.EnqueueBatchRequestJson{
+		Commands: make([]httpapi.EnqueueBatchCommandJson, len(items)),
+	}
+	for i, item := range items {
+		if item == nil || item.Command == nil {
+			return nil, fmt.Errorf("nil command at index %d", i)
+		}
+		batch.Commands[i] = httpapi.EnqueueBatchCommandJson{
+			Ids:        item.IDs,
+			RawCommand: base64.StdEncoding.EncodeToString(item.Command.Raw),
+		}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointEnqueueBatch, pushQuery(opts), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(api.BatchResult)
+	return out, c.do(req, out)
+}
+
+// WaitOption configures waiting for command results.
+type WaitOption func(url.Values)
+
+// WithWaitTimeout limits the time the server waits for command results.
+// The server default is used if not set.
+func WithWaitTimeout(timeout time.Duration) WaitOption {
+	return func(v url.Values) {
+		v.Set("timeout", timeout.String())
+	}
+}
+
+// EnqueueAndWait enqueues the raw MDM command plist rawCommand to
+// enrollment ids, sends APNs push notifications, and waits for the
+// enrollments to report the command results. Enrollment IDs that did
+// not report a final result before the timeout are listed in the
+// Pending field of the wait result. Note the HTTP request lasts as
+// long as the wait so ctx and any HTTP client timeouts should allow
+// for it. The wait result is returned even if an error is returned.
+func (c *Client) EnqueueAndWait(ctx context.Context, ids []string, rawCommand []byte, opts ...WaitOption) (*api.WaitResult, error) {
+	path, err := idsPath(c.apiPrefix+EndpointEnqueueWait, ids)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, query, bytes.NewReader(rawCommand))
+	if err != nil {
+		return nil, err
+	}
+	out := new(api.WaitResult)
+	return out, c.do(req, out)
+}
+
+// PushJob retrieves the status of the paced push job id.
+func (c *Client) PushJob(ctx context.Context, id string) (*pacer.Job, error) {
+	if id == "" {
+		return nil, errors.New("empty push job id")
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointPushJobs+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(pacer.Job)
+	return out, c.do(req, out)
+}
+
+// APICredential is an API credential.
+// The secret is only present when a credential is created or rotated.
+type APICredential = httpapi.APICredentialJson
+
+// CreateAPICredential creates a new API credential named name with
+// scopes and optionally restricted to enrollmentIDs.
+// See package apiauth for the scopes.
+func (c *Client) CreateAPICredential(ctx context.Context, name string, scopes, enrollmentIDs []string) (*APICredential, error) {
+	body, err := json.Marshal(&httpapi.APICredentialRequestJson{
+		Name:          name,
+		Scopes:        scopes,
+		EnrollmentIds: enrollmentIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointAPICredentials, nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(APICredential)
+	return out, c.do(req, out)
+}
+
+// ListAPICredentials lists all API credentials.
+func (c *Client) ListAPICredentials(ctx context.Context) ([]*APICredential, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointAPICredentials, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []*APICredential
+	err = c.do(req, &out)
+	return out, err
+}
+
+// apiCredentialPath returns the URL path of the API credential named name.
+func (c *Client) apiCredentialPath(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty credential name")
+	}
+	return c.apiPrefix + EndpointAPICredentials + url.PathEscape(name), nil
+}
+
+// RetrieveAPICredential retrieves the API credential named name.
+func (c *Client) RetrieveAPICredential(ctx context.Context, name string) (*APICredential, error) {
+	path, err := c.apiCredentialPath(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(APICredential)
+	return out, c.do(req, out)
+}
+
+// RotateAPICredential replaces the secret of the API credential named name.
+// The returned credential contains the new secret.
+func (c *Client) RotateAPICredential(ctx context.Context, name string) (*APICredential, error) {
+	path, err := c.apiCredentialPath(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, path+"/rotate", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(APICredential)
+	return out, c.do(req, out)
+}
+
+// RevokeAPICredential deletes the API credential named name.
+func (c *Client) RevokeAPICredential(ctx context.Context, name string) error {
+	path, err := c.apiCredentialPath(name)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// CommandTemplate is a named MDM command template.
+type CommandTemplate = httpapi.CommandTemplateJson
+
+// TemplateEnqueueRequest is a request to enqueue commands rendered
+// from a command template.
+type TemplateEnqueueRequest = httpapi.TemplateEnqueueRequestJson
+
+// templatePath returns the URL path of the command template named name.
+func (c *Client) templatePath(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty template name")
+	}
+	return c.apiPrefix + EndpointTemplates + url.PathEscape(name), nil
+}
+
+// StoreCommandTemplate stores the command plist template body as name.
+// The body may contain {{name}} variable placeholders.
+func (c *Client) StoreCommandTemplate(ctx context.Context, name string, body []byte) (*CommandTemplate, error) {
+	path, err := c.templatePath(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	out := new(CommandTemplate)
+	return out, c.do(req, out)
+}
+
+// ListCommandTemplates lists all command templates.
+func (c *Client) ListCommandTemplates(ctx context.Context) ([]*CommandTemplate, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointTemplates, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []*CommandTemplate
+	err = c.do(req, &out)
+	return out, err
+}
+
+// RetrieveCommandTemplate retrieves the command template named name.
+func (c *Client) RetrieveCommandTemplate(ctx context.Context, name string) (*CommandTemplate, error) {
+	path, err := c.templatePath(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(CommandTemplate)
+	return out, c.do(req, out)
+}
+
+// DeleteCommandTemplate deletes the command template named name.
+func (c *Client) DeleteCommandTemplate(ctx context.Context, name string) error {
+	path, err := c.templatePath(name)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// EnqueueTemplate renders the command template named name for each
+// enrollment ID of treq, enqueues the rendered commands, and (unless
+// disabled) sends APNs push notifications. Pacing is not supported.
+// The batch result has a result per enrollment ID in order.
+// The batch result is returned even if an error is returned.
+func (c *Client) EnqueueTemplate(ctx context.Context, name string, treq *TemplateEnqueueRequest, opts ...PushOption) (*api.BatchResult, error) {
+	path, err := c.templatePath(name)
+	if err != nil {
+		return nil, err
+	}
+	if treq == nil {
+		return nil, errors.New("nil template enqueue request")
+	}
+	body, err := json.Marshal(treq)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, path+"/enqueue", pushQuery(opts), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(api.BatchResult)
+	return out, c.do(req, out)
+}
+
+// Declaration is a Declarative Management declaration.
+type Declaration = httpapi.DDMDeclarationJson
+
+// DeclarationSet is a named set of Declarative Management declarations.
+type DeclarationSet = httpapi.DDMDeclarationSetJson
+
+// EnrollmentDeclarationSets are the declaration sets assigned to an enrollment.
+type EnrollmentDeclarationSets = httpapi.DDMEnrollmentSetsJson
+
+// DeclarationStatus is the Declarative Management status of an enrollment.
+type DeclarationStatus = ddm.Status
+
+// ddmPath returns the URL path of the Declarative Management resource
+// name of endpoint (e.g. [EndpointDDMDeclarations]).
+func (c *Client) ddmPath(endpoint, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	return c.apiPrefix + endpoint + "/" + url.PathEscape(name), nil
+}
+
+// StoreDeclaration stores the JSON Declarative Management declaration.
+// Enrollments assigned the declaration are told to synchronize their
+// declarations unless disabled with [WithNoSync].
+func (c *Client) StoreDeclaration(ctx context.Context, declaration []byte, opts ...PushOption) (*Declaration, error) {
+	decl := new(struct{ Identifier string })
+	if err := json.Unmarshal(declaration, decl); err != nil {
+		return nil, fmt.Errorf("decoding declaration: %w", err)
+	}
+	path, err := c.ddmPath(EndpointDDMDeclarations, decl.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, pushQuery(opts), bytes.NewReader(declaration))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(Declaration)
+	return out, c.do(req, out)
+}
+
+// ListDeclarations lists all Declarative Management declarations.
+func (c *Client) ListDeclarations(ctx context.Context) ([]*Declaration, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointDDMDeclarations, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Declaration
+	err = c.do(req, &out)
+	return out, err
+}
+
+// RetrieveDeclaration retrieves the JSON declaration identifier
+// including its ServerToken.
+func (c *Client) RetrieveDeclaration(ctx context.Context, identifier string) ([]byte, error) {
+	path, err := c.ddmPath(EndpointDDMDeclarations, identifier)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out json.RawMessage
+	err = c.do(req, &out)
+	return out, err
+}
+
+// DeleteDeclaration deletes the declaration identifier.
+// Declarations in a set cannot be deleted.
+func (c *Client) DeleteDeclaration(ctx context.Context, identifier string) error {
+	path, err := c.ddmPath(EndpointDDMDeclarations, identifier)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// StoreDeclarationSet replaces the declaration identifiers of the set
+// named name. Enrollments assigned the set are told to synchronize
+// their declarations unless disabled with [WithNoSync].
+func (c *Client) StoreDeclarationSet(ctx context.Context, name string, identifiers []string, opts ...PushOption) (*DeclarationSet, error) {
+	path, err := c.ddmPath(EndpointDDMSets, name)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(identifiers)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, pushQuery(opts), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(DeclarationSet)
+	return out, c.do(req, out)
+}
+
+// ListDeclarationSets lists the names of all declaration sets.
+func (c *Client) ListDeclarationSets(ctx context.Context) ([]string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointDDMSets, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	err = c.do(req, &out)
+	return out, err
+}
+
+// RetrieveDeclarationSet retrieves the declaration set named name.
+func (c *Client) RetrieveDeclarationSet(ctx context.Context, name string) (*DeclarationSet, error) {
+	path, err := c.ddmPath(EndpointDDMSets, name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(DeclarationSet)
+	return out, c.do(req, out)
+}
+
+// DeleteDeclarationSet deletes the declaration set named name.
+// Sets assigned to enrollments cannot be deleted.
+func (c *Client) DeleteDeclarationSet(ctx context.Context, name string) error {
+	path, err := c.ddmPath(EndpointDDMSets, name)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// StoreEnrollmentDeclarationSets replaces the declaration sets
+// assigned to enrollment id. The enrollment is told to synchronize its
+// declarations unless disabled with [WithNoSync].
+func (c *Client) StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string, opts ...PushOption) (*EnrollmentDeclarationSets, error) {
+	path, err := c.ddmPath(EndpointDDMEnrollments, id)
+	if err != nil {
+		return nil, err
+	}
+	if sets == nil {
+		sets = []string{}
+	}
+	body, err := json.Marshal(sets)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, path, pushQuery(opts), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	out := new(EnrollmentDeclarationSets)
+	return out, c.do(req, out)
+}
+
+// RetrieveEnrollmentDeclarationSets retrieves the declaration sets
+// assigned to enrollment id.
+func (c *Client) RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) (*EnrollmentDeclarationSets, error) {
+	path, err := c.ddmPath(EndpointDDMEnrollments, id)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(EnrollmentDeclarationSets)
+	return out, c.do(req, out)
+}
+
+// RetrieveDeclarationStatus retrieves the Declarative Management
+// status of enrollment id as recorded from its status reports.
+func (c *Client) RetrieveDeclarationStatus(ctx context.Context, id string) (*DeclarationStatus, error) {
+	path, err := c.ddmPath(EndpointDDMStatus, id)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(DeclarationStatus)
+	return out, c.do(req, out)
+}
+
+// AuditEntries queries the audit log, newest first.
+// Empty fields of q match all entries. A zero limit uses the server default.
+func (c *Client) AuditEntries(ctx context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	query := url.Values{}
+	if q != nil {
+		for k, v := range map[string]string{
+			"actor":         q.Actor,
+			"action":        q.Action,
+			"enrollment_id": q.EnrollmentID,
+			"command_uuid":  q.CommandUUID,
+		} {
+			if v != "" {
+				query.Set(k, v)
+			}
+		}
+		if !q.Since.IsZero() {
+			query.Set("since", q.Since.Format(time.RFC3339))
+		}
+		if !q.Until.IsZero() {
+			query.Set("until", q.Until.Format(time.RFC3339))
+		}
+		if q.Limit > 0 {
+			query.Set("limit", strconv.Itoa(q.Limit))
+		}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointAudit, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []*storage.AuditEntry
+	err = c.do(req, &out)
+	return out, err
+}
+
+// EventsQuery filters the MDM event stream.
+type EventsQuery struct {
+	// Topics selects only events with these topics (e.g. "mdm.Connect").
+	Topics []string
+
+	// EnrollmentIDs selects only events for these enrollment IDs.
+	EnrollmentIDs []string
+
+	// LastEventID resumes the stream after this event ID if the
+	// server still holds the events after it.
+	LastEventID string
+}
+
+// Event is an MDM event from the event stream.
+type Event struct {
+	// ID is the event ID in the stream. Use it to resume the stream.
+	ID string
+
+	// Event is the webhook event.
+	Event *webhook.EventJson
+}
+
+// StreamEvents streams MDM events matching q calling fn for each event.
+// It returns when ctx is done, the stream ends, or fn returns an error.
+// That error is returned as-is.
+func (c *Client) StreamEvents(ctx context.Context, q *EventsQuery, fn func(*Event) error) error {
+	query := url.Values{}
+	if q != nil {
+		if len(q.Topics) > 0 {
+			query.Set("topic", strings.Join(q.Topics, ","))
+		}
+		if len(q.EnrollmentIDs) > 0 {
+			query.Set("id", strings.Join(q.EnrollmentIDs, ","))
+		}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiPrefix+EndpointEvents, query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if q != nil && q.LastEventID != "" {
+		req.Header.Set("Last-Event-ID", q.LastEventID)
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("reading body: %w", err)
+		}
+		return newStatusError(resp, body, nil)
+	}
+
+	// parse the Server-Sent Events stream. only the fields the server
+	// sends are handled and comments (keep-alives) are ignored.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var id string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data == nil {
+				continue
+			}
+			ev := &Event{ID: id, Event: new(webhook.EventJson)}
+			if err = json.Unmarshal(data, ev.Event); err != nil {
+				return fmt.Errorf("decoding event %s: %w", id, err)
+			}
+			if err = fn(ev); err != nil {
+				return err
+			}
+			id, data = "", nil
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: ")...)
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// EscrowKeyUnlock performs an Escrow Key Unlock (Activation Lock
+// bypass) using the APNs push certificate of topic.
+// A [StatusError] is returned if Apple responds with an unsuccessful status.
+func (c *Client) EscrowKeyUnlock(ctx context.Context, topic string, params *escrowkeyunlock.EscrowKeyUnlockParams) error {
+	if !params.Valid() {
+		return errors.New("invalid or missing parameters")
+	}
+	form := url.Values{"topic": {topic}}
+	for k, v := range params.QueryParams() {
+		form[k] = v
+	}
+	for k, v := range params.FormParams() {
+		form[k] = v
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointEscrowKeyUnlock, nil, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, nil)
+}
+
+// SignProfile signs the configuration profile and returns the signed profile.
+func (c *Client) SignProfile(ctx context.Context, profile []byte) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointProfileSign, nil, bytes.NewReader(profile))
+	if err != nil {
+		return nil, err
+	}
+	return c.doBytes(req)
+}
+
+// doBytes sends req and returns the raw response body.
+// A [StatusError] is returned for non-200 HTTP responses.
+func (c *Client) doBytes(req *http.Request) ([]byte, error) {
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, body, nil)
+	}
+	return body, nil
+}
+
+// EnrollmentToken is a one-time enrollment token.
+type EnrollmentToken = httpapi.EnrollmentTokenJson
+
+// CreateEnrollmentToken creates a new one-time enrollment token for
+// retrieving the enrollment profile. The optional label describes who
+// or what the token is for. A zero ttl uses the server default.
+func (c *Client) CreateEnrollmentToken(ctx context.Context, label string, ttl time.Duration) (*EnrollmentToken, error) {
+	query := url.Values{}
+	if label != "" {
+		query.Set("label", label)
+	}
+	if ttl > 0 {
+		query.Set("ttl", ttl.String())
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiPrefix+EndpointEnrollTokens, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := new(EnrollmentToken)
+	return out, c.do(req, out)
+}
+
+// EnrollmentProfile retrieves the (possibly signed) enrollment profile.
+// The token is only required if the server requires enrollment tokens.
+func (c *Client) EnrollmentProfile(ctx context.Context, token string) ([]byte, error) {
+	var query url.Values
+	if token != "" {
+		query = url.Values{"token": {token}}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, EndpointEnroll, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.doBytes(req)
+}
+
+// Migrate sends the raw MDM check-in plist checkin (e.g. an
+// Authenticate or TokenUpdate message) to the migration endpoint.
+func (c *Client) Migrate(ctx context.Context, checkin []byte) error {
+	req, err := c.newRequest(ctx, http.MethodPut, EndpointMigration, nil, bytes.NewReader(checkin))
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Version returns the version of the NanoMDM server.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, EndpointVersion, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	out := new(struct {
+		Version string `json:"version"`
+	})
+	err = c.do(req, out)
+	return out.Version, err
+}
@@ -0,0 +1,1214 @@
+package client_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/api/client"
+	"github.com/micromdm/nanomdm/api/client/clienttest"
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/enrollprofile"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/http/escrowkeyunlock"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/profilesign"
+	"github.com/micromdm/nanomdm/push/pacer"
+	"github.com/micromdm/nanomdm/service/ddm"
+	"github.com/micromdm/nanomdm/service/webhook"
+	"github.com/micromdm/nanomdm/storage"
+	"github.com/micromdm/nanomdm/test"
+
+	"github.com/micromdm/plist"
+	"github.com/smallstep/pkcs7"
+)
+
+const (
+	apiKey = "secret"
+	// from mdm/testdata/Authenticate.2.plist
+	enrollmentID = "66ADE930-5FDF-5EC4-8429-15640684C489"
+)
+
+const profileList = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Command</key>
+	<dict>
+		<key>RequestType</key>
+		<string>ProfileList</string>
+	</dict>
+	<key>CommandUUID</key>
+	<string>fedd659e-fc3c-4e35-8bb1-c8f51ae542a5</string>
+</dict>
+</plist>
+`
+
+func newPushCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	pemCert, err := os.ReadFile("../../test/e2e/testdata/push.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := cryptoutil.DecodePEMCertificate(pemCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.PublicKey = nil
+	key, cert, err := test.SelfSignedCertRSAResigner(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cryptoutil.PEMCertificate(cert.Raw), pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
+
+func TestClient(t *testing.T) {
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+	ctx := context.Background()
+
+	version, err := c.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := version, clienttest.Version; have != want {
+		t.Errorf("version: have %q, want %q", have, want)
+	}
+
+	// push certs
+	pemCert, pemKey := newPushCert(t)
+	pcResp, err := c.StorePushCert(ctx, pemCert, pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcResp2, err := c.RetrievePushCert(ctx, pcResp.Topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := pcResp2.Topic, pcResp.Topic; have != want {
+		t.Errorf("topic: have %q, want %q", have, want)
+	}
+
+	_, err = c.StorePushCert(ctx, pemCert, nil)
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected status error, have: %v", err)
+	} else if have, want := statusErr.StatusCode, http.StatusBadRequest; have != want {
+		t.Errorf("status: have %d, want %d", have, want)
+	} else if statusErr.Err == nil {
+		t.Error("expected API error")
+	}
+
+	csrResp, err := c.GeneratePushCSR(ctx, "Example", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(csrResp.Csr, "CERTIFICATE REQUEST") || csrResp.PublicKeyHash == "" {
+		t.Errorf("invalid CSR response: %v", csrResp)
+	}
+
+	// migration
+	authenticate, err := os.ReadFile("../../mdm/testdata/Authenticate.2.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Migrate(ctx, authenticate); err != nil {
+		t.Fatal(err)
+	}
+
+	// enqueue and push
+	result, err := c.Enqueue(ctx, []string{enrollmentID}, []byte(profileList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := result.CommandUUID, "fedd659e-fc3c-4e35-8bb1-c8f51ae542a5"; have != want {
+		t.Errorf("command uuid: have %q, want %q", have, want)
+	}
+	if have, want := result.Status[enrollmentID].PushID, "clienttest-"+enrollmentID; have != want {
+		t.Errorf("push id: have %q, want %q", have, want)
+	}
+
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: enrollmentID}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != result.CommandUUID {
+		t.Errorf("expected enqueued command: %v", cmd)
+	}
+
+	profileList2 := strings.Replace(profileList, "fedd659e", "aedd659e", 1)
+	result, err = c.Enqueue(ctx, []string{enrollmentID}, []byte(profileList2), client.WithNoPush())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.NoPush {
+		t.Error("expected no push")
+	}
+
+	// JSON commands get a generated CommandUUID
+	result, err = c.EnqueueJSON(ctx, []string{enrollmentID}, []byte(`{"Command":{"RequestType":"ProfileList"}}`), client.WithNoPush())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CommandUUID == "" {
+		t.Error("expected generated command uuid")
+	}
+	if _, err = c.EnqueueJSON(ctx, []string{enrollmentID}, []byte(`{"Command":{}}`)); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error, have: %v", err)
+	}
+
+	srv.Reset()
+	result, err = c.Push(ctx, []string{enrollmentID, "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(result.Status), 2; have != want {
+		t.Errorf("push status: have %d, want %d", have, want)
+	}
+	if have, want := len(srv.Pushes()), 1; have != want {
+		t.Errorf("pushes: have %d, want %d", have, want)
+	}
+
+	// paced push jobs
+	result, err = c.Push(ctx, []string{enrollmentID}, client.WithPace(pacer.Pace{Rate: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PushJobID == "" {
+		t.Fatal("expected push job id")
+	}
+	var job *pacer.Job
+	for i := 0; i < 100; i++ {
+		if job, err = c.PushJob(ctx, result.PushJobID); err != nil {
+			t.Fatal(err)
+		} else if job.Finished != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if have, want := job.Pushed, 1; have != want {
+		t.Errorf("job pushed: have %d, want %d", have, want)
+	}
+	if _, err = c.PushJob(ctx, "missing"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found status error, have: %v", err)
+	}
+
+	// escrow key unlock
+	err = c.EscrowKeyUnlock(ctx, pcResp.Topic, &escrowkeyunlock.EscrowKeyUnlockParams{
+		Serial:      "C8TJ500QF1MN",
+		ProductType: "iPad4,1",
+		EscrowKey:   "3UM43-PUYVY-QYD1-UVCC-HEHJ-FKA4",
+		OrgName:     "Acme Inc",
+		GUID:        "123456",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlocks := srv.EscrowKeyUnlocks(); len(unlocks) != 1 || unlocks[0].Get("topic") != pcResp.Topic {
+		t.Errorf("expected escrow key unlock: %v", unlocks)
+	}
+
+	// audit log
+	entries, err := c.AuditEntries(ctx, &storage.AuditQuery{Action: "enqueue", EnrollmentID: enrollmentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 enqueue audit entries, have: %d", len(entries))
+	}
+	if have, want := entries[0].Outcome, storage.AuditOutcomeFailure; have != want {
+		t.Errorf("invalid json command audit outcome: have: %v, want: %v", have, want)
+	}
+	if have, want := entries[1].RequestType, "ProfileList"; have != want {
+		t.Errorf("audit request type: have: %v, want: %v", have, want)
+	}
+	if have, want := entries[1].Actor, client.DefaultUsername; have != want {
+		t.Errorf("audit actor: have: %v, want: %v", have, want)
+	}
+	if have, want := entries[1].Outcome, storage.AuditOutcomeSuccess; have != want {
+		t.Errorf("audit outcome: have: %v, want: %v", have, want)
+	}
+	entries, err = c.AuditEntries(ctx, &storage.AuditQuery{Action: "escrowkeyunlock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Topic != pcResp.Topic {
+		t.Errorf("expected escrow key unlock audit entry: %v", entries)
+	}
+
+	// bad API key
+	c2, err := client.New(srv.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c2.Push(ctx, []string{enrollmentID}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized status error, have: %v", err)
+	}
+}
+
+func TestAPICredentials(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer("apikey")
+	defer srv.Close()
+	admin := srv.Client()
+
+	const enrollmentID = "AAAA-1111"
+	cred, err := admin.CreateAPICredential(ctx, "helpdesk", []string{apiauth.ScopePush, apiauth.EnqueueScope("ProfileList")}, []string{enrollmentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Secret == "" {
+		t.Fatal("empty secret")
+	}
+
+	var statusErr *client.StatusError
+	if _, err = admin.CreateAPICredential(ctx, "helpdesk", []string{apiauth.ScopePush}, nil); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict status error, have: %v", err)
+	}
+	if _, err = admin.CreateAPICredential(ctx, "bad", []string{"bogus"}, nil); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error, have: %v", err)
+	}
+
+	creds, err := admin.ListAPICredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 || creds[0].Name != "helpdesk" || creds[0].Secret != "" {
+		t.Errorf("unexpected credential list: %v", creds)
+	}
+
+	newHelpdesk := func(secret string) *client.Client {
+		c, err := client.New(srv.URL, secret, client.WithUsername("helpdesk"), client.WithClient(srv.Server.Client()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	helpdesk := newHelpdesk(cred.Secret)
+
+	if _, err = helpdesk.Push(ctx, []string{enrollmentID}); err != nil {
+		t.Error(err)
+	}
+	if _, err = helpdesk.Push(ctx, []string{enrollmentID, "BBBB-2222"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for enrollment id, have: %v", err)
+	}
+	result, err := helpdesk.Push(ctx, []string{enrollmentID}, client.WithPace(pacer.Pace{Rate: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpdesk.PushJob(ctx, result.PushJobID); err != nil {
+		t.Error(err)
+	}
+	result, err = admin.Push(ctx, []string{"BBBB-2222"}, client.WithPace(pacer.Pace{Rate: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpdesk.PushJob(ctx, result.PushJobID); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for push job, have: %v", err)
+	}
+	if _, err = helpdesk.Enqueue(ctx, []string{enrollmentID}, []byte(profileList), client.WithNoPush()); err != nil {
+		t.Error(err)
+	}
+	eraseDevice := strings.Replace(profileList, "ProfileList", "EraseDevice", 1)
+	if _, err = helpdesk.Enqueue(ctx, []string{enrollmentID}, []byte(eraseDevice), client.WithNoPush()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for request type, have: %v", err)
+	}
+	if _, err = helpdesk.RetrievePushCert(ctx, "com.apple.mgmt.External.test"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for push cert, have: %v", err)
+	}
+	if _, err = helpdesk.ListAPICredentials(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for admin, have: %v", err)
+	}
+
+	rotated, err := admin.RotateAPICredential(ctx, "helpdesk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Secret == "" || rotated.Secret == cred.Secret {
+		t.Fatal("secret not rotated")
+	}
+	if _, err = helpdesk.Push(ctx, []string{enrollmentID}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized status error after rotation, have: %v", err)
+	}
+	helpdesk = newHelpdesk(rotated.Secret)
+	if _, err = helpdesk.Push(ctx, []string{enrollmentID}); err != nil {
+		t.Error(err)
+	}
+
+	if err = admin.RevokeAPICredential(ctx, "helpdesk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpdesk.Push(ctx, []string{enrollmentID}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized status error after revocation, have: %v", err)
+	}
+	if _, err = admin.RetrieveAPICredential(ctx, "helpdesk"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found status error, have: %v", err)
+	}
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	lock, err := commands.New(commands.DeviceLock{PIN: "123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := commands.New(commands.ProfileList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.EnqueueBatch(ctx, []*storage.EnqueueItem{
+		{IDs: []string{"AAAA-1111"}, Command: lock},
+		{IDs: []string{"AAAA-1111", "BBBB-2222"}, Command: list},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(result.Results), 2; have != want {
+		t.Fatalf("results: have: %v, want: %v", have, want)
+	}
+	if have, want := result.Results[0].CommandUUID, lock.CommandUUID; have != want {
+		t.Errorf("command uuid: have: %v, want: %v", have, want)
+	}
+	if have, want := result.Results[1].RequestType, "ProfileList"; have != want {
+		t.Errorf("request type: have: %v, want: %v", have, want)
+	}
+	if have, want := result.Results[1].Status["BBBB-2222"].PushID, "clienttest-BBBB-2222"; have != want {
+		t.Errorf("push id: have: %v, want: %v", have, want)
+	}
+
+	// each enrollment is pushed to only once
+	pushes := srv.Pushes()
+	if len(pushes) != 1 || len(pushes[0]) != 2 {
+		t.Errorf("expected one push to two ids, have: %v", pushes)
+	}
+
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: "BBBB-2222"}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != list.CommandUUID {
+		t.Errorf("expected enqueued command: %v", cmd)
+	}
+
+	var statusErr *client.StatusError
+	if _, err = c.EnqueueBatch(ctx, []*storage.EnqueueItem{{Command: lock}}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for no ids, have: %v", err)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	ctx := client.WithIdempotencyKey(context.Background(), "idem-key-1")
+	jsonCmd := []byte(`{"Command":{"RequestType":"ProfileList"}}`)
+
+	r1, err := c.EnqueueJSON(ctx, []string{"AAAA-1111"}, jsonCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.CommandUUID == "" {
+		t.Fatal("empty command uuid")
+	}
+
+	// a retry returns the original result (and generated command UUID)
+	r2, err := c.EnqueueJSON(ctx, []string{"AAAA-1111"}, jsonCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := r2.CommandUUID, r1.CommandUUID; have != want {
+		t.Errorf("command uuid: have: %v, want: %v", have, want)
+	}
+	if have, want := len(srv.Pushes()), 1; have != want {
+		t.Errorf("pushes: have: %v, want: %v", have, want)
+	}
+
+	// only one command was enqueued
+	r := mdm.NewRequestWithContext(context.Background(), nil)
+	r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111"}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != r1.CommandUUID {
+		t.Fatalf("expected enqueued command: %v", cmd)
+	}
+	if err = srv.Store.StoreCommandReport(r, &mdm.CommandResults{CommandUUID: cmd.CommandUUID, Status: "Acknowledged"}); err != nil {
+		t.Fatal(err)
+	}
+	if cmd, err = srv.Store.RetrieveNextCommand(r, false); err != nil {
+		t.Fatal(err)
+	} else if cmd != nil {
+		t.Errorf("expected no further commands, have: %v", cmd.CommandUUID)
+	}
+
+	// re-using the key for a different request is rejected
+	var statusErr *client.StatusError
+	_, err = c.EnqueueJSON(ctx, []string{"BBBB-2222"}, jsonCmd)
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected unprocessable entity status error, have: %v", err)
+	}
+
+	// without a key the command is enqueued again
+	r3, err := c.EnqueueJSON(context.Background(), []string{"AAAA-1111"}, jsonCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3.CommandUUID == r1.CommandUUID {
+		t.Error("expected new command uuid without idempotency key")
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// keep sending events until the stream is subscribed and receives one
+	sendCtx, stopSending := context.WithCancel(ctx)
+	defer stopSending()
+	go func() {
+		for sendCtx.Err() == nil {
+			for _, id := range []string{"AAAA-1111", "BBBB-2222"} {
+				srv.Events.SendEvent(sendCtx, &webhook.EventJson{
+					Topic:        webhook.EventJsonTopicMdmConnect,
+					CreatedAt:    time.Now(),
+					CheckinEvent: &webhook.CheckinEvent{Ids: &webhook.IDs{Id: id, Type: "Device"}},
+				})
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	errStop := errors.New("stop")
+	var first *client.Event
+	err := c.StreamEvents(ctx, &client.EventsQuery{EnrollmentIDs: []string{"BBBB-2222"}}, func(ev *client.Event) error {
+		first = ev
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatal(err)
+	}
+	stopSending()
+	if first.ID == "" {
+		t.Error("empty event id")
+	}
+	if have, want := first.Event.CheckinEvent.Ids.Id, "BBBB-2222"; have != want {
+		t.Errorf("enrollment id: have: %v, want: %v", have, want)
+	}
+
+	// resume from the first event: the buffered events after it are streamed
+	srv.Events.SendEvent(ctx, &webhook.EventJson{
+		Topic:        webhook.EventJsonTopicMdmConnect,
+		CreatedAt:    time.Now(),
+		CheckinEvent: &webhook.CheckinEvent{Ids: &webhook.IDs{Id: "BBBB-2222", Type: "Device"}},
+	})
+	var next *client.Event
+	err = c.StreamEvents(ctx, &client.EventsQuery{EnrollmentIDs: []string{"BBBB-2222"}, LastEventID: first.ID}, func(ev *client.Event) error {
+		next = ev
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatal(err)
+	}
+	if next.ID == first.ID {
+		t.Error("expected event after the last event id")
+	}
+	if have, want := next.Event.CheckinEvent.Ids.Id, "BBBB-2222"; have != want {
+		t.Errorf("enrollment id: have: %v, want: %v", have, want)
+	}
+
+	// credentials restricted to other enrollment IDs are forbidden
+	cred, err := c.CreateAPICredential(ctx, "events-restricted", []string{apiauth.ScopeEvents}, []string{"AAAA-1111"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := client.New(srv.URL, cred.Secret, client.WithUsername(cred.Name), client.WithClient(srv.Server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *client.StatusError
+	err = rc.StreamEvents(ctx, &client.EventsQuery{EnrollmentIDs: []string{"BBBB-2222"}}, func(*client.Event) error { return errStop })
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error, have: %v", err)
+	}
+}
+
+func TestEnqueueAndWait(t *testing.T) {
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	const report = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CommandUUID</key>
+	<string>fedd659e-fc3c-4e35-8bb1-c8f51ae542a5</string>
+	<key>ProfileList</key>
+	<array/>
+	<key>Status</key>
+	<string>Acknowledged</string>
+	<key>UDID</key>
+	<string>AAAA-1111</string>
+</dict>
+</plist>
+`
+
+	// simulate the AAAA-1111 device responding to the command.
+	// BBBB-2222 never responds.
+	errCh := make(chan error, 1)
+	go func() {
+		r := mdm.NewRequestWithContext(context.Background(), nil)
+		r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111"}
+		for {
+			cmd, err := srv.Store.RetrieveNextCommand(r, false)
+			if err != nil {
+				errCh <- err
+				return
+			} else if cmd == nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			results, err := mdm.DecodeCommandResults([]byte(report))
+			if err != nil {
+				errCh <- err
+				return
+			}
+			errCh <- srv.Store.StoreCommandReport(r, results)
+			return
+		}
+	}()
+
+	wr, err := c.EnqueueAndWait(context.Background(), []string{"AAAA-1111", "BBBB-2222"}, []byte(profileList), client.WithWaitTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := wr.CommandUUID, "fedd659e-fc3c-4e35-8bb1-c8f51ae542a5"; have != want {
+		t.Errorf("command uuid: have: %v, want: %v", have, want)
+	}
+	if have, want := strings.Join(wr.Pending, ","), "BBBB-2222"; have != want {
+		t.Errorf("pending: have: %v, want: %v", have, want)
+	}
+	result := wr.Results["AAAA-1111"]
+	if result == nil {
+		t.Fatal("no result for AAAA-1111")
+	}
+	if have, want := result.Status, "Acknowledged"; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+	if have, want := string(result.Raw), report; have != want {
+		t.Errorf("raw: have: %v, want: %v", have, want)
+	}
+	decoded, ok := result.Decoded.(map[string]interface{})
+	if !ok {
+		t.Fatalf("decoded: unexpected type: %T", result.Decoded)
+	}
+	if _, ok := decoded["ProfileList"]; !ok {
+		t.Errorf("decoded: missing ProfileList: %v", decoded)
+	}
+
+	// invalid timeouts are rejected
+	var statusErr *client.StatusError
+	_, err = c.EnqueueAndWait(context.Background(), []string{"AAAA-1111"}, []byte(profileList), client.WithWaitTimeout(time.Hour))
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error, have: %v", err)
+	}
+}
+
+func TestCommandTemplates(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	// enroll a device for its enrollment attributes
+	for _, name := range []string{"Authenticate.2.plist", "TokenUpdate.2.plist"} {
+		checkin, err := os.ReadFile("../../mdm/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Migrate(ctx, checkin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const settings = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Command</key>
+	<dict>
+		<key>RequestType</key>
+		<string>Settings</string>
+		<key>Settings</key>
+		<array>
+			<dict>
+				<key>Item</key>
+				<string>DeviceName</string>
+				<key>DeviceName</key>
+				<string>{{prefix}}-{{serial_number}}</string>
+			</dict>
+		</array>
+	</dict>
+</dict>
+</plist>
+`
+
+	tmpl, err := c.StoreCommandTemplate(ctx, "name-device", []byte(settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := strings.Join(tmpl.Placeholders, ","), "prefix,serial_number"; have != want {
+		t.Errorf("placeholders: have: %v, want: %v", have, want)
+	}
+
+	tmpls, err := c.ListCommandTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpls) != 1 || tmpls[0].Name != "name-device" || tmpls[0].Body != settings {
+		t.Errorf("unexpected templates: %v", tmpls)
+	}
+
+	var statusErr *client.StatusError
+	if _, err = c.StoreCommandTemplate(ctx, "invalid", []byte("<plist")); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for invalid template, have: %v", err)
+	}
+
+	// missing variable
+	_, err = c.EnqueueTemplate(ctx, "name-device", &client.TemplateEnqueueRequest{Ids: []string{enrollmentID}})
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for missing variable, have: %v", err)
+	}
+
+	result, err := c.EnqueueTemplate(ctx, "name-device", &client.TemplateEnqueueRequest{
+		Ids:  []string{enrollmentID},
+		Vars: map[string]string{"prefix": "lab"},
+	}, client.WithNoPush())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(result.Results), 1; have != want {
+		t.Fatalf("results: have: %v, want: %v", have, want)
+	}
+
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: enrollmentID}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != result.Results[0].CommandUUID {
+		t.Fatalf("expected enqueued command: %v", cmd)
+	}
+	if !strings.Contains(string(cmd.Raw), "<string>lab-C02MT66KFLHH</string>") {
+		t.Errorf("rendered command missing device name: %s", cmd.Raw)
+	}
+
+	if err = c.DeleteCommandTemplate(ctx, "name-device"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.RetrieveCommandTemplate(ctx, "name-device"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found status error, have: %v", err)
+	}
+}
+
+func TestSerialTargets(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	for _, name := range []string{"Authenticate.2.plist", "TokenUpdate.2.plist"} {
+		checkin, err := os.ReadFile("../../mdm/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Migrate(ctx, checkin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// from mdm/testdata/Authenticate.2.plist
+	const serial = "C02MT66KFLHH"
+
+	result, err := c.Enqueue(ctx, []string{"serial:" + serial}, []byte(profileList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := result.Status[enrollmentID].PushID, "clienttest-"+enrollmentID; have != want {
+		t.Errorf("push id: have: %v, want: %v", have, want)
+	}
+
+	if _, err = c.Push(ctx, []string{"serial:" + serial + ":all", enrollmentID}); err != nil {
+		t.Fatal(err)
+	}
+	// duplicate enrollment IDs are pushed to once
+	pushes := srv.Pushes()
+	if len(pushes) != 2 || len(pushes[1]) != 1 {
+		t.Errorf("expected second push to one id, have: %v", pushes)
+	}
+
+	var statusErr *client.StatusError
+	if _, err = c.Push(ctx, []string{"serial:" + serial + ":user:nobody"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found status error for user channel, have: %v", err)
+	}
+	if _, err = c.Push(ctx, []string{"serial:" + serial + ":bogus"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for channel selector, have: %v", err)
+	}
+}
+
+func TestSignProfile(t *testing.T) {
+	ctx := context.Background()
+	key, cert, err := test.SimpleSelfSignedRSAKeypair("profilesign", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := profilesign.NewSigner(
+		cryptoutil.PEMCertificate(cert.Raw),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := clienttest.NewServer(apiKey, clienttest.WithProfileSigner(signer))
+	defer srv.Close()
+	c := srv.Client()
+
+	const profile = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>PayloadType</key><string>Configuration</string></dict></plist>`
+
+	signed, err := c.SignProfile(ctx, []byte(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !profilesign.IsSigned(signed) {
+		t.Error("profile not signed")
+	}
+
+	var statusErr *client.StatusError
+	if _, err = c.SignProfile(ctx, signed); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for signed profile, have: %v", err)
+	}
+
+	checkin, err := os.ReadFile("../../mdm/testdata/Authenticate.2.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Migrate(ctx, checkin); err != nil {
+		t.Fatal(err)
+	}
+
+	installProfile, err := commands.New(&commands.InstallProfile{Payload: []byte(profile)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Enqueue(ctx, []string{enrollmentID}, installProfile.Raw, client.WithNoPush())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := result.CommandUUID, installProfile.CommandUUID; have != want {
+		t.Errorf("command uuid: have %q, want %q", have, want)
+	}
+
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: enrollmentID}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != installProfile.CommandUUID {
+		t.Fatalf("expected enqueued command: %v", cmd)
+	}
+	p := new(struct{ Command commands.InstallProfile })
+	if err = plist.Unmarshal(cmd.Raw, p); err != nil {
+		t.Fatal(err)
+	}
+	if !profilesign.IsSigned(p.Command.Payload) {
+		t.Error("enqueued profile not signed")
+	}
+}
+
+func TestEnqueueEncryptedProfile(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	key, cert, err := test.SimpleSelfSignedRSAKeypair("device", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store the Authenticate with an identity certificate directly
+	// as the migration endpoint does not have one
+	b, err := os.ReadFile("../../mdm/testdata/Authenticate.2.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mdm.DecodeCheckin(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mdm.NewRequestWithContext(ctx, cert)
+	r.EnrollID = &mdm.EnrollID{ID: enrollmentID}
+	if err = srv.Store.StoreAuthenticate(r, msg.(*mdm.Authenticate)); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = os.ReadFile("../../mdm/testdata/TokenUpdate.2.plist"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Migrate(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	const profile = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>PayloadContent</key><array><dict><key>Password</key><string>hunter2</string></dict></array><key>PayloadType</key><string>Configuration</string></dict></plist>`
+
+	installProfile, err := commands.New(&commands.InstallProfile{Payload: []byte(profile)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statusErr *client.StatusError
+	if _, err = c.EnqueueEncryptedProfile(ctx, []string{"INVALID"}, installProfile.Raw); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for missing identity certificate, have: %v", err)
+	}
+
+	result, err := c.EnqueueEncryptedProfile(ctx, []string{enrollmentID}, installProfile.Raw, client.WithNoPush())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(result.Results), 1; have != want {
+		t.Fatalf("results: have: %v, want: %v", have, want)
+	}
+	if result.Results[0].CommandUUID == installProfile.CommandUUID {
+		t.Error("expected new command uuid")
+	}
+
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.CommandUUID != result.Results[0].CommandUUID {
+		t.Fatalf("expected enqueued command: %v", cmd)
+	}
+	if strings.Contains(string(cmd.Raw), "hunter2") {
+		t.Error("cleartext payload in enqueued command")
+	}
+	p := new(struct{ Command commands.InstallProfile })
+	if err = plist.Unmarshal(cmd.Raw, p); err != nil {
+		t.Fatal(err)
+	}
+	enc := new(struct{ EncryptedPayloadContent []byte })
+	if err = plist.Unmarshal(p.Command.Payload, enc); err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(enc.EncryptedPayloadContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := p7.Decrypt(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "hunter2") {
+		t.Errorf("decrypted content missing payload: %s", content)
+	}
+}
+
+func TestDeclarativeManagement(t *testing.T) {
+	ctx := context.Background()
+	srv := clienttest.NewServer(apiKey)
+	defer srv.Close()
+	c := srv.Client()
+
+	for _, name := range []string{"Authenticate.2.plist", "TokenUpdate.2.plist"} {
+		checkin, err := os.ReadFile("../../mdm/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Migrate(ctx, checkin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const decl = `{"Type":"com.apple.configuration.management.test","Identifier":"com.example.test","Payload":{"Echo":"Foo"}}`
+	d, err := c.StoreDeclaration(ctx, []byte(decl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Identifier != "com.example.test" || d.ServerToken == "" {
+		t.Errorf("unexpected declaration: %v", d)
+	}
+
+	declBytes, err := c.RetrieveDeclaration(ctx, "com.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(declBytes), `"ServerToken":"`+d.ServerToken+`"`) {
+		t.Errorf("declaration missing server token: %s", declBytes)
+	}
+
+	// credentials restricted to enrollment ids can not change
+	// declarations or sets which may affect any enrollment
+	cred, err := c.CreateAPICredential(ctx, "ddm", []string{apiauth.ScopeDDM}, []string{enrollmentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := client.New(srv.URL, cred.Secret, client.WithUsername("ddm"), client.WithClient(srv.Server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *client.StatusError
+	if _, err = restricted.StoreDeclaration(ctx, []byte(decl)); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error storing declaration, have: %v", err)
+	}
+	if _, err = restricted.StoreDeclarationSet(ctx, "set1", []string{"com.example.test"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error storing set, have: %v", err)
+	}
+	if _, err = restricted.RetrieveDeclaration(ctx, "com.example.test"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = c.StoreDeclarationSet(ctx, "set1", []string{"com.example.missing"}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for missing declaration, have: %v", err)
+	}
+	if _, err = c.StoreDeclarationSet(ctx, "set1", []string{"com.example.test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	es, err := c.StoreEnrollmentDeclarationSets(ctx, enrollmentID, []string{"set1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := strings.Join(es.Sets, ","), "set1"; have != want {
+		t.Errorf("enrollment sets: have: %v, want: %v", have, want)
+	}
+
+	// assigning a set enqueues a sync command and pushes
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: enrollmentID}
+	cmd, err := srv.Store.RetrieveNextCommand(r, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd == nil || cmd.Command.RequestType != "DeclarativeManagement" {
+		t.Fatalf("expected enqueued DeclarativeManagement command: %v", cmd)
+	}
+	if len(srv.Pushes()) < 1 {
+		t.Error("expected push")
+	}
+
+	// status is recorded from the status reports of the enrollment
+	if _, err = c.RetrieveDeclarationStatus(ctx, enrollmentID); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found status error for missing status, have: %v", err)
+	}
+	const report = `{"StatusItems":{"management":{"declarations":{"configurations":[{"identifier":"com.example.test","active":false,"valid":"invalid"}]}}},"Errors":[]}`
+	rec := ddm.NewStatusRecorder(ddm.New(srv.Store), srv.Store)
+	if _, err = rec.DeclarativeManagement(r, &mdm.DeclarativeManagement{Endpoint: "status", Data: []byte(report)}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := c.RetrieveDeclarationStatus(ctx, enrollmentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Declarations) != 1 || status.Declarations[0].Identifier != "com.example.test" || status.Declarations[0].Valid != ddm.ValidityInvalid {
+		t.Errorf("unexpected declarations status: %v", status.Declarations)
+	}
+
+	if err = c.DeleteDeclaration(ctx, "com.example.test"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict status error deleting declaration in set, have: %v", err)
+	}
+	if err = c.DeleteDeclarationSet(ctx, "set1"); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict status error deleting assigned set, have: %v", err)
+	}
+
+	if _, err = c.StoreEnrollmentDeclarationSets(ctx, enrollmentID, nil, client.WithNoSync()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteDeclarationSet(ctx, "set1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteDeclaration(ctx, "com.example.test"); err != nil {
+		t.Fatal(err)
+	}
+	decls, err := c.ListDeclarations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decls) != 0 {
+		t.Errorf("expected no declarations: %v", decls)
+	}
+}
+
+func TestEnrollmentProfile(t *testing.T) {
+	ctx := context.Background()
+	pemCert, pemKey := newPushCert(t)
+	cert, err := cryptoutil.DecodePEMCertificate(pemCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := cryptoutil.TopicFromCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := clienttest.NewServer(apiKey, clienttest.WithEnrollProfile(&enrollprofile.Config{
+		ServerURL: "https://mdm.example.org/mdm",
+		Topic:     topic,
+	}))
+	defer srv.Close()
+	c := srv.Client()
+
+	var statusErr *client.StatusError
+	if _, err = c.EnrollmentProfile(ctx, ""); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized status error without token, have: %v", err)
+	}
+
+	tok, err := c.CreateEnrollmentToken(ctx, "test-device", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := tok.Label, "test-device"; have != want {
+		t.Errorf("label: have: %v, want: %v", have, want)
+	}
+	if tok.Token == "" || !tok.ExpiresAt.After(time.Now()) {
+		t.Errorf("invalid token: %+v", tok)
+	}
+
+	// no push cert stored yet
+	if _, err = c.EnrollmentProfile(ctx, tok.Token); err == nil {
+		t.Error("expected error without push cert")
+	}
+
+	if _, err = c.StorePushCert(ctx, pemCert, pemKey); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err = c.CreateEnrollmentToken(ctx, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := c.EnrollmentProfile(ctx, tok.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(profile), topic) {
+		t.Error("topic not found in profile")
+	}
+
+	// tokens are one-time
+	if _, err = c.EnrollmentProfile(ctx, tok.Token); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden status error for used token, have: %v", err)
+	}
+
+	if _, err = c.CreateEnrollmentToken(ctx, "", 365*24*time.Hour); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request status error for ttl, have: %v", err)
+	}
+}
+
+func TestEnrollmentProfileStoredTopic(t *testing.T) {
+	ctx := context.Background()
+	pemCert, pemKey := newPushCert(t)
+	cert, err := cryptoutil.DecodePEMCertificate(pemCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := cryptoutil.TopicFromCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := clienttest.NewServer(apiKey, clienttest.WithEnrollProfile(&enrollprofile.Config{
+		ServerURL: "https://mdm.example.org/mdm",
+	}))
+	defer srv.Close()
+	c := srv.Client()
+
+	if _, err = c.StorePushCert(ctx, pemCert, pemKey); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := c.CreateEnrollmentToken(ctx, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := c.EnrollmentProfile(ctx, tok.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(profile), topic) {
+		t.Error("stored topic not found in profile")
+	}
+}
+
+// TestOpenAPIPaths makes sure every path in the OpenAPI document has a client endpoint.
+func TestOpenAPIPaths(t *testing.T) {
+	b, err := os.ReadFile("../../docs/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := map[string]bool{
+		client.DefaultAPIPrefix + client.EndpointPushCert:              true,
+		client.DefaultAPIPrefix + client.EndpointPushCertCSR:           true,
+		client.DefaultAPIPrefix + client.EndpointPushCertSign:          true,
+		client.DefaultAPIPrefix + client.EndpointPush:                  true,
+		client.DefaultAPIPrefix + client.EndpointPushJobs:              true,
+		client.DefaultAPIPrefix + client.EndpointEnqueue:               true,
+		client.DefaultAPIPrefix + client.EndpointEnqueueBatch:          true,
+		client.DefaultAPIPrefix + client.EndpointEnqueueWait:           true,
+		client.DefaultAPIPrefix + client.EndpointEscrowKeyUnlock:       true,
+		client.DefaultAPIPrefix + client.EndpointProfileSign:           true,
+		client.DefaultAPIPrefix + client.EndpointAPICredentials:        true,
+		client.DefaultAPIPrefix + client.EndpointTemplates:             true,
+		client.DefaultAPIPrefix + client.EndpointDDMDeclarations:       true,
+		client.DefaultAPIPrefix + client.EndpointDDMDeclarations + "/": true,
+		client.DefaultAPIPrefix + client.EndpointDDMSets:               true,
+		client.DefaultAPIPrefix + client.EndpointDDMSets + "/":         true,
+		client.DefaultAPIPrefix + client.EndpointDDMEnrollments + "/":  true,
+		client.DefaultAPIPrefix + client.EndpointDDMStatus + "/":       true,
+		client.DefaultAPIPrefix + client.EndpointAudit:                 true,
+		client.DefaultAPIPrefix + client.EndpointEvents:                true,
+		client.DefaultAPIPrefix + client.EndpointEnrollTokens:          true,
+		client.EndpointEnroll:                                          true,
+		client.EndpointMigration:                                       true,
+		client.EndpointVersion:                                         true,
+	}
+	matches := regexp.MustCompile(`(?m)^  (/\S*):\s*$`).FindAllStringSubmatch(string(b), -1)
+	if len(matches) < 1 {
+		t.Fatal("no paths found")
+	}
+	for _, m := range matches {
+		// strip any path parameters (and beyond) leaving the trailing slash
+		path := regexp.MustCompile(`\{[^}]*\}.*$`).ReplaceAllString(m[1], "")
+		if !endpoints[path] {
+			t.Errorf("no client endpoint for OpenAPI path: %s", m[1])
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package clienttest provides an in-memory NanoMDM API server for
+// testing code that uses the NanoMDM API client.
+//
+// The server serves the real NanoMDM API handlers backed by in-memory
+// storage. APNs pushes and Escrow Key Unlock requests are not sent to
+// Apple but are instead recorded for inspection.
+package clienttest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/micromdm/nanomdm/api/client"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/enrollprofile"
+	"github.com/micromdm/nanomdm/eventstream"
+	httpapi "github.com/micromdm/nanomdm/http/api"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	httpmdm "github.com/micromdm/nanomdm/http/mdm"
+	"github.com/micromdm/nanomdm/profilesign"
+	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/push/pacer"
+	"github.com/micromdm/nanomdm/push/pushcsr"
+	"github.com/micromdm/nanomdm/service/nanomdm"
+	"github.com/micromdm/nanomdm/storage/inmem"
+
+	nlhttp "github.com/micromdm/nanolib/http"
+	"github.com/micromdm/nanolib/log"
+)
+
+// Version is the NanoMDM version reported by the server.
+const Version = "clienttest"
+
+// Server is an in-memory NanoMDM API server.
+type Server struct {
+	*httptest.Server
+
+	// Store is the in-memory storage backing the server.
+	Store *inmem.InMem
+
+	// Events is the broker of the event stream endpoint.
+	// Send events with it to stream them to clients.
+	Events *eventstream.Broker
+
+	apiKey string
+	signer *pushcsr.VendorSigner
+	psign  *profilesign.Signer
+	enroll *enrollprofile.Config
+
+	mu               sync.Mutex
+	pushes           [][]string
+	escrowKeyUnlocks []url.Values
+}
+
+type Option func(*Server)
+
+// WithVendorSigner enables signing push certificate CSRs with signer.
+func WithVendorSigner(signer *pushcsr.VendorSigner) Option {
+	return func(s *Server) {
+		s.signer = signer
+	}
+}
+
+// WithProfileSigner enables signing configuration profiles with signer.
+func WithProfileSigner(signer *profilesign.Signer) Option {
+	return func(s *Server) {
+		s.psign = signer
+	}
+}
+
+// WithEnrollProfile serves enrollment profiles generated from c.
+// One-time enrollment tokens are required to retrieve profiles and a
+// push certificate for the topic of c must be stored.
+func WithEnrollProfile(c *enrollprofile.Config) Option {
+	return func(s *Server) {
+		s.enroll = c
+	}
+}
+
+// NewServer creates and starts a new in-memory NanoMDM API server
+// that authenticates with apiKey or with API credentials created
+// through the API. Call Close when finished.
+func NewServer(apiKey string, opts ...Option) *Server {
+	s := &Server{
+		Store:  inmem.New(),
+		Events: eventstream.New(),
+		apiKey: apiKey,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	logger := log.NopLogger
+	pusher := (*recordingPusher)(s)
+	auditor := audit.New(logger, s.Store)
+
+	apiOpts := []httpapi.Option{
+		httpapi.WithPushKeyStore(s.Store),
+		httpapi.WithPushPacer(pacer.New(pusher)),
+		httpapi.WithAPICredentialStore(s.Store),
+		httpapi.WithAuditRecorder(auditor),
+		httpapi.WithAuditStore(s.Store),
+		httpapi.WithIdempotencyStore(s.Store, 0),
+		httpapi.WithEventBroker(s.Events),
+		httpapi.WithCommandResultsRetriever(s.Store),
+		httpapi.WithCommandTemplateStore(s.Store),
+		httpapi.WithSerialNumberResolver(s.Store),
+		httpapi.WithIdentityCertRetriever(s.Store),
+		httpapi.WithDeclarationStore(s.Store),
+		httpapi.WithDeclarationStatusStore(s.Store),
+		httpapi.WithEnrollmentTokenStore(s.Store),
+	}
+	if s.signer != nil {
+		apiOpts = append(apiOpts, httpapi.WithPushVendorSigner(s.signer))
+	}
+	if s.psign != nil {
+		apiOpts = append(apiOpts, httpapi.WithProfileSigner(s.psign))
+	}
+
+	apiMux := http.NewServeMux()
+	httpapi.HandleAPIv1(client.DefaultAPIPrefix, apiMux, logger, s.Store, pusher, apiOpts...)
+	apiMux.Handle(client.EndpointMigration, apiauth.RequireScope(
+		apiauth.ScopeMigration,
+		httpmdm.CheckinHandler(nanomdm.New(s.Store), logger),
+	))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.auth(apiMux))
+	// override the Escrow Key Unlock handler to avoid talking to Apple
+	mux.Handle(
+		client.DefaultAPIPrefix+client.EndpointEscrowKeyUnlock,
+		s.auth(auditor.Handler(
+			"escrowkeyunlock",
+			apiauth.RequireScope(apiauth.ScopeEscrowKeyUnlock, http.HandlerFunc(s.escrowKeyUnlock)),
+		)),
+	)
+	mux.Handle(client.EndpointVersion, nlhttp.NewJSONVersionHandler(Version))
+	if s.enroll != nil {
+		enrollOpts := []enrollprofile.Option{enrollprofile.WithTokens(s.Store)}
+		if s.psign != nil {
+			enrollOpts = append(enrollOpts, enrollprofile.WithSigner(s.psign))
+		}
+		enrollHandler, err := enrollprofile.NewHandler(s.enroll, s.Store, enrollOpts...)
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle(client.EndpointEnroll, enrollHandler)
+	}
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// auth authenticates requests to next with the API key or a stored API credential.
+func (s *Server) auth(next http.Handler) http.Handler {
+	return apiauth.NewBasicAuthHandler(next, s.Store, client.DefaultUsername, s.apiKey, "nanomdm", log.NopLogger)
+}
+
+// Client returns a new NanoMDM API client for the server.
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	opts = append([]client.Option{client.WithClient(s.Server.Client())}, opts...)
+	c, err := client.New(s.URL, s.apiKey, opts...)
+	if err != nil {
+		// the URL comes from httptest and should always parse
+		panic(err)
+	}
+	return c
+}
+
+func (s *Server) escrowKeyUnlock(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.Topic = r.PostForm.Get("topic")
+	}
+	s.mu.Lock()
+	s.escrowKeyUnlocks = append(s.escrowKeyUnlocks, r.PostForm)
+	s.mu.Unlock()
+}
+
+// Pushes returns the enrollment IDs of each push request received.
+func (s *Server) Pushes() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.pushes...)
+}
+
+// EscrowKeyUnlocks returns the form parameters of each Escrow Key Unlock request received.
+func (s *Server) EscrowKeyUnlocks() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.escrowKeyUnlocks...)
+}
+
+// Reset clears the recorded pushes and Escrow Key Unlock requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushes = nil
+	s.escrowKeyUnlocks = nil
+}
+
+// recordingPusher records pushes and responds with a successful push for each ID.
+type recordingPusher Server
+
+func (p *recordingPusher) Push(_ context.Context, ids []string) (map[string]*push.Response, error) {
+	p.mu.Lock()
+	p.pushes = append(p.pushes, append([]string(nil), ids...))
+	p.mu.Unlock()
+	resps := make(map[string]*push.Response, len(ids))
+	for _, id := range ids {
+		resps[id] = &push.Response{Id: "clienttest-" + id}
+	}
+	return resps, nil
+}
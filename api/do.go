@@ -167,3 +167,49 @@ func doEnqueue(ctx context.Context, r *APIResult, logger log.Logger, store stora
 
 	logs = append(logs, "count", len(ids)-len(idErrs))
 }
+
+// doEnqueueBatch enqueues the commands of items using store.
+// Results and/or errors are accumulated in the parallel results rs
+// and logged to logger. If store is a [storage.BatchCommandEnqueuer]
+// then items are enqueued with it. Otherwise each item is enqueued
+// individually.
+func doEnqueueBatch(ctx context.Context, rs []*APIResult, logger log.Logger, store storage.CommandEnqueuer, items []*storage.EnqueueItem) {
+	batcher, ok := store.(storage.BatchCommandEnqueuer)
+	if !ok {
+		for i, item := range items {
+			doEnqueue(ctx, rs[i], logger, store, item.Command, item.IDs)
+		}
+		return
+	}
+
+	var errCt int
+	errs, err := batcher.EnqueueCommands(ctx, items)
+	for i, item := range items {
+		rs[i].CommandUUID = item.Command.CommandUUID
+		rs[i].RequestType = item.Command.Command.RequestType
+		if err != nil {
+			rs[i].EnqueueError = NewError(err)
+		} else if i < len(errs) && errs[i] != nil {
+			errCt++
+			rs[i].EnqueueError = NewError(errs[i])
+		}
+	}
+
+	if logger != nil {
+		logs := []interface{}{
+			"msg", "enqueue batch",
+			"command_count", len(items),
+		}
+		if err != nil || errCt > 0 {
+			if errCt > 0 {
+				logs = append(logs, "errs", errCt)
+			}
+			if err != nil {
+				logs = append(logs, "err", err)
+			}
+			ctxlog.Logger(ctx, logger).Info(logs...)
+		} else {
+			ctxlog.Logger(ctx, logger).Debug(logs...)
+		}
+	}
+}
@@ -32,6 +32,9 @@ type APIResult struct {
 	// EnqueueError is present if there was an error enqueuing the command.
 	EnqueueError *Error `json:"command_error,omitempty"`
 
+	// PushJobID is the ID of the paced push job if pushes were paced.
+	PushJobID string `json:"push_job_id,omitempty"`
+
 	CommandUUID string `json:"command_uuid,omitempty"` // CommandUUID of the enqueued command.
 	RequestType string `json:"request_type,omitempty"` // RequestType of the enqueued command.
 }
@@ -85,3 +88,19 @@ func (r *APIResult) Error() error {
 
 	return nil
 }
+
+// BatchResult is the result of the batch enqueue API.
+type BatchResult struct {
+	// Results are the per-command results in the order of the batch.
+	// The per-enrollment ID push results are included in each.
+	Results []*APIResult `json:"results"`
+
+	// NoPush signifies if APNs pushes were not enabled for this API call.
+	NoPush bool `json:"no_push,omitempty"`
+
+	// PushError is present if there was an error sending the APNs push notifications.
+	PushError *Error `json:"push_error,omitempty"`
+
+	// EnqueueError is present if there was an error with the batch as a whole.
+	EnqueueError *Error `json:"command_error,omitempty"`
+}
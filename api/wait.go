@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/plist"
+)
+
+// DefaultWaitInterval is the default interval between polls of storage
+// for command results while waiting.
+const DefaultWaitInterval = time.Second
+
+// WithWaitInterval sets the interval between polls of storage for
+// command results while waiting. See [PushEnqueuer.EnqueueWithPushAndWait].
+func WithWaitInterval(interval time.Duration) PushEnqueuerOption {
+	return func(pe *PushEnqueuer) error {
+		if interval <= 0 {
+			return errors.New("invalid wait interval")
+		}
+		pe.waitInterval = interval
+		return nil
+	}
+}
+
+// CommandResult is the command result reported by an enrollment.
+type CommandResult struct {
+	// Status is the status of the command report, such as "Acknowledged".
+	Status string `json:"status"`
+
+	// Raw is the raw command report plist.
+	Raw []byte `json:"raw"`
+
+	// Decoded is the decoded command report. It is the typed result
+	// for command RequestTypes that have one (see [commands.DecodeResult])
+	// otherwise it is the generic plist dictionary.
+	Decoded interface{} `json:"decoded,omitempty"`
+}
+
+// newCommandResult creates a new command result from results of a
+// command of requestType. Any decoding errors leave the result undecoded.
+func newCommandResult(requestType string, results *mdm.CommandResults) *CommandResult {
+	r := &CommandResult{Status: results.Status, Raw: results.Raw}
+	decoded, err := commands.DecodeResult(requestType, results)
+	if errors.Is(err, commands.ErrNoResultDecoder) {
+		var dict map[string]interface{}
+		if err = plist.Unmarshal(results.Raw, &dict); err == nil {
+			decoded = dict
+		}
+	}
+	if err == nil {
+		r.Decoded = decoded
+	}
+	return r
+}
+
+// WaitResult is the result of enqueueing a command and waiting for its results.
+type WaitResult struct {
+	APIResult
+
+	// Results are the command results reported by enrollments.
+	// Map key is the enrollment ID.
+	Results map[string]*CommandResult `json:"results,omitempty"`
+
+	// Pending are the enrollment IDs that had not reported a final
+	// (i.e. not "NotNow") command result before waiting finished.
+	Pending []string `json:"pending,omitempty"`
+
+	// ResultsError is present if there was an error retrieving command results.
+	ResultsError *Error `json:"results_error,omitempty"`
+}
+
+// Error distills the WaitResult errors to a simple error or returns nil.
+// See [APIResult.Error].
+func (r *WaitResult) Error() error {
+	err := r.APIResult.Error()
+	if r.ResultsError == nil {
+		return err
+	} else if err == nil {
+		return fmt.Errorf("results error: %w", r.ResultsError)
+	}
+	return fmt.Errorf("%w; results error: %v", err, r.ResultsError)
+}
+
+// EnqueueWithPushAndWait enqueues command, sends APNs pushes to ids,
+// and then waits for the enrollments to report the command results.
+// Results are polled from retriever so that any NanoMDM instance
+// sharing the storage may receive the command reports. Waiting
+// finishes when each successfully enqueued enrollment ID has reported
+// a final (i.e. not "NotNow") result or ctx is done. Use a context with
+// a timeout or deadline to limit the wait.
+// The return integer follows [EnqueueWithPush] with the addition that
+// a 202 value indicates no errors but that some enrollment IDs are
+// still pending.
+func (pe *PushEnqueuer) EnqueueWithPushAndWait(ctx context.Context, command *mdm.Command, ids []string, retriever storage.CommandResultsRetriever) (*WaitResult, int, error) {
+	if command == nil {
+		return nil, 500, errors.New("nil command")
+	}
+	if retriever == nil {
+		return nil, 500, errors.New("nil retriever")
+	}
+
+	ar, ret, err := pe.EnqueueWithPush(ctx, command, ids, false)
+	if ar == nil {
+		return nil, ret, err
+	}
+	r := &WaitResult{APIResult: *ar}
+	if err != nil || r.EnqueueError != nil {
+		return r, ret, err
+	}
+
+	for _, id := range ids {
+		if r.Status[id].EnqueueError == nil {
+			r.Pending = append(r.Pending, id)
+		}
+	}
+
+	interval := pe.waitInterval
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+wait:
+	for len(r.Pending) > 0 {
+		results, err := retriever.RetrieveCommandResults(ctx, command.CommandUUID, r.Pending)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			r.ResultsError = NewError(fmt.Errorf("retrieving command results: %w", err))
+			return r, 500, nil
+		}
+
+		var pending []string
+		for _, id := range r.Pending {
+			report, ok := results[id]
+			if !ok {
+				pending = append(pending, id)
+				continue
+			}
+			if r.Results == nil {
+				r.Results = make(map[string]*CommandResult)
+			}
+			// include NotNow results while we wait for a final result
+			r.Results[id] = newCommandResult(command.Command.RequestType, report)
+			if report.Status == "NotNow" {
+				pending = append(pending, id)
+			}
+		}
+		r.Pending = pending
+
+		if len(r.Pending) > 0 {
+			select {
+			case <-ctx.Done():
+				break wait
+			case <-ticker.C:
+			}
+		}
+	}
+
+	if ret == 200 && len(r.Pending) > 0 {
+		ret = 202
+	}
+	return r, ret, nil
+}
@@ -0,0 +1,147 @@
+// Package audit records audit entries of state-changing API calls.
+//
+// A [Recorder] wraps API HTTP handlers. It creates an audit entry for
+// each request which the wrapped handler can add details to (see
+// [FromContext]). Once the handler finishes the entry is completed with
+// the outcome and stored with each configured [storage.AuditStorer].
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/http/trace"
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// Recorder records audit entries for API requests.
+type Recorder struct {
+	logger  log.Logger
+	storers []storage.AuditStorer
+}
+
+// New creates a new recorder that stores audit entries with storers.
+// Errors storing entries are logged to logger.
+func New(logger log.Logger, storers ...storage.AuditStorer) *Recorder {
+	if logger == nil {
+		logger = log.NopLogger
+	}
+	return &Recorder{logger: logger, storers: storers}
+}
+
+type ctxKeyEntry struct{}
+
+// FromContext returns the in-progress audit entry from ctx.
+// Handlers wrapped by a [Recorder] can use it to add details to the
+// entry. Nil is returned if the request is not being audited.
+func FromContext(ctx context.Context) *storage.AuditEntry {
+	e, _ := ctx.Value(ctxKeyEntry{}).(*storage.AuditEntry)
+	return e
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// actor returns the identity of the caller of r.
+func actor(r *http.Request) string {
+	if cred := apiauth.FromContext(r.Context()); cred != nil {
+		return cred.Name
+	}
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
+// sourceIP returns the IP address of the client of r.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Outcome returns the audit outcome of an HTTP status code.
+func Outcome(status int) string {
+	switch {
+	case status == http.StatusMultiStatus:
+		return storage.AuditOutcomePartial
+	case status >= 200 && status < 300:
+		return storage.AuditOutcomeSuccess
+	default:
+		return storage.AuditOutcomeFailure
+	}
+}
+
+// statusWriter captures the HTTP status written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Record stores e with each configured storer.
+// Errors are logged using the logger from ctx.
+func (rec *Recorder) Record(ctx context.Context, e *storage.AuditEntry) {
+	logger := ctxlog.Logger(ctx, rec.logger)
+	for _, storer := range rec.storers {
+		// store the entry even if the request has been canceled
+		if err := storer.StoreAuditEntry(context.Background(), e); err != nil {
+			logger.Info("msg", "storing audit entry", "action", e.Action, "id", e.ID, "err", err)
+		}
+	}
+}
+
+// Handler records an audit entry of action for each request to next.
+func (rec *Recorder) Handler(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := newID()
+		if err != nil {
+			ctxlog.Logger(r.Context(), rec.logger).Info("msg", "generating audit entry id", "err", err)
+		}
+		e := &storage.AuditEntry{
+			ID:       id,
+			Time:     time.Now(),
+			Actor:    actor(r),
+			SourceIP: sourceIP(r),
+			TraceID:  trace.GetTraceID(r.Context()),
+			Action:   action,
+		}
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), ctxKeyEntry{}, e)))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		e.Status = sw.status
+		e.Outcome = Outcome(sw.status)
+
+		rec.Record(r.Context(), e)
+	})
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/storage"
+	"github.com/micromdm/nanomdm/storage/inmem"
+)
+
+func TestOutcome(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusOK:                  storage.AuditOutcomeSuccess,
+		http.StatusNoContent:           storage.AuditOutcomeSuccess,
+		http.StatusMultiStatus:         storage.AuditOutcomePartial,
+		http.StatusForbidden:           storage.AuditOutcomeFailure,
+		http.StatusInternalServerError: storage.AuditOutcomeFailure,
+	} {
+		if have := Outcome(status); have != want {
+			t.Errorf("status %d: have: %v, want: %v", status, have, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	jsonl, err := NewJSONLFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := New(nil, store, jsonl)
+	handler := rec.Handler("enqueue", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := FromContext(r.Context())
+		if e == nil {
+			t.Fatal("nil audit entry")
+		}
+		e.EnrollmentIDs = []string{"AAAA-1111"}
+		e.RequestType = "ProfileList"
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+
+	req := httptest.NewRequest(http.MethodPut, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req = req.WithContext(apiauth.NewContext(req.Context(), &storage.APICredential{Name: "helpdesk"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err = jsonl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.RetrieveAuditEntries(ctx, &storage.AuditQuery{EnrollmentID: "AAAA-1111"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 1; have != want {
+		t.Fatalf("entries: have: %v, want: %v", have, want)
+	}
+	e := entries[0]
+	if e.ID == "" {
+		t.Error("empty id")
+	}
+	for _, tc := range []struct{ name, have, want string }{
+		{"actor", e.Actor, "helpdesk"},
+		{"source ip", e.SourceIP, "192.0.2.1"},
+		{"action", e.Action, "enqueue"},
+		{"request type", e.RequestType, "ProfileList"},
+		{"outcome", e.Outcome, storage.AuditOutcomePartial},
+	} {
+		if tc.have != tc.want {
+			t.Errorf("%s: have: %v, want: %v", tc.name, tc.have, tc.want)
+		}
+	}
+
+	// the same entry should be in the JSONL file
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		fileEntry := new(storage.AuditEntry)
+		if err = json.Unmarshal(scanner.Bytes(), fileEntry); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := fileEntry.ID, e.ID; have != want {
+			t.Errorf("file entry id: have: %v, want: %v", have, want)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := lines, 1; have != want {
+		t.Errorf("file entries: have: %v, want: %v", have, want)
+	}
+}
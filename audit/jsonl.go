@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// JSONLFile is an append-only audit log file of one JSON-encoded
+// audit entry per line.
+type JSONLFile struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONLFile opens (or creates) the JSONL audit log file at path for appending.
+func NewJSONLFile(path string) (*JSONLFile, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLFile{f: f}, nil
+}
+
+// StoreAuditEntry appends e to the file.
+func (j *JSONLFile) StoreAuditEntry(_ context.Context, e *storage.AuditEntry) error {
+	if e == nil {
+		return errors.New("nil audit entry")
+	}
+	entryBytes, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(entryBytes, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (j *JSONLFile) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
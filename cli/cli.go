@@ -40,12 +40,21 @@ type Storage struct {
 	Storage StringAccumulator
 	DSN     StringAccumulator
 	Options StringAccumulator
+
+	deleteCommands bool
 }
 
 func NewStorage() *Storage {
 	return &Storage{}
 }
 
+// RetainsCommandResults reports whether the storage returned by Parse
+// retains command results. It does not if the (first) storage backend
+// deletes commands once they are acknowledged.
+func (s *Storage) RetainsCommandResults() bool {
+	return !s.deleteCommands
+}
+
 func (s *Storage) Parse(logger log.Logger) (storage.AllStorage, error) {
 	if len(s.Storage) != len(s.DSN) {
 		return nil, errors.New("must have same number of storage and DSN flags")
@@ -88,12 +97,18 @@ func (s *Storage) Parse(logger log.Logger) (storage.AllStorage, error) {
 				return nil, err
 			}
 			mdmStorage = append(mdmStorage, mysqlStorage)
+			if idx == 0 {
+				s.deleteCommands = splitOptions(options)["delete"] == "1"
+			}
 		case "pgsql":
 			pgsqlStorage, err := pgsqlStorageConfig(dsn, options, logger)
 			if err != nil {
 				return nil, err
 			}
 			mdmStorage = append(mdmStorage, pgsqlStorage)
+			if idx == 0 {
+				s.deleteCommands = splitOptions(options)["delete"] == "1"
+			}
 		case "inmem":
 			if options != "" {
 				return nil, ErrNoStorageOptions
@@ -2,6 +2,8 @@ package main
 
 import (
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -12,26 +14,39 @@ import (
 	"strings"
 	"time"
 
+	"github.com/micromdm/nanomdm/audit"
 	"github.com/micromdm/nanomdm/certverify"
 	"github.com/micromdm/nanomdm/cli"
 	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/digestauth"
+	"github.com/micromdm/nanomdm/enrollprofile"
+	"github.com/micromdm/nanomdm/eventstream"
 	httpapi "github.com/micromdm/nanomdm/http/api"
+	"github.com/micromdm/nanomdm/http/apiauth"
 	"github.com/micromdm/nanomdm/http/authproxy"
 	httpmdm "github.com/micromdm/nanomdm/http/mdm"
+	"github.com/micromdm/nanomdm/profilesign"
 	"github.com/micromdm/nanomdm/push/nanopush"
+	"github.com/micromdm/nanomdm/push/pacer"
+	"github.com/micromdm/nanomdm/push/pushcsr"
+	"github.com/micromdm/nanomdm/push/relay"
 	pushsvc "github.com/micromdm/nanomdm/push/service"
 	"github.com/micromdm/nanomdm/service"
 	"github.com/micromdm/nanomdm/service/certauth"
+	"github.com/micromdm/nanomdm/service/ddm"
 	"github.com/micromdm/nanomdm/service/dmhook"
 	"github.com/micromdm/nanomdm/service/dump"
 	"github.com/micromdm/nanomdm/service/multi"
 	"github.com/micromdm/nanomdm/service/nanomdm"
+	"github.com/micromdm/nanomdm/service/tokenhook"
 	"github.com/micromdm/nanomdm/service/webhook"
+	"github.com/micromdm/nanomdm/storage"
 
 	"github.com/micromdm/nanolib/envflag"
 	nlhttp "github.com/micromdm/nanolib/http"
 	"github.com/micromdm/nanolib/http/trace"
 	"github.com/micromdm/nanolib/log/stdlogfmt"
+	"github.com/smallstep/pkcs7"
 )
 
 // overridden by -ldflags -X
@@ -45,6 +60,10 @@ const (
 
 	endpointAPIMigration = "/migration"
 	endpointAPIVersion   = "/version"
+
+	endpointPushRelay = "/pushrelay"
+
+	endpointEnroll = "/enroll"
 )
 
 const (
@@ -58,6 +77,8 @@ func main() {
 	flag.Var(&cliStorage.DSN, "storage-dsn", "data source name (e.g. connection string or path)")
 	flag.Var(&cliStorage.DSN, "dsn", "data source name; deprecated: use -storage-dsn")
 	flag.Var(&cliStorage.Options, "storage-options", "storage backend options")
+	var tokenHooks cli.StringAccumulator
+	flag.Var(&tokenHooks, "token-hook", "TokenServiceType=URL to send GetToken requests of TokenServiceType to (repeatable)")
 	var (
 		flListen     = flag.String("listen", ":9000", "HTTP listen address")
 		flAPIKey     = flag.String("api", "", "API key for API endpoints")
@@ -75,9 +96,28 @@ func main() {
 		flDMURLPfx   = flag.String("dm", "", "URL to send Declarative Management requests to")
 		flDMSendKey  = flag.String("dm-send-hmac-key", "", "attaches an HMAC HTTP header to each DM request using this key")
 		flDMRecvKey  = flag.String("dm-recv-hmac-key", "", "verifies an HMAC HTTP header from each DM request using this key")
+		flDDM        = flag.Bool("ddm", false, "enable built-in Declarative Management server")
 		flAuthProxy  = flag.String("auth-proxy-url", "", "Reverse proxy URL target for MDM-authenticated HTTP requests")
 		flUAZLChal   = flag.Bool("ua-zl-dc", false, "reply with zero-length DigestChallenge for UserAuthenticate")
+		flUADigest   = flag.String("ua-htdigest", "", "path to htdigest file for verifying UserAuthenticate digest challenges")
+		flUARealm    = flag.String("ua-realm", "NanoMDM", "realm of UserAuthenticate digest challenges")
+		flUAKey      = flag.String("ua-digest-key", "", "HMAC key for UserAuthenticate digest challenge nonces; share between instances")
+		flTHSendKey  = flag.String("token-hook-send-hmac-key", "", "attaches an HMAC HTTP header to each GetToken request using this key")
+		flTHRecvKey  = flag.String("token-hook-recv-hmac-key", "", "verifies an HMAC HTTP header from each GetToken response using this key")
 		flWHHMACKey  = flag.String("webhook-hmac-key", "", "attaches an HMAC HTTP header to each webhook request using this key")
+		flVendorCert = flag.String("push-vendor-cert", "", "path to PEM MDM vendor cert (and Apple chain) for signing push cert CSRs")
+		flVendorKey  = flag.String("push-vendor-key", "", "path to PEM MDM vendor private key for signing push cert CSRs")
+		flProfCert   = flag.String("profile-sign-cert", "", "path to PEM profile signing cert (and chain) for signing configuration profiles")
+		flProfKey    = flag.String("profile-sign-key", "", "path to PEM profile signing private key for signing configuration profiles")
+		flPushAltPrt = flag.Bool("push-alt-port", false, "send APNs pushes to the alternate port 2197")
+		flRelayURL   = flag.String("push-relay-url", "", "URL of push relay to forward pushes to instead of APNs")
+		flRelayKey   = flag.String("push-relay-hmac-key", "", "HMAC key for push relay requests; serves a push relay if no push relay URL")
+		flAuditFile  = flag.String("audit-file", "", "path to append-only JSONL audit log file of API actions")
+		flIdemWindow = flag.Duration("idempotency-window", httpapi.DefaultIdempotencyWindow, "duration to keep results of API requests with idempotency keys")
+		flEnrollCfg  = flag.String("enroll-profile", "", "path to JSON enrollment profile config; serves generated enrollment profiles")
+		flEnrollURL  = flag.String("enroll-url", "", "base URL of this server used for the MDM URLs of generated enrollment profiles")
+		flEnrollTok  = flag.Bool("enroll-tokens", false, "require one-time enrollment tokens for enrollment profiles")
+		flEventsBuf  = flag.Int("events-buffer", eventstream.DefaultBufferSize, "number of recent MDM events kept for resuming API event streams")
 	)
 	envflag.Parse("NANOMDM_", []string{"version", "dsn"})
 
@@ -92,6 +132,10 @@ func main() {
 
 	logger := stdlogfmt.New(stdlogfmt.WithDebugFlag(*flDebug))
 
+	// encrypt profiles (see the profileencrypt package) with AES-256
+	// instead of the pkcs7 package default of DES.
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+
 	if *flRootsPath == "" {
 		stdlog.Fatal("must supply CA cert path flag")
 	}
@@ -117,14 +161,55 @@ func main() {
 	}
 
 	tokenMux := nanomdm.NewTokenMux()
+	for _, hook := range tokenHooks {
+		serviceType, hookURL, ok := strings.Cut(hook, "=")
+		if !ok || serviceType == "" || hookURL == "" {
+			stdlog.Fatalf("invalid token hook (expected TokenServiceType=URL): %s", hook)
+		}
+		var tokenHookOpts []tokenhook.Option
+		if *flTHSendKey != "" {
+			tokenHookOpts = append(tokenHookOpts, tokenhook.WithSetHMACSecret([]byte(*flTHSendKey)))
+		}
+		if *flTHRecvKey != "" {
+			tokenHookOpts = append(tokenHookOpts, tokenhook.WithVerifyHMACSecret([]byte(*flTHRecvKey)))
+		}
+		tokenHook, err := tokenhook.New(hookURL, tokenHookOpts...)
+		if err != nil {
+			stdlog.Fatal(err)
+		}
+		tokenMux.Handle(serviceType, tokenHook)
+		logger.Debug("msg", "registered token hook", "token_service_type", serviceType, "url", hookURL)
+	}
+
+	var uaOpts []nanomdm.UAOption
+	if *flUADigest != "" {
+		if *flUAZLChal {
+			stdlog.Fatal("cannot use both -ua-htdigest and -ua-zl-dc")
+		}
+		creds, err := digestauth.LoadHTDigest(*flUADigest)
+		if err != nil {
+			stdlog.Fatal(err)
+		}
+		uaOpts = append(uaOpts, nanomdm.WithDigestChallenge(*flUARealm, creds))
+		if *flUAKey != "" {
+			uaOpts = append(uaOpts, nanomdm.WithDigestChallengeKey([]byte(*flUAKey)))
+		}
+	}
 
 	// create 'core' MDM service
 	nanoOpts := []nanomdm.Option{
-		nanomdm.WithUserAuthenticate(nanomdm.NewUAService(mdmStorage, *flUAZLChal)),
+		nanomdm.WithUserAuthenticate(nanomdm.NewUAService(mdmStorage, *flUAZLChal, uaOpts...)),
 		nanomdm.WithGetToken(tokenMux),
 		nanomdm.WithLogger(logger.With("service", "nanomdm")),
 	}
-	if *flDMURLPfx != "" {
+	if *flDDM && *flDMURLPfx != "" {
+		stdlog.Fatal("cannot use both -ddm and -dm")
+	}
+	var dm service.DeclarativeManagement
+	if *flDDM {
+		logger.Debug("msg", "built-in declarative management setup")
+		dm = ddm.New(mdmStorage)
+	} else if *flDMURLPfx != "" {
 		var warningText string
 		if !strings.HasSuffix(*flDMURLPfx, "/") {
 			warningText = ": warning: URL has no trailing slash"
@@ -141,13 +226,57 @@ func main() {
 		if err != nil {
 			stdlog.Fatal(err)
 		}
-		nanoOpts = append(nanoOpts, nanomdm.WithDeclarativeManagement(dmHook))
+		dm = dmHook
+	}
+	if dm != nil {
+		// record the status reports of enrollments
+		dm = ddm.NewStatusRecorder(dm, mdmStorage)
+		nanoOpts = append(nanoOpts, nanomdm.WithDeclarativeManagement(dm))
 	}
 	nano := nanomdm.New(mdmStorage, nanoOpts...)
 
+	var profSigner *profilesign.Signer
+	if *flProfCert != "" || *flProfKey != "" {
+		profSigner, err = loadProfileSigner(*flProfCert, *flProfKey)
+		if err != nil {
+			stdlog.Fatal(err)
+		}
+		logger.Debug("msg", "loaded profile signing cert", "cn", profSigner.Certificate().Subject.CommonName)
+	}
+
 	mux := http.NewServeMux()
 	mdmAuthMux := nlhttp.NewMWMux(mux)
 
+	if *flEnrollCfg != "" {
+		enrollCfg, err := loadEnrollProfileConfig(*flEnrollCfg)
+		if err != nil {
+			stdlog.Fatal(err)
+		}
+		if *flEnrollURL != "" {
+			enrollURL := strings.TrimRight(*flEnrollURL, "/")
+			enrollCfg.ServerURL = enrollURL + endpointMDM
+			enrollCfg.CheckInURL = ""
+			if *flCheckin {
+				enrollCfg.CheckInURL = enrollURL + endpointCheckin
+			}
+		}
+		enrollOpts := []enrollprofile.Option{enrollprofile.WithLogger(logger.With("handler", "enroll"))}
+		if profSigner != nil {
+			enrollOpts = append(enrollOpts, enrollprofile.WithSigner(profSigner))
+		}
+		if *flEnrollTok {
+			enrollOpts = append(enrollOpts, enrollprofile.WithTokens(mdmStorage))
+		}
+		enrollHandler, err := enrollprofile.NewHandler(enrollCfg, mdmStorage, enrollOpts...)
+		if err != nil {
+			stdlog.Fatal(fmt.Errorf("enrollment profile: %w", err))
+		}
+		mux.Handle(endpointEnroll, enrollHandler)
+		logger.Debug("msg", "enrollment profile setup", "server_url", enrollCfg.ServerURL, "topic", enrollCfg.Topic, "tokens", *flEnrollTok)
+	} else if *flEnrollURL != "" || *flEnrollTok {
+		stdlog.Fatal("must supply enrollment profile config path flag")
+	}
+
 	if *flCertHeader != "" {
 		// extract certificate from HTTP header (mTLS)
 		mdmAuthMux.Use(func(h http.Handler) http.Handler {
@@ -171,18 +300,35 @@ func main() {
 		return httpmdm.CertVerifyMiddleware(h, verifier, logger.With("handler", "cert-verify"))
 	})
 
+	// buffer MDM events for the API event stream
+	var eventBroker *eventstream.Broker
+	if *flAPIKey != "" {
+		eventBroker = eventstream.New(
+			eventstream.WithBufferSize(*flEventsBuf),
+			eventstream.WithLogger(logger.With("service", "eventstream")),
+		)
+	}
+
 	if !*flDisableMDM {
 		var mdmService service.CheckinAndCommandService = nano
+		whOpts := []webhook.Option{
+			webhook.WithTokenUpdateTalley(mdmStorage),
+			webhook.WithEventID(trace.GetTraceID),
+			webhook.WithDecodedResults(mdmStorage),
+		}
+		var eventServices []service.CheckinAndCommandService
 		if *flWebhook != "" {
-			whOpts := []webhook.Option{
-				webhook.WithTokenUpdateTalley(mdmStorage),
-				webhook.WithEventID(trace.GetTraceID),
-			}
+			webhookOpts := append([]webhook.Option{}, whOpts...)
 			if *flWHHMACKey != "" {
-				whOpts = append(whOpts, webhook.WithHMACSecret([]byte(*flWHHMACKey)))
+				webhookOpts = append(webhookOpts, webhook.WithHMACSecret([]byte(*flWHHMACKey)))
 			}
-			webhookService := webhook.New(*flWebhook, whOpts...)
-			mdmService = multi.New(logger.With("service", "multi"), mdmService, webhookService)
+			eventServices = append(eventServices, webhook.New(*flWebhook, webhookOpts...))
+		}
+		if eventBroker != nil {
+			eventServices = append(eventServices, webhook.NewWithSender(eventBroker, whOpts...))
+		}
+		if len(eventServices) > 0 {
+			mdmService = multi.New(logger.With("service", "multi"), append([]service.CheckinAndCommandService{mdmService}, eventServices...)...)
 		}
 		certAuthOpts := []certauth.Option{certauth.WithLogger(logger.With("service", "certauth"))}
 		if *flRetro {
@@ -234,20 +380,95 @@ func main() {
 	}
 
 	if *flAPIKey != "" {
-		const apiUsername = "nanomdm"
-
 		apiAuthMux := nlhttp.NewMWMux(mux)
 
 		apiAuthMux.Use(func(h http.Handler) http.Handler {
-			return nlhttp.NewSimpleBasicAuthHandler(h, apiUsername, *flAPIKey, "nanomdm")
+			// authenticate either the API key or a stored API credential
+			return apiauth.NewBasicAuthHandler(h, mdmStorage, apiauth.RootUsername, *flAPIKey, "nanomdm", logger.With("handler", "apiauth"))
 		})
 
 		// create our push provider and push service
-		pushProviderFactory := nanopush.NewFactory()
-		pushService := pushsvc.New(mdmStorage, mdmStorage, pushProviderFactory, logger.With("service", "push"))
+		var pushService *pushsvc.PushService
+		if *flRelayURL != "" {
+			// forward pushes to the push relay which holds the push certs
+			var relayOpts []relay.Option
+			if *flRelayKey != "" {
+				relayOpts = append(relayOpts, relay.WithHMACSecret([]byte(*flRelayKey)))
+			}
+			pushProviderFactory := relay.NewFactory(*flRelayURL, relayOpts...)
+			pushService = pushsvc.New(mdmStorage, nil, pushProviderFactory, logger.With("service", "push"))
+		} else {
+			var pushOpts []nanopush.Option
+			if *flPushAltPrt {
+				pushOpts = append(pushOpts, nanopush.WithAlternatePort())
+			}
+			pushProviderFactory := nanopush.NewFactory(pushOpts...)
+			pushService = pushsvc.New(mdmStorage, mdmStorage, pushProviderFactory, logger.With("service", "push"))
+
+			if *flRelayKey != "" {
+				// serve a push relay for other instances using our push certs
+				mux.Handle(endpointPushRelay, relay.NewHandler(
+					pushService.Provider(),
+					[]byte(*flRelayKey),
+					logger.With("handler", "push-relay"),
+				))
+			}
+		}
+
+		pushPacer := pacer.New(pushService, pacer.WithLogger(logger.With("service", "pacer")))
+
+		// record audit entries of API actions into storage and optionally a file
+		auditStorers := []storage.AuditStorer{mdmStorage}
+		if *flAuditFile != "" {
+			auditFile, err := audit.NewJSONLFile(*flAuditFile)
+			if err != nil {
+				stdlog.Fatal(err)
+			}
+			defer auditFile.Close()
+			auditStorers = append(auditStorers, auditFile)
+		}
+		auditor := audit.New(logger.With("service", "audit"), auditStorers...)
+
+		apiOpts := []httpapi.Option{
+			httpapi.WithPushKeyStore(mdmStorage),
+			httpapi.WithPushPacer(pushPacer),
+			httpapi.WithAPICredentialStore(mdmStorage),
+			httpapi.WithAuditRecorder(auditor),
+			httpapi.WithAuditStore(mdmStorage),
+			httpapi.WithIdempotencyStore(mdmStorage, *flIdemWindow),
+			httpapi.WithEventBroker(eventBroker),
+			httpapi.WithCommandTemplateStore(mdmStorage),
+			httpapi.WithSerialNumberResolver(mdmStorage),
+			httpapi.WithIdentityCertRetriever(mdmStorage),
+		}
+		if cliStorage.RetainsCommandResults() {
+			apiOpts = append(apiOpts, httpapi.WithCommandResultsRetriever(mdmStorage))
+		} else {
+			logger.Info("msg", "enqueue and wait API disabled: storage deletes command results")
+		}
+		if *flVendorCert != "" || *flVendorKey != "" {
+			signer, err := loadVendorSigner(*flVendorCert, *flVendorKey)
+			if err != nil {
+				stdlog.Fatal(err)
+			}
+			apiOpts = append(apiOpts, httpapi.WithPushVendorSigner(signer))
+			logger.Debug("msg", "loaded push vendor cert", "cn", signer.Certificate().Subject.CommonName)
+		}
+		if profSigner != nil {
+			apiOpts = append(apiOpts, httpapi.WithProfileSigner(profSigner))
+		}
+		if *flDDM {
+			apiOpts = append(apiOpts, httpapi.WithDeclarationStore(mdmStorage))
+		}
+		if dm != nil {
+			apiOpts = append(apiOpts, httpapi.WithDeclarationStatusStore(mdmStorage))
+		}
+		if *flEnrollTok {
+			apiOpts = append(apiOpts, httpapi.WithEnrollmentTokenStore(mdmStorage))
+		}
 
 		// register API handlers
-		httpapi.HandleAPIv1("/v1", apiAuthMux, logger, mdmStorage, pushService)
+		httpapi.HandleAPIv1("/v1", apiAuthMux, logger, mdmStorage, pushService, apiOpts...)
 
 		if *flMigration {
 			// setup a "migration" handler that takes Check-In messages
@@ -260,7 +481,13 @@ func main() {
 			// migrate MDM enrollments between servers.
 			apiAuthMux.Handle(
 				endpointAPIMigration,
-				httpmdm.CheckinHandler(nano, logger.With("handler", "migration")),
+				auditor.Handler(
+					"migration",
+					apiauth.RequireScope(
+						apiauth.ScopeMigration,
+						httpmdm.CheckinHandler(nano, logger.With("handler", "migration")),
+					),
+				),
 			)
 		}
 	}
@@ -287,3 +514,48 @@ func newTraceID(_ *http.Request) string {
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)
 }
+
+// loadVendorSigner loads the MDM vendor certificate chain and private key.
+func loadVendorSigner(certPath, keyPath string) (*pushcsr.VendorSigner, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("must supply both push vendor cert and key paths")
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading push vendor cert: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading push vendor key: %w", err)
+	}
+	return pushcsr.NewVendorSigner(certPEM, keyPEM)
+}
+
+// loadEnrollProfileConfig reads the JSON enrollment profile config at path.
+func loadEnrollProfileConfig(path string) (*enrollprofile.Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading enrollment profile config: %w", err)
+	}
+	c := new(enrollprofile.Config)
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("decoding enrollment profile config: %w", err)
+	}
+	return c, nil
+}
+
+// loadProfileSigner loads the profile signing certificate chain and private key.
+func loadProfileSigner(certPath, keyPath string) (*profilesign.Signer, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("must supply both profile signing cert and key paths")
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile signing cert: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile signing key: %w", err)
+	}
+	return profilesign.NewSigner(certPEM, keyPEM)
+}
@@ -0,0 +1,231 @@
+// Command nanopushcert requests, signs, and uploads NanoMDM APNs push certificates.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	stdlog "log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/micromdm/nanomdm/push/pushcsr"
+)
+
+// overridden by -ldflags -X
+var version = "unknown"
+
+const apiUsername = "nanomdm"
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] <subcommand> [subcommand flags]
+
+Subcommands:
+  csr     generate a push cert CSR (and private key) on the NanoMDM server
+  upload  upload an Apple-issued push cert (and optional private key) to the NanoMDM server
+  sign    sign a CSR locally with an MDM vendor cert and private key
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		flVersion = flag.Bool("version", false, "print version")
+		flURL     = flag.String("url", "", "NanoMDM server URL (e.g. http://[::1]:9000)")
+		flAPIKey  = flag.String("key", "", "NanoMDM API Key")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	if *flVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := &client{url: strings.TrimRight(*flURL, "/"), key: *flAPIKey}
+
+	var err error
+	switch flag.Arg(0) {
+	case "csr":
+		err = c.csr(flag.Args()[1:])
+	case "upload":
+		err = c.upload(flag.Args()[1:])
+	case "sign":
+		err = sign(flag.Args()[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+}
+
+type client struct {
+	url string
+	key string
+}
+
+// do sends an HTTP request to the NanoMDM API and returns the response body.
+func (c *client) do(method, path, contentType string, body io.Reader) ([]byte, error) {
+	if c.url == "" || c.key == "" {
+		return nil, errors.New("must supply server URL and API key")
+	}
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(apiUsername, c.key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d: %s", res.StatusCode, bytes.TrimSpace(b))
+	}
+	return b, nil
+}
+
+func (c *client) csr(args []string) error {
+	fs := flag.NewFlagSet("csr", flag.ExitOnError)
+	var (
+		flCN    = fs.String("cn", "", "CSR common name")
+		flEmail = fs.String("email", "", "CSR email address")
+		flCSR   = fs.String("csr", "push.csr", "path to write PEM CSR")
+		flReq   = fs.String("out", "push.req", "path to write vendor-signed push cert request (if returned)")
+	)
+	fs.Parse(args)
+
+	form := url.Values{}
+	if *flCN != "" {
+		form.Set("cn", *flCN)
+	}
+	if *flEmail != "" {
+		form.Set("email", *flEmail)
+	}
+	b, err := c.do(http.MethodPost, "/v1/pushcert/csr", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		CSR             string `json:"csr"`
+		PublicKeyHash   string `json:"public_key_hash"`
+		PushCertRequest string `json:"push_cert_request"`
+	}
+	if err = json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	if err = os.WriteFile(*flCSR, []byte(resp.CSR), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote CSR to %s (public key hash %s)\n", *flCSR, resp.PublicKeyHash)
+	if resp.PushCertRequest == "" {
+		fmt.Println("no vendor-signed request returned: sign the CSR with an MDM vendor certificate")
+		return nil
+	}
+	if err = os.WriteFile(*flReq, []byte(resp.PushCertRequest), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote push cert request to %s: upload it to https://identity.apple.com/pushcert/\n", *flReq)
+	return nil
+}
+
+func (c *client) upload(args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	var (
+		flCert = fs.String("cert", "", "path to Apple-issued PEM push cert")
+		flKey  = fs.String("private-key", "", "path to PEM private key (if not held by the server)")
+	)
+	fs.Parse(args)
+
+	if *flCert == "" {
+		return errors.New("must supply push cert path")
+	}
+	body, err := os.ReadFile(*flCert)
+	if err != nil {
+		return err
+	}
+	if *flKey != "" {
+		key, err := os.ReadFile(*flKey)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, '\n'), key...)
+	}
+	b, err := c.do(http.MethodPut, "/v1/pushcert", "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bytes.TrimSpace(b)))
+	return nil
+}
+
+func sign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	var (
+		flCSR        = fs.String("csr", "push.csr", "path to PEM or DER CSR")
+		flVendorCert = fs.String("vendor-cert", "", "path to PEM MDM vendor cert (and Apple chain)")
+		flVendorKey  = fs.String("vendor-key", "", "path to PEM MDM vendor private key")
+		flReq        = fs.String("out", "push.req", "path to write vendor-signed push cert request")
+	)
+	fs.Parse(args)
+
+	if *flVendorCert == "" || *flVendorKey == "" {
+		return errors.New("must supply vendor cert and key paths")
+	}
+	certPEM, err := os.ReadFile(*flVendorCert)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(*flVendorKey)
+	if err != nil {
+		return err
+	}
+	signer, err := pushcsr.NewVendorSigner(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	csrBytes, err := os.ReadFile(*flCSR)
+	if err != nil {
+		return err
+	}
+	csr, _, err := pushcsr.DecodeCSR(csrBytes)
+	if err != nil {
+		return err
+	}
+	req, err := signer.Sign(csr)
+	if err != nil {
+		return err
+	}
+	b, err := req.Encode()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(*flReq, b, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote push cert request to %s: upload it to https://identity.apple.com/pushcert/\n", *flReq)
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package cmdtemplate renders MDM command templates.
+//
+// A template is a command plist containing {{name}} variable
+// placeholders. Placeholders are replaced by XML-escaped variable
+// values and so may be used anywhere in the plist that text may
+// appear, such as <string> or <integer> element content. Each
+// rendered command is given a freshly generated CommandUUID.
+package cmdtemplate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/plist"
+)
+
+// Built-in variable names.
+// Their values are provided when rendering and can not be set by callers.
+const (
+	VarCommandUUID   = "command_uuid"
+	VarEnrollmentID  = "enrollment_id"
+	VarUDID          = "udid"
+	VarSerialNumber  = "serial_number"
+	VarUserID        = "user_id"
+	VarUserShortName = "user_short_name"
+	VarUserLongName  = "user_long_name"
+)
+
+var builtins = map[string]struct{}{
+	VarCommandUUID:   {},
+	VarEnrollmentID:  {},
+	VarUDID:          {},
+	VarSerialNumber:  {},
+	VarUserID:        {},
+	VarUserShortName: {},
+	VarUserLongName:  {},
+}
+
+// IsBuiltin reports whether name is a built-in variable name.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.:-]+)\s*\}\}`)
+
+// Template is a parsed command template.
+type Template struct {
+	body  []byte
+	names []string
+}
+
+// Parse parses and validates the command template body.
+// The body must be a plist dictionary once placeholders are replaced.
+func Parse(body []byte) (*Template, error) {
+	if len(body) < 1 {
+		return nil, errors.New("empty template")
+	}
+	t := &Template{body: body}
+	seen := make(map[string]struct{})
+	for _, m := range placeholderRe.FindAllSubmatch(body, -1) {
+		name := string(m[1])
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			t.names = append(t.names, name)
+		}
+	}
+	sort.Strings(t.names)
+
+	// replace placeholders with a value that is valid for both
+	// string and integer elements to check the plist structure
+	check := placeholderRe.ReplaceAll(body, []byte("0"))
+	var dict map[string]interface{}
+	if err := plist.Unmarshal(check, &dict); err != nil {
+		return nil, fmt.Errorf("decoding template plist: %w", err)
+	}
+	if dict == nil {
+		return nil, errors.New("template is not a plist dictionary")
+	}
+	return t, nil
+}
+
+// Placeholders returns the sorted, unique variable names used in t.
+func (t *Template) Placeholders() []string {
+	return append([]string(nil), t.names...)
+}
+
+// Render substitutes vars into t and returns the resulting command
+// with a newly generated CommandUUID. The CommandUUID is also
+// available to the template as the "command_uuid" variable.
+// Every placeholder in t must have a value in vars.
+func (t *Template) Render(vars map[string]string) (*mdm.Command, error) {
+	cmdUUID, err := mdm.NewCommandUUID()
+	if err != nil {
+		return nil, fmt.Errorf("generating command uuid: %w", err)
+	}
+	for _, name := range t.names {
+		if name == VarCommandUUID {
+			continue
+		}
+		if _, ok := vars[name]; !ok {
+			return nil, fmt.Errorf("missing value for variable %q", name)
+		}
+	}
+
+	rendered := placeholderRe.ReplaceAllFunc(t.body, func(m []byte) []byte {
+		name := string(placeholderRe.FindSubmatch(m)[1])
+		value := vars[name]
+		if name == VarCommandUUID {
+			value = cmdUUID
+		}
+		var buf bytes.Buffer
+		// writes to a bytes.Buffer do not fail
+		_ = xml.EscapeText(&buf, []byte(value))
+		return buf.Bytes()
+	})
+
+	var dict map[string]interface{}
+	if err = plist.Unmarshal(rendered, &dict); err != nil {
+		return nil, fmt.Errorf("decoding rendered plist: %w", err)
+	}
+	if dict == nil {
+		return nil, errors.New("rendered template is not a plist dictionary")
+	}
+	dict["CommandUUID"] = cmdUUID
+	rawCommand, err := plist.MarshalIndent(dict, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encoding command plist: %w", err)
+	}
+	return mdm.DecodeCommand(rawCommand)
+}
+
+// EnrollmentVars returns the built-in variables for enrollment id
+// from its stored attributes. attrs may be nil.
+func EnrollmentVars(id string, attrs *storage.EnrollmentAttributes) map[string]string {
+	vars := map[string]string{VarEnrollmentID: id}
+	if attrs == nil {
+		return vars
+	}
+	udid := attrs.UDID
+	if udid == "" {
+		udid = attrs.EnrollmentID
+	}
+	userID := attrs.UserID
+	if userID == "" {
+		userID = attrs.EnrollmentUserID
+	}
+	for k, v := range map[string]string{
+		VarUDID:          udid,
+		VarSerialNumber:  attrs.SerialNumber,
+		VarUserID:        userID,
+		VarUserShortName: attrs.UserShortName,
+		VarUserLongName:  attrs.UserLongName,
+	} {
+		if v != "" {
+			vars[k] = v
+		}
+	}
+	return vars
+}
@@ -0,0 +1,125 @@
+package cmdtemplate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/plist"
+)
+
+const testTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Command</key>
+	<dict>
+		<key>RequestType</key>
+		<string>Settings</string>
+		<key>Settings</key>
+		<array>
+			<dict>
+				<key>Item</key>
+				<string>DeviceName</string>
+				<key>DeviceName</key>
+				<string>{{ prefix }}-{{serial_number}}</string>
+			</dict>
+			<dict>
+				<key>Item</key>
+				<string>MaximumResidentUsers</string>
+				<key>MaximumResidentUsers</key>
+				<integer>{{max_users}}</integer>
+			</dict>
+		</array>
+	</dict>
+	<key>CommandUUID</key>
+	<string>{{command_uuid}}</string>
+</dict>
+</plist>`
+
+type settings struct {
+	Command struct {
+		Settings []struct {
+			Item                 string
+			DeviceName           string
+			MaximumResidentUsers int
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse([]byte(testTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := tmpl.Placeholders(), []string{"command_uuid", "max_users", "prefix", "serial_number"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("placeholders: have: %v, want: %v", have, want)
+	}
+
+	vars := EnrollmentVars("AAAA-1111", &storage.EnrollmentAttributes{
+		Enrollment:   mdm.Enrollment{UDID: "AAAA-1111"},
+		SerialNumber: "C02ABC",
+	})
+	vars["prefix"] = "<lab & co>"
+	vars["max_users"] = "4"
+
+	cmd1, err := tmpl.Render(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd2, err := tmpl.Render(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd1.CommandUUID == "" || cmd1.CommandUUID == "{{command_uuid}}" {
+		t.Errorf("invalid command uuid: %q", cmd1.CommandUUID)
+	}
+	if cmd1.CommandUUID == cmd2.CommandUUID {
+		t.Error("rendered commands share a command uuid")
+	}
+	if have, want := cmd1.Command.RequestType, "Settings"; have != want {
+		t.Errorf("request type: have: %q, want: %q", have, want)
+	}
+
+	var s settings
+	if err = plist.Unmarshal(cmd1.Raw, &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Command.Settings) != 2 {
+		t.Fatalf("settings count: have: %d, want: 2", len(s.Command.Settings))
+	}
+	if have, want := s.Command.Settings[0].DeviceName, "<lab & co>-C02ABC"; have != want {
+		t.Errorf("device name: have: %q, want: %q", have, want)
+	}
+	if have, want := s.Command.Settings[1].MaximumResidentUsers, 4; have != want {
+		t.Errorf("max users: have: %d, want: %d", have, want)
+	}
+}
+
+func TestRenderMissingVar(t *testing.T) {
+	tmpl, err := Parse([]byte(testTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Render(map[string]string{"prefix": "lab", "max_users": "1"})
+	if err == nil || !strings.Contains(err.Error(), "serial_number") {
+		t.Errorf("expected missing serial_number error, got: %v", err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"not a plist",
+		`<plist version="1.0"><array><string>{{x}}</string></array></plist>`,
+	} {
+		if _, err := Parse([]byte(body)); err == nil {
+			t.Errorf("expected error parsing %q", body)
+		}
+	}
+}
@@ -2,9 +2,12 @@
 package cryptoutil
 
 import (
+	"crypto"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -82,3 +85,15 @@ func DecodePEMCertificate(pemData []byte) (*x509.Certificate, error) {
 	}
 	return x509.ParseCertificate(block.Bytes)
 }
+
+// PublicKeyHash returns the hex-encoded SHA-256 digest of the PKIX
+// (SubjectPublicKeyInfo) DER encoding of pub. It can be used to find
+// the private key matching a certificate.
+func PublicKeyHash(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,168 @@
+// Package digestauth implements HTTP Digest authentication challenges
+// and responses as used by the MDM UserAuthenticate check-in message.
+// See https://www.rfc-editor.org/rfc/rfc2617
+package digestauth
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Credentials looks up the credentials of users.
+type Credentials interface {
+	// HA1 returns the hex-encoded MD5 hash of "username:realm:password"
+	// for username in realm. An empty string and no error should be
+	// returned for unknown users.
+	HA1(ctx context.Context, realm, username string) (string, error)
+}
+
+// HA1 returns the hex-encoded MD5 hash of "username:realm:password".
+func HA1(username, realm, password string) string {
+	return md5Hex(username + ":" + realm + ":" + password)
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// NewNonce returns a new random hex-encoded nonce.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Challenge is a Digest challenge.
+// It is the value of an HTTP WWW-Authenticate header.
+type Challenge struct {
+	Realm string
+	Nonce string
+}
+
+// String returns the challenge header value.
+// The challenge always offers the "auth" qop with the MD5 algorithm.
+func (c *Challenge) String() string {
+	return fmt.Sprintf(`Digest realm=%s, qop="auth", nonce=%s, algorithm=MD5`, quote(c.Realm), quote(c.Nonce))
+}
+
+// quote returns s as a quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Response is a Digest response.
+// It is the value of an HTTP Authorization header.
+type Response struct {
+	Username  string
+	Realm     string
+	Nonce     string
+	URI       string
+	Response  string
+	Algorithm string
+	QOP       string
+	NC        string
+	CNonce    string
+	Opaque    string
+}
+
+// ParseResponse parses the Digest response header value s.
+// The "Digest" scheme prefix is optional.
+func ParseResponse(s string) (*Response, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 7 && strings.EqualFold(s[:7], "digest ") {
+		s = s[7:]
+	}
+	params, err := parseParams(s)
+	if err != nil {
+		return nil, err
+	}
+	r := &Response{
+		Username:  params["username"],
+		Realm:     params["realm"],
+		Nonce:     params["nonce"],
+		URI:       params["uri"],
+		Response:  params["response"],
+		Algorithm: params["algorithm"],
+		QOP:       params["qop"],
+		NC:        params["nc"],
+		CNonce:    params["cnonce"],
+		Opaque:    params["opaque"],
+	}
+	if r.Username == "" || r.Nonce == "" || r.Response == "" {
+		return nil, errors.New("missing username, nonce, or response")
+	}
+	return r, nil
+}
+
+// parseParams parses the comma-separated key=value parameters of s.
+// Values may be quoted strings. Keys are lower-cased.
+func parseParams(s string) (map[string]string, error) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t\r\n,")
+		if s == "" {
+			return params, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 1 {
+			return nil, fmt.Errorf("invalid parameter: %q", s)
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t\r\n")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for %s", key)
+			}
+			value, s = b.String(), s[i+1:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		params[key] = value
+	}
+}
+
+// Verify reports whether r is a valid response for method given the
+// HA1 of the user (see [HA1]). Only the MD5 and MD5-sess algorithms and
+// the "auth" qop (or no qop) are supported.
+func (r *Response) Verify(method, ha1 string) bool {
+	switch strings.ToLower(r.Algorithm) {
+	case "", "md5":
+	case "md5-sess":
+		ha1 = md5Hex(ha1 + ":" + r.Nonce + ":" + r.CNonce)
+	default:
+		return false
+	}
+	ha2 := md5Hex(method + ":" + r.URI)
+	var expected string
+	switch r.QOP {
+	case "":
+		expected = md5Hex(ha1 + ":" + r.Nonce + ":" + ha2)
+	case "auth":
+		expected = md5Hex(ha1 + ":" + r.Nonce + ":" + r.NC + ":" + r.CNonce + ":" + r.QOP + ":" + ha2)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(r.Response))) == 1
+}
@@ -0,0 +1,81 @@
+package digestauth
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// rfc2617Response is the example response of RFC 2617 section 3.5.
+const rfc2617Response = `Digest username="Mufasa",
+	realm="testrealm@host.com",
+	nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093",
+	uri="/dir/index.html",
+	qop=auth,
+	nc=00000001,
+	cnonce="0a4f113b",
+	response="6629fae49393a05397450978507c4ef1",
+	opaque="5ccc069c403ebaf9f0171e9517f40e41"`
+
+func TestVerify(t *testing.T) {
+	r, err := ParseResponse(rfc2617Response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := r.Username, "Mufasa"; have != want {
+		t.Errorf("username: have: %v, want: %v", have, want)
+	}
+	if have, want := r.NC, "00000001"; have != want {
+		t.Errorf("nc: have: %v, want: %v", have, want)
+	}
+
+	ha1 := HA1("Mufasa", "testrealm@host.com", "Circle Of Life")
+	if !r.Verify("GET", ha1) {
+		t.Error("expected valid response")
+	}
+	if r.Verify("GET", HA1("Mufasa", "testrealm@host.com", "wrong")) {
+		t.Error("expected invalid response with wrong password")
+	}
+	if r.Verify("PUT", ha1) {
+		t.Error("expected invalid response with wrong method")
+	}
+
+	if _, err = ParseResponse(`Digest username="Mufasa", nonce="abc`); err == nil {
+		t.Error("expected error for unterminated quoted value")
+	}
+	if _, err = ParseResponse(`Digest realm="x"`); err == nil {
+		t.Error("expected error for missing parameters")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	c := &Challenge{Realm: `a "realm"`, Nonce: "abc"}
+	if have, want := c.String(), `Digest realm="a \"realm\"", qop="auth", nonce="abc", algorithm=MD5`; have != want {
+		t.Errorf("challenge: have: %v, want: %v", have, want)
+	}
+	params, err := parseParams(strings.TrimPrefix(c.String(), "Digest "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := params["realm"], `a "realm"`; have != want {
+		t.Errorf("realm: have: %v, want: %v", have, want)
+	}
+}
+
+func TestHTDigest(t *testing.T) {
+	ha1 := HA1("alice", "NanoMDM", "secret")
+	h, err := NewHTDigest(strings.NewReader("# users\n\nalice:NanoMDM:" + ha1 + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if have, _ := h.HA1(ctx, "NanoMDM", "alice"); have != ha1 {
+		t.Errorf("ha1: have: %v, want: %v", have, ha1)
+	}
+	if have, _ := h.HA1(ctx, "Other", "alice"); have != "" {
+		t.Errorf("expected no ha1 for other realm: %v", have)
+	}
+	if _, err = NewHTDigest(strings.NewReader("alice:NanoMDM\n")); err == nil {
+		t.Error("expected error for invalid line")
+	}
+}
@@ -0,0 +1,50 @@
+package digestauth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HTDigest holds static credentials in the format of an Apache htdigest
+// file. Each line is "username:realm:ha1". Empty lines and lines
+// starting with "#" are ignored.
+type HTDigest struct {
+	ha1s map[string]string
+}
+
+// NewHTDigest reads htdigest credentials from r.
+func NewHTDigest(r io.Reader) (*HTDigest, error) {
+	h := &HTDigest{ha1s: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) != 3 || parts[0] == "" || len(parts[2]) != 32 {
+			return nil, fmt.Errorf("invalid htdigest line %d", n)
+		}
+		h.ha1s[parts[1]+":"+parts[0]] = strings.ToLower(parts[2])
+	}
+	return h, scanner.Err()
+}
+
+// LoadHTDigest reads htdigest credentials from the file at path.
+func LoadHTDigest(path string) (*HTDigest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewHTDigest(f)
+}
+
+// HA1 returns the HA1 of username in realm.
+func (h *HTDigest) HA1(_ context.Context, realm, username string) (string, error) {
+	return h.ha1s[realm+":"+username], nil
+}
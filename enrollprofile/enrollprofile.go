@@ -0,0 +1,297 @@
+// Package enrollprofile generates MDM enrollment profiles.
+//
+// The generated profile contains an identity payload (SCEP, ACME, or
+// PKCS#12) and an MDM payload which uses the identity to authenticate
+// to the MDM server.
+package enrollprofile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/plist"
+)
+
+const (
+	// AllAccessRights is the combination of all MDM access rights.
+	AllAccessRights = 8191
+
+	DefaultPayloadIdentifier  = "com.github.micromdm.nanomdm"
+	DefaultPayloadDisplayName = "Enrollment Profile"
+)
+
+// DefaultServerCapabilities are the MDM server capabilities supported
+// by NanoMDM.
+var DefaultServerCapabilities = []string{
+	"com.apple.mdm.per-user-connections",
+	"com.apple.mdm.bootstraptoken",
+	"com.apple.mdm.token",
+}
+
+// SCEP configures a SCEP identity payload.
+type SCEP struct {
+	URL       string       `json:"url"`
+	Name      string       `json:"name,omitempty"`
+	Challenge string       `json:"challenge,omitempty"`
+	Subject   [][][]string `json:"subject,omitempty"`
+	KeyType   string       `json:"key_type,omitempty"`  // defaults to "RSA"
+	KeySize   int          `json:"key_size,omitempty"`  // defaults to 2048
+	KeyUsage  int          `json:"key_usage,omitempty"` // defaults to 5 (signing and encryption)
+}
+
+// ACME configures an ACME identity payload.
+type ACME struct {
+	DirectoryURL     string       `json:"directory_url"`
+	ClientIdentifier string       `json:"client_identifier"`
+	Subject          [][][]string `json:"subject,omitempty"`
+	KeyType          string       `json:"key_type,omitempty"` // defaults to "ECSECPrimeRandom"
+	KeySize          int          `json:"key_size,omitempty"` // defaults to 384
+	HardwareBound    bool         `json:"hardware_bound,omitempty"`
+	Attest           bool         `json:"attest,omitempty"`
+}
+
+// PKCS12 configures a PKCS#12 identity payload.
+// If Data is empty the payload is a placeholder to be filled in later.
+type PKCS12 struct {
+	Data     []byte `json:"data,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Config configures the generated enrollment profile.
+// At most one identity payload option may be set. If none are set
+// an empty PKCS#12 placeholder payload is used.
+// The APNs Topic is required to generate a profile but the handler
+// (see [NewHandler]) uses the topic of the stored push certificate
+// if it is empty.
+type Config struct {
+	ServerURL  string `json:"server_url"`
+	CheckInURL string `json:"check_in_url,omitempty"`
+	Topic      string `json:"topic,omitempty"`
+
+	AccessRights        int      `json:"access_rights,omitempty"` // defaults to AllAccessRights
+	SignMessage         bool     `json:"sign_message,omitempty"`
+	CheckOutWhenRemoved bool     `json:"check_out_when_removed,omitempty"`
+	ServerCapabilities  []string `json:"server_capabilities,omitempty"` // defaults to DefaultServerCapabilities
+
+	PayloadIdentifier   string `json:"payload_identifier,omitempty"`   // defaults to DefaultPayloadIdentifier
+	PayloadDisplayName  string `json:"payload_display_name,omitempty"` // defaults to DefaultPayloadDisplayName
+	PayloadOrganization string `json:"payload_organization,omitempty"`
+
+	SCEP   *SCEP   `json:"scep,omitempty"`
+	ACME   *ACME   `json:"acme,omitempty"`
+	PKCS12 *PKCS12 `json:"pkcs12,omitempty"`
+}
+
+// Validate checks c for required and conflicting options.
+func (c *Config) Validate() error {
+	if c == nil {
+		return errors.New("nil config")
+	}
+	if c.ServerURL == "" {
+		return errors.New("empty server URL")
+	}
+	if c.AccessRights < 0 || c.AccessRights > AllAccessRights {
+		return fmt.Errorf("invalid access rights: %d", c.AccessRights)
+	}
+	var n int
+	if c.SCEP != nil {
+		if c.SCEP.URL == "" {
+			return errors.New("empty SCEP URL")
+		}
+		n++
+	}
+	if c.ACME != nil {
+		if c.ACME.DirectoryURL == "" || c.ACME.ClientIdentifier == "" {
+			return errors.New("empty ACME directory URL or client identifier")
+		}
+		n++
+	}
+	if c.PKCS12 != nil {
+		n++
+	}
+	if n > 1 {
+		return errors.New("multiple identity payloads configured")
+	}
+	return nil
+}
+
+// payload contains the common keys of profile payloads.
+type payload struct {
+	PayloadDisplayName  string `plist:",omitempty"`
+	PayloadIdentifier   string
+	PayloadOrganization string `plist:",omitempty"`
+	PayloadType         string
+	PayloadUUID         string
+	PayloadVersion      int
+}
+
+type scepPayload struct {
+	payload
+	PayloadContent scepContent
+}
+
+type scepContent struct {
+	URL       string
+	Name      string       `plist:",omitempty"`
+	Challenge string       `plist:",omitempty"`
+	Subject   [][][]string `plist:",omitempty"`
+	KeyType   string       `plist:"Key Type"`
+	KeySize   int          `plist:"Keysize"`
+	KeyUsage  int          `plist:"Key Usage"`
+}
+
+type acmePayload struct {
+	payload
+	DirectoryURL     string
+	ClientIdentifier string
+	Subject          [][][]string `plist:",omitempty"`
+	KeyType          string
+	KeySize          int
+	HardwareBound    bool
+	Attest           bool
+}
+
+type pkcs12Payload struct {
+	payload
+	PayloadContent []byte
+	Password       string `plist:",omitempty"`
+}
+
+type mdmPayload struct {
+	payload
+	AccessRights            int
+	CheckInURL              string `plist:",omitempty"`
+	CheckOutWhenRemoved     bool
+	IdentityCertificateUUID string
+	ServerCapabilities      []string
+	ServerURL               string
+	SignMessage             bool
+	Topic                   string
+}
+
+type profile struct {
+	payload
+	PayloadContent []interface{}
+}
+
+// Generate generates an unsigned enrollment profile plist from c.
+// New payload UUIDs are generated each time.
+func Generate(c *Config) ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Topic == "" {
+		return nil, errors.New("empty topic")
+	}
+
+	ident := c.PayloadIdentifier
+	if ident == "" {
+		ident = DefaultPayloadIdentifier
+	}
+	newPayload := func(suffix, payloadType string) (payload, error) {
+		uuid, err := mdm.NewCommandUUID()
+		uuid = strings.ToUpper(uuid)
+		p := payload{
+			PayloadIdentifier:   ident,
+			PayloadOrganization: c.PayloadOrganization,
+			PayloadType:         payloadType,
+			PayloadUUID:         uuid,
+			PayloadVersion:      1,
+		}
+		if suffix != "" {
+			p.PayloadIdentifier += "." + suffix
+		}
+		return p, err
+	}
+
+	var identity interface{}
+	var identityUUID string
+	switch {
+	case c.SCEP != nil:
+		p, err := newPayload("scep", "com.apple.security.scep")
+		if err != nil {
+			return nil, err
+		}
+		identity, identityUUID = scepPayload{
+			payload: p,
+			PayloadContent: scepContent{
+				URL:       c.SCEP.URL,
+				Name:      c.SCEP.Name,
+				Challenge: c.SCEP.Challenge,
+				Subject:   c.SCEP.Subject,
+				KeyType:   withDefault(c.SCEP.KeyType, "RSA"),
+				KeySize:   withDefault(c.SCEP.KeySize, 2048),
+				KeyUsage:  withDefault(c.SCEP.KeyUsage, 5),
+			},
+		}, p.PayloadUUID
+	case c.ACME != nil:
+		p, err := newPayload("acme", "com.apple.security.acme")
+		if err != nil {
+			return nil, err
+		}
+		identity, identityUUID = acmePayload{
+			payload:          p,
+			DirectoryURL:     c.ACME.DirectoryURL,
+			ClientIdentifier: c.ACME.ClientIdentifier,
+			Subject:          c.ACME.Subject,
+			KeyType:          withDefault(c.ACME.KeyType, "ECSECPrimeRandom"),
+			KeySize:          withDefault(c.ACME.KeySize, 384),
+			HardwareBound:    c.ACME.HardwareBound,
+			Attest:           c.ACME.Attest,
+		}, p.PayloadUUID
+	default:
+		p, err := newPayload("pkcs12", "com.apple.security.pkcs12")
+		if err != nil {
+			return nil, err
+		}
+		pkcs12 := pkcs12Payload{payload: p, PayloadContent: []byte{}}
+		if c.PKCS12 != nil {
+			if len(c.PKCS12.Data) > 0 {
+				pkcs12.PayloadContent = c.PKCS12.Data
+			}
+			pkcs12.Password = c.PKCS12.Password
+		}
+		identity, identityUUID = pkcs12, p.PayloadUUID
+	}
+
+	p, err := newPayload("mdm", "com.apple.mdm")
+	if err != nil {
+		return nil, err
+	}
+	mdmP := mdmPayload{
+		payload:                 p,
+		AccessRights:            withDefault(c.AccessRights, AllAccessRights),
+		CheckInURL:              c.CheckInURL,
+		CheckOutWhenRemoved:     c.CheckOutWhenRemoved,
+		IdentityCertificateUUID: identityUUID,
+		ServerCapabilities:      c.ServerCapabilities,
+		ServerURL:               c.ServerURL,
+		SignMessage:             c.SignMessage,
+		Topic:                   c.Topic,
+	}
+	if mdmP.ServerCapabilities == nil {
+		mdmP.ServerCapabilities = DefaultServerCapabilities
+	}
+
+	p, err = newPayload("", "Configuration")
+	if err != nil {
+		return nil, err
+	}
+	p.PayloadDisplayName = withDefault(c.PayloadDisplayName, DefaultPayloadDisplayName)
+	return plist.MarshalIndent(profile{
+		payload:        p,
+		PayloadContent: []interface{}{identity, mdmP},
+	}, "\t")
+}
+
+// withDefault returns def if v is the zero value.
+func withDefault[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
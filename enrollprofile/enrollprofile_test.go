@@ -0,0 +1,108 @@
+package enrollprofile
+
+import (
+	"testing"
+
+	"github.com/micromdm/plist"
+)
+
+func decodeProfile(t *testing.T, b []byte) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	var profile map[string]interface{}
+	if err := plist.Unmarshal(b, &profile); err != nil {
+		t.Fatal(err)
+	}
+	content, ok := profile["PayloadContent"].([]interface{})
+	if !ok || len(content) != 2 {
+		t.Fatalf("invalid payload content: %v", profile["PayloadContent"])
+	}
+	identity, _ := content[0].(map[string]interface{})
+	mdm, _ := content[1].(map[string]interface{})
+	if identity == nil || mdm == nil {
+		t.Fatal("invalid payloads")
+	}
+	if have, want := mdm["IdentityCertificateUUID"], identity["PayloadUUID"]; have != want {
+		t.Errorf("identity certificate UUID: have: %v, want: %v", have, want)
+	}
+	return identity, mdm
+}
+
+func TestGenerateSCEP(t *testing.T) {
+	c := &Config{
+		ServerURL:   "https://mdm.example.org/mdm",
+		CheckInURL:  "https://mdm.example.org/checkin",
+		Topic:       "com.apple.mgmt.External.test",
+		SignMessage: true,
+		SCEP: &SCEP{
+			URL:       "https://mdm.example.org/scep",
+			Challenge: "secret",
+		},
+	}
+	b, err := Generate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, mdm := decodeProfile(t, b)
+
+	if have, want := identity["PayloadType"], "com.apple.security.scep"; have != want {
+		t.Errorf("identity payload type: have: %v, want: %v", have, want)
+	}
+	scep, _ := identity["PayloadContent"].(map[string]interface{})
+	if have, want := scep["Challenge"], "secret"; have != want {
+		t.Errorf("challenge: have: %v, want: %v", have, want)
+	}
+	if have, want := scep["Key Type"], "RSA"; have != want {
+		t.Errorf("key type: have: %v, want: %v", have, want)
+	}
+
+	for k, want := range map[string]interface{}{
+		"ServerURL":    c.ServerURL,
+		"CheckInURL":   c.CheckInURL,
+		"Topic":        c.Topic,
+		"SignMessage":  true,
+		"AccessRights": uint64(AllAccessRights),
+	} {
+		if have := mdm[k]; have != want {
+			t.Errorf("%s: have: %v (%T), want: %v", k, have, have, want)
+		}
+	}
+}
+
+func TestGeneratePKCS12Placeholder(t *testing.T) {
+	b, err := Generate(&Config{ServerURL: "https://mdm.example.org/mdm", Topic: "com.apple.mgmt.External.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, mdm := decodeProfile(t, b)
+	if have, want := identity["PayloadType"], "com.apple.security.pkcs12"; have != want {
+		t.Errorf("identity payload type: have: %v, want: %v", have, want)
+	}
+	if _, ok := mdm["CheckInURL"]; ok {
+		t.Error("unexpected CheckInURL")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []*Config{
+		nil,
+		{Topic: "topic"},
+		{ServerURL: "https://mdm.example.org/mdm", Topic: "topic", AccessRights: 8192},
+		{ServerURL: "https://mdm.example.org/mdm", Topic: "topic", SCEP: &SCEP{}},
+		{ServerURL: "https://mdm.example.org/mdm", Topic: "topic", ACME: &ACME{DirectoryURL: "https://acme.example.org"}},
+		{ServerURL: "https://mdm.example.org/mdm", Topic: "topic", SCEP: &SCEP{URL: "https://x"}, PKCS12: &PKCS12{}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for config: %+v", c)
+		}
+	}
+}
+
+func TestGenerateEmptyTopic(t *testing.T) {
+	c := &Config{ServerURL: "https://mdm.example.org/mdm"}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(c); err == nil {
+		t.Error("expected error for empty topic")
+	}
+}
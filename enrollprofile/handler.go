@@ -0,0 +1,202 @@
+package enrollprofile
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// ContentType is the MIME type of (signed or unsigned) profiles.
+	ContentType = "application/x-apple-aspen-config"
+
+	// TokenParameter is the URL query parameter of enrollment tokens.
+	TokenParameter = "token"
+)
+
+// Signer signs configuration profiles.
+type Signer interface {
+	Sign(profile []byte) ([]byte, error)
+}
+
+// PushCertStore retrieves push certificates and lists their topics.
+type PushCertStore interface {
+	storage.PushCertStore
+	storage.PushCertTopicLister
+}
+
+// TokenUser uses one-time enrollment tokens.
+type TokenUser interface {
+	UseEnrollmentToken(ctx context.Context, hash string) (*storage.EnrollmentToken, error)
+}
+
+// NewToken generates a new random enrollment token.
+// Only the hash of the token (see [HashToken]) should be stored.
+func NewToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of token.
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+type handler struct {
+	config    *Config
+	pushCerts PushCertStore
+	signer    Signer
+	tokens    TokenUser
+	logger    log.Logger
+}
+
+type Option func(*handler)
+
+// WithLogger sets a logger for error reporting.
+func WithLogger(logger log.Logger) Option {
+	return func(h *handler) {
+		h.logger = logger
+	}
+}
+
+// WithSigner signs the served profiles with signer.
+func WithSigner(signer Signer) Option {
+	return func(h *handler) {
+		h.signer = signer
+	}
+}
+
+// WithTokens requires a valid one-time enrollment token in the
+// [TokenParameter] URL query parameter to serve the profile.
+func WithTokens(tokens TokenUser) Option {
+	return func(h *handler) {
+		h.tokens = tokens
+	}
+}
+
+// NewHandler creates an HTTP handler that generates and serves
+// enrollment profiles from c for GET requests. A push certificate for
+// the topic of c must be stored in pushCerts to serve profiles. If c
+// has no topic then exactly one push certificate must be stored and
+// its topic is used.
+func NewHandler(c *Config, pushCerts PushCertStore, opts ...Option) (http.Handler, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if pushCerts == nil {
+		return nil, errors.New("nil push cert store")
+	}
+	h := &handler{
+		config:    c,
+		pushCerts: pushCerts,
+		logger:    log.NopLogger,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := ctxlog.Logger(r.Context(), h.logger)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.tokens != nil {
+		token := r.URL.Query().Get(TokenParameter)
+		if token == "" {
+			logger.Info("msg", "missing enrollment token")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		t, err := h.tokens.UseEnrollmentToken(r.Context(), HashToken(token))
+		if err != nil {
+			logger.Info("msg", "using enrollment token", "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if t == nil {
+			logger.Info("msg", "invalid, used, or expired enrollment token")
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		logger = logger.With("label", t.Label)
+	}
+
+	config := *h.config
+	if config.Topic == "" {
+		topic, err := h.storedTopic(r.Context())
+		if err != nil {
+			logger.Info("msg", "finding push cert topic", "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		config.Topic = topic
+	}
+
+	// make sure we actually have a push cert for the topic
+	cert, _, err := h.pushCerts.RetrievePushCert(r.Context(), config.Topic)
+	if err != nil {
+		logger.Info("msg", "retrieving push cert", "topic", config.Topic, "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if cert == nil {
+		logger.Info("msg", "no push cert", "topic", config.Topic)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := Generate(&config)
+	if err != nil {
+		logger.Info("msg", "generating enrollment profile", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if h.signer != nil {
+		if profile, err = h.signer.Sign(profile); err != nil {
+			logger.Info("msg", "signing enrollment profile", "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	logger.Debug("msg", "serving enrollment profile", "signed", h.signer != nil)
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="enroll.mobileconfig"`)
+	if _, err = w.Write(profile); err != nil {
+		logger.Info("msg", "writing body", "err", err)
+	}
+}
+
+// storedTopic returns the topic of the only stored push certificate.
+func (h *handler) storedTopic(ctx context.Context) (string, error) {
+	topics, err := h.pushCerts.ListPushCertTopics(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch len(topics) {
+	case 0:
+		return "", errors.New("no push certs stored")
+	case 1:
+		return topics[0], nil
+	default:
+		return "", fmt.Errorf("multiple push certs stored, configure a topic: %s", strings.Join(topics, ", "))
+	}
+}
@@ -0,0 +1,273 @@
+// Package eventstream buffers NanoMDM webhook events for streaming to
+// API consumers.
+//
+// A [Broker] is a [webhook.Sender]. Use it with [webhook.NewWithSender]
+// to receive the same events (check-ins, command acknowledgements,
+// Declarative Management) that are sent to webhook URLs. Subscribers
+// receive events as they are sent. Recent events are kept in a bounded
+// in-memory ring buffer so that subscribers can resume after a given
+// event ID without missing events.
+package eventstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanomdm/service/webhook"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+const (
+	// DefaultBufferSize is the default number of recent events kept for resuming.
+	DefaultBufferSize = 1000
+
+	// subscriberBufferSize is the number of events queued for each
+	// subscriber before it is considered too slow and closed.
+	subscriberBufferSize = 64
+)
+
+// Event is a webhook event in the stream.
+type Event struct {
+	// ID uniquely identifies the event in the stream.
+	ID string
+
+	// Topic is the webhook event topic, such as "mdm.Authenticate".
+	Topic string
+
+	// EnrollmentID is the enrollment ID the event is for.
+	EnrollmentID string
+
+	// Data is the JSON-encoded webhook event.
+	Data []byte
+}
+
+// Filter selects events for a subscription.
+type Filter struct {
+	// Topics selects only events with these topics.
+	// An empty list selects all topics.
+	Topics []string
+
+	// EnrollmentIDs selects only events for these enrollment IDs.
+	// An empty list selects all enrollment IDs.
+	EnrollmentIDs []string
+
+	// Allow additionally selects only events it returns true for, if set.
+	Allow func(*Event) bool
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether e is selected by f.
+// A nil filter selects all events.
+func (f *Filter) Match(e *Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Topics) > 0 && !contains(f.Topics, e.Topic) {
+		return false
+	}
+	if len(f.EnrollmentIDs) > 0 && !contains(f.EnrollmentIDs, e.EnrollmentID) {
+		return false
+	}
+	if f.Allow != nil && !f.Allow(e) {
+		return false
+	}
+	return true
+}
+
+// Broker distributes webhook events to subscribers.
+type Broker struct {
+	logger log.Logger
+	size   int
+
+	// epoch differentiates event IDs of different brokers (such as
+	// after a restart) so that stale IDs are not resumed from.
+	epoch string
+
+	mu   sync.Mutex
+	seq  uint64
+	ring []*Event
+	subs map[*Subscription]struct{}
+}
+
+type Option func(*Broker)
+
+// WithLogger configures a logger.
+func WithLogger(logger log.Logger) Option {
+	return func(b *Broker) {
+		b.logger = logger
+	}
+}
+
+// WithBufferSize sets the number of recent events kept for resuming.
+// The default is [DefaultBufferSize].
+func WithBufferSize(n int) Option {
+	return func(b *Broker) {
+		if n < 1 {
+			n = 1
+		}
+		b.size = n
+	}
+}
+
+// New creates a new broker.
+func New(opts ...Option) *Broker {
+	b := &Broker{
+		logger: log.NopLogger,
+		size:   DefaultBufferSize,
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:   make(map[*Subscription]struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.ring = make([]*Event, b.size)
+	return b
+}
+
+// Subscription receives events from a broker.
+type Subscription struct {
+	// C receives the events of the subscription. It is closed when
+	// the subscription is closed. This includes when the subscriber
+	// fails to keep up with events in which case it should re-subscribe
+	// resuming from the last event it received.
+	C <-chan *Event
+
+	c      chan *Event
+	filter *Filter
+	b      *Broker
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.unsubscribe(s)
+}
+
+// unsubscribe removes s from b. The caller must hold the lock.
+func (b *Broker) unsubscribe(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
+
+// eventID returns the event ID of the event with sequence seq.
+func (b *Broker) eventID(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID returns the sequence of the event with id.
+// An error is returned if id is not an event ID of this broker.
+func (b *Broker) parseEventID(id string) (uint64, error) {
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return 0, errors.New("invalid event id")
+	}
+	if id[:i] != b.epoch {
+		return 0, errors.New("event id from another stream")
+	}
+	return strconv.ParseUint(id[i+1:], 10, 64)
+}
+
+// Subscribe subscribes to events selected by filter.
+//
+// If lastEventID is the ID of an event still held in the buffer then
+// any buffered events after it that are selected by filter are
+// returned. Otherwise the subscription starts with new events only.
+// Close the subscription when finished.
+func (b *Broker) Subscribe(lastEventID string, filter *Filter) ([]*Event, *Subscription) {
+	c := make(chan *Event, subscriberBufferSize)
+	s := &Subscription{C: c, c: c, filter: filter, b: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []*Event
+	if lastEventID != "" {
+		last, err := b.parseEventID(lastEventID)
+		if err != nil {
+			b.logger.Debug("msg", "not resuming event stream", "last_event_id", lastEventID, "err", err)
+		} else if last <= b.seq {
+			oldest := uint64(1)
+			if b.seq > uint64(b.size) {
+				oldest = b.seq - uint64(b.size) + 1
+			}
+			if last+1 < oldest {
+				b.logger.Debug("msg", "resuming event stream: events dropped", "last_event_id", lastEventID, "dropped", oldest-last-1)
+				last = oldest - 1
+			}
+			for seq := last + 1; seq <= b.seq; seq++ {
+				if e := b.ring[seq%uint64(b.size)]; filter.Match(e) {
+					backlog = append(backlog, e)
+				}
+			}
+		}
+	}
+
+	b.subs[s] = struct{}{}
+	return backlog, s
+}
+
+// enrollmentID returns the enrollment ID of ev.
+func enrollmentID(ev *webhook.EventJson) string {
+	switch {
+	case ev.CheckinEvent != nil && ev.CheckinEvent.Ids != nil:
+		return ev.CheckinEvent.Ids.Id
+	case ev.AcknowledgeEvent != nil && ev.AcknowledgeEvent.Ids != nil:
+		return ev.AcknowledgeEvent.Ids.Id
+	}
+	return ""
+}
+
+// SendEvent buffers ev and sends it to subscribers.
+// Subscribers that are not keeping up are closed.
+func (b *Broker) SendEvent(_ context.Context, ev *webhook.EventJson) error {
+	if ev == nil {
+		return errors.New("nil event")
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	e := &Event{
+		Topic:        string(ev.Topic),
+		EnrollmentID: enrollmentID(ev),
+		Data:         data,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.ID = b.eventID(b.seq)
+	b.ring[b.seq%uint64(b.size)] = e
+
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			b.logger.Info("msg", "closing slow event stream subscriber", "event_id", e.ID)
+			b.unsubscribe(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package eventstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micromdm/nanomdm/service/webhook"
+)
+
+func event(topic webhook.EventJsonTopic, id string) *webhook.EventJson {
+	return &webhook.EventJson{
+		Topic:        topic,
+		CheckinEvent: &webhook.CheckinEvent{Ids: &webhook.IDs{Id: id, Type: "Device"}},
+	}
+}
+
+func send(t *testing.T, b *Broker, topic webhook.EventJsonTopic, id string) {
+	t.Helper()
+	if err := b.SendEvent(context.Background(), event(topic, id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBroker(t *testing.T) {
+	b := New(WithBufferSize(3))
+
+	backlog, sub := b.Subscribe("", &Filter{EnrollmentIDs: []string{"AAAA"}})
+	defer sub.Close()
+	if len(backlog) != 0 {
+		t.Errorf("expected empty backlog, have: %d", len(backlog))
+	}
+
+	send(t, b, webhook.EventJsonTopicMdmAuthenticate, "AAAA")
+	send(t, b, webhook.EventJsonTopicMdmAuthenticate, "BBBB")
+	send(t, b, webhook.EventJsonTopicMdmTokenUpdate, "AAAA")
+
+	first := <-sub.C
+	if have, want := first.Topic, "mdm.Authenticate"; have != want {
+		t.Errorf("topic: have: %v, want: %v", have, want)
+	}
+	second := <-sub.C
+	if have, want := second.EnrollmentID, "AAAA"; have != want {
+		t.Errorf("enrollment id: have: %v, want: %v", have, want)
+	}
+	if have, want := second.Topic, "mdm.TokenUpdate"; have != want {
+		t.Errorf("topic: have: %v, want: %v", have, want)
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("unexpected event: %v", e.ID)
+	default:
+	}
+
+	// resume after the first event
+	backlog, sub2 := b.Subscribe(first.ID, nil)
+	sub2.Close()
+	if have, want := len(backlog), 2; have != want {
+		t.Fatalf("backlog: have: %v, want: %v", have, want)
+	}
+	if have, want := backlog[1].ID, second.ID; have != want {
+		t.Errorf("backlog event id: have: %v, want: %v", have, want)
+	}
+
+	// overflow the buffer: only the last 3 events are kept
+	send(t, b, webhook.EventJsonTopicMdmCheckOut, "AAAA")
+	send(t, b, webhook.EventJsonTopicMdmCheckOut, "BBBB")
+	backlog, sub2 = b.Subscribe(first.ID, &Filter{Topics: []string{"mdm.CheckOut"}})
+	sub2.Close()
+	if have, want := len(backlog), 2; have != want {
+		t.Errorf("backlog after overflow: have: %v, want: %v", have, want)
+	}
+
+	// unknown event IDs are not resumed from
+	for _, id := range []string{"bogus", "0-1", first.ID + "0"} {
+		backlog, sub2 = b.Subscribe(id, nil)
+		sub2.Close()
+		if len(backlog) != 0 {
+			t.Errorf("expected empty backlog for %q, have: %d", id, len(backlog))
+		}
+	}
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	b := New()
+	_, sub := b.Subscribe("", nil)
+	for i := 0; i <= subscriberBufferSize; i++ {
+		send(t, b, webhook.EventJsonTopicMdmConnect, "AAAA")
+	}
+	var n int
+	for range sub.C {
+		n++
+	}
+	if have, want := n, subscriberBufferSize; have != want {
+		t.Errorf("events before close: have: %v, want: %v", have, want)
+	}
+	// closing again is harmless
+	sub.Close()
+}
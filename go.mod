@@ -11,6 +11,7 @@ require (
 	github.com/peterbourgon/diskv/v3 v3.0.1
 	github.com/smallstep/pkcs7 v0.2.1
 	golang.org/x/net v0.34.0
+	software.sslmate.com/src/go-pkcs12 v0.4.0
 )
 
 require (
@@ -1,21 +1,32 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/push/pacer"
 	"github.com/micromdm/nanomdm/storage"
 
 	"github.com/micromdm/nanolib/log"
 	"github.com/micromdm/nanolib/log/ctxlog"
 )
 
+// jsonContentType is the media type of JSON request bodies.
+const jsonContentType = "application/json"
+
 // writeJSON encodes v to JSON writing to w using the HTTP status of header.
 // An error during encoding is logged to logger if it is not nil.
 func writeJSON(w http.ResponseWriter, v interface{}, header int, logger log.Logger) {
@@ -90,6 +101,60 @@ func PathIDGetter(r *http.Request) ([]string, error) {
 	return strings.Split(r.URL.Path, ","), nil
 }
 
+// paceFromRequest returns the push pace from the "pace_rate" (pushes
+// per second) or "pace_duration" (e.g. "10m") query parameters of r.
+// Nil is returned if neither are present.
+func paceFromRequest(r *http.Request) (*pacer.Pace, error) {
+	q := r.URL.Query()
+	rate, duration := q.Get("pace_rate"), q.Get("pace_duration")
+	if rate == "" && duration == "" {
+		return nil, nil
+	}
+	pace := new(pacer.Pace)
+	var err error
+	if rate != "" {
+		if pace.Rate, err = strconv.Atoi(rate); err != nil {
+			return nil, fmt.Errorf("parsing pace_rate: %w", err)
+		}
+	}
+	if duration != "" {
+		if pace.Duration, err = time.ParseDuration(duration); err != nil {
+			return nil, fmt.Errorf("parsing pace_duration: %w", err)
+		}
+	}
+	return pace, nil
+}
+
+// authorizeEnqueue checks that the API credential in ctx, if any, may
+// enqueue the raw command cmdBytes to ids.
+func authorizeEnqueue(ctx context.Context, ids []string, cmdBytes []byte) error {
+	if apiauth.FromContext(ctx) == nil {
+		return nil
+	}
+	if err := apiauth.AuthorizeEnrollmentIDs(ctx, ids); err != nil {
+		return err
+	}
+	cmd, err := mdm.DecodeCommand(cmdBytes)
+	if err != nil {
+		// enqueueing will reject the command with this same error
+		return nil
+	}
+	return apiauth.Authorize(ctx, apiauth.EnqueueScope(cmd.Command.RequestType))
+}
+
+// newPushEnqueuer creates a new push enqueuer configured with opts.
+func newPushEnqueuer(store storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, opts []Option) (*api.PushEnqueuer, error) {
+	config := new(config)
+	for _, opt := range opts {
+		opt(config)
+	}
+	peOpts := []api.PushEnqueuerOption{api.WithLogger(logger)}
+	if config.pacer != nil {
+		peOpts = append(peOpts, api.WithPacer(config.pacer))
+	}
+	return api.NewPushEnqueuer(store, pusher, peOpts...)
+}
+
 // PushHandler sends APNs push notifications to MDM enrollments.
 //
 // Note the whole URL path is used as the identifier to push to. This
@@ -105,12 +170,15 @@ func PushHandler(pusher push.Pusher, logger log.Logger) http.HandlerFunc {
 
 // PushToIDsHandler sends APNs push notifications to MDM enrollments.
 // Use idGetter to get the slice of enrollment IDs from the HTTP request.
-func PushToIDsHandler(pusher push.Pusher, logger log.Logger, idGetter func(*http.Request) ([]string, error)) http.HandlerFunc {
+// If a push pacer is configured with [WithPushPacer] then the pushes
+// are sent by a paced push job when the "pace_rate" or "pace_duration"
+// query parameters are present.
+func PushToIDsHandler(pusher push.Pusher, logger log.Logger, idGetter func(*http.Request) ([]string, error), opts ...Option) http.HandlerFunc {
 	if pusher == nil {
 		panic("nil pusher")
 	}
 
-	pe, peErr := api.NewPushEnqueuer(nil, pusher, api.WithLogger(logger))
+	pe, peErr := newPushEnqueuer(nil, pusher, logger, opts)
 	if peErr != nil {
 		panic(peErr)
 	}
@@ -131,10 +199,36 @@ func PushToIDsHandler(pusher push.Pusher, logger log.Logger, idGetter func(*http
 			// synthesize an API result error
 			pr = new(api.APIResult)
 			amendAPIError(err, &pr.PushError)
+			header = idGetterErrorStatus(err)
+			return
+		}
+
+		if e := audit.FromContext(r.Context()); e != nil {
+			e.EnrollmentIDs = ids
+		}
+
+		if err = apiauth.AuthorizeEnrollmentIDs(r.Context(), ids); err != nil {
+			logger.Info("err", err)
+			pr = new(api.APIResult)
+			amendAPIError(err, &pr.PushError)
+			header = http.StatusForbidden
 			return
 		}
 
-		pr, header, err = pe.Push(r.Context(), ids)
+		pace, err := paceFromRequest(r)
+		if err != nil {
+			logger.Info("err", err)
+			pr = new(api.APIResult)
+			amendAPIError(err, &pr.PushError)
+			header = http.StatusBadRequest
+			return
+		}
+
+		if pace != nil {
+			pr, header, err = pe.EnqueueWithPacedPush(r.Context(), nil, ids, *pace)
+		} else {
+			pr, header, err = pe.Push(r.Context(), ids)
+		}
 		if err != nil {
 			if pr == nil {
 				pr = new(api.APIResult)
@@ -171,13 +265,33 @@ func RawCommandEnqueueHandler(enqueuer storage.CommandEnqueuer, pusher push.Push
 
 // RawCommandEnqueueToIDsHandler enqueues a raw MDM command and sends
 // push notifications to MDM enrollments.
+// If the Content-Type is "application/json" then the body is the JSON
+// representation of the command dictionary which is converted to a
+// plist (see [mdm.CommandFromJSON]). A CommandUUID is generated if it
+// is omitted and is returned in the API result.
 // Use idGetter to get the slice of enrollment IDs from the HTTP request.
-func RawCommandEnqueueToIDsHandler(enqueuer storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, idGetter func(*http.Request) ([]string, error)) http.HandlerFunc {
+// If a push pacer is configured with [WithPushPacer] then the pushes
+// are sent by a paced push job when the "pace_rate" or "pace_duration"
+// query parameters are present.
+// If a profile signer is configured with [WithProfileSigner] then the
+// profile of InstallProfile commands is signed before enqueueing
+// unless the "nosign" query parameter is present.
+// If the "encrypt" query parameter is present then the profile of an
+// InstallProfile command is instead encrypted to the identity
+// certificate of each enrollment (see [WithIdentityCertRetriever]).
+// As each enrollment has its own command the per-command batch result
+// is returned. Paced pushes are not supported when encrypting.
+func RawCommandEnqueueToIDsHandler(enqueuer storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, idGetter func(*http.Request) ([]string, error), opts ...Option) http.HandlerFunc {
 	if enqueuer == nil {
 		panic("nil enqueuer")
 	}
 
-	pe, peErr := api.NewPushEnqueuer(enqueuer, pusher, api.WithLogger(logger))
+	config := new(config)
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	pe, peErr := newPushEnqueuer(enqueuer, pusher, logger, opts)
 	if peErr != nil {
 		panic(peErr)
 	}
@@ -187,6 +301,11 @@ func RawCommandEnqueueToIDsHandler(enqueuer storage.CommandEnqueuer, pusher push
 		header := http.StatusInternalServerError
 		logger := ctxlog.Logger(r.Context(), logger)
 
+		if r.URL.Query().Get("encrypt") != "" {
+			enqueueEncryptedProfile(w, r, pe, config, idGetter, logger)
+			return
+		}
+
 		defer func() {
 			writeAPIResult(er, w, header, logger)
 		}()
@@ -198,6 +317,7 @@ func RawCommandEnqueueToIDsHandler(enqueuer storage.CommandEnqueuer, pusher push
 			// synthesize an API result error
 			er = new(api.APIResult)
 			amendAPIError(err, &er.EnqueueError)
+			header = idGetterErrorStatus(err)
 			return
 		}
 
@@ -210,9 +330,65 @@ func RawCommandEnqueueToIDsHandler(enqueuer storage.CommandEnqueuer, pusher push
 			return
 		}
 
+		e := audit.FromContext(r.Context())
+		if e != nil {
+			e.EnrollmentIDs = ids
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == jsonContentType {
+			cmd, err := mdm.CommandFromJSON(cmdBytes)
+			if err != nil {
+				logger.Info("msg", "converting json command", "err", err)
+				er = new(api.APIResult)
+				amendAPIError(err, &er.EnqueueError)
+				header = http.StatusBadRequest
+				return
+			}
+			cmdBytes = cmd.Raw
+		}
+
+		if config.profileSigner != nil && r.URL.Query().Get("nosign") == "" {
+			cmdBytes, err = signInstallProfile(config.profileSigner, cmdBytes)
+			if err != nil {
+				logger.Info("err", err)
+				er = new(api.APIResult)
+				amendAPIError(err, &er.EnqueueError)
+				header = http.StatusBadRequest
+				return
+			}
+		}
+
+		if e != nil {
+			if cmd, err := mdm.DecodeCommand(cmdBytes); err == nil {
+				e.CommandUUID = cmd.CommandUUID
+				e.RequestType = cmd.Command.RequestType
+			}
+		}
+
+		if err = authorizeEnqueue(r.Context(), ids, cmdBytes); err != nil {
+			logger.Info("err", err)
+			er = new(api.APIResult)
+			amendAPIError(err, &er.EnqueueError)
+			header = http.StatusForbidden
+			return
+		}
+
 		noPush := r.URL.Query().Get("nopush") != ""
 
-		er, header, err = pe.RawCommandEnqueueWithPush(r.Context(), cmdBytes, ids, noPush)
+		pace, err := paceFromRequest(r)
+		if err != nil {
+			logger.Info("err", err)
+			er = new(api.APIResult)
+			amendAPIError(err, &er.PushError)
+			header = http.StatusBadRequest
+			return
+		}
+
+		if pace != nil && !noPush {
+			er, header, err = pe.RawCommandEnqueueWithPacedPush(r.Context(), cmdBytes, ids, *pace)
+		} else {
+			er, header, err = pe.RawCommandEnqueueWithPush(r.Context(), cmdBytes, ids, noPush)
+		}
 		if err != nil {
 			if er == nil {
 				er = new(api.APIResult)
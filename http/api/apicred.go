@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// apiCredentialRotatePath is the URL path suffix for rotating a credential secret.
+const apiCredentialRotatePath = "/rotate"
+
+// apiCredentialJSON converts cred to its JSON response, omitting the secret hash.
+func apiCredentialJSON(cred *storage.APICredential, secret string) *APICredentialJson {
+	return &APICredentialJson{
+		Name:          cred.Name,
+		Scopes:        cred.Scopes,
+		EnrollmentIds: cred.EnrollmentIDs,
+		CreatedAt:     cred.CreatedAt,
+		UpdatedAt:     cred.UpdatedAt,
+		Secret:        secret,
+	}
+}
+
+// NewAPICredentialsHandler manages API credentials.
+//
+// With an empty URL path a GET lists the credentials and a POST creates
+// a new credential from a JSON body. Otherwise the URL path is the name
+// of the credential: a GET retrieves it, a DELETE revokes it, and a
+// POST to the name suffixed with "/rotate" replaces its secret.
+// This probably necessitates stripping the URL prefix before using.
+// Secrets are only returned when a credential is created or rotated.
+func NewAPICredentialsHandler(store storage.APICredentialStore, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		name := r.URL.Path
+		rotate := strings.HasSuffix(name, apiCredentialRotatePath)
+		if rotate {
+			name = strings.TrimSuffix(name, apiCredentialRotatePath)
+		}
+		if e := audit.FromContext(r.Context()); e != nil && name != "" {
+			e.Details = map[string]string{"name": name}
+		}
+
+		switch {
+		case name == "" && r.Method == http.MethodGet:
+			creds, err := store.ListAPICredentials(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "list api credentials", err, http.StatusInternalServerError)
+				return
+			}
+			out := make([]*APICredentialJson, 0, len(creds))
+			for _, cred := range creds {
+				out = append(out, apiCredentialJSON(cred, ""))
+			}
+			writeJSON(w, out, http.StatusOK, logger)
+
+		case name == "" && !rotate && r.Method == http.MethodPost:
+			req := new(APICredentialRequestJson)
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				logAndWriteJSONError(logger, w, "decoding api credential request", err, http.StatusBadRequest)
+				return
+			}
+			if e := audit.FromContext(r.Context()); e != nil {
+				e.Details = map[string]string{"name": req.Name}
+			}
+			if existing, err := store.RetrieveAPICredential(r.Context(), req.Name); err != nil {
+				logAndWriteJSONError(logger, w, "retrieve api credential", err, http.StatusInternalServerError)
+				return
+			} else if existing != nil {
+				logAndWriteJSONError(logger, w, "create api credential", fmt.Errorf("credential already exists: %s", req.Name), http.StatusConflict)
+				return
+			}
+			cred, secret, err := apiauth.NewCredential(req.Name, req.Scopes, req.EnrollmentIds)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "create api credential", err, http.StatusBadRequest)
+				return
+			}
+			if err = store.StoreAPICredential(r.Context(), cred); err != nil {
+				logAndWriteJSONError(logger, w, "store api credential", err, http.StatusInternalServerError)
+				return
+			}
+			logger.Info("msg", "created api credential", "name", cred.Name, "scopes", strings.Join(cred.Scopes, ","))
+			writeJSON(w, apiCredentialJSON(cred, secret), http.StatusCreated, logger)
+
+		case name != "" && !rotate && (r.Method == http.MethodGet || r.Method == http.MethodDelete),
+			name != "" && rotate && r.Method == http.MethodPost:
+			cred, err := store.RetrieveAPICredential(r.Context(), name)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve api credential", err, http.StatusInternalServerError)
+				return
+			} else if cred == nil {
+				logAndWriteJSONError(logger, w, "retrieve api credential", fmt.Errorf("credential not found: %s", name), http.StatusNotFound)
+				return
+			}
+
+			switch {
+			case r.Method == http.MethodGet:
+				writeJSON(w, apiCredentialJSON(cred, ""), http.StatusOK, logger)
+			case r.Method == http.MethodDelete:
+				if err = store.DeleteAPICredential(r.Context(), name); err != nil {
+					logAndWriteJSONError(logger, w, "delete api credential", err, http.StatusInternalServerError)
+					return
+				}
+				logger.Info("msg", "revoked api credential", "name", name)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				secret, err := apiauth.Rotate(cred)
+				if err != nil {
+					logAndWriteJSONError(logger, w, "rotate api credential", err, http.StatusInternalServerError)
+					return
+				}
+				if err = store.StoreAPICredential(r.Context(), cred); err != nil {
+					logAndWriteJSONError(logger, w, "store api credential", err, http.StatusInternalServerError)
+					return
+				}
+				logger.Info("msg", "rotated api credential", "name", name)
+				writeJSON(w, apiCredentialJSON(cred, secret), http.StatusOK, logger)
+			}
+
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+}
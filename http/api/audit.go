@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// DefaultAuditLimit is the default maximum number of audit entries returned.
+	DefaultAuditLimit = 100
+
+	// MaxAuditLimit is the maximum number of audit entries that can be requested.
+	MaxAuditLimit = 1000
+)
+
+// auditQueryFromRequest parses the audit query from the URL query parameters of r.
+func auditQueryFromRequest(r *http.Request) (*storage.AuditQuery, error) {
+	v := r.URL.Query()
+	q := &storage.AuditQuery{
+		Actor:        v.Get("actor"),
+		Action:       v.Get("action"),
+		EnrollmentID: v.Get("enrollment_id"),
+		CommandUUID:  v.Get("command_uuid"),
+		Limit:        DefaultAuditLimit,
+	}
+	var err error
+	if since := v.Get("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return nil, fmt.Errorf("parsing since: %w", err)
+		}
+	}
+	if until := v.Get("until"); until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, fmt.Errorf("parsing until: %w", err)
+		}
+	}
+	if limit := v.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("parsing limit: %w", err)
+		}
+		if q.Limit < 1 || q.Limit > MaxAuditLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxAuditLimit)
+		}
+	}
+	return q, nil
+}
+
+// NewAuditHandler returns audit entries, newest first, filtered by the
+// optional "actor", "action", "enrollment_id", "command_uuid", "since"
+// and "until" (RFC 3339) URL query parameters. The "limit" query
+// parameter sets the maximum number of entries returned.
+func NewAuditHandler(store storage.AuditStore, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		q, err := auditQueryFromRequest(r)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing audit query", err, http.StatusBadRequest)
+			return
+		}
+
+		entries, err := store.RetrieveAuditEntries(r.Context(), q)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving audit entries", err, http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			// encode an empty JSON array rather than null
+			entries = []*storage.AuditEntry{}
+		}
+
+		writeJSON(w, entries, http.StatusOK, logger)
+	}
+}
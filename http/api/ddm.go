@@ -0,0 +1,519 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/service/ddm"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// DDM API URL path prefixes (after the DDM endpoint is stripped).
+const (
+	ddmDeclarationsPath = "declarations"
+	ddmSetsPath         = "sets"
+	ddmEnrollmentsPath  = "enrollments"
+)
+
+// WithDeclarationStatusStore enables the Declarative Management status
+// API handler backed by store.
+func WithDeclarationStatusStore(store storage.DeclarationStatusStore) Option {
+	return func(c *config) {
+		c.ddmStatusStore = store
+	}
+}
+
+// WithDeclarationStore enables the Declarative Management API handler
+// backed by store.
+func WithDeclarationStore(store storage.DeclarationStore) Option {
+	return func(c *config) {
+		c.ddmStore = store
+	}
+}
+
+// declarationJSON converts d to its JSON response.
+func declarationJSON(d *storage.Declaration) *DDMDeclarationJson {
+	return &DDMDeclarationJson{
+		Identifier:  d.Identifier,
+		Type:        d.Type,
+		ServerToken: d.ServerToken,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+// declarationSetEnrollments returns the enrollment IDs assigned any
+// set that contains the declaration identifier.
+func declarationSetEnrollments(ctx context.Context, store storage.DeclarationStore, identifier string) (sets []string, ids []string, err error) {
+	names, err := store.ListDeclarationSets(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list sets: %w", err)
+	}
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		identifiers, err := store.RetrieveDeclarationSet(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("retrieve set %s: %w", name, err)
+		}
+		for _, setIdentifier := range identifiers {
+			if setIdentifier != identifier {
+				continue
+			}
+			sets = append(sets, name)
+			setIDs, err := store.ListDeclarationSetEnrollments(ctx, name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("list set %s enrollments: %w", name, err)
+			}
+			for _, id := range setIDs {
+				if _, ok := seen[id]; !ok {
+					seen[id] = struct{}{}
+					ids = append(ids, id)
+				}
+			}
+			break
+		}
+	}
+	return sets, ids, nil
+}
+
+// ddmSyncer enqueues DeclarativeManagement commands to enrollments so
+// that they synchronize their declarations.
+type ddmSyncer struct {
+	store storage.DeclarationStore
+	pe    *api.PushEnqueuer
+}
+
+// sync enqueues a DeclarativeManagement command to each enrollment ID
+// unless the "nosync" URL query parameter of r is present. Pushes are
+// not sent if the "nopush" URL query parameter is present.
+func (s *ddmSyncer) sync(r *http.Request, ids []string, logger log.Logger) error {
+	if len(ids) < 1 || r.URL.Query().Get("nosync") != "" {
+		return nil
+	}
+	items := make([]*storage.EnqueueItem, 0, len(ids))
+	for _, id := range ids {
+		cmd, err := ddm.SyncCommand(r.Context(), s.store, id)
+		if err != nil {
+			return fmt.Errorf("enrollment id %s: %w", id, err)
+		}
+		items = append(items, &storage.EnqueueItem{IDs: []string{id}, Command: cmd})
+	}
+	br, _, err := s.pe.EnqueueBatchWithPush(r.Context(), items, r.URL.Query().Get("nopush") != "")
+	if err != nil {
+		return err
+	}
+	var enqueueErrs int
+	for _, result := range br.Results {
+		if result != nil && result.EnqueueError != nil {
+			enqueueErrs++
+		}
+	}
+	logger.Debug("msg", "enqueued sync commands", "count", len(items), "enqueue_errors", enqueueErrs)
+	if enqueueErrs > 0 {
+		return fmt.Errorf("%d of %d sync commands failed to enqueue", enqueueErrs, len(items))
+	}
+	return nil
+}
+
+// readJSONStrings decodes the JSON array of strings in the body of r.
+func readJSONStrings(r *http.Request) ([]string, error) {
+	var s []string
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("decoding JSON array: %w", err)
+	}
+	for _, v := range s {
+		if v == "" {
+			return nil, errors.New("empty value")
+		}
+	}
+	return s, nil
+}
+
+// NewDDMHandler manages the declarations, declaration sets, and
+// enrollment set assignments of the built-in Declarative Management
+// service (see package ddm).
+// This probably necessitates stripping the URL prefix before using.
+//
+// The URL path "declarations" lists the declarations with a GET.
+// The path "declarations/<identifier>" stores the JSON declaration of
+// the request body with a PUT, returns the declaration JSON with a GET,
+// and deletes the declaration with a DELETE. The identifier of the
+// declaration must match the path. Declarations in a set cannot be
+// deleted.
+//
+// The URL path "sets" lists the set names with a GET. The path
+// "sets/<name>" replaces the declaration identifiers of the set with the
+// JSON array of the request body with a PUT, returns the set with a
+// GET, and deletes the set with a DELETE. Sets assigned to enrollments
+// cannot be deleted.
+//
+// The URL path "enrollments/<id>" replaces the set names assigned to
+// the enrollment with the JSON array of the request body with a PUT and
+// returns them with a GET.
+//
+// Changes enqueue DeclarativeManagement commands to the affected
+// enrollments and send push notifications to them. As changes to
+// declarations and sets may affect any enrollment they require an API
+// credential that is not restricted to enrollment IDs. If the "nosync" URL
+// query parameter is present then no commands are enqueued. If the
+// "nopush" URL query parameter is present then no pushes are sent.
+func NewDDMHandler(store storage.DeclarationStore, enqueuer storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, opts ...Option) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	if enqueuer == nil {
+		panic("nil enqueuer")
+	}
+
+	pe, err := newPushEnqueuer(enqueuer, pusher, logger, opts)
+	if err != nil {
+		panic(err)
+	}
+	syncer := &ddmSyncer{store: store, pe: pe}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		kind, name, _ := strings.Cut(r.URL.Path, "/")
+		switch {
+		case kind == ddmDeclarationsPath && name == "" && r.Method == http.MethodGet:
+			decls, err := store.ListDeclarations(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "list declarations", err, http.StatusInternalServerError)
+				return
+			}
+			out := make([]*DDMDeclarationJson, 0, len(decls))
+			for _, d := range decls {
+				out = append(out, declarationJSON(d))
+			}
+			writeJSON(w, out, http.StatusOK, logger)
+
+		case kind == ddmDeclarationsPath && name != "":
+			ddmDeclaration(w, r, store, syncer, name, logger)
+
+		case kind == ddmSetsPath && name == "" && r.Method == http.MethodGet:
+			names, err := store.ListDeclarationSets(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "list sets", err, http.StatusInternalServerError)
+				return
+			}
+			if names == nil {
+				names = []string{}
+			}
+			writeJSON(w, names, http.StatusOK, logger)
+
+		case kind == ddmSetsPath && name != "":
+			ddmSet(w, r, store, syncer, name, logger)
+
+		case kind == ddmEnrollmentsPath && name != "":
+			ddmEnrollment(w, r, store, syncer, name, logger)
+
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		}
+	}
+}
+
+// ddmDeclaration handles requests for the declaration identifier.
+func ddmDeclaration(w http.ResponseWriter, r *http.Request, store storage.DeclarationStore, syncer *ddmSyncer, identifier string, logger log.Logger) {
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.Details = map[string]string{"declaration": identifier}
+	}
+	if r.Method != http.MethodGet {
+		if err := apiauth.AuthorizeAllEnrollmentIDs(r.Context()); err != nil {
+			logAndWriteJSONError(logger, w, "declaration", err, http.StatusForbidden)
+			return
+		}
+	}
+
+	existing, err := store.RetrieveDeclaration(r.Context(), identifier)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "retrieve declaration", err, http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if existing == nil {
+			logAndWriteJSONError(logger, w, "retrieve declaration", fmt.Errorf("declaration not found: %s", identifier), http.StatusNotFound)
+			return
+		}
+		declBytes, err := ddm.DeclarationJSON(existing)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "declaration json", err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(declBytes)
+
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading body", err, http.StatusInternalServerError)
+			return
+		}
+		d, err := ddm.ParseDeclaration(body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing declaration", err, http.StatusBadRequest)
+			return
+		} else if d.Identifier != identifier {
+			logAndWriteJSONError(logger, w, "parsing declaration", fmt.Errorf("identifier mismatch: %s", d.Identifier), http.StatusBadRequest)
+			return
+		}
+
+		header := http.StatusOK
+		if existing == nil {
+			header = http.StatusCreated
+		}
+
+		if existing == nil || existing.ServerToken != d.ServerToken {
+			now := time.Now()
+			d.CreatedAt, d.UpdatedAt = now, now
+			if existing != nil {
+				d.CreatedAt = existing.CreatedAt
+			}
+			if err = store.StoreDeclaration(r.Context(), d); err != nil {
+				logAndWriteJSONError(logger, w, "store declaration", err, http.StatusInternalServerError)
+				return
+			}
+			logger.Info("msg", "stored declaration", "identifier", identifier, "server_token", d.ServerToken)
+			if existing, err = store.RetrieveDeclaration(r.Context(), identifier); err != nil {
+				logAndWriteJSONError(logger, w, "retrieve declaration", err, http.StatusInternalServerError)
+				return
+			} else if existing == nil {
+				logAndWriteJSONError(logger, w, "retrieve declaration", fmt.Errorf("declaration not found: %s", identifier), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		_, ids, err := declarationSetEnrollments(r.Context(), store, identifier)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "finding declaration enrollments", err, http.StatusInternalServerError)
+			return
+		}
+		if err = syncer.sync(r, ids, logger); err != nil {
+			logAndWriteJSONError(logger, w, "syncing enrollments", err, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, declarationJSON(existing), header, logger)
+
+	case http.MethodDelete:
+		sets, _, err := declarationSetEnrollments(r.Context(), store, identifier)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "finding declaration sets", err, http.StatusInternalServerError)
+			return
+		} else if len(sets) > 0 {
+			logAndWriteJSONError(logger, w, "delete declaration", fmt.Errorf("declaration in sets: %s", strings.Join(sets, ", ")), http.StatusConflict)
+			return
+		}
+		if err = store.DeleteDeclaration(r.Context(), identifier); err != nil {
+			logAndWriteJSONError(logger, w, "delete declaration", err, http.StatusInternalServerError)
+			return
+		}
+		logger.Info("msg", "deleted declaration", "identifier", identifier)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// ddmSet handles requests for the declaration set name.
+func ddmSet(w http.ResponseWriter, r *http.Request, store storage.DeclarationStore, syncer *ddmSyncer, name string, logger log.Logger) {
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.Details = map[string]string{"set": name}
+	}
+	if strings.Contains(name, "/") {
+		logAndWriteJSONError(logger, w, "declaration set", fmt.Errorf("invalid set name: %s", name), http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet {
+		if err := apiauth.AuthorizeAllEnrollmentIDs(r.Context()); err != nil {
+			logAndWriteJSONError(logger, w, "declaration set", err, http.StatusForbidden)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		identifiers, err := store.RetrieveDeclarationSet(r.Context(), name)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieve set", err, http.StatusInternalServerError)
+			return
+		} else if len(identifiers) < 1 {
+			logAndWriteJSONError(logger, w, "retrieve set", fmt.Errorf("set not found: %s", name), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &DDMDeclarationSetJson{Name: name, Declarations: identifiers}, http.StatusOK, logger)
+
+	case http.MethodPut:
+		identifiers, err := readJSONStrings(r)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading set declarations", err, http.StatusBadRequest)
+			return
+		} else if len(identifiers) < 1 {
+			logAndWriteJSONError(logger, w, "reading set declarations", errors.New("no declarations"), http.StatusBadRequest)
+			return
+		}
+		for _, identifier := range identifiers {
+			d, err := store.RetrieveDeclaration(r.Context(), identifier)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve declaration", err, http.StatusInternalServerError)
+				return
+			} else if d == nil {
+				logAndWriteJSONError(logger, w, "retrieve declaration", fmt.Errorf("declaration not found: %s", identifier), http.StatusBadRequest)
+				return
+			}
+		}
+		existing, err := store.RetrieveDeclarationSet(r.Context(), name)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieve set", err, http.StatusInternalServerError)
+			return
+		}
+		if err = store.StoreDeclarationSet(r.Context(), name, identifiers); err != nil {
+			logAndWriteJSONError(logger, w, "store set", err, http.StatusInternalServerError)
+			return
+		}
+		logger.Info("msg", "stored set", "name", name, "declaration_count", len(identifiers))
+		ids, err := store.ListDeclarationSetEnrollments(r.Context(), name)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "list set enrollments", err, http.StatusInternalServerError)
+			return
+		}
+		if err = syncer.sync(r, ids, logger); err != nil {
+			logAndWriteJSONError(logger, w, "syncing enrollments", err, http.StatusInternalServerError)
+			return
+		}
+		if identifiers, err = store.RetrieveDeclarationSet(r.Context(), name); err != nil {
+			logAndWriteJSONError(logger, w, "retrieve set", err, http.StatusInternalServerError)
+			return
+		}
+		header := http.StatusOK
+		if len(existing) < 1 {
+			header = http.StatusCreated
+		}
+		writeJSON(w, &DDMDeclarationSetJson{Name: name, Declarations: identifiers}, header, logger)
+
+	case http.MethodDelete:
+		ids, err := store.ListDeclarationSetEnrollments(r.Context(), name)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "list set enrollments", err, http.StatusInternalServerError)
+			return
+		} else if len(ids) > 0 {
+			logAndWriteJSONError(logger, w, "delete set", fmt.Errorf("set assigned to %d enrollment(s)", len(ids)), http.StatusConflict)
+			return
+		}
+		if err = store.StoreDeclarationSet(r.Context(), name, nil); err != nil {
+			logAndWriteJSONError(logger, w, "delete set", err, http.StatusInternalServerError)
+			return
+		}
+		logger.Info("msg", "deleted set", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// ddmEnrollment handles requests for the set assignments of enrollment id.
+func ddmEnrollment(w http.ResponseWriter, r *http.Request, store storage.DeclarationStore, syncer *ddmSyncer, id string, logger log.Logger) {
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.EnrollmentIDs = []string{id}
+	}
+	if err := apiauth.AuthorizeEnrollmentIDs(r.Context(), []string{id}); err != nil {
+		logAndWriteJSONError(logger, w, "enrollment sets", err, http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		sets, err := readJSONStrings(r)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading enrollment sets", err, http.StatusBadRequest)
+			return
+		}
+		for _, set := range sets {
+			identifiers, err := store.RetrieveDeclarationSet(r.Context(), set)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve set", err, http.StatusInternalServerError)
+				return
+			} else if len(identifiers) < 1 {
+				logAndWriteJSONError(logger, w, "retrieve set", fmt.Errorf("set not found: %s", set), http.StatusBadRequest)
+				return
+			}
+		}
+		if e := audit.FromContext(r.Context()); e != nil {
+			e.Details = map[string]string{"set_count": strconv.Itoa(len(sets))}
+		}
+		if err = store.StoreEnrollmentDeclarationSets(r.Context(), id, sets); err != nil {
+			logAndWriteJSONError(logger, w, "store enrollment sets", err, http.StatusInternalServerError)
+			return
+		}
+		logger.Info("msg", "stored enrollment sets", "id", id, "set_count", len(sets))
+		if err = syncer.sync(r, []string{id}, logger); err != nil {
+			logAndWriteJSONError(logger, w, "syncing enrollment", err, http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	sets, err := store.RetrieveEnrollmentDeclarationSets(r.Context(), id)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "retrieve enrollment sets", err, http.StatusInternalServerError)
+		return
+	}
+	if sets == nil {
+		sets = []string{}
+	}
+	writeJSON(w, &DDMEnrollmentSetsJson{Id: id, Sets: sets}, http.StatusOK, logger)
+}
+
+// NewDDMStatusHandler returns the Declarative Management status of an
+// enrollment as recorded from its status reports (see package ddm).
+// The enrollment ID is the URL path.
+// This probably necessitates stripping the URL prefix before using.
+func NewDDMStatusHandler(store storage.DeclarationStatusStore, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		id := r.URL.Path
+		if id == "" || strings.Contains(id, "/") {
+			logAndWriteJSONError(logger, w, "ddm status", errors.New("invalid enrollment id"), http.StatusBadRequest)
+			return
+		}
+		if err := apiauth.AuthorizeEnrollmentIDs(r.Context(), []string{id}); err != nil {
+			logAndWriteJSONError(logger, w, "ddm status", err, http.StatusForbidden)
+			return
+		}
+		status, err := ddm.RetrieveStatus(r.Context(), store, id)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieve status", err, http.StatusInternalServerError)
+			return
+		} else if status == nil {
+			logAndWriteJSONError(logger, w, "retrieve status", errors.New("status not found"), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, status, http.StatusOK, logger)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// enqueueItemFromJSON converts the batch enqueue command c to an enqueue item.
+func enqueueItemFromJSON(c *EnqueueBatchCommandJson) (*storage.EnqueueItem, error) {
+	if len(c.Ids) < 1 {
+		return nil, errors.New("no enrollment ids")
+	}
+	var cmd *mdm.Command
+	switch {
+	case c.Command != nil && c.RawCommand != "":
+		return nil, errors.New("both command and raw_command present")
+	case c.Command != nil:
+		jsonCommand, err := json.Marshal(c.Command)
+		if err != nil {
+			return nil, err
+		}
+		if cmd, err = mdm.CommandFromJSON(jsonCommand); err != nil {
+			return nil, err
+		}
+	case c.RawCommand != "":
+		rawCommand, err := base64.StdEncoding.DecodeString(c.RawCommand)
+		if err != nil {
+			return nil, fmt.Errorf("decoding raw_command: %w", err)
+		}
+		if cmd, err = mdm.DecodeCommand(rawCommand); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no command or raw_command")
+	}
+	return &storage.EnqueueItem{IDs: c.Ids, Command: cmd}, nil
+}
+
+// writeBatchResult encodes r to JSON writing to w using the HTTP status of header.
+func writeBatchResult(r *api.BatchResult, w http.ResponseWriter, header int, logger log.Logger) {
+	if r == nil {
+		r = &api.BatchResult{EnqueueError: api.NewError(errors.New("nil batch result"))}
+		header = 0 // override http status if a nil batch result happens
+	}
+	writeJSON(w, r, header, logger)
+}
+
+// NewEnqueueBatchHandler enqueues multiple MDM commands, each to its
+// own enrollment IDs, and sends push notifications to each affected
+// enrollment once. The JSON body is a list of commands with their
+// enrollment IDs. Each command is either the JSON representation of
+// the command dictionary (see [mdm.CommandFromJSON]) or a base64-encoded
+// raw command plist. Per-command results are returned in order.
+// If the "nopush" URL query parameter is present then no pushes are sent.
+func NewEnqueueBatchHandler(enqueuer storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, opts ...Option) http.HandlerFunc {
+	if enqueuer == nil {
+		panic("nil enqueuer")
+	}
+
+	pe, peErr := newPushEnqueuer(enqueuer, pusher, logger, opts)
+	if peErr != nil {
+		panic(peErr)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		req := new(EnqueueBatchRequestJson)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			logAndWriteJSONError(logger, w, "decoding batch enqueue request", err, http.StatusBadRequest)
+			return
+		}
+		if len(req.Commands) < 1 {
+			logAndWriteJSONError(logger, w, "batch enqueue request", errors.New("no commands"), http.StatusBadRequest)
+			return
+		}
+
+		items := make([]*storage.EnqueueItem, len(req.Commands))
+		var ids []string
+		seen := make(map[string]struct{})
+		for i := range req.Commands {
+			item, err := enqueueItemFromJSON(&req.Commands[i])
+			if err != nil {
+				logAndWriteJSONError(logger, w, "batch enqueue request", fmt.Errorf("command at index %d: %w", i, err), http.StatusBadRequest)
+				return
+			}
+			items[i] = item
+			for _, id := range item.IDs {
+				if _, ok := seen[id]; !ok {
+					seen[id] = struct{}{}
+					ids = append(ids, id)
+				}
+			}
+		}
+
+		if e := audit.FromContext(r.Context()); e != nil {
+			e.EnrollmentIDs = ids
+			e.Details = map[string]string{"command_count": strconv.Itoa(len(items))}
+		}
+
+		for i, item := range items {
+			if err := authorizeEnqueue(r.Context(), item.IDs, item.Command.Raw); err != nil {
+				logAndWriteJSONError(logger, w, "batch enqueue request", fmt.Errorf("command at index %d: %w", i, err), http.StatusForbidden)
+				return
+			}
+		}
+
+		br, header, err := pe.EnqueueBatchWithPush(r.Context(), items, r.URL.Query().Get("nopush") != "")
+		if err != nil {
+			if br == nil {
+				br = new(api.BatchResult)
+			}
+			// amend the result json with our error
+			// so as to be visible to HTTP API callers
+			amendAPIError(err, &br.EnqueueError)
+			logger.Info("msg", "enqueueing batch", "command_count", len(items), "err", err)
+		}
+		writeBatchResult(br, w, header, logger)
+	}
+}
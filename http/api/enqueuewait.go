@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// DefaultWaitTimeout is the default duration to wait for command results.
+	DefaultWaitTimeout = 30 * time.Second
+
+	// MaxWaitTimeout is the maximum duration to wait for command results.
+	MaxWaitTimeout = 5 * time.Minute
+)
+
+// WithCommandResultsRetriever enables the enqueue and wait handler
+// which polls store for command results. Do not use this with storage
+// that does not retain command results (e.g. that deletes commands
+// once they are acknowledged): waiting would always fail.
+func WithCommandResultsRetriever(store storage.CommandResultsRetriever) Option {
+	return func(c *config) {
+		c.resultsStore = store
+	}
+}
+
+// writeWaitResult encodes r to JSON writing to w using the HTTP status of header.
+func writeWaitResult(r *api.WaitResult, w http.ResponseWriter, header int, logger log.Logger) {
+	if r == nil {
+		nilErr := api.NewError(errors.New("nil wait result"))
+		r = &api.WaitResult{APIResult: api.APIResult{
+			EnqueueError: nilErr,
+			PushError:    nilErr,
+		}}
+		header = 0 // override http status if a nil wait result happens
+	}
+
+	writeJSON(w, r, header, logger)
+}
+
+// waitTimeoutFromRequest returns the wait timeout from the "timeout"
+// query parameter (e.g. "1m") of r or [DefaultWaitTimeout].
+func waitTimeoutFromRequest(r *http.Request) (time.Duration, error) {
+	timeout := r.URL.Query().Get("timeout")
+	if timeout == "" {
+		return DefaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("parsing timeout: %w", err)
+	}
+	if d <= 0 || d > MaxWaitTimeout {
+		return 0, fmt.Errorf("timeout must be positive and at most %s", MaxWaitTimeout)
+	}
+	return d, nil
+}
+
+// NewEnqueueWaitHandler enqueues an MDM command, sends push
+// notifications to MDM enrollments, and waits for the enrollments to
+// report the command results. The raw and decoded command results
+// are returned per enrollment ID. The request body is the same as
+// [RawCommandEnqueueToIDsHandler]. The "timeout" query parameter
+// (e.g. "1m") limits the wait (see [DefaultWaitTimeout] and
+// [MaxWaitTimeout]). A 202 Accepted status indicates that some
+// enrollment IDs had not reported results before the timeout.
+// Results are polled from retriever so that command reports received
+// by any NanoMDM instance sharing the storage are seen. The retriever
+// must retain command results: storage that deletes commands once they
+// are acknowledged can not be used.
+// Use idGetter to get the slice of enrollment IDs from the HTTP request.
+func NewEnqueueWaitHandler(enqueuer storage.CommandEnqueuer, retriever storage.CommandResultsRetriever, pusher push.Pusher, logger log.Logger, idGetter func(*http.Request) ([]string, error), opts ...Option) http.HandlerFunc {
+	if enqueuer == nil {
+		panic("nil enqueuer")
+	}
+	if retriever == nil {
+		panic("nil retriever")
+	}
+
+	pe, peErr := newPushEnqueuer(enqueuer, pusher, logger, opts)
+	if peErr != nil {
+		panic(peErr)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var wr *api.WaitResult
+		header := http.StatusInternalServerError
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		defer func() {
+			writeWaitResult(wr, w, header, logger)
+		}()
+
+		// errResult synthesizes a wait result error
+		errResult := func(err error, status int) {
+			logger.Info("err", err)
+			wr = new(api.WaitResult)
+			amendAPIError(err, &wr.EnqueueError)
+			header = status
+		}
+
+		ids, err := idGetter(r)
+		if err != nil {
+			errResult(fmt.Errorf("getting enrollment ids: %w", err), idGetterErrorStatus(err))
+			return
+		}
+
+		cmdBytes, err := io.ReadAll(r.Body)
+		if err != nil {
+			errResult(fmt.Errorf("reading body: %w", err), http.StatusInternalServerError)
+			return
+		}
+
+		e := audit.FromContext(r.Context())
+		if e != nil {
+			e.EnrollmentIDs = ids
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == jsonContentType {
+			cmd, err := mdm.CommandFromJSON(cmdBytes)
+			if err != nil {
+				errResult(fmt.Errorf("converting json command: %w", err), http.StatusBadRequest)
+				return
+			}
+			cmdBytes = cmd.Raw
+		}
+
+		cmd, err := mdm.DecodeCommand(cmdBytes)
+		if err != nil {
+			errResult(fmt.Errorf("decoding command: %w", err), http.StatusBadRequest)
+			return
+		}
+
+		if e != nil {
+			e.CommandUUID = cmd.CommandUUID
+			e.RequestType = cmd.Command.RequestType
+		}
+
+		if err = authorizeEnqueue(r.Context(), ids, cmdBytes); err != nil {
+			errResult(err, http.StatusForbidden)
+			return
+		}
+
+		timeout, err := waitTimeoutFromRequest(r)
+		if err != nil {
+			errResult(err, http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		wr, header, err = pe.EnqueueWithPushAndWait(ctx, cmd, ids, retriever)
+		if err != nil {
+			if wr == nil {
+				wr = new(api.WaitResult)
+			}
+			// amend the result json with our error
+			// so as to be visible to HTTP API callers
+			amendAPIError(err, &wr.EnqueueError)
+			logs := []interface{}{
+				"msg", "enqueueing and waiting",
+				"id_count", len(ids),
+				"err", err,
+			}
+			if len(ids) > 0 {
+				logs = append(logs, "id_first", ids[0])
+			}
+			logger.Info(logs...)
+		} else if len(wr.Pending) > 0 {
+			logger.Debug(
+				"msg", "timed out waiting for command results",
+				"command_uuid", cmd.CommandUUID,
+				"pending_count", len(wr.Pending),
+			)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanomdm/enrollprofile"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// DefaultEnrollmentTokenTTL is the default duration enrollment tokens are valid.
+	DefaultEnrollmentTokenTTL = 24 * time.Hour
+
+	// MaxEnrollmentTokenTTL is the maximum duration enrollment tokens are valid.
+	MaxEnrollmentTokenTTL = 30 * 24 * time.Hour
+)
+
+// WithEnrollmentTokenStore enables the enrollment token API handler
+// backed by store.
+func WithEnrollmentTokenStore(store storage.EnrollmentTokenStore) Option {
+	return func(c *config) {
+		c.enrollTokenStore = store
+	}
+}
+
+// enrollmentTokenTTLFromRequest returns the token TTL from the "ttl"
+// query parameter (e.g. "1h") of r or [DefaultEnrollmentTokenTTL].
+func enrollmentTokenTTLFromRequest(r *http.Request) (time.Duration, error) {
+	ttl := r.URL.Query().Get("ttl")
+	if ttl == "" {
+		return DefaultEnrollmentTokenTTL, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ttl: %w", err)
+	}
+	if d <= 0 || d > MaxEnrollmentTokenTTL {
+		return 0, fmt.Errorf("ttl must be positive and at most %s", MaxEnrollmentTokenTTL)
+	}
+	return d, nil
+}
+
+// NewEnrollmentTokenHandler creates a new one-time enrollment token
+// and stores its hash in store. The "ttl" query parameter (e.g. "1h")
+// sets how long the token is valid (see [DefaultEnrollmentTokenTTL]
+// and [MaxEnrollmentTokenTTL]). The optional "label" query parameter
+// describes who or what the token is for and is logged when used.
+// The token is only returned in this response.
+func NewEnrollmentTokenHandler(store storage.EnrollmentTokenStore, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		ttl, err := enrollmentTokenTTLFromRequest(r)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "enrollment token ttl", err, http.StatusBadRequest)
+			return
+		}
+
+		token, err := enrollprofile.NewToken()
+		if err != nil {
+			logAndWriteJSONError(logger, w, "generating enrollment token", err, 0)
+			return
+		}
+
+		t := &storage.EnrollmentToken{
+			Hash:      enrollprofile.HashToken(token),
+			Label:     r.URL.Query().Get("label"),
+			ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		}
+		if err = store.StoreEnrollmentToken(r.Context(), t); err != nil {
+			logAndWriteJSONError(logger, w, "storing enrollment token", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "created enrollment token", "label", t.Label, "expires_at", t.ExpiresAt)
+		writeJSON(w, &EnrollmentTokenJson{
+			Token:     token,
+			Label:     t.Label,
+			ExpiresAt: t.ExpiresAt,
+		}, http.StatusCreated, logger)
+	}
+}
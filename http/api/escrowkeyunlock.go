@@ -8,6 +8,7 @@ import (
 
 	"github.com/micromdm/nanolib/log"
 	"github.com/micromdm/nanolib/log/ctxlog"
+	"github.com/micromdm/nanomdm/audit"
 	"github.com/micromdm/nanomdm/http/escrowkeyunlock"
 	"github.com/micromdm/nanomdm/storage"
 )
@@ -50,6 +51,11 @@ func NewEscrowKeyUnlockHandler(store storage.PushCertStore, client *http.Client,
 			return
 		}
 
+		if e := audit.FromContext(r.Context()); e != nil {
+			e.Topic = topic
+			e.Details = map[string]string{"serial": params.Serial}
+		}
+
 		resp, err := escrowkeyunlock.DoEscrowKeyUnlock(
 			r.Context(),
 			store,
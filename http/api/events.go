@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/eventstream"
+	"github.com/micromdm/nanomdm/http/apiauth"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// eventsKeepAlive is the interval between keep-alive comments sent to
+// idle event stream clients.
+const eventsKeepAlive = 15 * time.Second
+
+// WithEventBroker enables the MDM event stream handler backed by broker.
+func WithEventBroker(broker *eventstream.Broker) Option {
+	return func(c *config) {
+		c.broker = broker
+	}
+}
+
+// queryList returns the values of the query parameter key of r.
+// Values may be repeated or comma-separated.
+func queryList(r *http.Request, key string) []string {
+	var list []string
+	for _, v := range r.URL.Query()[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// writeEvent writes e to w in the Server-Sent Events format.
+func writeEvent(w http.ResponseWriter, e *eventstream.Event) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Topic, e.Data)
+	return err
+}
+
+// NewEventsHandler streams MDM events from broker as Server-Sent Events.
+//
+// Events are the same JSON events that are sent to webhook URLs.
+// The "topic" and "id" (enrollment ID) query parameters filter the
+// events. If the API credential is restricted to enrollment IDs then
+// only events for those enrollment IDs are streamed. Streaming resumes
+// after the event ID in the Last-Event-ID header (or "last_event_id"
+// query parameter) if it is still buffered.
+func NewEventsHandler(broker *eventstream.Broker, logger log.Logger) http.HandlerFunc {
+	if broker == nil {
+		panic("nil broker")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			logAndWriteJSONError(logger, w, "streaming events", errors.New("streaming not supported"), http.StatusInternalServerError)
+			return
+		}
+
+		filter := &eventstream.Filter{
+			Topics:        queryList(r, "topic"),
+			EnrollmentIDs: queryList(r, "id"),
+		}
+
+		if err := apiauth.AuthorizeEnrollmentIDs(r.Context(), filter.EnrollmentIDs); err != nil {
+			logAndWriteJSONError(logger, w, "authorizing", err, http.StatusForbidden)
+			return
+		}
+		if cred := apiauth.FromContext(r.Context()); cred != nil && len(cred.EnrollmentIDs) > 0 {
+			filter.Allow = func(e *eventstream.Event) bool {
+				return apiauth.AllowsEnrollmentID(cred, e.EnrollmentID)
+			}
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+
+		backlog, sub := broker.Subscribe(lastEventID, filter)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		for _, e := range backlog {
+			if err := writeEvent(w, e); err != nil {
+				logger.Debug("msg", "writing event", "err", err)
+				return
+			}
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					logger.Info("msg", "event stream closed")
+					return
+				}
+				if err := writeEvent(w, e); err != nil {
+					logger.Debug("msg", "writing event", "err", err)
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					logger.Debug("msg", "writing keep-alive", "err", err)
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -1,6 +1,17 @@
 package api
 
+//go:generate oa2js -o APICredential.json ../../docs/openapi.yaml APICredential
+//go:generate oa2js -o APICredentialRequest.json ../../docs/openapi.yaml APICredentialRequest
+//go:generate oa2js -o CommandTemplate.json ../../docs/openapi.yaml CommandTemplate
+//go:generate oa2js -o DDMDeclaration.json ../../docs/openapi.yaml DDMDeclaration
+//go:generate oa2js -o DDMDeclarationSet.json ../../docs/openapi.yaml DDMDeclarationSet
+//go:generate oa2js -o DDMEnrollmentSets.json ../../docs/openapi.yaml DDMEnrollmentSets
+//go:generate oa2js -o EnqueueBatchCommand.json ../../docs/openapi.yaml EnqueueBatchCommand
+//go:generate oa2js -o EnqueueBatchRequest.json ../../docs/openapi.yaml EnqueueBatchRequest
+//go:generate oa2js -o EnrollmentToken.json ../../docs/openapi.yaml EnrollmentToken
 //go:generate oa2js -o ErrorResponse.json ../../docs/openapi.yaml ErrorResponse
 //go:generate oa2js -o PushCertResponse.json ../../docs/openapi.yaml PushCertResponse
-//go:generate go-jsonschema -p $GOPACKAGE --tags json --only-models --output schema.go ErrorResponse.json PushCertResponse.json
-//go:generate rm -f ErrorResponse.json PushCertResponse.json
+//go:generate oa2js -o PushCertCSRResponse.json ../../docs/openapi.yaml PushCertCSRResponse
+//go:generate oa2js -o TemplateEnqueueRequest.json ../../docs/openapi.yaml TemplateEnqueueRequest
+//go:generate go-jsonschema -p $GOPACKAGE --tags json --only-models --output schema.go APICredential.json APICredentialRequest.json CommandTemplate.json DDMDeclaration.json DDMDeclarationSet.json DDMEnrollmentSets.json EnqueueBatchCommand.json EnqueueBatchRequest.json EnrollmentToken.json ErrorResponse.json PushCertResponse.json PushCertCSRResponse.json TemplateEnqueueRequest.json
+//go:generate rm -f APICredential.json APICredentialRequest.json CommandTemplate.json DDMDeclaration.json DDMDeclarationSet.json DDMEnrollmentSets.json EnqueueBatchCommand.json EnqueueBatchRequest.json EnrollmentToken.json ErrorResponse.json PushCertResponse.json PushCertCSRResponse.json TemplateEnqueueRequest.json
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// IdempotencyKeyHeader is the HTTP header containing the idempotency key of a request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses that are replayed
+	// from the stored result of a previous request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// DefaultIdempotencyWindow is the default duration that results of
+	// requests with idempotency keys are kept for.
+	DefaultIdempotencyWindow = 24 * time.Hour
+
+	// maxIdempotencyKeyLength is the maximum length of an idempotency key.
+	maxIdempotencyKeyLength = 255
+)
+
+// WithIdempotencyStore enables idempotency keys for the enqueue handlers.
+// The results of requests with idempotency keys are kept in store for
+// window. If window is zero then [DefaultIdempotencyWindow] is used.
+func WithIdempotencyStore(store storage.IdempotencyStore, window time.Duration) Option {
+	return func(c *config) {
+		c.idemStore = store
+		c.idemWindow = window
+	}
+}
+
+// idempotencyHandler wraps next with an idempotency handler for action
+// if an idempotency store is configured.
+func (c *config) idempotencyHandler(action string, next http.Handler, logger log.Logger) http.Handler {
+	if c.idemStore == nil {
+		return next
+	}
+	return NewIdempotencyHandler(next, c.idemStore, action, c.idemWindow, logger)
+}
+
+// recordingWriter captures the HTTP status and body written to a response.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// idempotencyActor returns the identity of the caller of r.
+func idempotencyActor(r *http.Request) string {
+	if cred := apiauth.FromContext(r.Context()); cred != nil {
+		return cred.Name
+	}
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
+// hashStrings returns the hex-encoded SHA-256 hash of s.
+// Each string is length-prefixed to avoid ambiguity.
+func hashStrings(s ...string) string {
+	h := sha256.New()
+	for _, v := range s {
+		fmt.Fprintf(h, "%d:%s", len(v), v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewIdempotencyHandler makes requests to next idempotent using the
+// caller-supplied key in the [IdempotencyKeyHeader] header.
+//
+// The HTTP status and body of the response to the first request with a
+// key is kept in store for window. Repeated requests with the same key
+// (from the same caller) are replied to with that stored response
+// instead of reaching next. Requests without a key always reach next.
+// A repeated request with a different method, URL, or body than the
+// original is rejected as is a repeated request while the original
+// is still in progress. If next panics, replies with a server error
+// (5xx), or its response cannot be stored then the key is released so
+// the request may be retried.
+// Action differentiates handlers sharing a store.
+func NewIdempotencyHandler(next http.Handler, store storage.IdempotencyStore, action string, window time.Duration, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		idemKey := r.Header.Get(IdempotencyKeyHeader)
+		if idemKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		if len(idemKey) > maxIdempotencyKeyLength {
+			err := fmt.Errorf("idempotency key longer than %d characters", maxIdempotencyKeyLength)
+			logAndWriteJSONError(logger, w, "checking idempotency key", err, http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading body", err, http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := hashStrings(action, idempotencyActor(r), idemKey)
+		reqHash := hashStrings(r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"), string(body))
+
+		// mark the key as in progress so that concurrent repeated
+		// requests (possibly to other replicas) are not also handled.
+		rec := &storage.IdempotencyRecord{
+			Key:         key,
+			RequestHash: reqHash,
+			ExpiresAt:   time.Now().Add(window),
+		}
+		created, err := store.CreateIdempotencyRecord(r.Context(), rec)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "creating idempotency record", err, http.StatusInternalServerError)
+			return
+		}
+
+		if !created {
+			existing, err := store.RetrieveIdempotencyRecord(r.Context(), key)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieving idempotency record", err, http.StatusInternalServerError)
+				return
+			}
+			if existing != nil && existing.RequestHash != reqHash {
+				err = errors.New("idempotency key already used for a different request")
+				logAndWriteJSONError(logger, w, "checking idempotency key", err, http.StatusUnprocessableEntity)
+				return
+			}
+			if existing == nil || existing.Status == 0 {
+				// a missing record means it expired or was cleared
+				// after a failure since we tried to create it.
+				err = errors.New("request with idempotency key in progress")
+				logAndWriteJSONError(logger, w, "checking idempotency key", err, http.StatusConflict)
+				return
+			}
+			logger.Debug("msg", "replaying idempotent response", "status", existing.Status)
+			if e := audit.FromContext(r.Context()); e != nil {
+				if e.Details == nil {
+					e.Details = make(map[string]string)
+				}
+				e.Details["idempotent_replay"] = "true"
+			}
+			w.Header().Set("Content-type", "application/json")
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(existing.Status)
+			w.Write(existing.Response)
+			return
+		}
+
+		// clear the in-progress record if next panics, fails with a
+		// server error, or the result cannot be stored so that the
+		// request may be retried with the same key.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := store.DeleteIdempotencyRecord(context.Background(), key); err != nil {
+				logger.Info("msg", "deleting idempotency record", "err", err)
+			}
+		}()
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		rec.Status = rw.status
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		if rec.Status >= http.StatusInternalServerError {
+			// server errors are likely transient: do not replay them
+			return
+		}
+		rec.Response = rw.body.Bytes()
+		// store the result even if the request has been canceled
+		if err = store.StoreIdempotencyRecord(context.Background(), rec); err != nil {
+			logger.Info("msg", "storing idempotency record", "err", err)
+			return
+		}
+		stored = true
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("test panic")
+		}
+		w.Write([]byte(`{}`))
+	})
+	h := NewIdempotencyHandler(next, inmem.New(), "test", 0, log.NopLogger)
+
+	serve := func() (rec *httptest.ResponseRecorder, panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		req := httptest.NewRequest("PUT", "/test", nil)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return
+	}
+
+	if _, panicked := serve(); !panicked {
+		t.Fatal("expected panic")
+	}
+
+	// the retry is not rejected as in progress
+	rec, _ := serve()
+	if have, want := rec.Code, http.StatusOK; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+	if have, want := calls, 2; have != want {
+		t.Errorf("calls: have: %v, want: %v", have, want)
+	}
+
+	// a further retry is replayed
+	rec, _ = serve()
+	if have, want := rec.Header().Get(IdempotentReplayedHeader), "true"; have != want {
+		t.Errorf("replayed header: have: %v, want: %v", have, want)
+	}
+	if have, want := calls, 2; have != want {
+		t.Errorf("calls: have: %v, want: %v", have, want)
+	}
+}
+
+func TestIdempotencyServerErrorReleasesKey(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "transient failure", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	h := NewIdempotencyHandler(next, inmem.New(), "test", 0, log.NopLogger)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/test", nil)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if have, want := serve().Code, http.StatusInternalServerError; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+
+	// the retry reaches next instead of replaying the server error
+	rec := serve()
+	if have, want := rec.Code, http.StatusOK; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+	if have, want := rec.Header().Get(IdempotentReplayedHeader), ""; have != want {
+		t.Errorf("replayed header: have: %v, want: %v", have, want)
+	}
+	if have, want := calls, 2; have != want {
+		t.Errorf("calls: have: %v, want: %v", have, want)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/profileencrypt"
+	"github.com/micromdm/nanomdm/profilesign"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// WithIdentityCertRetriever enables encrypting the profile of
+// InstallProfile commands to the identity certificates of enrollments
+// retrieved with store (see [RawCommandEnqueueToIDsHandler]).
+func WithIdentityCertRetriever(store storage.IdentityCertRetriever) Option {
+	return func(c *config) {
+		c.identityCerts = store
+	}
+}
+
+// encryptProfileItems encrypts the profile of the InstallProfile
+// command cmd to the identity certificate in certs of each enrollment
+// ID and returns the per-enrollment commands. The commands are signed
+// if signer is not nil. Each command has a unique CommandUUID.
+func encryptProfileItems(cmd *mdm.Command, ids []string, certs map[string]*x509.Certificate, signer *profilesign.Signer) ([]*storage.EnqueueItem, error) {
+	items := make([]*storage.EnqueueItem, 0, len(ids))
+	for _, id := range ids {
+		cert := certs[id]
+		if cert == nil {
+			return nil, fmt.Errorf("no identity certificate for enrollment id %s", id)
+		}
+		cmdUUID, err := mdm.NewCommandUUID()
+		if err != nil {
+			return nil, fmt.Errorf("generating command uuid: %w", err)
+		}
+		encCmd, err := profileencrypt.EncryptInstallProfile(cmd, cert, cmdUUID)
+		if err != nil {
+			return nil, fmt.Errorf("enrollment id %s: %w", id, err)
+		}
+		if signer != nil {
+			if encCmd, err = signer.SignInstallProfile(encCmd); err != nil {
+				return nil, fmt.Errorf("enrollment id %s: signing profile: %w", id, err)
+			}
+		}
+		items = append(items, &storage.EnqueueItem{IDs: []string{id}, Command: encCmd})
+	}
+	return items, nil
+}
+
+// enqueueEncryptedProfile enqueues the InstallProfile command of the
+// body of r with its profile encrypted to each enrollment ID and
+// writes the per-command batch result.
+func enqueueEncryptedProfile(w http.ResponseWriter, r *http.Request, pe *api.PushEnqueuer, config *config, idGetter func(*http.Request) ([]string, error), logger log.Logger) {
+	if config.identityCerts == nil {
+		logAndWriteJSONError(logger, w, "encrypting profile", errors.New("profile encryption not enabled"), http.StatusBadRequest)
+		return
+	}
+
+	ids, err := idGetter(r)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "getting enrollment ids", err, idGetterErrorStatus(err))
+		return
+	} else if len(ids) < 1 {
+		logAndWriteJSONError(logger, w, "getting enrollment ids", errors.New("no enrollment ids"), http.StatusBadRequest)
+		return
+	}
+
+	if pace, err := paceFromRequest(r); err != nil || pace != nil {
+		logAndWriteJSONError(logger, w, "encrypting profile", errors.New("paced pushes not supported with encryption"), http.StatusBadRequest)
+		return
+	}
+
+	cmdBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "reading body", err, http.StatusInternalServerError)
+		return
+	}
+
+	var cmd *mdm.Command
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == jsonContentType {
+		cmd, err = mdm.CommandFromJSON(cmdBytes)
+	} else {
+		cmd, err = mdm.DecodeCommand(cmdBytes)
+	}
+	if err != nil {
+		logAndWriteJSONError(logger, w, "decoding command", err, http.StatusBadRequest)
+		return
+	} else if cmd.Command.RequestType != "InstallProfile" {
+		logAndWriteJSONError(logger, w, "encrypting profile", errors.New("not an InstallProfile command"), http.StatusBadRequest)
+		return
+	}
+
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.EnrollmentIDs = ids
+		e.RequestType = cmd.Command.RequestType
+		e.Details = map[string]string{
+			"encrypted":     "true",
+			"command_count": strconv.Itoa(len(ids)),
+		}
+	}
+
+	if err = authorizeEnqueue(r.Context(), ids, cmd.Raw); err != nil {
+		logAndWriteJSONError(logger, w, "encrypted profile enqueue request", err, http.StatusForbidden)
+		return
+	}
+
+	certs, err := config.identityCerts.RetrieveIdentityCerts(r.Context(), ids)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "retrieve identity certificates", err, http.StatusInternalServerError)
+		return
+	}
+
+	signer := config.profileSigner
+	if r.URL.Query().Get("nosign") != "" {
+		signer = nil
+	}
+
+	items, err := encryptProfileItems(cmd, ids, certs, signer)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "encrypting profile", err, http.StatusBadRequest)
+		return
+	}
+
+	br, header, err := pe.EnqueueBatchWithPush(r.Context(), items, r.URL.Query().Get("nopush") != "")
+	if err != nil {
+		if br == nil {
+			br = new(api.BatchResult)
+		}
+		// amend the result json with our error
+		// so as to be visible to HTTP API callers
+		amendAPIError(err, &br.EnqueueError)
+		logger.Info("msg", "enqueueing encrypted profile", "command_count", len(items), "err", err)
+	}
+	writeBatchResult(br, w, header, logger)
+}
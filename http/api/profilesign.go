@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/profilesign"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+	"github.com/micromdm/plist"
+)
+
+// signedProfileContentType is the media type of signed configuration profiles.
+const signedProfileContentType = "application/x-apple-aspen-config"
+
+// WithProfileSigner enables signing of configuration profiles with signer.
+// The profile Payload of InstallProfile commands enqueued with the
+// enqueue handler is signed unless already signed.
+func WithProfileSigner(signer *profilesign.Signer) Option {
+	return func(c *config) {
+		c.profileSigner = signer
+	}
+}
+
+// signInstallProfile signs the profile of the InstallProfile command
+// plist cmdBytes with signer and returns the re-serialized command.
+// Other commands are returned unchanged.
+func signInstallProfile(signer *profilesign.Signer, cmdBytes []byte) ([]byte, error) {
+	cmd, err := mdm.DecodeCommand(cmdBytes)
+	if err != nil || cmd.Command.RequestType != "InstallProfile" {
+		// leave decoding errors to the enqueuer
+		return cmdBytes, nil
+	}
+	signed, err := signer.SignInstallProfile(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("signing profile: %w", err)
+	}
+	return signed.Raw, nil
+}
+
+// NewSignProfileHandler signs the configuration profile read from the
+// HTTP body with signer. The signed profile is returned in the body.
+// Already signed profiles are rejected.
+func NewSignProfileHandler(signer *profilesign.Signer, logger log.Logger) http.HandlerFunc {
+	if signer == nil {
+		panic("nil signer")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading body", err, 0)
+			return
+		}
+
+		var dict map[string]interface{}
+		if profilesign.IsSigned(b) {
+			logAndWriteJSONError(logger, w, "signing profile", errors.New("profile already signed"), http.StatusBadRequest)
+			return
+		} else if err = plist.Unmarshal(b, &dict); err != nil || dict == nil {
+			if err == nil {
+				err = errors.New("profile is not a plist dictionary")
+			}
+			logAndWriteJSONError(logger, w, "decoding profile", err, http.StatusBadRequest)
+			return
+		}
+
+		signed, err := signer.Sign(b)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "signing profile", err, http.StatusBadRequest)
+			return
+		}
+
+		logger.Debug("msg", "signed profile", "size", len(b))
+
+		w.Header().Set("Content-Type", signedProfileContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="profile.mobileconfig"`)
+		if _, err = w.Write(signed); err != nil {
+			logger.Info("msg", "writing body", "err", err)
+		}
+	}
+}
@@ -8,13 +8,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
 
 	"github.com/micromdm/nanolib/log"
 	"github.com/micromdm/nanolib/log/ctxlog"
+	"github.com/micromdm/nanomdm/audit"
 	"github.com/micromdm/nanomdm/cryptoutil"
 	"github.com/micromdm/nanomdm/storage"
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 // NewRetrievePushCertHandler returns the topic and expiry of the stored APNs
@@ -81,27 +84,114 @@ func readPEMCertAndKey(input []byte) (cert []byte, key []byte, err error) {
 	return
 }
 
-// NewStorePushCertHandler reads a PEM-encoded certificate and private
-// key from the HTTP body and saves it to storage. This effectively
-// enables us to do something like:
+// PKCS12PasswordHeader is the HTTP header that contains the password
+// for PKCS#12 push certificate uploads.
+const PKCS12PasswordHeader = "X-PKCS12-Password"
+
+const (
+	pkcs12ContentType    = "application/x-pkcs12"
+	pkcs12FormFile       = "pkcs12"
+	pkcs12FormPassword   = "password"
+	maxMultipartMemory   = 1 << 20
+	multipartContentType = "multipart/form-data"
+)
+
+// readPKCS12CertAndKey decrypts a PKCS#12 (.p12) file from input
+// using password and returns the PEM certificate and private key in
+// cert and key respectively.
+func readPKCS12CertAndKey(input []byte, password string) (cert []byte, key []byte, err error) {
+	privKey, leaf, _, err := pkcs12.DecodeChain(input, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding PKCS#12: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	cert = cryptoutil.PEMCertificate(leaf.Raw)
+	key = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// readCertAndKey reads the push certificate and private key from r.
+// A PKCS#12 file is read from the body if the Content-Type is
+// "application/x-pkcs12" with the password in the [PKCS12PasswordHeader]
+// header. A PKCS#12 file is read from the "pkcs12" form file with the
+// password in the "password" form field if the Content-Type is
+// "multipart/form-data". Otherwise the body is read as concatenated
+// PEM-encoded certificate and private key.
+// The PEM certificate and private key are returned in cert and key respectively.
+func readCertAndKey(r *http.Request) (cert []byte, key []byte, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case pkcs12ContentType:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading body: %w", err)
+		}
+		return readPKCS12CertAndKey(b, r.Header.Get(PKCS12PasswordHeader))
+	case multipartContentType:
+		if err = r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return nil, nil, fmt.Errorf("parsing multipart form: %w", err)
+		}
+		f, _, err := r.FormFile(pkcs12FormFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading form file: %w", err)
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading form file: %w", err)
+		}
+		return readPKCS12CertAndKey(b, r.FormValue(pkcs12FormPassword))
+	default:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading body: %w", err)
+		}
+		return readPEMCertAndKey(b)
+	}
+}
+
+// NewStorePushCertHandler reads a certificate and private key from the
+// HTTP body and saves it to storage. By default a PEM-encoded
+// certificate and private key are read. This effectively enables us to
+// do something like:
 // `% cat push.pem push.key | curl -T - http://example.com:9001/v1/pushcert` to
 // upload our MDM APNs push cert.
+//
+// A PKCS#12 (.p12) file can also be uploaded by using a Content-Type of
+// "application/x-pkcs12" and supplying the password in the
+// [PKCS12PasswordHeader] header or by uploading a multipart form with
+// the file in the "pkcs12" field and the password in the "password" field.
 func NewStorePushCertHandler(storage storage.PushCertStorer, logger log.Logger) http.HandlerFunc {
+	return NewStorePushCertWithKeysHandler(storage, nil, logger)
+}
+
+// NewStorePushCertWithKeysHandler is like [NewStorePushCertHandler]
+// but also allows uploading a PEM-encoded certificate by itself.
+// In that case the private key is retrieved from keyStore using the
+// hash of the certificate's public key. Such a private key is held in
+// keyStore when generating a CSR with [NewPushCSRHandler].
+func NewStorePushCertWithKeysHandler(storage storage.PushCertStorer, keyStore storage.PushKeyStore, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := ctxlog.Logger(r.Context(), logger)
 
-		// read the body of the request
-		b, err := io.ReadAll(r.Body)
+		// read the cert and key from the request
+		certPEM, keyPEM, err := readCertAndKey(r)
 		if err != nil {
-			logAndWriteJSONError(logger, w, "reading body", err, 0)
+			logAndWriteJSONError(logger, w, "reading cert and key", err, http.StatusBadRequest)
 			return
 		}
 
-		// parse for the two separate cert and key PEM blocks
-		certPEM, keyPEM, err := readPEMCertAndKey(b)
-		if err != nil {
-			logAndWriteJSONError(logger, w, "reading PEM cert and key", err, http.StatusBadRequest)
-			return
+		// if only a certificate was provided try to find its held private key
+		var keyHash string
+		if len(certPEM) > 0 && len(keyPEM) < 1 {
+			keyPEM, keyHash, err = retrievePushKey(r, keyStore, certPEM)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieving held private key", err, http.StatusBadRequest)
+				return
+			}
 		}
 
 		// sanity check the provided cert and key to make sure they're usable as a pair.
@@ -125,6 +215,10 @@ func NewStorePushCertHandler(storage storage.PushCertStorer, logger log.Logger)
 			return
 		}
 
+		if e := audit.FromContext(r.Context()); e != nil {
+			e.Topic = topic
+		}
+
 		// store the push cert and key
 		err = storage.StorePushCert(r.Context(), certPEM, keyPEM)
 		if err != nil {
@@ -135,6 +229,13 @@ func NewStorePushCertHandler(storage storage.PushCertStorer, logger log.Logger)
 		// debug log our success
 		logger.Debug("msg", "stored push cert", "topic", topic)
 
+		// the held private key is now stored with the push cert
+		if keyHash != "" {
+			if err = keyStore.DeletePushKey(r.Context(), keyHash); err != nil {
+				logger.Info("msg", "deleting held private key", "hash", keyHash, "err", err)
+			}
+		}
+
 		// JSON API response
 		out := &PushCertResponseJson{
 			Topic:    topic,
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/test"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type pushCertStorer struct {
+	pemCert []byte
+	pemKey  []byte
+}
+
+func (s *pushCertStorer) StorePushCert(_ context.Context, pemCert, pemKey []byte) error {
+	s.pemCert = pemCert
+	s.pemKey = pemKey
+	return nil
+}
+
+// newPKCS12 creates a new PKCS#12 file from the test push certificate.
+func newPKCS12(t *testing.T, password string) []byte {
+	t.Helper()
+	pemCert, err := os.ReadFile("../../test/e2e/testdata/push.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTmpl, err := cryptoutil.DecodePEMCertificate(pemCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTmpl.PublicKey = nil
+	key, cert, err := test.SelfSignedCertRSAResigner(pushTmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := pkcs12.LegacyDES.Encode(key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p12
+}
+
+func TestStorePushCertPKCS12(t *testing.T) {
+	const password = "secret"
+	p12 := newPKCS12(t, password)
+
+	multipartBody := func(password string) (*bytes.Buffer, string) {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		fw, err := mw.CreateFormFile("pkcs12", "push.p12")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(p12)
+		mw.WriteField("password", password)
+		mw.Close()
+		return body, mw.FormDataContentType()
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    func() *http.Request
+		status int
+	}{
+		{
+			name: "body",
+			req: func() *http.Request {
+				r := httptest.NewRequest("PUT", "/v1/pushcert", bytes.NewReader(p12))
+				r.Header.Set("Content-Type", "application/x-pkcs12")
+				r.Header.Set(PKCS12PasswordHeader, password)
+				return r
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "body-bad-password",
+			req: func() *http.Request {
+				r := httptest.NewRequest("PUT", "/v1/pushcert", bytes.NewReader(p12))
+				r.Header.Set("Content-Type", "application/x-pkcs12")
+				r.Header.Set(PKCS12PasswordHeader, "wrong")
+				return r
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "multipart",
+			req: func() *http.Request {
+				body, contentType := multipartBody(password)
+				r := httptest.NewRequest("PUT", "/v1/pushcert", body)
+				r.Header.Set("Content-Type", contentType)
+				return r
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "multipart-bad-password",
+			req: func() *http.Request {
+				body, contentType := multipartBody("wrong")
+				r := httptest.NewRequest("PUT", "/v1/pushcert", body)
+				r.Header.Set("Content-Type", contentType)
+				return r
+			},
+			status: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := new(pushCertStorer)
+			rec := httptest.NewRecorder()
+			NewStorePushCertHandler(store, log.NopLogger).ServeHTTP(rec, tc.req())
+
+			if have, want := rec.Code, tc.status; have != want {
+				t.Fatalf("status: have %d, want %d: %s", have, want, rec.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var resp PushCertResponseJson
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			topic, err := cryptoutil.TopicFromPEMCert(store.pemCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := resp.Topic, topic; have != want {
+				t.Errorf("topic: have %q, want %q", have, want)
+			}
+			if len(store.pemKey) < 1 {
+				t.Error("expected stored private key")
+			}
+		})
+	}
+}
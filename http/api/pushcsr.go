@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/push/pushcsr"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// DefaultPushCSRCommonName is the CSR common name used when none is provided.
+const DefaultPushCSRCommonName = "NanoMDM APNs"
+
+// encodePushCertRequest signs csr with signer and returns the base64 plist
+// push certificate request. An empty string is returned if signer is nil.
+func encodePushCertRequest(signer *pushcsr.VendorSigner, csr []byte) (string, error) {
+	if signer == nil {
+		return "", nil
+	}
+	req, err := signer.Sign(csr)
+	if err != nil {
+		return "", err
+	}
+	b, err := req.Encode()
+	return string(b), err
+}
+
+// NewPushCSRHandler generates a new private key and CSR for an APNs
+// push certificate. The private key is held in store so that the
+// Apple-issued push certificate can later be uploaded by itself.
+// The optional "cn" and "email" form (or query) parameters set the
+// subject of the CSR. If signer is not nil then the CSR is also signed
+// with the MDM vendor certificate and returned as a push certificate
+// request suitable for uploading to the Apple Push Certificates Portal.
+func NewPushCSRHandler(store storage.PushKeyStore, signer *pushcsr.VendorSigner, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		cn := r.FormValue("cn")
+		if cn == "" {
+			cn = DefaultPushCSRCommonName
+		}
+
+		key, csr, err := pushcsr.GenerateKeyAndCSR(cn, r.FormValue("email"))
+		if err != nil {
+			logAndWriteJSONError(logger, w, "generating key and CSR", err, 0)
+			return
+		}
+
+		hash, err := cryptoutil.PublicKeyHash(&key.PublicKey)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "hashing public key", err, 0)
+			return
+		}
+
+		pushReq, err := encodePushCertRequest(signer, csr)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "signing CSR", err, 0)
+			return
+		}
+
+		pemKey := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+
+		if err = store.StorePushKey(r.Context(), hash, pemKey); err != nil {
+			logAndWriteJSONError(logger, w, "storing push key", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "generated push CSR", "public_key_hash", hash, "signed", pushReq != "")
+
+		out := &PushCertCSRResponseJson{
+			PublicKeyHash:   hash,
+			Csr:             string(pushcsr.PEMCSR(csr)),
+			PushCertRequest: pushReq,
+		}
+
+		writeJSON(w, out, http.StatusOK, logger)
+	}
+}
+
+// NewSignPushCSRHandler signs a PEM or DER-encoded CSR read from the
+// HTTP body with the MDM vendor certificate of signer. The returned
+// push certificate request is suitable for uploading to the Apple Push
+// Certificates Portal. The private key of the CSR is not held by the
+// server and must be supplied when uploading the issued push certificate.
+func NewSignPushCSRHandler(signer *pushcsr.VendorSigner, logger log.Logger) http.HandlerFunc {
+	if signer == nil {
+		panic("nil signer")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading body", err, 0)
+			return
+		}
+
+		csrDER, csr, err := pushcsr.DecodeCSR(b)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "decoding CSR", err, http.StatusBadRequest)
+			return
+		}
+
+		hash, err := cryptoutil.PublicKeyHash(csr.PublicKey)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "hashing public key", err, http.StatusBadRequest)
+			return
+		}
+
+		pushReq, err := encodePushCertRequest(signer, csrDER)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "signing CSR", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "signed push CSR", "public_key_hash", hash)
+
+		out := &PushCertCSRResponseJson{
+			PublicKeyHash:   hash,
+			Csr:             string(pushcsr.PEMCSR(csrDER)),
+			PushCertRequest: pushReq,
+		}
+
+		writeJSON(w, out, http.StatusOK, logger)
+	}
+}
+
+// retrievePushKey retrieves the held private key matching the public
+// key of the PEM-encoded certificate certPEM from store.
+// The public key hash of the held private key is also returned.
+func retrievePushKey(r *http.Request, store storage.PushKeyStore, certPEM []byte) ([]byte, string, error) {
+	if store == nil {
+		return nil, "", errors.New("missing private key")
+	}
+	cert, err := cryptoutil.DecodePEMCertificate(certPEM)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode PEM cert: %w", err)
+	}
+	hash, err := cryptoutil.PublicKeyHash(cert.PublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("hashing public key: %w", err)
+	}
+	keyPEM, err := store.RetrievePushKey(r.Context(), hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("retrieving push key: %w", err)
+	} else if keyPEM == nil {
+		return nil, "", fmt.Errorf("missing private key and no held private key found for public key hash: %s", hash)
+	}
+	return keyPEM, hash, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/push/pushcsr"
+	"github.com/micromdm/nanomdm/test"
+)
+
+type pushKeyStore map[string][]byte
+
+func (s pushKeyStore) StorePushKey(_ context.Context, hash string, pemKey []byte) error {
+	s[hash] = pemKey
+	return nil
+}
+
+func (s pushKeyStore) RetrievePushKey(_ context.Context, hash string) ([]byte, error) {
+	return s[hash], nil
+}
+
+func (s pushKeyStore) DeletePushKey(_ context.Context, hash string) error {
+	delete(s, hash)
+	return nil
+}
+
+// issuePushCert simulates Apple issuing a push certificate for csrPEM.
+func issuePushCert(t *testing.T, csrPEM []byte) []byte {
+	t.Helper()
+	_, csr, err := pushcsr.DecodeCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemCert, err := os.ReadFile("../../test/e2e/testdata/push.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := cryptoutil.DecodePEMCertificate(pemCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(2)
+	tmpl.NotBefore = time.Now().Add(-time.Minute)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	caKey, caCert, err := test.SimpleSelfSignedRSAKeypair("apple", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cryptoutil.PEMCertificate(der)
+}
+
+func TestPushCSRFlow(t *testing.T) {
+	vendorKey, vendorCert, err := test.SimpleSelfSignedRSAKeypair("vendor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := pushcsr.NewVendorSigner(
+		cryptoutil.PEMCertificate(vendorCert.Raw),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(vendorKey)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyStore := make(pushKeyStore)
+	certStore := new(pushCertStorer)
+
+	form := url.Values{"cn": {"Example"}, "email": {"admin@example.com"}}
+	r := httptest.NewRequest("POST", "/v1/pushcert/csr", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	NewPushCSRHandler(keyStore, signer, log.NopLogger).ServeHTTP(rec, r)
+	if have, want := rec.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, rec.Body.String())
+	}
+
+	var resp PushCertCSRResponseJson
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.PushCertRequest == "" {
+		t.Error("expected push cert request")
+	}
+	heldKey, ok := keyStore[resp.PublicKeyHash]
+	if !ok {
+		t.Fatal("expected held private key")
+	}
+
+	certPEM := issuePushCert(t, []byte(resp.Csr))
+
+	// upload only the certificate; it should pair with the held key
+	r = httptest.NewRequest("PUT", "/v1/pushcert", bytes.NewReader(certPEM))
+	rec = httptest.NewRecorder()
+	NewStorePushCertWithKeysHandler(certStore, keyStore, log.NopLogger).ServeHTTP(rec, r)
+	if have, want := rec.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, rec.Body.String())
+	}
+	if !bytes.Equal(certStore.pemKey, heldKey) {
+		t.Error("stored key does not match held key")
+	}
+	if _, ok := keyStore[resp.PublicKeyHash]; ok {
+		t.Error("expected held private key to be deleted")
+	}
+
+	// without a key store a certificate by itself should fail
+	r = httptest.NewRequest("PUT", "/v1/pushcert", bytes.NewReader(certPEM))
+	rec = httptest.NewRecorder()
+	NewStorePushCertHandler(new(pushCertStorer), log.NopLogger).ServeHTTP(rec, r)
+	if have, want := rec.Code, http.StatusBadRequest; have != want {
+		t.Errorf("status: have %d, want %d", have, want)
+	}
+
+	// sign the CSR separately
+	r = httptest.NewRequest("POST", "/v1/pushcert/sign", strings.NewReader(resp.Csr))
+	rec = httptest.NewRecorder()
+	NewSignPushCSRHandler(signer, log.NopLogger).ServeHTTP(rec, r)
+	if have, want := rec.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, rec.Body.String())
+	}
+	var signResp PushCertCSRResponseJson
+	if err := json.NewDecoder(rec.Body).Decode(&signResp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := signResp.PublicKeyHash, resp.PublicKeyHash; have != want {
+		t.Errorf("public key hash: have %q, want %q", have, want)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/push/pacer"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// NewPushJobHandler returns the progress and per-enrollment ID results
+// of the paced push job identified by the URL path.
+// API credentials restricted to enrollment IDs may only retrieve jobs
+// of their enrollment IDs.
+// This probably necessitates stripping the URL prefix before using.
+func NewPushJobHandler(p *pacer.Pacer, logger log.Logger) http.HandlerFunc {
+	if p == nil {
+		panic("nil pacer")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "get push job id", errors.New("missing push job id"), http.StatusBadRequest)
+			return
+		}
+
+		job := p.Job(r.URL.Path)
+		if job == nil {
+			logAndWriteJSONError(logger, w, "get push job", errors.New("push job not found"), http.StatusNotFound)
+			return
+		}
+
+		if err := apiauth.AuthorizeEnrollmentIDs(r.Context(), job.IDs); err != nil {
+			logAndWriteJSONError(logger, w, "push job", err, http.StatusForbidden)
+			return
+		}
+
+		writeJSON(w, job, http.StatusOK, logger)
+	}
+}
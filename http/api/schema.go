@@ -4,12 +4,146 @@ package api
 
 import "time"
 
+// API credential. The secret is only present when a credential is created or
+// rotated.
+type APICredentialJson struct {
+	// When the credential was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Enrollment IDs the credential is restricted to. Empty means no restriction.
+	EnrollmentIds []string `json:"enrollment_ids,omitempty"`
+
+	// Name of the credential. Used as the HTTP Basic username.
+	Name string `json:"name"`
+
+	// Scopes granted to the credential.
+	Scopes []string `json:"scopes"`
+
+	// The credential secret. Used as the HTTP Basic password.
+	Secret string `json:"secret,omitempty"`
+
+	// When the credential was last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// API credential creation request.
+type APICredentialRequestJson struct {
+	// Enrollment IDs to restrict the credential to. Empty means no restriction.
+	EnrollmentIds []string `json:"enrollment_ids,omitempty"`
+
+	// Name of the credential. Used as the HTTP Basic username.
+	Name string `json:"name"`
+
+	// Scopes granted to the credential.
+	Scopes []string `json:"scopes"`
+}
+
+// Named MDM command template.
+type CommandTemplateJson struct {
+	// The command plist template with {{name}} variable placeholders.
+	Body string `json:"body"`
+
+	// When the template was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Name of the template.
+	Name string `json:"name"`
+
+	// The sorted variable names of the placeholders in the template.
+	Placeholders []string `json:"placeholders,omitempty"`
+
+	// When the template was last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Declarative Management declaration.
+type DDMDeclarationJson struct {
+	// When the declaration was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Identifier of the declaration.
+	Identifier string `json:"identifier"`
+
+	// Token that changes whenever the declaration changes.
+	ServerToken string `json:"server_token"`
+
+	// Type of the declaration.
+	Type string `json:"type"`
+
+	// When the declaration was last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Named set of Declarative Management declarations.
+type DDMDeclarationSetJson struct {
+	// The sorted identifiers of the declarations in the set.
+	Declarations []string `json:"declarations"`
+
+	// Name of the set.
+	Name string `json:"name"`
+}
+
+// Declaration sets assigned to an enrollment.
+type DDMEnrollmentSetsJson struct {
+	// Enrollment ID.
+	Id string `json:"id"`
+
+	// The sorted names of the sets assigned to the enrollment.
+	Sets []string `json:"sets"`
+}
+
+// A command to enqueue in a batch enqueue request.
+type EnqueueBatchCommandJson struct {
+	// The JSON representation of the MDM command dictionary. Binary data is
+	// represented by an object with a single "$data" key of the base64-encoded
+	// data. A CommandUUID is generated if omitted.
+	Command map[string]interface{} `json:"command,omitempty"`
+
+	// Enrollment IDs to enqueue the command to.
+	Ids []string `json:"ids"`
+
+	// The base64-encoded MDM command plist. Used if command is not present.
+	RawCommand string `json:"raw_command,omitempty"`
+}
+
+// Batch enqueue request.
+type EnqueueBatchRequestJson struct {
+	// The commands to enqueue.
+	Commands []EnqueueBatchCommandJson `json:"commands"`
+}
+
+// One-time enrollment token.
+type EnrollmentTokenJson struct {
+	// When the token expires.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Label describing who or what the token was issued for.
+	Label string `json:"label,omitempty"`
+
+	// The token. Use as the "token" query parameter of the enrollment profile
+	// endpoint. It is only returned once.
+	Token string `json:"token"`
+}
+
 // Error response.
 type ErrorResponseJson struct {
 	// Error response string.
 	Error string `json:"error"`
 }
 
+// APNs push certificate CSR response.
+type PushCertCSRResponseJson struct {
+	// The PEM-encoded CSR.
+	Csr string `json:"csr"`
+
+	// Hex-encoded SHA-256 hash of the DER-encoded public key of the CSR.
+	PublicKeyHash string `json:"public_key_hash"`
+
+	// The base64-encoded plist push certificate request signed by the MDM
+	// vendor certificate. Only present if a vendor certificate is configured.
+	PushCertRequest string `json:"push_cert_request,omitempty"`
+}
+
 // APNs push certificate and key upload response.
 type PushCertResponseJson struct {
 	// Expiration date of the uploaded APNs certificate.
@@ -18,3 +152,16 @@ type PushCertResponseJson struct {
 	// The "topic" (UID attribute) from the uploaded APNs certificate.
 	Topic string `json:"topic"`
 }
+
+// Template enqueue request.
+type TemplateEnqueueRequestJson struct {
+	// Per-enrollment ID template variables. Map key is the enrollment ID. These
+	// override vars.
+	IdVars map[string]map[string]string `json:"id_vars,omitempty"`
+
+	// Enrollment IDs to render the template for and enqueue to.
+	Ids []string `json:"ids"`
+
+	// Template variables for all enrollment IDs.
+	Vars map[string]string `json:"vars,omitempty"`
+}
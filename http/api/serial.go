@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// SerialTargetPrefix prefixes serial number targets in place of enrollment IDs.
+//
+// A target of "serial:<serial>" selects the device channel of the
+// device with the serial number. Append ":user:<short name>" to select
+// the user channel of the user with the short name instead or ":all"
+// to select the device channel and all user channels.
+const SerialTargetPrefix = "serial:"
+
+var (
+	// ErrInvalidSerialTarget is returned for malformed serial number targets.
+	ErrInvalidSerialTarget = errors.New("invalid serial number target")
+
+	// ErrNoSerialEnrollments is returned when a serial number target
+	// resolves to no enrollment IDs.
+	ErrNoSerialEnrollments = errors.New("no enrollments for serial number target")
+)
+
+// WithSerialNumberResolver enables serial number targets (see
+// [SerialTargetPrefix]) for the push and enqueue handlers.
+func WithSerialNumberResolver(resolver storage.SerialNumberResolver) Option {
+	return func(c *config) {
+		c.serialResolver = resolver
+	}
+}
+
+// ParseSerialTarget parses the serial number target target.
+// The returned bool is false if target is not a serial number target.
+func ParseSerialTarget(target string) (string, storage.ChannelSelector, bool, error) {
+	var sel storage.ChannelSelector
+	if !strings.HasPrefix(target, SerialTargetPrefix) {
+		return "", sel, false, nil
+	}
+	serial, channel, _ := strings.Cut(target[len(SerialTargetPrefix):], ":")
+	if serial == "" {
+		return "", sel, true, fmt.Errorf("%w: %s: empty serial number", ErrInvalidSerialTarget, target)
+	}
+	switch {
+	case channel == "":
+	case channel == "all":
+		sel.All = true
+	case strings.HasPrefix(channel, "user:") && len(channel) > len("user:"):
+		sel.UserShortName = channel[len("user:"):]
+	default:
+		return "", sel, true, fmt.Errorf("%w: %s: unknown channel selector", ErrInvalidSerialTarget, target)
+	}
+	return serial, sel, true, nil
+}
+
+// SerialIDGetter wraps idGetter to resolve serial number targets (see
+// [SerialTargetPrefix]) to enrollment IDs using resolver. Other
+// targets are passed through as enrollment IDs. Duplicate enrollment
+// IDs are removed.
+func SerialIDGetter(resolver storage.SerialNumberResolver, idGetter func(*http.Request) ([]string, error)) func(*http.Request) ([]string, error) {
+	if resolver == nil {
+		panic("nil resolver")
+	}
+	return func(r *http.Request) ([]string, error) {
+		targets, err := idGetter(r)
+		if err != nil {
+			return targets, err
+		}
+		ids := make([]string, 0, len(targets))
+		seen := make(map[string]struct{})
+		add := func(id string) {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+		for _, target := range targets {
+			serial, sel, ok, err := ParseSerialTarget(target)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				add(target)
+				continue
+			}
+			resolved, err := resolver.ResolveSerialNumber(r.Context(), serial, sel)
+			if err != nil {
+				return nil, fmt.Errorf("resolving serial number %s: %w", serial, err)
+			} else if len(resolved) < 1 {
+				return nil, fmt.Errorf("%w: %s", ErrNoSerialEnrollments, target)
+			}
+			for _, id := range resolved {
+				add(id)
+			}
+		}
+		return ids, nil
+	}
+}
+
+// idGetterErrorStatus returns the HTTP status for errors from ID getters.
+func idGetterErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidSerialTarget):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNoSerialEnrollments):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/micromdm/nanomdm/api"
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/cmdtemplate"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// templateEnqueuePath is the URL path suffix for enqueueing a rendered template.
+const templateEnqueuePath = "/enqueue"
+
+// TemplateStorage is required for the command template handler.
+type TemplateStorage interface {
+	storage.CommandTemplateStore
+	storage.EnrollmentAttributesRetriever
+}
+
+// WithCommandTemplateStore enables the command template handler
+// backed by store.
+func WithCommandTemplateStore(store TemplateStorage) Option {
+	return func(c *config) {
+		c.tmplStore = store
+	}
+}
+
+// commandTemplateJSON converts tmpl to its JSON response.
+func commandTemplateJSON(tmpl *storage.CommandTemplate) *CommandTemplateJson {
+	out := &CommandTemplateJson{
+		Name:      tmpl.Name,
+		Body:      string(tmpl.Body),
+		CreatedAt: tmpl.CreatedAt,
+		UpdatedAt: tmpl.UpdatedAt,
+	}
+	if t, err := cmdtemplate.Parse(tmpl.Body); err == nil {
+		out.Placeholders = t.Placeholders()
+	}
+	return out
+}
+
+// renderTemplateItems renders tmpl for each enrollment ID of req.
+// Each rendered command is its own enqueue item.
+func renderTemplateItems(tmpl *cmdtemplate.Template, req *TemplateEnqueueRequestJson, attrs map[string]*storage.EnrollmentAttributes) ([]*storage.EnqueueItem, error) {
+	for name := range req.Vars {
+		if cmdtemplate.IsBuiltin(name) {
+			return nil, fmt.Errorf("variable %q is built-in", name)
+		}
+	}
+	for id, vars := range req.IdVars {
+		for name := range vars {
+			if cmdtemplate.IsBuiltin(name) {
+				return nil, fmt.Errorf("enrollment id %s: variable %q is built-in", id, name)
+			}
+		}
+	}
+
+	items := make([]*storage.EnqueueItem, 0, len(req.Ids))
+	for _, id := range req.Ids {
+		vars := cmdtemplate.EnrollmentVars(id, attrs[id])
+		for k, v := range req.Vars {
+			vars[k] = v
+		}
+		for k, v := range req.IdVars[id] {
+			vars[k] = v
+		}
+		cmd, err := tmpl.Render(vars)
+		if err != nil {
+			return nil, fmt.Errorf("enrollment id %s: %w", id, err)
+		}
+		items = append(items, &storage.EnqueueItem{IDs: []string{id}, Command: cmd})
+	}
+	return items, nil
+}
+
+// NewCommandTemplatesHandler manages named MDM command templates and
+// enqueues commands rendered from them.
+//
+// With an empty URL path a GET lists the templates. Otherwise the URL
+// path is the name of the template: a PUT stores the command plist
+// template of the request body, a GET retrieves it, and a DELETE
+// removes it. These require the templates scope.
+// This probably necessitates stripping the URL prefix before using.
+//
+// A POST to the name suffixed with "/enqueue" renders the template for
+// each enrollment ID of the JSON body and enqueues the rendered
+// commands, sending push notifications to the enrollments. Variables
+// are taken from the request and from the stored enrollment attributes
+// (see [cmdtemplate.EnrollmentVars]). Each rendered command has a
+// unique CommandUUID. Per-command results are returned in the order of
+// the enrollment IDs. This requires the enqueue scope of the rendered
+// commands. If the "nopush" URL query parameter is present then no
+// pushes are sent.
+func NewCommandTemplatesHandler(store TemplateStorage, enqueuer storage.CommandEnqueuer, pusher push.Pusher, logger log.Logger, opts ...Option) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	if enqueuer == nil {
+		panic("nil enqueuer")
+	}
+
+	pe, peErr := newPushEnqueuer(enqueuer, pusher, logger, opts)
+	if peErr != nil {
+		panic(peErr)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		name := r.URL.Path
+		enqueue := strings.HasSuffix(name, templateEnqueuePath)
+		if enqueue {
+			name = strings.TrimSuffix(name, templateEnqueuePath)
+		}
+		if e := audit.FromContext(r.Context()); e != nil && name != "" {
+			e.Details = map[string]string{"name": name}
+		}
+
+		if !enqueue {
+			if err := apiauth.Authorize(r.Context(), apiauth.ScopeTemplates); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		switch {
+		case name == "" && !enqueue && r.Method == http.MethodGet:
+			tmpls, err := store.ListCommandTemplates(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "list command templates", err, http.StatusInternalServerError)
+				return
+			}
+			out := make([]*CommandTemplateJson, 0, len(tmpls))
+			for _, tmpl := range tmpls {
+				out = append(out, commandTemplateJSON(tmpl))
+			}
+			writeJSON(w, out, http.StatusOK, logger)
+
+		case name != "" && !enqueue && r.Method == http.MethodPut:
+			if strings.Contains(name, "/") {
+				logAndWriteJSONError(logger, w, "store command template", fmt.Errorf("invalid template name: %s", name), http.StatusBadRequest)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "reading body", err, http.StatusInternalServerError)
+				return
+			}
+			if _, err = cmdtemplate.Parse(body); err != nil {
+				logAndWriteJSONError(logger, w, "parsing command template", err, http.StatusBadRequest)
+				return
+			}
+			existing, err := store.RetrieveCommandTemplate(r.Context(), name)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve command template", err, http.StatusInternalServerError)
+				return
+			}
+			if err = store.StoreCommandTemplate(r.Context(), &storage.CommandTemplate{Name: name, Body: body}); err != nil {
+				logAndWriteJSONError(logger, w, "store command template", err, http.StatusInternalServerError)
+				return
+			}
+			tmpl, err := store.RetrieveCommandTemplate(r.Context(), name)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve command template", err, http.StatusInternalServerError)
+				return
+			} else if tmpl == nil {
+				logAndWriteJSONError(logger, w, "retrieve command template", fmt.Errorf("template not found: %s", name), http.StatusInternalServerError)
+				return
+			}
+			logger.Info("msg", "stored command template", "name", name)
+			header := http.StatusOK
+			if existing == nil {
+				header = http.StatusCreated
+			}
+			writeJSON(w, commandTemplateJSON(tmpl), header, logger)
+
+		case name != "" && !enqueue && (r.Method == http.MethodGet || r.Method == http.MethodDelete),
+			name != "" && enqueue && r.Method == http.MethodPost:
+			tmpl, err := store.RetrieveCommandTemplate(r.Context(), name)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "retrieve command template", err, http.StatusInternalServerError)
+				return
+			} else if tmpl == nil {
+				logAndWriteJSONError(logger, w, "retrieve command template", fmt.Errorf("template not found: %s", name), http.StatusNotFound)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, commandTemplateJSON(tmpl), http.StatusOK, logger)
+			case http.MethodDelete:
+				if err = store.DeleteCommandTemplate(r.Context(), name); err != nil {
+					logAndWriteJSONError(logger, w, "delete command template", err, http.StatusInternalServerError)
+					return
+				}
+				logger.Info("msg", "deleted command template", "name", name)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				enqueueTemplate(w, r, pe, store, tmpl, logger)
+			}
+
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// enqueueTemplate renders stored and enqueues the commands for the
+// template enqueue request of r.
+func enqueueTemplate(w http.ResponseWriter, r *http.Request, pe *api.PushEnqueuer, store storage.EnrollmentAttributesRetriever, stored *storage.CommandTemplate, logger log.Logger) {
+	req := new(TemplateEnqueueRequestJson)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		logAndWriteJSONError(logger, w, "decoding template enqueue request", err, http.StatusBadRequest)
+		return
+	}
+	if len(req.Ids) < 1 {
+		logAndWriteJSONError(logger, w, "template enqueue request", errors.New("no enrollment ids"), http.StatusBadRequest)
+		return
+	}
+
+	if e := audit.FromContext(r.Context()); e != nil {
+		e.EnrollmentIDs = req.Ids
+		e.Details = map[string]string{
+			"name":          stored.Name,
+			"command_count": strconv.Itoa(len(req.Ids)),
+		}
+	}
+
+	tmpl, err := cmdtemplate.Parse(stored.Body)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "parsing command template", err, http.StatusInternalServerError)
+		return
+	}
+
+	attrs, err := store.RetrieveEnrollmentAttributes(r.Context(), req.Ids)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "retrieve enrollment attributes", err, http.StatusInternalServerError)
+		return
+	}
+
+	items, err := renderTemplateItems(tmpl, req, attrs)
+	if err != nil {
+		logAndWriteJSONError(logger, w, "rendering command template", err, http.StatusBadRequest)
+		return
+	}
+
+	for _, item := range items {
+		if err := authorizeEnqueue(r.Context(), item.IDs, item.Command.Raw); err != nil {
+			logAndWriteJSONError(logger, w, "template enqueue request", err, http.StatusForbidden)
+			return
+		}
+	}
+
+	br, header, err := pe.EnqueueBatchWithPush(r.Context(), items, r.URL.Query().Get("nopush") != "")
+	if err != nil {
+		if br == nil {
+			br = new(api.BatchResult)
+		}
+		// amend the result json with our error
+		// so as to be visible to HTTP API callers
+		amendAPIError(err, &br.EnqueueError)
+		logger.Info("msg", "enqueueing template", "name", stored.Name, "command_count", len(items), "err", err)
+	}
+	writeBatchResult(br, w, header, logger)
+}
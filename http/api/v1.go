@@ -3,8 +3,15 @@ package api
 import (
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/micromdm/nanomdm/audit"
+	"github.com/micromdm/nanomdm/eventstream"
+	"github.com/micromdm/nanomdm/http/apiauth"
+	"github.com/micromdm/nanomdm/profilesign"
 	"github.com/micromdm/nanomdm/push"
+	"github.com/micromdm/nanomdm/push/pacer"
+	"github.com/micromdm/nanomdm/push/pushcsr"
 	"github.com/micromdm/nanomdm/storage"
 
 	"github.com/micromdm/nanolib/log"
@@ -12,9 +19,22 @@ import (
 
 const (
 	APIEndpointPushCert        = "/pushcert"
-	APIEndpointPush            = "/push/"    // note trailing slash
-	APIEndpointEnqueue         = "/enqueue/" // note trailing slash
+	APIEndpointPushCertCSR     = "/pushcert/csr"
+	APIEndpointPushCertSign    = "/pushcert/sign"
+	APIEndpointPush            = "/push/"     // note trailing slash
+	APIEndpointEnqueue         = "/enqueue/"  // note trailing slash
+	APIEndpointPushJobs        = "/pushjobs/" // note trailing slash
+	APIEndpointEnqueueBatch    = "/enqueuebatch"
+	APIEndpointEnqueueWait     = "/enqueuewait/" // note trailing slash
 	APIEndpointEscrowKeyUnlock = "/escrowkeyunlock"
+	APIEndpointProfileSign     = "/profilesign"
+	APIEndpointAPICredentials  = "/apicredentials/" // note trailing slash
+	APIEndpointTemplates       = "/templates/"      // note trailing slash
+	APIEndpointDDM             = "/ddm/"            // note trailing slash
+	APIEndpointDDMStatus       = "/ddm/status/"     // note trailing slash
+	APIEndpointEnrollTokens    = "/enrolltokens"
+	APIEndpointAudit           = "/audit"
+	APIEndpointEvents          = "/events"
 )
 
 // Mux can register HTTP handlers.
@@ -32,6 +52,99 @@ type APIStorage interface {
 	storage.CommandEnqueuer
 }
 
+type config struct {
+	keyStore       storage.PushKeyStore
+	signer         *pushcsr.VendorSigner
+	pacer          *pacer.Pacer
+	credStore      storage.APICredentialStore
+	auditor        *audit.Recorder
+	auditStore     storage.AuditStore
+	idemStore      storage.IdempotencyStore
+	idemWindow     time.Duration
+	broker         *eventstream.Broker
+	resultsStore   storage.CommandResultsRetriever
+	tmplStore      TemplateStorage
+	serialResolver storage.SerialNumberResolver
+	profileSigner  *profilesign.Signer
+	identityCerts  storage.IdentityCertRetriever
+	ddmStore       storage.DeclarationStore
+	ddmStatusStore storage.DeclarationStatusStore
+
+	enrollTokenStore storage.EnrollmentTokenStore
+}
+
+// Option configures the API handlers.
+type Option func(*config)
+
+// WithPushKeyStore enables generating APNs push certificate CSRs.
+// Generated private keys are held in store so that the Apple-issued
+// push certificate can be uploaded by itself.
+func WithPushKeyStore(store storage.PushKeyStore) Option {
+	return func(c *config) {
+		c.keyStore = store
+	}
+}
+
+// WithPushVendorSigner enables signing APNs push certificate CSRs
+// with the MDM vendor certificate of signer.
+func WithPushVendorSigner(signer *pushcsr.VendorSigner) Option {
+	return func(c *config) {
+		c.signer = signer
+	}
+}
+
+// WithPushPacer enables paced push jobs for the push and enqueue
+// handlers and the push job status handler.
+func WithPushPacer(p *pacer.Pacer) Option {
+	return func(c *config) {
+		c.pacer = p
+	}
+}
+
+// WithAPICredentialStore enables the API credential management handler
+// backed by store.
+func WithAPICredentialStore(store storage.APICredentialStore) Option {
+	return func(c *config) {
+		c.credStore = store
+	}
+}
+
+// WithAuditRecorder records audit entries of state-changing API calls with rec.
+func WithAuditRecorder(rec *audit.Recorder) Option {
+	return func(c *config) {
+		c.auditor = rec
+	}
+}
+
+// WithAuditStore enables the audit log query handler backed by store.
+func WithAuditStore(store storage.AuditStore) Option {
+	return func(c *config) {
+		c.auditStore = store
+	}
+}
+
+// auditHandler records audit entries of action for requests to next
+// using the configured audit recorder, if any. If methods are given
+// then only requests with those methods are recorded.
+func (c *config) auditHandler(action string, next http.Handler, methods ...string) http.Handler {
+	if c.auditor == nil {
+		return next
+	}
+	audited := c.auditor.Handler(action, next)
+	if len(methods) < 1 {
+		return audited
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				audited.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func handlerName(endpoint string) string {
 	return strings.Trim(endpoint, "/")
 }
@@ -39,15 +152,36 @@ func handlerName(endpoint string) string {
 // HandleAPIv1 registers the various API handlers into mux.
 // API endpoint paths are prepended with prefix.
 // Authentication or any other layered handlers are not present.
-// They are assumed to be layered with mux.
+// They are assumed to be layered with mux. If that authentication
+// places an API credential into the request context (see package
+// apiauth) then the handlers require the relevant scopes.
 // If prefix is empty and these handlers are used in sub-paths then
 // handlers should have that sub-path stripped from the request.
 // The logger is adorned with a "handler" key of the endpoint name.
-func HandleAPIv1(prefix string, mux Mux, logger log.Logger, store APIStorage, pusher push.Pusher) {
+func HandleAPIv1(prefix string, mux Mux, logger log.Logger, store APIStorage, pusher push.Pusher, opts ...Option) {
+	config := new(config)
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	idGetter := PathIDGetter
+	if config.serialResolver != nil {
+		idGetter = SerialIDGetter(config.serialResolver, PathIDGetter)
+	}
+
 	// register API handlers for push cert retrieval (GET) and upload (PUT)
 	pushCertLogger := logger.With("handler", handlerName(APIEndpointPushCert))
-	pushCertPUT := NewStorePushCertHandler(store, pushCertLogger)
-	pushCertGET := NewRetrievePushCertHandler(store, pushCertLogger)
+	pushCertPUT := config.auditHandler(
+		handlerName(APIEndpointPushCert),
+		apiauth.RequireScope(
+			apiauth.ScopePushCertWrite,
+			NewStorePushCertWithKeysHandler(store, config.keyStore, pushCertLogger),
+		),
+	)
+	pushCertGET := apiauth.RequireScope(
+		apiauth.ScopePushCertRead,
+		NewRetrievePushCertHandler(store, pushCertLogger),
+	)
 	mux.Handle(
 		prefix+APIEndpointPushCert,
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,36 +196,342 @@ func HandleAPIv1(prefix string, mux Mux, logger log.Logger, store APIStorage, pu
 		}),
 	)
 
+	// register API handler for push cert CSR generation
+	if config.keyStore != nil {
+		mux.Handle(
+			prefix+APIEndpointPushCertCSR,
+			methodHandler(
+				http.MethodPost,
+				config.auditHandler(
+					handlerName(APIEndpointPushCertCSR),
+					apiauth.RequireScope(
+						apiauth.ScopePushCertWrite,
+						NewPushCSRHandler(
+							config.keyStore,
+							config.signer,
+							logger.With("handler", handlerName(APIEndpointPushCertCSR)),
+						),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for vendor signing of push cert CSRs
+	if config.signer != nil {
+		mux.Handle(
+			prefix+APIEndpointPushCertSign,
+			methodHandler(
+				http.MethodPost,
+				apiauth.RequireScope(
+					apiauth.ScopePushCertWrite,
+					NewSignPushCSRHandler(
+						config.signer,
+						logger.With("handler", handlerName(APIEndpointPushCertSign)),
+					),
+				),
+			),
+		)
+	}
+
 	// register API handler for sending APNs push notifications
 	if pusher != nil {
 		mux.Handle(
 			prefix+APIEndpointPush,
 			http.StripPrefix( // we strip the prefix to use the path as an id
 				prefix+APIEndpointPush,
-				PushHandler(
-					pusher,
-					logger.With("handler", handlerName(APIEndpointPush)),
+				config.auditHandler(
+					handlerName(APIEndpointPush),
+					apiauth.RequireScope(
+						apiauth.ScopePush,
+						PushToIDsHandler(
+							pusher,
+							logger.With("handler", handlerName(APIEndpointPush)),
+							idGetter,
+							opts...,
+						),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for paced push job status
+	if config.pacer != nil {
+		mux.Handle(
+			prefix+APIEndpointPushJobs,
+			http.StripPrefix( // we strip the prefix to use the path as an id
+				prefix+APIEndpointPushJobs,
+				methodHandler(
+					http.MethodGet,
+					apiauth.RequireScope(
+						apiauth.ScopePush,
+						NewPushJobHandler(
+							config.pacer,
+							logger.With("handler", handlerName(APIEndpointPushJobs)),
+						),
+					),
 				),
 			),
 		)
 	}
 
 	// register API handler for new command enqueueing
+	// note the enqueue handler checks the per-RequestType scope itself
 	mux.Handle(
 		prefix+APIEndpointEnqueue,
 		http.StripPrefix( // we strip the prefix to use the path as an id
 			prefix+APIEndpointEnqueue,
-			RawCommandEnqueueHandler(
-				store,
-				pusher,
-				logger.With("handler", handlerName(APIEndpointEnqueue)),
+			config.auditHandler(
+				handlerName(APIEndpointEnqueue),
+				config.idempotencyHandler(
+					handlerName(APIEndpointEnqueue),
+					RawCommandEnqueueToIDsHandler(
+						store,
+						pusher,
+						logger.With("handler", handlerName(APIEndpointEnqueue)),
+						idGetter,
+						opts...,
+					),
+					logger.With("handler", handlerName(APIEndpointEnqueue)),
+				),
+			),
+		),
+	)
+
+	// register API handler for batch command enqueueing
+	// note the batch enqueue handler checks the per-RequestType scope itself
+	mux.Handle(
+		prefix+APIEndpointEnqueueBatch,
+		methodHandler(
+			http.MethodPost,
+			config.auditHandler(
+				handlerName(APIEndpointEnqueueBatch),
+				config.idempotencyHandler(
+					handlerName(APIEndpointEnqueueBatch),
+					NewEnqueueBatchHandler(
+						store,
+						pusher,
+						logger.With("handler", handlerName(APIEndpointEnqueueBatch)),
+						opts...,
+					),
+					logger.With("handler", handlerName(APIEndpointEnqueueBatch)),
+				),
 			),
 		),
 	)
 
+	// register API handler for enqueueing commands and waiting for results
+	// note the enqueue and wait handler checks the per-RequestType scope itself
+	if config.resultsStore != nil {
+		mux.Handle(
+			prefix+APIEndpointEnqueueWait,
+			http.StripPrefix( // we strip the prefix to use the path as an id
+				prefix+APIEndpointEnqueueWait,
+				methodHandler(
+					http.MethodPut,
+					config.auditHandler(
+						handlerName(APIEndpointEnqueueWait),
+						config.idempotencyHandler(
+							handlerName(APIEndpointEnqueueWait),
+							NewEnqueueWaitHandler(
+								store,
+								config.resultsStore,
+								pusher,
+								logger.With("handler", handlerName(APIEndpointEnqueueWait)),
+								idGetter,
+								opts...,
+							),
+							logger.With("handler", handlerName(APIEndpointEnqueueWait)),
+						),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for signing configuration profiles
+	if config.profileSigner != nil {
+		mux.Handle(
+			prefix+APIEndpointProfileSign,
+			methodHandler(
+				http.MethodPost,
+				apiauth.RequireScope(
+					apiauth.ScopeProfileSign,
+					NewSignProfileHandler(
+						config.profileSigner,
+						logger.With("handler", handlerName(APIEndpointProfileSign)),
+					),
+				),
+			),
+		)
+	}
+
 	// register API handler for escrow key unlock
 	mux.Handle(
 		prefix+APIEndpointEscrowKeyUnlock,
-		NewEscrowKeyUnlockHandler(store, nil, logger.With("handler", handlerName(APIEndpointEscrowKeyUnlock))),
+		config.auditHandler(
+			handlerName(APIEndpointEscrowKeyUnlock),
+			apiauth.RequireScope(
+				apiauth.ScopeEscrowKeyUnlock,
+				NewEscrowKeyUnlockHandler(store, nil, logger.With("handler", handlerName(APIEndpointEscrowKeyUnlock))),
+			),
+		),
 	)
+
+	// register API handler for API credential management
+	if config.credStore != nil {
+		mux.Handle(
+			prefix+APIEndpointAPICredentials,
+			http.StripPrefix( // we strip the prefix to use the path as a name
+				prefix+APIEndpointAPICredentials,
+				config.auditHandler(
+					handlerName(APIEndpointAPICredentials),
+					apiauth.RequireScope(
+						apiauth.ScopeAdmin,
+						NewAPICredentialsHandler(
+							config.credStore,
+							logger.With("handler", handlerName(APIEndpointAPICredentials)),
+						),
+					),
+					http.MethodPost, http.MethodDelete,
+				),
+			),
+		)
+	}
+
+	// register API handler for command template management and enqueueing
+	// note the template handler checks the templates and enqueue scopes itself
+	if config.tmplStore != nil {
+		mux.Handle(
+			prefix+APIEndpointTemplates,
+			http.StripPrefix( // we strip the prefix to use the path as a name
+				prefix+APIEndpointTemplates,
+				config.auditHandler(
+					handlerName(APIEndpointTemplates),
+					config.idempotencyHandler(
+						handlerName(APIEndpointTemplates),
+						NewCommandTemplatesHandler(
+							config.tmplStore,
+							store,
+							pusher,
+							logger.With("handler", handlerName(APIEndpointTemplates)),
+							opts...,
+						),
+						logger.With("handler", handlerName(APIEndpointTemplates)),
+					),
+					http.MethodPut, http.MethodPost, http.MethodDelete,
+				),
+			),
+		)
+	}
+
+	// register API handler for Declarative Management
+	if config.ddmStore != nil {
+		mux.Handle(
+			prefix+APIEndpointDDM,
+			http.StripPrefix( // we strip the prefix to use the path
+				prefix+APIEndpointDDM,
+				config.auditHandler(
+					handlerName(APIEndpointDDM),
+					apiauth.RequireScope(
+						apiauth.ScopeDDM,
+						NewDDMHandler(
+							config.ddmStore,
+							store,
+							pusher,
+							logger.With("handler", handlerName(APIEndpointDDM)),
+							opts...,
+						),
+					),
+					http.MethodPut, http.MethodDelete,
+				),
+			),
+		)
+	}
+
+	// register API handler for Declarative Management status
+	if config.ddmStatusStore != nil {
+		mux.Handle(
+			prefix+APIEndpointDDMStatus,
+			http.StripPrefix( // we strip the prefix to use the path as an id
+				prefix+APIEndpointDDMStatus,
+				methodHandler(
+					http.MethodGet,
+					apiauth.RequireScope(
+						apiauth.ScopeDDM,
+						NewDDMStatusHandler(
+							config.ddmStatusStore,
+							logger.With("handler", handlerName(APIEndpointDDMStatus)),
+						),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for creating one-time enrollment tokens
+	if config.enrollTokenStore != nil {
+		mux.Handle(
+			prefix+APIEndpointEnrollTokens,
+			methodHandler(
+				http.MethodPost,
+				config.auditHandler(
+					handlerName(APIEndpointEnrollTokens),
+					apiauth.RequireScope(
+						apiauth.ScopeEnroll,
+						NewEnrollmentTokenHandler(
+							config.enrollTokenStore,
+							logger.With("handler", handlerName(APIEndpointEnrollTokens)),
+						),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for querying the audit log
+	if config.auditStore != nil {
+		mux.Handle(
+			prefix+APIEndpointAudit,
+			methodHandler(
+				http.MethodGet,
+				apiauth.RequireScope(
+					apiauth.ScopeAudit,
+					NewAuditHandler(
+						config.auditStore,
+						logger.With("handler", handlerName(APIEndpointAudit)),
+					),
+				),
+			),
+		)
+	}
+
+	// register API handler for streaming MDM events
+	if config.broker != nil {
+		mux.Handle(
+			prefix+APIEndpointEvents,
+			methodHandler(
+				http.MethodGet,
+				apiauth.RequireScope(
+					apiauth.ScopeEvents,
+					NewEventsHandler(
+						config.broker,
+						logger.With("handler", handlerName(APIEndpointEvents)),
+					),
+				),
+			),
+		)
+	}
+}
+
+// methodHandler only allows requests with method to reach next.
+func methodHandler(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,255 @@
+// Package apiauth authenticates and authorizes NanoMDM API requests
+// using named and scoped API credentials.
+//
+// Credentials authenticate with HTTP Basic authentication using the
+// credential name as the username and the credential secret as the
+// password. Only a hash of the secret is stored. An authenticated
+// credential is placed into the request context where API handlers
+// check it for the scopes and enrollment IDs they require.
+package apiauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// RootUsername is the HTTP Basic username of the API key. It is
+// reserved and can not be the name of an API credential.
+const RootUsername = "nanomdm"
+
+// API credential scopes.
+const (
+	// ScopeAdmin grants every scope, including managing API credentials.
+	ScopeAdmin = "admin"
+
+	// ScopePush allows sending APNs pushes and querying push jobs.
+	ScopePush = "push"
+
+	// ScopeEnqueue allows enqueueing commands of any RequestType.
+	// Use [EnqueueScope] to allow only a single RequestType.
+	ScopeEnqueue = "enqueue"
+
+	ScopePushCertRead  = "pushcert:read"
+	ScopePushCertWrite = "pushcert:write"
+
+	ScopeEscrowKeyUnlock = "escrowkeyunlock"
+	ScopeMigration       = "migration"
+
+	// ScopeAudit allows querying the audit log.
+	ScopeAudit = "audit"
+
+	// ScopeEvents allows streaming MDM events.
+	ScopeEvents = "events"
+
+	// ScopeTemplates allows managing command templates.
+	// Enqueueing from a template requires the enqueue scope instead.
+	ScopeTemplates = "templates"
+
+	// ScopeProfileSign allows signing configuration profiles.
+	ScopeProfileSign = "profilesign"
+
+	// ScopeDDM allows managing Declarative Management declarations
+	// and their assignment to enrollments.
+	ScopeDDM = "ddm"
+
+	// ScopeEnroll allows creating one-time enrollment tokens.
+	ScopeEnroll = "enroll"
+)
+
+var scopes = map[string]struct{}{
+	ScopeAdmin:           {},
+	ScopePush:            {},
+	ScopeEnqueue:         {},
+	ScopePushCertRead:    {},
+	ScopePushCertWrite:   {},
+	ScopeEscrowKeyUnlock: {},
+	ScopeMigration:       {},
+	ScopeAudit:           {},
+	ScopeEvents:          {},
+	ScopeTemplates:       {},
+	ScopeProfileSign:     {},
+	ScopeDDM:             {},
+	ScopeEnroll:          {},
+}
+
+// EnqueueScope returns the scope that allows enqueueing commands of requestType.
+func EnqueueScope(requestType string) string {
+	return ScopeEnqueue + ":" + requestType
+}
+
+// ValidScope reports whether scope is a known scope.
+func ValidScope(scope string) bool {
+	if _, ok := scopes[scope]; ok {
+		return true
+	}
+	return strings.HasPrefix(scope, ScopeEnqueue+":") && len(scope) > len(ScopeEnqueue)+1
+}
+
+// ErrForbidden is returned when a credential lacks a required scope or
+// enrollment ID.
+var ErrForbidden = errors.New("forbidden")
+
+// HasScope reports whether cred grants scope.
+func HasScope(cred *storage.APICredential, scope string) bool {
+	if cred == nil {
+		return false
+	}
+	for _, s := range cred.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+		if s == ScopeEnqueue && strings.HasPrefix(scope, ScopeEnqueue+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsEnrollmentID reports whether cred may operate on enrollment id.
+func AllowsEnrollmentID(cred *storage.APICredential, id string) bool {
+	if cred == nil {
+		return false
+	}
+	if len(cred.EnrollmentIDs) < 1 {
+		return true
+	}
+	for _, allowed := range cred.EnrollmentIDs {
+		if allowed == id {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKeyCredential struct{}
+
+// NewContext returns a new context with cred.
+func NewContext(ctx context.Context, cred *storage.APICredential) context.Context {
+	return context.WithValue(ctx, ctxKeyCredential{}, cred)
+}
+
+// FromContext returns the API credential from ctx.
+// Nil is returned if there is no credential.
+func FromContext(ctx context.Context) *storage.APICredential {
+	cred, _ := ctx.Value(ctxKeyCredential{}).(*storage.APICredential)
+	return cred
+}
+
+// Authorize checks that the API credential in ctx grants scope.
+// If ctx has no credential then authorization is assumed to be handled
+// elsewhere and nil is returned.
+func Authorize(ctx context.Context, scope string) error {
+	cred := FromContext(ctx)
+	if cred == nil || HasScope(cred, scope) {
+		return nil
+	}
+	return fmt.Errorf("%w: credential %s lacks scope: %s", ErrForbidden, cred.Name, scope)
+}
+
+// AuthorizeEnrollmentIDs checks that the API credential in ctx may
+// operate on all of ids.
+// If ctx has no credential then authorization is assumed to be handled
+// elsewhere and nil is returned.
+func AuthorizeEnrollmentIDs(ctx context.Context, ids []string) error {
+	cred := FromContext(ctx)
+	if cred == nil {
+		return nil
+	}
+	for _, id := range ids {
+		if !AllowsEnrollmentID(cred, id) {
+			return fmt.Errorf("%w: credential %s not permitted for enrollment id: %s", ErrForbidden, cred.Name, id)
+		}
+	}
+	return nil
+}
+
+// AuthorizeAllEnrollmentIDs checks that the API credential in ctx is
+// not restricted to enrollment IDs. This is needed for changes that
+// may affect any enrollment.
+// If ctx has no credential then authorization is assumed to be handled
+// elsewhere and nil is returned.
+func AuthorizeAllEnrollmentIDs(ctx context.Context) error {
+	cred := FromContext(ctx)
+	if cred == nil || len(cred.EnrollmentIDs) < 1 {
+		return nil
+	}
+	return fmt.Errorf("%w: credential %s restricted to enrollment ids", ErrForbidden, cred.Name)
+}
+
+// HashSecret returns the hex-encoded SHA-256 hash of secret.
+func HashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// NewSecret generates a new random credential secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,255}$`)
+
+// NewCredential creates a new API credential with a new random secret.
+// The credential is not stored.
+func NewCredential(name string, scopes, enrollmentIDs []string) (*storage.APICredential, string, error) {
+	if !nameRe.MatchString(name) {
+		return nil, "", fmt.Errorf("invalid credential name: %q", name)
+	}
+	if name == RootUsername {
+		return nil, "", fmt.Errorf("reserved credential name: %q", name)
+	}
+	if len(scopes) < 1 {
+		return nil, "", errors.New("no scopes")
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return nil, "", fmt.Errorf("invalid scope: %q", scope)
+		}
+	}
+	for _, id := range enrollmentIDs {
+		if id == "" {
+			return nil, "", errors.New("empty enrollment id")
+		}
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &storage.APICredential{
+		Name:          name,
+		SecretHash:    HashSecret(secret),
+		Scopes:        scopes,
+		EnrollmentIDs: enrollmentIDs,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, secret, nil
+}
+
+// Rotate replaces the secret of cred with a new random secret.
+// The new secret is returned. The credential is not stored.
+func Rotate(cred *storage.APICredential) (string, error) {
+	if cred == nil {
+		return "", errors.New("nil credential")
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return "", err
+	}
+	cred.SecretHash = HashSecret(secret)
+	cred.UpdatedAt = time.Now()
+	return secret, nil
+}
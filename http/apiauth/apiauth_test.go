@@ -0,0 +1,157 @@
+package apiauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+	"github.com/micromdm/nanomdm/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestHasScope(t *testing.T) {
+	for _, tc := range []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{ScopeAdmin}, ScopePushCertWrite, true},
+		{[]string{ScopeAdmin}, EnqueueScope("DeviceLock"), true},
+		{[]string{ScopePush}, ScopePush, true},
+		{[]string{ScopePush}, ScopePushCertRead, false},
+		{[]string{ScopeEnqueue}, EnqueueScope("ProfileList"), true},
+		{[]string{EnqueueScope("ProfileList")}, EnqueueScope("ProfileList"), true},
+		{[]string{EnqueueScope("ProfileList")}, EnqueueScope("EraseDevice"), false},
+		{[]string{ScopePushCertRead}, ScopePushCertWrite, false},
+		{nil, ScopePush, false},
+	} {
+		cred := &storage.APICredential{Name: "test", Scopes: tc.scopes}
+		if have := HasScope(cred, tc.scope); have != tc.want {
+			t.Errorf("scopes %v, scope %s: have: %v, want: %v", tc.scopes, tc.scope, have, tc.want)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		ScopeAdmin:            true,
+		ScopeMigration:        true,
+		"enqueue:ProfileList": true,
+		"enqueue:":            false,
+		"pushcert":            false,
+		"":                    false,
+	} {
+		if have := ValidScope(scope); have != want {
+			t.Errorf("scope %q: have: %v, want: %v", scope, have, want)
+		}
+	}
+}
+
+func TestAuthorizeEnrollmentIDs(t *testing.T) {
+	ctx := context.Background()
+
+	// no credential means authorization is handled elsewhere
+	if err := AuthorizeEnrollmentIDs(ctx, []string{"A"}); err != nil {
+		t.Error(err)
+	}
+
+	ctx = NewContext(ctx, &storage.APICredential{Name: "test", Scopes: []string{ScopePush}})
+	if err := AuthorizeEnrollmentIDs(ctx, []string{"A", "B"}); err != nil {
+		t.Error(err)
+	}
+
+	ctx = NewContext(ctx, &storage.APICredential{Name: "test", Scopes: []string{ScopePush}, EnrollmentIDs: []string{"A"}})
+	if err := AuthorizeEnrollmentIDs(ctx, []string{"A"}); err != nil {
+		t.Error(err)
+	}
+	if err := AuthorizeEnrollmentIDs(ctx, []string{"A", "B"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestBasicAuthHandler(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	if _, _, err := NewCredential(RootUsername, []string{ScopePush}, nil); err == nil {
+		t.Error("expected error creating credential with the root username")
+	}
+
+	cred, secret, err := NewCredential("helpdesk", []string{ScopePush}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.SecretHash == secret {
+		t.Fatal("secret stored unhashed")
+	}
+	if err = store.StoreAPICredential(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewBasicAuthHandler(
+		RequireScope(ScopePush, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(FromContext(r.Context()).Name))
+		})),
+		store, RootUsername, "apikey", "nanomdm", log.NopLogger,
+	)
+
+	for _, tc := range []struct {
+		username, password string
+		status             int
+		name               string
+	}{
+		{"nanomdm", "apikey", http.StatusOK, "nanomdm"},
+		{"nanomdm", "wrong", http.StatusUnauthorized, ""},
+		{"helpdesk", secret, http.StatusOK, "helpdesk"},
+		{"helpdesk", "wrong", http.StatusUnauthorized, ""},
+		{"unknown", secret, http.StatusUnauthorized, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(tc.username, tc.password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if have, want := rec.Code, tc.status; have != want {
+			t.Errorf("%s: status: have: %v, want: %v", tc.username, have, want)
+		}
+		if tc.name != "" && rec.Body.String() != tc.name {
+			t.Errorf("%s: credential name: have: %v, want: %v", tc.username, rec.Body.String(), tc.name)
+		}
+	}
+
+	// rotation invalidates the previous secret
+	newSecret, err := Rotate(cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.StoreAPICredential(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]int{secret: http.StatusUnauthorized, newSecret: http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("helpdesk", password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if have := rec.Code; have != want {
+			t.Errorf("rotated: status: have: %v, want: %v", have, want)
+		}
+	}
+
+	// a credential without the required scope is forbidden
+	cred, secret, err = NewCredential("readonly", []string{ScopePushCertRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.StoreAPICredential(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("readonly", secret)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if have, want := rec.Code, http.StatusForbidden; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+}
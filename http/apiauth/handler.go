@@ -0,0 +1,80 @@
+package apiauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// NewBasicAuthHandler authenticates HTTP Basic requests to next.
+//
+// A request with username and password authenticates as a built-in
+// credential with the [ScopeAdmin] scope. Otherwise the username is
+// looked up as a stored API credential named by it and the password is
+// checked against its secret hash. The authenticated credential is
+// placed into the request context (see [FromContext]).
+func NewBasicAuthHandler(next http.Handler, store storage.APICredentialStore, username, password, realm string, logger log.Logger) http.HandlerFunc {
+	if store == nil {
+		panic("nil store")
+	}
+	root := &storage.APICredential{
+		Name:   username,
+		Scopes: []string{ScopeAdmin},
+	}
+	ubc := []byte(username)
+	pbc := []byte(password)
+	rc := `Basic realm="` + realm + `"`
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		u, p, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("Www-Authenticate", rc)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		var cred *storage.APICredential
+		if subtle.ConstantTimeCompare([]byte(u), ubc) == 1 {
+			if password != "" && subtle.ConstantTimeCompare([]byte(p), pbc) == 1 {
+				cred = root
+			}
+		} else {
+			stored, err := store.RetrieveAPICredential(r.Context(), u)
+			if err != nil {
+				logger.Info("msg", "retrieving api credential", "name", u, "err", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if stored != nil && subtle.ConstantTimeCompare([]byte(HashSecret(p)), []byte(stored.SecretHash)) == 1 {
+				cred = stored
+			}
+		}
+
+		if cred == nil {
+			logger.Info("msg", "api authentication failed", "name", u)
+			w.Header().Set("Www-Authenticate", rc)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), cred)))
+	}
+}
+
+// RequireScope only allows requests whose API credential grants scope
+// to reach next. Requests without a credential in the context are
+// allowed (see [Authorize]).
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Authorize(r.Context(), scope); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package hashbody
+
+import (
+	"hash"
+	"net/http"
+)
+
+// VerifyBodyHashHandler is an HTTP handler wrapper that verifies the hash in a header of the request.
+type VerifyBodyHashHandler struct {
+	next    http.Handler
+	header  string
+	newHash func() hash.Hash
+	decoder func(string) ([]byte, error)
+}
+
+// NewVerifyBodyHashHandler sets up a new body hash header verifying handler wrapper.
+// The next handler is provided in next and will panic if nil.
+// The name of the HTTP header is provided in header and will panic if nil.
+// The decoder and newHash can be nil per [VerifyRequestBodyHashHeader].
+// Requests with an invalid body hash are rejected with an HTTP 401 Unauthorized status.
+func NewVerifyBodyHashHandler(next http.Handler, header string, newHash func() hash.Hash, decoder func(string) ([]byte, error)) *VerifyBodyHashHandler {
+	if next == nil {
+		panic("nil handler")
+	}
+	if header == "" {
+		panic("empty header")
+	}
+	if newHash == nil {
+		newHash = func() hash.Hash { return nil }
+	}
+	return &VerifyBodyHashHandler{
+		next:    next,
+		header:  header,
+		newHash: newHash,
+		decoder: decoder,
+	}
+}
+
+// ServeHTTP verifies the body hash header and dispatches to the next handler.
+func (h *VerifyBodyHashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	valid, err := VerifyRequestBodyHashHeader(r, h.header, h.newHash(), h.decoder)
+	if err != nil || !valid {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
@@ -90,3 +90,40 @@ func VerifyBodyHashHeader(resp *http.Response, header string, hasher hash.Hash,
 
 	return subtle.ConstantTimeCompare(bodyHash, decoded) == 1, nil
 }
+
+// VerifyRequestBodyHashHeader verifies the hasher of the req HTTP body against the decoder header.
+// True is returned if the hashes match.
+// If needed the body is replaced with a byte buffer for re-use.
+// If hasher is nil a default SHA-256 hasher is used.
+// If decoder is nil a default hex decoder is used.
+func VerifyRequestBodyHashHeader(req *http.Request, header string, hasher hash.Hash, decoder func(string) ([]byte, error)) (bool, error) {
+	if req == nil {
+		return false, errors.New("nil request")
+	}
+	if header == "" {
+		return false, errors.New("empty header")
+	}
+
+	if decoder == nil {
+		decoder = hex.DecodeString
+	}
+
+	decoded, err := decoder(req.Header.Get(header))
+	if err != nil {
+		return false, fmt.Errorf("decoding %s header: %w", header, err)
+	}
+
+	if hasher == nil {
+		hasher = sha256.New()
+	} else {
+		hasher.Reset()
+	}
+
+	if err := libhttp.GetAndReplaceBody(req, hasher); err != nil {
+		return false, fmt.Errorf("getting body: %w", err)
+	}
+
+	bodyHash := hasher.Sum(nil)
+
+	return subtle.ConstantTimeCompare(bodyHash, decoded) == 1, nil
+}
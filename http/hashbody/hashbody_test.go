@@ -7,6 +7,7 @@ import (
 	"hash/fnv"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -70,3 +71,47 @@ func TestHashBody(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyRequestBodyHashHeader(t *testing.T) {
+	ctx := context.Background()
+	body := []byte("hello, world!")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SetBodyHashHeader(req, "X-Hash", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := VerifyRequestBodyHashHeader(req, "X-Hash", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := valid, true; have != want {
+		t.Errorf("request hash invalid: have: %t, want: %t", have, want)
+	}
+
+	// the body is replaced for re-use
+	if reqBody, err := io.ReadAll(req.Body); err != nil {
+		t.Fatal(err)
+	} else if have, want := reqBody, body; !bytes.Equal(have, want) {
+		t.Errorf("request body mismatch: have: %s, want: %s", have, want)
+	}
+
+	// a server-side request with a different body
+	tampered := httptest.NewRequest("POST", "/", bytes.NewBufferString("goodbye, world!"))
+	tampered.Header.Set("X-Hash", req.Header.Get("X-Hash"))
+
+	valid, err = VerifyRequestBodyHashHeader(tampered, "X-Hash", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := valid, false; have != want {
+		t.Errorf("tampered request hash valid: have: %t, want: %t", have, want)
+	}
+}
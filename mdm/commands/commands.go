@@ -0,0 +1,67 @@
+// Package commands provides typed MDM commands.
+//
+// Each command type is the "Command" dictionary of an Apple MDM
+// command without its RequestType, which is provided by its
+// RequestType method. Use [New] or [NewWithUUID] to build an
+// [mdm.Command] (with its Raw plist) ready for enqueueing.
+// Use [DecodeResult] to decode the command reports of some commands
+// into typed results.
+//
+// See https://developer.apple.com/documentation/devicemanagement/commands_and_queries
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/plist"
+)
+
+// Payload is the "Command" dictionary of an MDM command.
+type Payload interface {
+	// RequestType returns the MDM command RequestType.
+	RequestType() string
+}
+
+// New builds an MDM command from p with a newly generated CommandUUID.
+func New(p Payload) (*mdm.Command, error) {
+	cmdUUID, err := mdm.NewCommandUUID()
+	if err != nil {
+		return nil, fmt.Errorf("generating command uuid: %w", err)
+	}
+	return NewWithUUID(cmdUUID, p)
+}
+
+// NewWithUUID builds an MDM command from p with cmdUUID as its CommandUUID.
+// The command plist is available in Raw.
+func NewWithUUID(cmdUUID string, p Payload) (*mdm.Command, error) {
+	if cmdUUID == "" {
+		return nil, errors.New("empty command uuid")
+	}
+	if p == nil {
+		return nil, errors.New("nil command payload")
+	}
+
+	// round-trip the payload through a plist dictionary to add the
+	// RequestType alongside the command-specific fields.
+	payloadBytes, err := plist.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s payload: %w", p.RequestType(), err)
+	}
+	cmdDict := make(map[string]interface{})
+	if err = plist.Unmarshal(payloadBytes, &cmdDict); err != nil {
+		return nil, fmt.Errorf("decoding %s payload: %w", p.RequestType(), err)
+	}
+	cmdDict["RequestType"] = p.RequestType()
+
+	rawCommand, err := plist.MarshalIndent(map[string]interface{}{
+		"CommandUUID": cmdUUID,
+		"Command":     cmdDict,
+	}, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s command: %w", p.RequestType(), err)
+	}
+	return mdm.DecodeCommand(rawCommand)
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/micromdm/plist"
+)
+
+func TestNew(t *testing.T) {
+	for _, p := range []Payload{
+		DeviceInformation{Queries: []string{"DeviceName", "OSVersion"}},
+		SecurityInfo{},
+		ProfileList{},
+		InstallProfile{Payload: []byte("profile")},
+		RemoveProfile{Identifier: "com.example.profile"},
+		CertificateList{},
+		InstalledApplicationList{ManagedAppsOnly: true},
+		InstallApplication{ITunesStoreID: 640199958, ManagementFlags: 1, Options: &InstallApplicationOptions{PurchaseMethod: 1}},
+		RemoveApplication{Identifier: "com.example.app"},
+		DeviceLock{Message: "Lost"},
+		ClearPasscode{UnlockToken: []byte("token")},
+		EraseDevice{PIN: "123456"},
+		RestartDevice{},
+		ShutDownDevice{},
+		Settings{Settings: []Setting{DeviceNameSetting("kiosk")}},
+	} {
+		cmd, err := New(p)
+		if err != nil {
+			t.Fatalf("%s: %v", p.RequestType(), err)
+		}
+		if have, want := cmd.Command.RequestType, p.RequestType(); have != want {
+			t.Errorf("RequestType: have: %v, want: %v", have, want)
+		}
+		if cmd.CommandUUID == "" {
+			t.Errorf("%s: empty CommandUUID", p.RequestType())
+		}
+		if len(cmd.Raw) < 1 {
+			t.Errorf("%s: empty Raw", p.RequestType())
+		}
+	}
+}
+
+func TestNewWithUUID(t *testing.T) {
+	cmd, err := NewWithUUID("uuid-1", InstallApplication{
+		ITunesStoreID:   640199958,
+		ManagementFlags: 1,
+		Options:         &InstallApplicationOptions{PurchaseMethod: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmd.CommandUUID, "uuid-1"; have != want {
+		t.Errorf("CommandUUID: have: %v, want: %v", have, want)
+	}
+
+	var decoded struct {
+		Command struct {
+			RequestType string
+			InstallApplication
+		}
+	}
+	if err = plist.Unmarshal(cmd.Raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := decoded.Command.ITunesStoreID, 640199958; have != want {
+		t.Errorf("iTunesStoreID: have: %v, want: %v", have, want)
+	}
+	if decoded.Command.Options == nil || decoded.Command.Options.PurchaseMethod != 1 {
+		t.Errorf("Options: have: %v", decoded.Command.Options)
+	}
+	if decoded.Command.Identifier != "" {
+		t.Errorf("expected omitted Identifier, have: %v", decoded.Command.Identifier)
+	}
+
+	cmd, err = NewWithUUID("uuid-2", ClearPasscode{UnlockToken: []byte("token")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clear struct{ Command ClearPasscode }
+	if err = plist.Unmarshal(cmd.Raw, &clear); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := clear.Command.UnlockToken, []byte("token"); !bytes.Equal(have, want) {
+		t.Errorf("UnlockToken: have: %v, want: %v", have, want)
+	}
+
+	if _, err = NewWithUUID("", ProfileList{}); err == nil {
+		t.Error("expected error for empty uuid")
+	}
+	if _, err = NewWithUUID("uuid-3", nil); err == nil {
+		t.Error("expected error for nil payload")
+	}
+}
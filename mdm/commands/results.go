@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/plist"
+)
+
+// ErrNoResultDecoder is returned when there is no result decoder for a RequestType.
+var ErrNoResultDecoder = errors.New("no result decoder for request type")
+
+// DeviceInformationResult is the result of a DeviceInformation command.
+type DeviceInformationResult struct {
+	// QueryResponses maps the queried attribute names to their values.
+	QueryResponses map[string]interface{}
+}
+
+// SecurityInfoResult is the result of a SecurityInfo command.
+type SecurityInfoResult struct {
+	SecurityInfo map[string]interface{}
+}
+
+// ProfileListPayload is a payload within an installed configuration profile.
+type ProfileListPayload struct {
+	PayloadType         string
+	PayloadIdentifier   string
+	PayloadDisplayName  string `plist:",omitempty"`
+	PayloadDescription  string `plist:",omitempty"`
+	PayloadOrganization string `plist:",omitempty"`
+	PayloadUUID         string `plist:",omitempty"`
+	PayloadVersion      int    `plist:",omitempty"`
+}
+
+// ProfileListItem is an installed configuration profile.
+type ProfileListItem struct {
+	PayloadIdentifier        string
+	PayloadUUID              string
+	PayloadVersion           int
+	PayloadDisplayName       string               `plist:",omitempty"`
+	PayloadDescription       string               `plist:",omitempty"`
+	PayloadOrganization      string               `plist:",omitempty"`
+	PayloadRemovalDisallowed bool                 `plist:",omitempty"`
+	HasRemovalPasscode       bool                 `plist:",omitempty"`
+	IsEncrypted              bool                 `plist:",omitempty"`
+	IsManaged                bool                 `plist:",omitempty"`
+	PayloadContent           []ProfileListPayload `plist:",omitempty"`
+
+	// SignerCertificates are the DER-encoded signing certificates.
+	SignerCertificates [][]byte `plist:",omitempty"`
+}
+
+// ProfileListResult is the result of a ProfileList command.
+type ProfileListResult struct {
+	ProfileList []ProfileListItem
+}
+
+// CertificateListItem is an installed certificate.
+type CertificateListItem struct {
+	CommonName string
+	IsIdentity bool
+
+	// Data is the DER-encoded certificate.
+	Data []byte
+}
+
+// CertificateListResult is the result of a CertificateList command.
+type CertificateListResult struct {
+	CertificateList []CertificateListItem
+}
+
+// InstalledApplication is an installed application.
+type InstalledApplication struct {
+	Identifier   string
+	Name         string `plist:",omitempty"`
+	ShortVersion string `plist:",omitempty"`
+	Version      string `plist:",omitempty"`
+
+	BundleSize                int `plist:",omitempty"`
+	DynamicSize               int `plist:",omitempty"`
+	ExternalVersionIdentifier int `plist:",omitempty"`
+
+	AdHocCodeSigned    bool `plist:",omitempty"`
+	AppStoreVendable   bool `plist:",omitempty"`
+	BetaApp            bool `plist:",omitempty"`
+	DeviceBasedVPP     bool `plist:",omitempty"`
+	HasUpdateAvailable bool `plist:",omitempty"`
+	Installing         bool `plist:",omitempty"`
+	IsAppClip          bool `plist:",omitempty"`
+	IsValidated        bool `plist:",omitempty"`
+}
+
+// InstalledApplicationListResult is the result of an InstalledApplicationList command.
+type InstalledApplicationListResult struct {
+	InstalledApplicationList []InstalledApplication
+}
+
+// ProvisioningProfile is an installed provisioning profile.
+type ProvisioningProfile struct {
+	Name       string
+	UUID       string
+	ExpiryDate time.Time
+}
+
+// ProvisioningProfileListResult is the result of a ProvisioningProfileList command.
+type ProvisioningProfileListResult struct {
+	ProvisioningProfileList []ProvisioningProfile
+}
+
+// resultDecoders create new typed results keyed by RequestType.
+var resultDecoders = map[string]func() interface{}{
+	"DeviceInformation":        func() interface{} { return new(DeviceInformationResult) },
+	"SecurityInfo":             func() interface{} { return new(SecurityInfoResult) },
+	"ProfileList":              func() interface{} { return new(ProfileListResult) },
+	"CertificateList":          func() interface{} { return new(CertificateListResult) },
+	"InstalledApplicationList": func() interface{} { return new(InstalledApplicationListResult) },
+	"ProvisioningProfileList":  func() interface{} { return new(ProvisioningProfileListResult) },
+}
+
+// DecodeResult decodes results of a command of requestType into its
+// typed result, e.g. a *DeviceInformationResult for a DeviceInformation
+// command. The requestType is usually from the originating command.
+// [ErrNoResultDecoder] is returned if requestType has no typed result.
+func DecodeResult(requestType string, results *mdm.CommandResults) (interface{}, error) {
+	newResult, ok := resultDecoders[requestType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoResultDecoder, requestType)
+	}
+	if results == nil || len(results.Raw) < 1 {
+		return nil, errors.New("no raw command results")
+	}
+	result := newResult()
+	if err := plist.Unmarshal(results.Raw, result); err != nil {
+		return nil, &mdm.ParseError{Err: err, Content: results.Raw}
+	}
+	return result, nil
+}
+
+// DecodeCommandResult decodes results of cmd into its typed result.
+// See [DecodeResult].
+func DecodeCommandResult(cmd *mdm.Command, results *mdm.CommandResults) (interface{}, error) {
+	if cmd == nil {
+		return nil, errors.New("nil command")
+	}
+	return DecodeResult(cmd.Command.RequestType, results)
+}
+
+// ReportRequestType returns the RequestType included in the command
+// report of results by newer clients. This is useful when the
+// originating command is not available. An empty string is returned
+// if the report does not include its RequestType.
+func ReportRequestType(results *mdm.CommandResults) string {
+	if results == nil || len(results.Raw) < 1 {
+		return ""
+	}
+	var report struct{ RequestType string }
+	if err := plist.Unmarshal(results.Raw, &report); err != nil {
+		return ""
+	}
+	return report.RequestType
+}
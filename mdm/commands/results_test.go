@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+)
+
+const profileListResults = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CommandUUID</key>
+	<string>fedd659e-fc3c-4e35-8bb1-c8f51ae542a5</string>
+	<key>ProfileList</key>
+	<array>
+		<dict>
+			<key>PayloadIdentifier</key>
+			<string>com.example.mdm</string>
+			<key>PayloadUUID</key>
+			<string>0A6B7F4F-0E38-4B24-9C11-2D8B6E0E9D0A</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+			<key>IsManaged</key>
+			<true/>
+			<key>PayloadContent</key>
+			<array>
+				<dict>
+					<key>PayloadType</key>
+					<string>com.apple.mdm</string>
+					<key>PayloadIdentifier</key>
+					<string>com.example.mdm.payload</string>
+				</dict>
+			</array>
+		</dict>
+	</array>
+	<key>Status</key>
+	<string>Acknowledged</string>
+	<key>UDID</key>
+	<string>66ADE930-5FDF-5EC4-8429-15640684C489</string>
+</dict>
+</plist>
+`
+
+func TestDecodeResult(t *testing.T) {
+	b, err := os.ReadFile("../testdata/DeviceInformation.1.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := mdm.DecodeCommandResults(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := ReportRequestType(results), "DeviceInformation"; have != want {
+		t.Errorf("report request type: have: %v, want: %v", have, want)
+	}
+	result, err := DecodeCommandResult(&mdm.Command{Command: struct{ RequestType string }{"DeviceInformation"}}, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devInfo, ok := result.(*DeviceInformationResult)
+	if !ok {
+		t.Fatalf("unexpected result type: %T", result)
+	}
+	if have, want := devInfo.QueryResponses["HostName"], "fruit.example.com"; have != want {
+		t.Errorf("HostName: have: %v, want: %v", have, want)
+	}
+
+	results, err = mdm.DecodeCommandResults([]byte(profileListResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no RequestType key in the report
+	if have, want := ReportRequestType(results), ""; have != want {
+		t.Errorf("report request type: have: %v, want: %v", have, want)
+	}
+	result, err = DecodeResult("ProfileList", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileList := result.(*ProfileListResult)
+	if len(profileList.ProfileList) != 1 {
+		t.Fatalf("profiles: have: %v, want: 1", len(profileList.ProfileList))
+	}
+	profile := profileList.ProfileList[0]
+	if profile.PayloadIdentifier != "com.example.mdm" || profile.PayloadVersion != 1 || !profile.IsManaged {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+	if len(profile.PayloadContent) != 1 || profile.PayloadContent[0].PayloadType != "com.apple.mdm" {
+		t.Errorf("unexpected profile payloads: %+v", profile.PayloadContent)
+	}
+
+	if _, err = DecodeResult("EraseDevice", results); !errors.Is(err, ErrNoResultDecoder) {
+		t.Errorf("have: %v, want: %v", err, ErrNoResultDecoder)
+	}
+}
@@ -0,0 +1,177 @@
+package commands
+
+// DeviceInformation queries device attributes.
+type DeviceInformation struct {
+	// Queries are the names of the attributes to query, e.g. "DeviceName".
+	Queries []string `plist:",omitempty"`
+}
+
+func (DeviceInformation) RequestType() string { return "DeviceInformation" }
+
+// SecurityInfo queries security-related device information.
+type SecurityInfo struct{}
+
+func (SecurityInfo) RequestType() string { return "SecurityInfo" }
+
+// ProfileList queries the installed configuration profiles.
+type ProfileList struct {
+	ManagedOnly bool `plist:",omitempty"`
+}
+
+func (ProfileList) RequestType() string { return "ProfileList" }
+
+// InstallProfile installs a configuration profile.
+type InstallProfile struct {
+	// Payload is the (optionally signed) configuration profile.
+	Payload []byte
+}
+
+func (InstallProfile) RequestType() string { return "InstallProfile" }
+
+// RemoveProfile removes an installed configuration profile.
+type RemoveProfile struct {
+	// Identifier is the PayloadIdentifier of the profile.
+	Identifier string
+}
+
+func (RemoveProfile) RequestType() string { return "RemoveProfile" }
+
+// CertificateList queries the installed certificates.
+type CertificateList struct {
+	ManagedOnly bool `plist:",omitempty"`
+}
+
+func (CertificateList) RequestType() string { return "CertificateList" }
+
+// InstalledApplicationList queries the installed applications.
+type InstalledApplicationList struct {
+	Identifiers     []string `plist:",omitempty"`
+	ManagedAppsOnly bool     `plist:",omitempty"`
+}
+
+func (InstalledApplicationList) RequestType() string { return "InstalledApplicationList" }
+
+// InstallApplicationOptions are options of an InstallApplication command.
+type InstallApplicationOptions struct {
+	// PurchaseMethod 1 installs a VPP app; 0 is the legacy method.
+	PurchaseMethod int `plist:",omitempty"`
+}
+
+// InstallApplication installs an application by its App Store ID,
+// bundle identifier, or manifest URL (for enterprise apps).
+type InstallApplication struct {
+	ITunesStoreID int    `plist:"iTunesStoreID,omitempty"`
+	Identifier    string `plist:",omitempty"`
+	ManifestURL   string `plist:",omitempty"`
+
+	// ManagementFlags is a bitmask; 1 removes the app when the MDM
+	// profile is removed, 4 prevents backup of app data.
+	ManagementFlags int `plist:",omitempty"`
+
+	ChangeManagementState string `plist:",omitempty"`
+	InstallAsManaged      bool   `plist:",omitempty"`
+
+	Options       *InstallApplicationOptions `plist:",omitempty"`
+	Configuration map[string]interface{}     `plist:",omitempty"`
+	Attributes    map[string]interface{}     `plist:",omitempty"`
+}
+
+func (InstallApplication) RequestType() string { return "InstallApplication" }
+
+// RemoveApplication removes a managed application.
+type RemoveApplication struct {
+	Identifier string
+}
+
+func (RemoveApplication) RequestType() string { return "RemoveApplication" }
+
+// DeviceLock locks the device.
+type DeviceLock struct {
+	// PIN is the six-digit Find My PIN (macOS only).
+	PIN string `plist:",omitempty"`
+
+	// Message and PhoneNumber are displayed on the lock screen.
+	Message     string `plist:",omitempty"`
+	PhoneNumber string `plist:",omitempty"`
+}
+
+func (DeviceLock) RequestType() string { return "DeviceLock" }
+
+// ClearPasscode removes the device passcode.
+type ClearPasscode struct {
+	// UnlockToken is the token from the TokenUpdate check-in.
+	UnlockToken []byte
+}
+
+func (ClearPasscode) RequestType() string { return "ClearPasscode" }
+
+// ReturnToService configures a device to re-enroll after being erased.
+type ReturnToService struct {
+	Enabled         bool
+	MDMProfileData  []byte `plist:",omitempty"`
+	WiFiProfileData []byte `plist:",omitempty"`
+	BootstrapToken  []byte `plist:",omitempty"`
+}
+
+// EraseDevice erases the device.
+type EraseDevice struct {
+	// PIN is the six-digit Find My PIN (macOS only).
+	PIN string `plist:",omitempty"`
+
+	PreserveDataPlan       bool `plist:",omitempty"`
+	DisallowProximitySetup bool `plist:",omitempty"`
+
+	// ObliterationBehavior is one of "Default", "DoNotObliterate",
+	// "ObliterateWithWarning", or "Always" (macOS only).
+	ObliterationBehavior string `plist:",omitempty"`
+
+	ReturnToService *ReturnToService `plist:",omitempty"`
+}
+
+func (EraseDevice) RequestType() string { return "EraseDevice" }
+
+// RestartDevice restarts the device.
+type RestartDevice struct {
+	NotifyUser bool `plist:",omitempty"`
+}
+
+func (RestartDevice) RequestType() string { return "RestartDevice" }
+
+// ShutDownDevice shuts down the device.
+type ShutDownDevice struct{}
+
+func (ShutDownDevice) RequestType() string { return "ShutDownDevice" }
+
+// Setting is a single item of a Settings command.
+// It must contain an "Item" key naming the setting.
+type Setting map[string]interface{}
+
+// DeviceNameSetting sets the device name.
+func DeviceNameSetting(name string) Setting {
+	return Setting{"Item": "DeviceName", "DeviceName": name}
+}
+
+// HostNameSetting sets the host name (macOS only).
+func HostNameSetting(name string) Setting {
+	return Setting{"Item": "HostName", "HostName": name}
+}
+
+// TimeZoneSetting sets the time zone, e.g. "America/Los_Angeles".
+func TimeZoneSetting(tz string) Setting {
+	return Setting{"Item": "TimeZone", "TimeZone": tz}
+}
+
+// Settings changes device settings.
+type Settings struct {
+	Settings []Setting
+}
+
+func (Settings) RequestType() string { return "Settings" }
+
+// DeclarativeManagement tells the device to synchronize declarations.
+type DeclarativeManagement struct {
+	// Data is the JSON of the server's SyncTokens.
+	Data []byte `plist:",omitempty"`
+}
+
+func (DeclarativeManagement) RequestType() string { return "DeclarativeManagement" }
@@ -0,0 +1,112 @@
+package mdm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/plist"
+)
+
+// JSONDataKey is the key of a single-key JSON object representing
+// plist data. Its value is the base64-encoded data.
+// For example: {"$data": "PD94bWwgdm..."}
+const JSONDataKey = "$data"
+
+// NewCommandUUID generates a new random (version 4) UUID for use as
+// a CommandUUID.
+func NewCommandUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// jsonToPlistValue converts a decoded JSON value v to a value suitable
+// for plist encoding. JSON numbers become integers if they are
+// integral and reals otherwise. Objects with only the [JSONDataKey]
+// key become data.
+func jsonToPlistValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if b64, ok := v[JSONDataKey]; ok && len(v) == 1 {
+			s, ok := b64.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s value is not a string", JSONDataKey)
+			}
+			data, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", JSONDataKey, err)
+			}
+			return data, nil
+		}
+		for k, elem := range v {
+			conv, err := jsonToPlistValue(elem)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			v[k] = conv
+		}
+		return v, nil
+	case []interface{}:
+		for i, elem := range v {
+			conv, err := jsonToPlistValue(elem)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			v[i] = conv
+		}
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case nil:
+		return nil, errors.New("null values not supported")
+	default:
+		// strings and booleans
+		return v, nil
+	}
+}
+
+// CommandFromJSON converts the JSON representation of an MDM command
+// dictionary to a command with its XML plist in Raw.
+// Binary data is represented by JSON objects with a single
+// [JSONDataKey] key (see its documentation). A new CommandUUID is
+// generated if it is missing or empty. The resulting plist is
+// validated with [DecodeCommand].
+func CommandFromJSON(jsonCommand []byte) (*Command, error) {
+	if len(jsonCommand) < 1 {
+		return nil, ErrEmptyCommand
+	}
+	dec := json.NewDecoder(bytes.NewReader(jsonCommand))
+	dec.UseNumber()
+	var cmdDict map[string]interface{}
+	if err := dec.Decode(&cmdDict); err != nil {
+		return nil, fmt.Errorf("decoding json command: %w", err)
+	}
+	if cmdDict == nil {
+		return nil, ErrInvalidCommand
+	}
+	if _, err := jsonToPlistValue(cmdDict); err != nil {
+		return nil, fmt.Errorf("converting json command: %w", err)
+	}
+	if cmdUUID, _ := cmdDict["CommandUUID"].(string); cmdUUID == "" {
+		var err error
+		if cmdDict["CommandUUID"], err = NewCommandUUID(); err != nil {
+			return nil, fmt.Errorf("generating command uuid: %w", err)
+		}
+	}
+	rawCommand, err := plist.MarshalIndent(cmdDict, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encoding command plist: %w", err)
+	}
+	return DecodeCommand(rawCommand)
+}
@@ -0,0 +1,81 @@
+package mdm
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/micromdm/plist"
+)
+
+func TestCommandFromJSON(t *testing.T) {
+	cmd, err := CommandFromJSON([]byte(`{
+	"Command": {
+		"RequestType": "InstallProfile",
+		"Payload": {"$data": "aGVsbG8="},
+		"Count": 3,
+		"Ratio": 0.5,
+		"Flag": true,
+		"Queries": ["DeviceName", {"$data": "d29ybGQ="}]
+	}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmd.Command.RequestType, "InstallProfile"; have != want {
+		t.Errorf("RequestType: have: %v, want: %v", have, want)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(cmd.CommandUUID) {
+		t.Errorf("invalid generated CommandUUID: %q", cmd.CommandUUID)
+	}
+
+	var decoded struct {
+		Command struct {
+			Payload []byte
+			Count   int
+			Ratio   float64
+			Flag    bool
+			Queries []interface{}
+		}
+	}
+	if err = plist.Unmarshal(cmd.Raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := decoded.Command.Payload, []byte("hello"); !bytes.Equal(have, want) {
+		t.Errorf("Payload: have: %v, want: %v", have, want)
+	}
+	if decoded.Command.Count != 3 || decoded.Command.Ratio != 0.5 || !decoded.Command.Flag {
+		t.Errorf("unexpected values: %+v", decoded.Command)
+	}
+	if len(decoded.Command.Queries) != 2 {
+		t.Fatalf("Queries: have: %v, want: 2", len(decoded.Command.Queries))
+	}
+	if have, want := decoded.Command.Queries[1], []byte("world"); !bytes.Equal(have.([]byte), want) {
+		t.Errorf("Queries data: have: %v, want: %v", have, want)
+	}
+
+	// supplied CommandUUIDs are kept
+	cmd, err = CommandFromJSON([]byte(`{"CommandUUID": "abc", "Command": {"RequestType": "ProfileList"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmd.CommandUUID, "abc"; have != want {
+		t.Errorf("CommandUUID: have: %v, want: %v", have, want)
+	}
+
+	for name, input := range map[string]string{
+		"no request type": `{"Command": {}}`,
+		"not an object":   `["ProfileList"]`,
+		"null":            `null`,
+		"null value":      `{"Command": {"RequestType": "ProfileList", "Value": null}}`,
+		"bad data":        `{"Command": {"RequestType": "InstallProfile", "Payload": {"$data": "!"}}}`,
+	} {
+		if _, err = CommandFromJSON([]byte(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err = CommandFromJSON(nil); !errors.Is(err, ErrEmptyCommand) {
+		t.Errorf("empty: have: %v, want: %v", err, ErrEmptyCommand)
+	}
+}
@@ -0,0 +1,100 @@
+// Package profileencrypt encrypts Apple configuration profiles to
+// device identity certificates.
+//
+// The PayloadContent array of the profile is serialized as a plist and
+// encrypted as CMS (PKCS #7) EnvelopedData. The DER-encoded result
+// replaces PayloadContent as the EncryptedPayloadContent of the
+// profile. Only the device holding the private key of the identity
+// certificate can decrypt the payloads. Encrypted profiles can
+// subsequently be signed.
+//
+// The content encryption algorithm is the global
+// pkcs7.ContentEncryptionAlgorithm. Programs should set it once at
+// startup, e.g. to pkcs7.EncryptionAlgorithmAES256CBC.
+package profileencrypt
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/plist"
+	"github.com/smallstep/pkcs7"
+)
+
+// Encrypt encrypts the PayloadContent of the unsigned configuration
+// profile to the identity certificate cert and returns the profile
+// with EncryptedPayloadContent instead. Only RSA certificates are
+// supported.
+func Encrypt(profile []byte, cert *x509.Certificate) ([]byte, error) {
+	if cert == nil {
+		return nil, errors.New("nil certificate")
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported certificate public key type: %T", cert.PublicKey)
+	}
+	var dict map[string]interface{}
+	if err := plist.Unmarshal(profile, &dict); err != nil {
+		return nil, fmt.Errorf("decoding profile plist (signed profiles can not be encrypted): %w", err)
+	}
+	if dict == nil {
+		return nil, errors.New("profile is not a plist dictionary")
+	}
+	if _, ok := dict["EncryptedPayloadContent"]; ok {
+		return nil, errors.New("profile already encrypted")
+	}
+	content, ok := dict["PayloadContent"].([]interface{})
+	if !ok {
+		return nil, errors.New("missing or invalid profile PayloadContent")
+	}
+	rawContent, err := plist.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("encoding PayloadContent plist: %w", err)
+	}
+	encrypted, err := pkcs7.Encrypt(rawContent, []*x509.Certificate{cert})
+	if err != nil {
+		return nil, fmt.Errorf("encrypting PayloadContent: %w", err)
+	}
+	delete(dict, "PayloadContent")
+	dict["EncryptedPayloadContent"] = encrypted
+	return plist.MarshalIndent(dict, "\t")
+}
+
+// EncryptInstallProfile encrypts the profile Payload of the
+// InstallProfile command cmd to the identity certificate cert (see
+// [Encrypt]) and returns a new command with the re-serialized plist and
+// a CommandUUID of cmdUUID.
+func EncryptInstallProfile(cmd *mdm.Command, cert *x509.Certificate, cmdUUID string) (*mdm.Command, error) {
+	if cmd == nil || cmd.Command.RequestType != "InstallProfile" {
+		return nil, errors.New("not an InstallProfile command")
+	}
+	if cmdUUID == "" {
+		return nil, errors.New("empty command uuid")
+	}
+	var dict map[string]interface{}
+	if err := plist.Unmarshal(cmd.Raw, &dict); err != nil {
+		return nil, fmt.Errorf("decoding command plist: %w", err)
+	}
+	command, ok := dict["Command"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid command dictionary")
+	}
+	payload, ok := command["Payload"].([]byte)
+	if !ok || len(payload) < 1 {
+		return nil, errors.New("missing or invalid profile payload")
+	}
+	encrypted, err := Encrypt(payload, cert)
+	if err != nil {
+		return nil, err
+	}
+	command["Payload"] = encrypted
+	dict["CommandUUID"] = cmdUUID
+	rawCommand, err := plist.MarshalIndent(dict, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encoding command plist: %w", err)
+	}
+	return mdm.DecodeCommand(rawCommand)
+}
@@ -0,0 +1,103 @@
+package profileencrypt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/test"
+
+	"github.com/micromdm/plist"
+	"github.com/smallstep/pkcs7"
+)
+
+const testProfile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>Password</key>
+			<string>hunter2</string>
+			<key>PayloadType</key>
+			<string>com.apple.wifi.managed</string>
+		</dict>
+	</array>
+	<key>PayloadIdentifier</key>
+	<string>com.example.wifi</string>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`
+
+type profile struct {
+	PayloadContent          []map[string]string
+	EncryptedPayloadContent []byte
+	PayloadIdentifier       string
+}
+
+func TestEncryptInstallProfile(t *testing.T) {
+	key, cert, err := test.SimpleSelfSignedRSAKeypair("device", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := commands.New(&commands.InstallProfile{Payload: []byte(testProfile)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encCmd, err := EncryptInstallProfile(cmd, cert, "new-uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := encCmd.CommandUUID, "new-uuid"; have != want {
+		t.Errorf("command uuid: have: %q, want: %q", have, want)
+	}
+
+	p := new(struct {
+		Command commands.InstallProfile
+	})
+	if err = plist.Unmarshal(encCmd.Raw, p); err != nil {
+		t.Fatal(err)
+	}
+	var enc profile
+	if err = plist.Unmarshal(p.Command.Payload, &enc); err != nil {
+		t.Fatal(err)
+	}
+	if enc.PayloadContent != nil {
+		t.Error("cleartext PayloadContent in encrypted profile")
+	}
+	if have, want := enc.PayloadIdentifier, "com.example.wifi"; have != want {
+		t.Errorf("payload identifier: have: %q, want: %q", have, want)
+	}
+
+	p7, err := pkcs7.Parse(enc.EncryptedPayloadContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := p7.Decrypt(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []map[string]string
+	if err = plist.Unmarshal(content, &have); err != nil {
+		t.Fatal(err)
+	}
+	var orig profile
+	if err = plist.Unmarshal([]byte(testProfile), &orig); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, orig.PayloadContent) {
+		t.Errorf("decrypted content: have: %v, want: %v", have, orig.PayloadContent)
+	}
+
+	// encrypting twice is an error
+	if _, err = Encrypt(p.Command.Payload, cert); err == nil {
+		t.Error("expected error encrypting encrypted profile")
+	}
+}
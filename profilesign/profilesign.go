@@ -0,0 +1,166 @@
+// Package profilesign signs Apple configuration profiles.
+//
+// Signed profiles are CMS (PKCS #7) SignedData with the profile plist
+// as the attached content. Devices show signed profiles as "Verified"
+// if they trust the signing certificate and some payloads require
+// signed profiles.
+package profilesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/plist"
+	"github.com/smallstep/pkcs7"
+)
+
+// Signer signs configuration profiles with a signing identity.
+type Signer struct {
+	chain []*x509.Certificate
+	key   crypto.PrivateKey
+}
+
+// NewSigner creates a new profile signer from the PEM-encoded signing
+// certificate chain and private key. The first certificate in chainPEM
+// must be the signing certificate and must match the private key. Any
+// following certificates should be its issuer(s) which are included in
+// signed profiles.
+func NewSigner(chainPEM, keyPEM []byte) (*Signer, error) {
+	s := new(Signer)
+	for {
+		var block *pem.Block
+		block, chainPEM = pem.Decode(chainPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signing certificate: %w", err)
+		}
+		s.chain = append(s.chain, cert)
+	}
+	if len(s.chain) < 1 {
+		return nil, errors.New("no signing certificate found")
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing private key: %w", err)
+	}
+	pub, ok := key.(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	if eq, ok := pub.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !eq.Equal(s.chain[0].PublicKey) {
+		return nil, errors.New("signing certificate and private key do not match")
+	}
+	s.key = key
+	return s, nil
+}
+
+// Certificate returns the signing certificate.
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.chain[0]
+}
+
+// Sign signs the configuration profile and returns the DER-encoded
+// CMS SignedData containing it.
+func (s *Signer) Sign(profile []byte) ([]byte, error) {
+	if len(profile) < 1 {
+		return nil, errors.New("empty profile")
+	}
+	sd, err := pkcs7.NewSignedData(profile)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err = sd.AddSignerChain(s.chain[0], s.key, s.chain[1:], pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("adding signer: %w", err)
+	}
+	return sd.Finish()
+}
+
+// IsSigned reports whether profile is CMS SignedData (rather than a plist).
+func IsSigned(profile []byte) bool {
+	// plists start with "<" (XML) or "bplist" (binary), possibly after
+	// whitespace or a BOM. DER starts with a SEQUENCE tag.
+	if len(profile) < 1 || profile[0] != 0x30 {
+		return false
+	}
+	_, err := pkcs7.Parse(profile)
+	return err == nil
+}
+
+// SignInstallProfile signs the unsigned profile Payload of the
+// InstallProfile command cmd and returns a new command with the
+// re-serialized plist. The CommandUUID is kept. Commands of other
+// RequestTypes and already signed profiles are returned as-is.
+func (s *Signer) SignInstallProfile(cmd *mdm.Command) (*mdm.Command, error) {
+	if cmd == nil || cmd.Command.RequestType != "InstallProfile" {
+		return cmd, nil
+	}
+	var dict map[string]interface{}
+	if err := plist.Unmarshal(cmd.Raw, &dict); err != nil {
+		return nil, fmt.Errorf("decoding command plist: %w", err)
+	}
+	command, ok := dict["Command"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid command dictionary")
+	}
+	payload, ok := command["Payload"].([]byte)
+	if !ok || len(payload) < 1 {
+		return nil, errors.New("missing or invalid profile payload")
+	}
+	if IsSigned(payload) {
+		return cmd, nil
+	}
+	signed, err := s.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("signing profile: %w", err)
+	}
+	command["Payload"] = signed
+	rawCommand, err := plist.MarshalIndent(dict, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encoding command plist: %w", err)
+	}
+	return mdm.DecodeCommand(rawCommand)
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS#1, PKCS#8, or SEC 1 private key.
+func parsePrivateKey(keyPEM []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if x509.IsEncryptedPEMBlock(block) {
+		return nil, errors.New("private key PEM appears to be encrypted")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return nil, errors.New("ed25519 keys are not supported for CMS signing")
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+}
@@ -0,0 +1,151 @@
+package profilesign
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/test"
+
+	"github.com/micromdm/plist"
+	"github.com/smallstep/pkcs7"
+)
+
+const testProfile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array/>
+	<key>PayloadIdentifier</key>
+	<string>com.example.test</string>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>0BA9B5A4-2F0F-4B5F-9C0A-3B4E6C9A1F21</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, cert, err := test.SimpleSelfSignedRSAKeypair("profilesign-test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSign(t *testing.T) {
+	signer := newTestSigner(t)
+
+	if IsSigned([]byte(testProfile)) {
+		t.Error("unsigned profile reported as signed")
+	}
+
+	signed, err := signer.Sign([]byte(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSigned(signed) {
+		t.Error("signed profile reported as unsigned")
+	}
+
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p7.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p7.Content, []byte(testProfile)) {
+		t.Error("signed content does not match profile")
+	}
+	if p7.GetOnlySigner() == nil || !p7.GetOnlySigner().Equal(signer.Certificate()) {
+		t.Error("signer certificate mismatch")
+	}
+}
+
+func TestNewSignerMismatch(t *testing.T) {
+	_, cert, err := test.SimpleSelfSignedRSAKeypair("a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := test.SimpleSelfSignedRSAKeypair("b", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSigner(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	)
+	if err == nil {
+		t.Error("expected error for mismatched key")
+	}
+}
+
+func TestSignInstallProfile(t *testing.T) {
+	signer := newTestSigner(t)
+
+	cmd, err := commands.New(&commands.InstallProfile{Payload: []byte(testProfile)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedCmd, err := signer.SignInstallProfile(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := signedCmd.CommandUUID, cmd.CommandUUID; have != want {
+		t.Errorf("command uuid: have: %q, want: %q", have, want)
+	}
+	if have, want := signedCmd.Command.RequestType, "InstallProfile"; have != want {
+		t.Errorf("request type: have: %q, want: %q", have, want)
+	}
+
+	payload := installProfilePayload(t, signedCmd)
+	if !IsSigned(payload) {
+		t.Fatal("payload not signed")
+	}
+
+	// already signed profiles are left alone
+	again, err := signer.SignInstallProfile(signedCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(installProfilePayload(t, again), payload) {
+		t.Error("signed payload re-signed")
+	}
+
+	// other commands are left alone
+	other, err := commands.New(&commands.ProfileList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, err := signer.SignInstallProfile(other); err != nil || same != other {
+		t.Errorf("expected unchanged command, have: %v, err: %v", same, err)
+	}
+}
+
+func installProfilePayload(t *testing.T, cmd *mdm.Command) []byte {
+	t.Helper()
+	p := new(struct {
+		Command commands.InstallProfile
+	})
+	if err := plist.Unmarshal(cmd.Raw, p); err != nil {
+		t.Fatal(err)
+	}
+	return p.Command.Payload
+}
@@ -0,0 +1,297 @@
+// Package apnstest implements a mock Apple APNs HTTP/2 server for
+// testing and local development.
+//
+// The server implements the APNs "/3/device/{token}" contract over a
+// TLS HTTP/2 connection. Responses can be configured per device token
+// and all received pushes are recorded for later inspection.
+package apnstest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// APNs error reasons.
+// See https://developer.apple.com/documentation/usernotifications/handling-notification-responses-from-apns
+const (
+	ReasonBadDeviceToken         = "BadDeviceToken"
+	ReasonBadTopic               = "BadTopic"
+	ReasonDeviceTokenNotForTopic = "DeviceTokenNotForTopic"
+	ReasonBadCertificate         = "BadCertificate"
+	ReasonExpiredProviderToken   = "ExpiredProviderToken"
+	ReasonForbidden              = "Forbidden"
+	ReasonUnregistered           = "Unregistered"
+	ReasonTooManyRequests        = "TooManyRequests"
+	ReasonInternalServerError    = "InternalServerError"
+	ReasonServiceUnavailable     = "ServiceUnavailable"
+	ReasonShutdown               = "Shutdown"
+)
+
+// Response configures how the server responds to a push.
+type Response struct {
+	// StatusCode is the HTTP status code of the response.
+	// A zero value is treated as 200.
+	StatusCode int
+
+	// ID is the "apns-id" header of the response.
+	// A random UUID is generated if empty.
+	ID string
+
+	// Reason is the APNs error reason of non-200 responses.
+	// When GoAway is set it is sent as the GOAWAY debug data.
+	Reason string
+
+	// Timestamp is the APNs error timestamp in milliseconds.
+	// Typically only present for 410 responses.
+	Timestamp int64
+
+	// GoAway sends an HTTP/2 GOAWAY frame and closes the connection
+	// instead of responding normally.
+	GoAway bool
+
+	// GoAwayCode is the HTTP/2 error code of the GOAWAY frame.
+	GoAwayCode http2.ErrCode
+}
+
+// OK returns a successful response.
+func OK() *Response {
+	return &Response{StatusCode: http.StatusOK}
+}
+
+// Error returns an APNs JSON error response with statusCode and reason.
+func Error(statusCode int, reason string) *Response {
+	r := &Response{StatusCode: statusCode, Reason: reason}
+	if statusCode == http.StatusGone {
+		r.Timestamp = time.Now().UnixMilli()
+	}
+	return r
+}
+
+// GoAway returns a response that sends an HTTP/2 GOAWAY frame with reason.
+func GoAway(reason string) *Response {
+	return &Response{GoAway: true, Reason: reason}
+}
+
+// body returns the JSON body of non-200 responses.
+func (r *Response) body() []byte {
+	if r.Reason == "" {
+		return nil
+	}
+	e := struct {
+		Reason    string `json:"reason"`
+		Timestamp int64  `json:"timestamp,omitempty"`
+	}{
+		Reason:    r.Reason,
+		Timestamp: r.Timestamp,
+	}
+	b, _ := json.Marshal(&e)
+	return b
+}
+
+// Push is a push notification received by the server.
+type Push struct {
+	// Token is the hex device token from the URL path.
+	Token string
+
+	// PushMagic is the "mdm" key from the JSON payload.
+	PushMagic string
+
+	// Header contains the HTTP headers of the push request.
+	Header http.Header
+
+	// Body is the raw push payload.
+	Body []byte
+
+	// Certificate is the client (push) certificate, if any was sent.
+	Certificate *x509.Certificate
+
+	// Response is what the server responded with.
+	Response Response
+
+	// Received is the time the push was received.
+	Received time.Time
+}
+
+// Server is a mock APNs server.
+type Server struct {
+	ts *httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]*Response
+	dflt      *Response
+	pushes    []*Push
+}
+
+// Option configures the server.
+type Option func(*Server)
+
+// WithDefaultResponse sets the response for tokens without a
+// configured response. The default is a 200 response.
+func WithDefaultResponse(resp *Response) Option {
+	return func(s *Server) {
+		s.dflt = resp
+	}
+}
+
+// WithResponse configures the response for token.
+func WithResponse(token string, resp *Response) Option {
+	return func(s *Server) {
+		s.responses[token] = resp
+	}
+}
+
+// NewUnstartedServer creates a new mock APNs server but does not start it.
+// Callers should call Start and then Close when finished.
+func NewUnstartedServer(opts ...Option) *Server {
+	s := &Server{
+		responses: make(map[string]*Response),
+		dflt:      OK(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ts = httptest.NewUnstartedServer(http.NotFoundHandler())
+	s.ts.EnableHTTP2 = true
+	s.ts.TLS = &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+		NextProtos: []string{http2.NextProtoTLS},
+	}
+	// take over h2 connections with our own (minimal) HTTP/2 server
+	// so that we can control the framing (i.e. GOAWAY frames).
+	s.ts.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+		http2.NextProtoTLS: func(_ *http.Server, c *tls.Conn, _ http.Handler) {
+			newConn(s, c).serve()
+		},
+	}
+	return s
+}
+
+// NewServer creates and starts a new mock APNs server.
+// Callers should call Close when finished.
+func NewServer(opts ...Option) *Server {
+	s := NewUnstartedServer(opts...)
+	s.Start()
+	return s
+}
+
+// Start starts the server.
+func (s *Server) Start() {
+	s.ts.StartTLS()
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// URL returns the base URL of the server.
+// Suitable for use as an APNs base URL in push providers.
+func (s *Server) URL() string {
+	return s.ts.URL
+}
+
+// Certificate returns the TLS certificate of the server.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.ts.Certificate()
+}
+
+// Client returns an HTTP/2 client configured to trust the server.
+func (s *Server) Client() *http.Client {
+	return s.ts.Client()
+}
+
+// NewClient returns an HTTP/2 client configured to trust the server
+// that presents cert as its client certificate.
+// It is suitable for use as a push provider's HTTP client callback.
+func (s *Server) NewClient(cert *tls.Certificate) (*http.Client, error) {
+	if cert == nil {
+		return nil, errors.New("nil cert")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate())
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{*cert},
+		},
+	}
+	if err := http2.ConfigureTransport(transport); err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// SetResponse configures the response for pushes to token.
+// A nil resp removes the configured response.
+func (s *Server) SetResponse(token string, resp *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resp == nil {
+		delete(s.responses, token)
+		return
+	}
+	s.responses[token] = resp
+}
+
+// SetDefaultResponse sets the response for tokens without a configured response.
+func (s *Server) SetDefaultResponse(resp *Response) {
+	if resp == nil {
+		resp = OK()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dflt = resp
+}
+
+// Pushes returns the pushes received by the server.
+func (s *Server) Pushes() []*Push {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Push(nil), s.pushes...)
+}
+
+// PushesFor returns the pushes received by the server for token.
+func (s *Server) PushesFor(token string) (pushes []*Push) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pushes {
+		if p.Token == token {
+			pushes = append(pushes, p)
+		}
+	}
+	return
+}
+
+// Reset clears the recorded pushes.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushes = nil
+}
+
+// respond records p and returns the configured response for it.
+func (s *Server) respond(p *Push) *Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.responses[p.Token]
+	if !ok || resp == nil {
+		resp = s.dflt
+	}
+	p.Response = *resp
+	if p.Response.StatusCode == 0 {
+		p.Response.StatusCode = http.StatusOK
+	}
+	if p.Response.ID == "" {
+		p.Response.ID = newUUID()
+	}
+	s.pushes = append(s.pushes, p)
+	return &p.Response
+}
@@ -0,0 +1,147 @@
+package apnstest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push/nanopush"
+	"github.com/micromdm/nanomdm/test"
+	"golang.org/x/net/http2"
+)
+
+const (
+	tokenOK      = "c2732227a1d8021cfaf781d71fb2f908c61f5861079a00954a5453f1d0281433"
+	tokenGone    = "7f1839ca30d5c6d36d6ae426258c4306c14eca90afd709a07375a85ad5a11c69"
+	tokenGoAway  = "1b2bd31d8b8ebd0e5f4d9d0a8eb6cf4ea8e3b96ac5de0b8a84e6b2d8b3ae7b11"
+	pushMagic    = "47250C9C-1B37-4381-98A9-0B8315A441C7"
+	pushTopic    = "com.apple.mgmt.External.example"
+	responseAPNs = "922D9F1F-B82E-B337-EDC9-DB4FC8527676"
+)
+
+func newPush(token string) *mdm.Push {
+	p := &mdm.Push{PushMagic: pushMagic, Topic: pushTopic}
+	p.SetTokenString(token)
+	return p
+}
+
+func newClientCert(t *testing.T) *tls.Certificate {
+	key, cert, err := test.SimpleSelfSignedRSAKeypair("apnstest", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(
+		WithResponse(tokenOK, &Response{ID: responseAPNs}),
+		WithResponse(tokenGone, Error(http.StatusGone, ReasonUnregistered)),
+	)
+	defer srv.Close()
+
+	fact := nanopush.NewFactory(
+		nanopush.WithBaseURL(srv.URL()),
+		nanopush.WithNewClient(srv.NewClient),
+	)
+	prov, err := fact.NewPushProvider(newClientCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	resps, err := prov.Push(ctx, []*mdm.Push{newPush(tokenOK), newPush(tokenGone)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := resps[tokenOK]; resp == nil {
+		t.Fatal("nil response")
+	} else if resp.Err != nil {
+		t.Errorf("unexpected error: %v", resp.Err)
+	} else if have, want := resp.Id, responseAPNs; have != want {
+		t.Errorf("apns-id: have %q, want %q", have, want)
+	}
+
+	var jsonErr *nanopush.JSONPushError
+	if resp := resps[tokenGone]; resp == nil {
+		t.Fatal("nil response")
+	} else if !errors.As(resp.Err, &jsonErr) {
+		t.Errorf("expected JSON push error, have: %v", resp.Err)
+	} else if have, want := jsonErr.Reason, ReasonUnregistered; have != want {
+		t.Errorf("reason: have %q, want %q", have, want)
+	} else if jsonErr.Timestamp == 0 {
+		t.Error("expected timestamp")
+	}
+
+	if have, want := len(srv.Pushes()), 2; have != want {
+		t.Fatalf("pushes: have %d, want %d", have, want)
+	}
+	pushes := srv.PushesFor(tokenOK)
+	if have, want := len(pushes), 1; have != want {
+		t.Fatalf("pushes for token: have %d, want %d", have, want)
+	}
+	if have, want := pushes[0].PushMagic, pushMagic; have != want {
+		t.Errorf("push magic: have %q, want %q", have, want)
+	}
+	if pushes[0].Certificate == nil || pushes[0].Certificate.Subject.CommonName != "apnstest" {
+		t.Error("expected client certificate")
+	}
+
+	srv.Reset()
+	if have, want := len(srv.Pushes()), 0; have != want {
+		t.Errorf("pushes after reset: have %d, want %d", have, want)
+	}
+
+	srv.SetResponse(tokenGoAway, GoAway(ReasonShutdown))
+
+	resps, err = prov.Push(ctx, []*mdm.Push{newPush(tokenGoAway)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := resps[tokenGoAway]; resp == nil {
+		t.Fatal("nil response")
+	} else if resp.Err == nil || !strings.Contains(resp.Err.Error(), ReasonShutdown) {
+		t.Errorf("expected GOAWAY error, have: %v", resp.Err)
+	}
+
+	// make sure a new connection can be made after a GOAWAY
+	resps, err = prov.Push(ctx, []*mdm.Push{newPush(tokenOK)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := resps[tokenOK]; resp == nil || resp.Err != nil {
+		t.Errorf("expected successful push after GOAWAY: %v", resp)
+	}
+}
+
+func TestGoAwayError(t *testing.T) {
+	srv := NewServer(WithDefaultResponse(GoAway(ReasonShutdown)))
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL()+devicePathPrefix+tokenOK, strings.NewReader(`{"mdm":"`+pushMagic+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := srv.NewClient(newClientCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req)
+	var goAwayErr http2.GoAwayError
+	if !errors.As(err, &goAwayErr) {
+		t.Fatalf("expected GOAWAY error, have: %v", err)
+	}
+	if have, want := goAwayErr.DebugData, `{"reason":"Shutdown"}`; have != want {
+		t.Errorf("debug data: have %q, want %q", have, want)
+	}
+}
@@ -0,0 +1,191 @@
+package apnstest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// devicePathPrefix is the APNs URL path prefix for device tokens.
+const devicePathPrefix = "/3/device/"
+
+// stream is an in-progress HTTP/2 request stream.
+type stream struct {
+	header http.Header
+	method string
+	path   string
+	body   bytes.Buffer
+}
+
+// conn is a minimal HTTP/2 server connection.
+// It only supports what is needed to mock the APNs push API.
+type conn struct {
+	srv     *Server
+	c       *tls.Conn
+	fr      *http2.Framer
+	henc    *hpack.Encoder
+	hbuf    bytes.Buffer
+	streams map[uint32]*stream
+}
+
+func newConn(srv *Server, c *tls.Conn) *conn {
+	cc := &conn{
+		srv:     srv,
+		c:       c,
+		streams: make(map[uint32]*stream),
+	}
+	cc.fr = http2.NewFramer(c, c)
+	cc.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	return cc
+}
+
+// serve reads and responds to HTTP/2 frames until the connection is closed.
+func (cc *conn) serve() {
+	defer cc.c.Close()
+
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(cc.c, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+
+	if err := cc.fr.WriteSettings(http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 1000}); err != nil {
+		return
+	}
+
+	for {
+		f, err := cc.fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				err = cc.fr.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = cc.fr.WritePing(true, f.Data)
+			}
+		case *http2.MetaHeadersFrame:
+			s := &stream{
+				header: make(http.Header),
+				method: f.PseudoValue("method"),
+				path:   f.PseudoValue("path"),
+			}
+			for _, hf := range f.RegularFields() {
+				s.header.Add(hf.Name, hf.Value)
+			}
+			cc.streams[f.StreamID] = s
+			if f.StreamEnded() {
+				err = cc.handle(f.StreamID)
+			}
+		case *http2.DataFrame:
+			s, ok := cc.streams[f.StreamID]
+			if !ok {
+				err = cc.fr.WriteRSTStream(f.StreamID, http2.ErrCodeStreamClosed)
+				break
+			}
+			s.body.Write(f.Data())
+			if len(f.Data()) > 0 {
+				// replenish the connection flow control window.
+				// the stream window does not matter as pushes are small.
+				err = cc.fr.WriteWindowUpdate(0, uint32(len(f.Data())))
+			}
+			if err == nil && f.StreamEnded() {
+				err = cc.handle(f.StreamID)
+			}
+		case *http2.RSTStreamFrame:
+			delete(cc.streams, f.StreamID)
+		case *http2.GoAwayFrame:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle records and responds to the push request of streamID.
+func (cc *conn) handle(streamID uint32) error {
+	s := cc.streams[streamID]
+	delete(cc.streams, streamID)
+
+	if s.method != http.MethodPost || !strings.HasPrefix(s.path, devicePathPrefix) {
+		return cc.writeResponse(streamID, http.StatusNotFound, nil, []byte(`{"reason":"BadPath"}`))
+	}
+
+	p := &Push{
+		Token:    strings.TrimPrefix(s.path, devicePathPrefix),
+		Header:   s.header,
+		Body:     s.body.Bytes(),
+		Received: time.Now(),
+	}
+	if certs := cc.c.ConnectionState().PeerCertificates; len(certs) > 0 {
+		p.Certificate = certs[0]
+	}
+	payload := struct {
+		MDM string `json:"mdm"`
+	}{}
+	if err := json.Unmarshal(p.Body, &payload); err == nil {
+		p.PushMagic = payload.MDM
+	}
+
+	resp := cc.srv.respond(p)
+
+	if resp.GoAway {
+		// closing the connection after the GOAWAY frame should
+		// surface an error to clients of streams up to and
+		// including this one.
+		cc.fr.WriteGoAway(streamID, resp.GoAwayCode, resp.body())
+		return io.EOF
+	}
+
+	header := http.Header{"apns-id": []string{resp.ID}}
+	var body []byte
+	if resp.StatusCode != http.StatusOK {
+		body = resp.body()
+		header.Set("content-type", "application/json")
+	}
+	return cc.writeResponse(streamID, resp.StatusCode, header, body)
+}
+
+// writeResponse writes the response headers and body of streamID.
+func (cc *conn) writeResponse(streamID uint32, statusCode int, header http.Header, body []byte) error {
+	cc.hbuf.Reset()
+	cc.henc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(statusCode)})
+	for k, vs := range header {
+		for _, v := range vs {
+			cc.henc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	err := cc.fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: cc.hbuf.Bytes(),
+		EndStream:     len(body) < 1,
+		EndHeaders:    true,
+	})
+	if err != nil || len(body) < 1 {
+		return err
+	}
+	return cc.fr.WriteData(streamID, true, body)
+}
+
+// newUUID generates a random (version 4) UUID string.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+}
@@ -60,7 +60,8 @@ func NewPushProviderFactory(opts ...Option) *bufordFactory {
 	return factory
 }
 
-// NewPushProvider generates a new PushProvider given a tls keypair
+// NewPushProvider generates a new PushProvider given a tls keypair.
+// The APNs environment is detected from the certificate.
 func (f *bufordFactory) NewPushProvider(cert *tls.Certificate) (push.PushProvider, error) {
 	var client *http.Client
 	var err error
@@ -72,8 +73,14 @@ func (f *bufordFactory) NewPushProvider(cert *tls.Certificate) (push.PushProvide
 	if err != nil {
 		return nil, err
 	}
+	host := bufordpush.Production
+	if env, err := push.EnvironmentFromTLSCert(cert); err != nil {
+		return nil, err
+	} else if env == push.Development {
+		host = bufordpush.Development
+	}
 	prov := &bufordPushProvider{
-		service:    bufordpush.NewService(client, bufordpush.Production),
+		service:    bufordpush.NewService(client, host),
 		expiration: f.expiration,
 		workers:    f.workers,
 	}
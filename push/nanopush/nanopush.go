@@ -74,6 +74,8 @@ type Factory struct {
 	newClient  NewClient
 	expiration time.Duration
 	workers    int
+	baseURL    string
+	altPort    bool
 }
 
 type Option func(*Factory)
@@ -104,6 +106,27 @@ func WithWorkers(workers int) Option {
 	}
 }
 
+// WithBaseURL sets the APNs base URL that pushes are sent to.
+// By default the APNs environment is detected from each push
+// certificate (see [push.EnvironmentFromCert]). Setting a base URL
+// overrides this detection for all push certificates. This can be used
+// to send pushes to a mock APNs server (such as the one in the apnstest
+// package) for testing.
+func WithBaseURL(baseURL string) Option {
+	return func(f *Factory) {
+		f.baseURL = baseURL
+	}
+}
+
+// WithAlternatePort sends pushes to the alternate APNs port 2197
+// rather than the default HTTPS port. This can be useful when outbound
+// port 443 is restricted. Ignored if a base URL is set with [WithBaseURL].
+func WithAlternatePort() Option {
+	return func(f *Factory) {
+		f.altPort = true
+	}
+}
+
 // NewFactory creates a new Factory.
 func NewFactory(opts ...Option) *Factory {
 	f := &Factory{
@@ -116,12 +139,36 @@ func NewFactory(opts ...Option) *Factory {
 	return f
 }
 
+// BaseURL returns the APNs base URL for env.
+// The alternate port 2197 URL is returned if altPort is true.
+func BaseURL(env push.Environment, altPort bool) string {
+	switch {
+	case env == push.Development && altPort:
+		return Development2197
+	case env == push.Development:
+		return Development
+	case altPort:
+		return Production2197
+	default:
+		return Production
+	}
+}
+
 // NewPushProvider generates a new PushProvider given a tls keypair.
+// The APNs environment is detected from the certificate unless a
+// base URL was set with [WithBaseURL].
 func (f *Factory) NewPushProvider(cert *tls.Certificate) (push.PushProvider, error) {
 	p := &Provider{
 		expiration: f.expiration,
 		workers:    f.workers,
-		baseURL:    Production,
+		baseURL:    f.baseURL,
+	}
+	if p.baseURL == "" {
+		env, err := push.EnvironmentFromTLSCert(cert)
+		if err != nil {
+			return nil, fmt.Errorf("detecting APNs environment: %w", err)
+		}
+		p.baseURL = BaseURL(env, f.altPort)
 	}
 	var err error
 	p.client, err = f.newClient(cert)
@@ -0,0 +1,65 @@
+package nanopush
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/test"
+)
+
+func newPushCert(t *testing.T, oid asn1.ObjectIdentifier) *tls.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "APSP:test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if oid != nil {
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oid, Value: []byte{0x05, 0x00}}}
+	}
+	key, cert, err := test.SelfSignedCertRSAResigner(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+func TestFactoryEnvironment(t *testing.T) {
+	var (
+		oidDev  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 1}
+		oidProd = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 2}
+	)
+	newClient := func(*tls.Certificate) (*http.Client, error) { return new(http.Client), nil }
+
+	for _, tc := range []struct {
+		name string
+		oid  asn1.ObjectIdentifier
+		opts []Option
+		want string
+	}{
+		{"production", oidProd, nil, Production},
+		{"development", oidDev, nil, Development},
+		{"no-extension", nil, nil, Production},
+		{"production-2197", oidProd, []Option{WithAlternatePort()}, Production2197},
+		{"development-2197", oidDev, []Option{WithAlternatePort()}, Development2197},
+		{"base-url", oidDev, []Option{WithBaseURL("https://example.com")}, "https://example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFactory(append(tc.opts, WithNewClient(newClient))...)
+			prov, err := f.NewPushProvider(newPushCert(t, tc.oid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := prov.(*Provider).baseURL, tc.want; have != want {
+				t.Errorf("base URL: have %q, want %q", have, want)
+			}
+		})
+	}
+}
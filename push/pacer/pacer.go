@@ -0,0 +1,292 @@
+// Package pacer sends MDM APNs push notifications to large numbers of
+// enrollments spread out over time.
+//
+// Pushing many enrollments at once can cause a "thundering herd" of
+// MDM check-ins. A paced push job instead sends pushes in batches at a
+// configured rate (or over a configured duration) in the background.
+// The progress and per-enrollment results of jobs can be queried by
+// job ID.
+package pacer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanomdm/push"
+)
+
+const (
+	// DefaultBatchSize is the default maximum number of enrollments pushed at once.
+	DefaultBatchSize = 100
+
+	// DefaultRetention is the default time finished jobs are kept.
+	DefaultRetention = 24 * time.Hour
+)
+
+// Pace configures how pushes in a job are spread out.
+// Only one of Rate or Duration should be set.
+type Pace struct {
+	// Rate is the number of enrollments pushed per second.
+	Rate int
+
+	// Duration is the total time over which to spread the pushes.
+	Duration time.Duration
+}
+
+// Result is the push result for a single enrollment ID.
+type Result struct {
+	// PushID is the "apns-id" of a successful APNs push notification.
+	PushID string `json:"push_result,omitempty"`
+
+	// PushError is present if there was an error sending the APNs push notification.
+	PushError string `json:"push_error,omitempty"`
+}
+
+// Job is the status of a paced push job.
+type Job struct {
+	ID       string     `json:"id"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// Total is the number of enrollment IDs in the job.
+	Total int `json:"total"`
+
+	// Pushed is the number of enrollment IDs attempted so far.
+	Pushed int `json:"pushed"`
+
+	// Errors is the number of enrollment IDs that failed.
+	Errors int `json:"errors"`
+
+	// Status is the per-enrollment ID results of the job.
+	// Map key is the enrollment ID.
+	Status map[string]Result `json:"status,omitempty"`
+
+	// IDs are the enrollment IDs of the job.
+	IDs []string `json:"-"`
+}
+
+// Pacer runs paced push jobs.
+type Pacer struct {
+	pusher    push.Pusher
+	logger    log.Logger
+	batchSize int
+	retention time.Duration
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+type Option func(*Pacer)
+
+// WithLogger configures a logger.
+func WithLogger(logger log.Logger) Option {
+	return func(p *Pacer) {
+		p.logger = logger
+	}
+}
+
+// WithBatchSize sets the maximum number of enrollments pushed at once.
+// The default is [DefaultBatchSize].
+func WithBatchSize(n int) Option {
+	return func(p *Pacer) {
+		if n < 1 {
+			n = 1
+		}
+		p.batchSize = n
+	}
+}
+
+// WithRetention sets how long finished jobs are kept.
+// The default is [DefaultRetention].
+func WithRetention(d time.Duration) Option {
+	return func(p *Pacer) {
+		p.retention = d
+	}
+}
+
+// New creates a new pacer that sends pushes with pusher.
+func New(pusher push.Pusher, opts ...Option) *Pacer {
+	if pusher == nil {
+		panic("nil pusher")
+	}
+	p := &Pacer{
+		pusher:    pusher,
+		logger:    log.NopLogger,
+		batchSize: DefaultBatchSize,
+		retention: DefaultRetention,
+		jobs:      make(map[string]*Job),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// schedule returns the batch size and interval between batches for n
+// enrollments at pace.
+func (p *Pacer) schedule(n int, pace Pace) (int, time.Duration, error) {
+	batch := p.batchSize
+	switch {
+	case pace.Rate > 0 && pace.Duration > 0:
+		return 0, 0, errors.New("only one of rate or duration may be set")
+	case pace.Rate > 0:
+		if batch > pace.Rate {
+			batch = pace.Rate
+		}
+		interval := time.Duration(batch) * time.Second / time.Duration(pace.Rate)
+		if interval < 1 {
+			// very large rates would otherwise make a zero interval
+			interval = 1
+		}
+		return batch, interval, nil
+	case pace.Duration > 0:
+		batches := (n + batch - 1) / batch
+		if batches < 1 {
+			batches = 1
+		}
+		interval := pace.Duration / time.Duration(batches)
+		if interval < 1 {
+			interval = 1
+		}
+		return batch, interval, nil
+	default:
+		return 0, 0, errors.New("rate or duration must be set")
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Start starts a new paced push job in the background for ids.
+// The job ID is returned.
+func (p *Pacer) Start(ids []string, pace Pace) (string, error) {
+	if len(ids) < 1 {
+		return "", errors.New("no ids")
+	}
+	batch, interval, err := p.schedule(len(ids), pace)
+	if err != nil {
+		return "", err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	// copy the ids as the caller may modify them
+	ids = append([]string(nil), ids...)
+	j := &Job{
+		ID:      id,
+		Started: time.Now(),
+		Total:   len(ids),
+		Status:  make(map[string]Result, len(ids)),
+		IDs:     ids,
+	}
+
+	p.mu.Lock()
+	p.prune(j.Started)
+	p.jobs[id] = j
+	p.mu.Unlock()
+
+	p.logger.Debug(
+		"msg", "starting push job",
+		"job_id", id,
+		"id_count", len(ids),
+		"batch_size", batch,
+		"interval", interval.String(),
+	)
+
+	go p.run(j, ids, batch, interval)
+	return id, nil
+}
+
+// prune removes jobs that finished before the retention period.
+// The lock must be held.
+func (p *Pacer) prune(now time.Time) {
+	for id, j := range p.jobs {
+		if j.Finished != nil && now.Sub(*j.Finished) > p.retention {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// run sends pushes to ids in batches every interval.
+func (p *Pacer) run(j *Job, ids []string, batch int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := 0; i < len(ids); i += batch {
+		if i > 0 {
+			<-ticker.C
+		}
+		end := i + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		resps, err := p.pusher.Push(context.Background(), ids[i:end])
+		if err != nil {
+			p.logger.Info("msg", "push job batch", "job_id", j.ID, "err", err)
+		}
+		p.record(j, ids[i:end], resps, err)
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	j.Finished = &now
+	errCt := j.Errors
+	p.mu.Unlock()
+
+	p.logger.Info("msg", "finished push job", "job_id", j.ID, "id_count", len(ids), "errs", errCt)
+}
+
+// record records the push responses for ids in j.
+func (p *Pacer) record(j *Job, ids []string, resps map[string]*push.Response, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range ids {
+		var r Result
+		if resp, ok := resps[id]; ok && resp != nil {
+			r.PushID = resp.Id
+			if resp.Err != nil {
+				r.PushError = resp.Err.Error()
+			}
+		} else if err != nil {
+			r.PushError = err.Error()
+		} else {
+			r.PushError = "no push response"
+		}
+		if r.PushError != "" {
+			j.Errors++
+		}
+		j.Status[id] = r
+		j.Pushed++
+	}
+}
+
+// Job returns a copy of the status of job id.
+// Nil is returned if the job is not found.
+func (p *Pacer) Job(id string) *Job {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	j, ok := p.jobs[id]
+	if !ok {
+		return nil
+	}
+	c := *j
+	if j.Finished != nil {
+		finished := *j.Finished
+		c.Finished = &finished
+	}
+	c.Status = make(map[string]Result, len(j.Status))
+	for k, v := range j.Status {
+		c.Status[k] = v
+	}
+	return &c
+}
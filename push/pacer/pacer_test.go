@@ -0,0 +1,126 @@
+package pacer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/push"
+)
+
+type mockPusher struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (p *mockPusher) Push(_ context.Context, ids []string) (map[string]*push.Response, error) {
+	p.mu.Lock()
+	p.batches = append(p.batches, ids)
+	p.mu.Unlock()
+	resps := make(map[string]*push.Response)
+	for _, id := range ids {
+		if id == "fail" {
+			resps[id] = &push.Response{Err: errors.New("push failed")}
+			continue
+		}
+		resps[id] = &push.Response{Id: "apns-" + id}
+	}
+	return resps, nil
+}
+
+func waitJob(t *testing.T, p *Pacer, id string) *Job {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if job := p.Job(id); job == nil {
+			t.Fatal("job not found")
+		} else if job.Finished != nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not finish")
+	return nil
+}
+
+func TestPacer(t *testing.T) {
+	pusher := new(mockPusher)
+	p := New(pusher, WithBatchSize(2))
+
+	ids := []string{"fail"}
+	for i := 0; i < 8; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+
+	if _, err := p.Start(ids, Pace{}); err == nil {
+		t.Error("expected error with no pace")
+	}
+
+	id, err := p.Start(ids, Pace{Duration: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitJob(t, p, id)
+
+	if have, want := len(pusher.batches), 5; have != want {
+		t.Errorf("batches: have %d, want %d", have, want)
+	}
+	if have, want := job.Pushed, len(ids); have != want {
+		t.Errorf("pushed: have %d, want %d", have, want)
+	}
+	if have, want := job.Errors, 1; have != want {
+		t.Errorf("errors: have %d, want %d", have, want)
+	}
+	if have, want := job.Status["3"].PushID, "apns-3"; have != want {
+		t.Errorf("push id: have %q, want %q", have, want)
+	}
+	if job.Status["fail"].PushError == "" {
+		t.Error("expected push error")
+	}
+
+	if p.Job("missing") != nil {
+		t.Error("expected nil job")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	p := New(new(mockPusher), WithBatchSize(100))
+	for _, tc := range []struct {
+		n        int
+		pace     Pace
+		batch    int
+		interval time.Duration
+	}{
+		{1000, Pace{Rate: 50}, 50, time.Second},
+		{1000, Pace{Rate: 200}, 100, 500 * time.Millisecond},
+		{1000, Pace{Duration: 10 * time.Second}, 100, time.Second},
+		{1000, Pace{Rate: 200000000000}, 100, 1},
+	} {
+		batch, interval, err := p.schedule(tc.n, tc.pace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch != tc.batch || interval != tc.interval {
+			t.Errorf("schedule %+v: have %d/%s, want %d/%s", tc.pace, batch, interval, tc.batch, tc.interval)
+		}
+	}
+}
+
+func TestLargeRate(t *testing.T) {
+	pusher := new(mockPusher)
+	p := New(pusher, WithBatchSize(2))
+
+	id, err := p.Start([]string{"0", "1", "2"}, Pace{Rate: 200000000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitJob(t, p, id)
+
+	if have, want := job.Pushed, 3; have != want {
+		t.Errorf("pushed: have %d, want %d", have, want)
+	}
+}
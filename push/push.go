@@ -5,6 +5,9 @@ package push
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
 
 	"github.com/micromdm/nanomdm/mdm"
 )
@@ -31,3 +34,58 @@ type PushProvider interface {
 type PushProviderFactory interface {
 	NewPushProvider(*tls.Certificate) (PushProvider, error)
 }
+
+// Environment is an APNs environment.
+type Environment string
+
+const (
+	Production  Environment = "production"
+	Development Environment = "development"
+)
+
+var (
+	// Apple Development IOS Push Services marker OID
+	oidAPNsDevelopment = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 1}
+	// Apple Production IOS Push Services marker OID
+	oidAPNsProduction = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 2}
+)
+
+// EnvironmentFromCert detects the APNs environment of the push
+// certificate cert from its extensions. Certificates with only the
+// development push services extension are development certificates.
+// All others (including MDM push certificates issued by the Apple
+// Push Certificates Portal) are production certificates.
+func EnvironmentFromCert(cert *x509.Certificate) Environment {
+	var dev bool
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidAPNsProduction) {
+			return Production
+		} else if ext.Id.Equal(oidAPNsDevelopment) {
+			dev = true
+		}
+	}
+	if dev {
+		return Development
+	}
+	return Production
+}
+
+// EnvironmentFromTLSCert detects the APNs environment of the leaf
+// push certificate of cert. See [EnvironmentFromCert].
+func EnvironmentFromTLSCert(cert *tls.Certificate) (Environment, error) {
+	if cert == nil {
+		return "", errors.New("nil certificate")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) < 1 {
+			return "", errors.New("no certificate")
+		}
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", err
+		}
+	}
+	return EnvironmentFromCert(leaf), nil
+}
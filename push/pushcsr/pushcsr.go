@@ -0,0 +1,207 @@
+// Package pushcsr generates MDM APNs push certificate signing requests
+// (CSRs) and signs them with an MDM vendor certificate.
+//
+// Apple issues MDM APNs push certificates via the Apple Push
+// Certificates Portal. The portal requires a "push certificate request"
+// which is a customer CSR signed by an MDM vendor certificate and
+// wrapped in a base64-encoded plist.
+package pushcsr
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/plist"
+)
+
+// KeySize is the RSA key size of generated push certificate private keys.
+const KeySize = 2048
+
+// GenerateKeyAndCSR generates a new RSA private key and a DER-encoded
+// CSR for the key with the given common name and email address.
+func GenerateKeyAndCSR(cn, email string) (*rsa.PrivateKey, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, KeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+	csr, err := NewCSR(key, cn, email)
+	return key, csr, err
+}
+
+// NewCSR creates a DER-encoded CSR for key with the given common name
+// and email address.
+func NewCSR(key crypto.Signer, cn, email string) ([]byte, error) {
+	if cn == "" {
+		return nil, errors.New("empty common name")
+	}
+	tmpl := &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: cn},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	if email != "" {
+		tmpl.EmailAddresses = []string{email}
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating CSR: %w", err)
+	}
+	return csr, nil
+}
+
+// PEMCSR returns csr as a PEM-encoded certificate request.
+func PEMCSR(csr []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr,
+	})
+}
+
+// DecodeCSR decodes a DER or PEM-encoded CSR and checks its signature.
+// The DER-encoded CSR is returned along with the parsed request.
+func DecodeCSR(b []byte) ([]byte, *x509.CertificateRequest, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, nil, fmt.Errorf("unrecognized PEM type: %q", block.Type)
+		}
+		b = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CSR: %w", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("checking CSR signature: %w", err)
+	}
+	return b, csr, nil
+}
+
+// PushCertRequest is the vendor-signed push certificate request.
+// It is uploaded to the Apple Push Certificates Portal as a
+// base64-encoded plist.
+type PushCertRequest struct {
+	// PushCertRequestCSR is the base64-encoded DER customer CSR.
+	PushCertRequestCSR string
+	// PushCertCertificateChain is the PEM-encoded vendor certificate
+	// chain (the vendor certificate, then its issuer(s)).
+	PushCertCertificateChain string
+	// PushCertSignature is the base64-encoded SHA-256 RSA signature
+	// of the DER customer CSR by the vendor private key.
+	PushCertSignature string
+}
+
+// VendorSigner signs push certificate CSRs with an MDM vendor certificate.
+type VendorSigner struct {
+	chain []*x509.Certificate
+	key   *rsa.PrivateKey
+}
+
+// NewVendorSigner creates a new vendor signer from the PEM-encoded
+// MDM vendor certificate chain and private key.
+// The first certificate in chainPEM must be the MDM vendor certificate
+// and must match the private key. Any following certificates should be
+// the Apple intermediate and root certificates which are included in
+// the push certificate request.
+func NewVendorSigner(chainPEM, keyPEM []byte) (*VendorSigner, error) {
+	s := new(VendorSigner)
+	for {
+		var block *pem.Block
+		block, chainPEM = pem.Decode(chainPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing vendor certificate: %w", err)
+		}
+		s.chain = append(s.chain, cert)
+	}
+	if len(s.chain) < 1 {
+		return nil, errors.New("no vendor certificate found")
+	}
+	key, err := parseRSAPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing vendor private key: %w", err)
+	}
+	if pub, ok := s.chain[0].PublicKey.(*rsa.PublicKey); !ok || !key.PublicKey.Equal(pub) {
+		return nil, errors.New("vendor certificate and private key do not match")
+	}
+	s.key = key
+	return s, nil
+}
+
+// Certificate returns the MDM vendor certificate.
+func (s *VendorSigner) Certificate() *x509.Certificate {
+	return s.chain[0]
+}
+
+// chainPEM returns the PEM-encoded vendor certificate chain.
+func (s *VendorSigner) chainPEM() string {
+	var chain []byte
+	for _, cert := range s.chain {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return string(chain)
+}
+
+// Sign signs the DER-encoded customer CSR and returns the push certificate request.
+func (s *VendorSigner) Sign(csr []byte) (*PushCertRequest, error) {
+	if len(csr) < 1 {
+		return nil, errors.New("empty CSR")
+	}
+	hashed := sha256.Sum256(csr)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("signing CSR: %w", err)
+	}
+	return &PushCertRequest{
+		PushCertRequestCSR:       base64.StdEncoding.EncodeToString(csr),
+		PushCertCertificateChain: s.chainPEM(),
+		PushCertSignature:        base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// Encode encodes req in the format expected by the Apple Push
+// Certificates Portal: a base64-encoded XML plist.
+func (req *PushCertRequest) Encode() ([]byte, error) {
+	b, err := plist.MarshalIndent(req, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("marshal push cert request: %w", err)
+	}
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+	base64.StdEncoding.Encode(out, b)
+	return out, nil
+}
+
+// parseRSAPrivateKey parses a PEM-encoded PKCS#1 or PKCS#8 RSA private key.
+func parseRSAPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if x509.IsEncryptedPEMBlock(block) {
+		return nil, errors.New("private key PEM appears to be encrypted")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return rsaKey, nil
+}
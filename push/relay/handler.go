@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push"
+)
+
+// writeResponse encodes resp as JSON to w with status.
+// The response is signed with key and the request timestamp ts.
+func writeResponse(w http.ResponseWriter, key []byte, ts string, resp *Response, status int, logger log.Logger) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		logger.Info("msg", "encoding json", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set(HMACHeader, signature(key, ts, body))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// verifyRequest checks the timestamp and HMAC signature of a request
+// with body using key at now.
+func verifyRequest(r *http.Request, key, body []byte, now time.Time) error {
+	ts := r.Header.Get(TimestampHeader)
+	if !validSignature(key, ts, r.Header.Get(HMACHeader), body) {
+		return errors.New("invalid HMAC")
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return errors.New("timestamp outside of allowed clock skew")
+	}
+	return nil
+}
+
+// NewHandler creates a push relay HTTP handler.
+// Pushes forwarded by [Provider] are sent with prov.
+// Requests must include a SHA-256 HMAC of the timestamp and HTTP body
+// using key in the [HMACHeader] header. Requests with an invalid HMAC
+// or a timestamp more than [MaxClockSkew] from now are rejected.
+// Responses include an HMAC of the request timestamp and response body.
+func NewHandler(prov push.PushProvider, key []byte, logger log.Logger) http.Handler {
+	if prov == nil {
+		panic("nil provider")
+	}
+	if len(key) < 1 {
+		panic("empty HMAC key")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Info("msg", "reading push relay request", "err", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if err = verifyRequest(r, key, body, time.Now()); err != nil {
+			logger.Info("msg", "verifying push relay request", "err", err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		ts := r.Header.Get(TimestampHeader)
+
+		relayReq := new(Request)
+		if err = json.Unmarshal(body, relayReq); err != nil {
+			logger.Info("msg", "decoding push relay request", "err", err)
+			writeResponse(w, key, ts, &Response{Error: err.Error()}, http.StatusBadRequest, logger)
+			return
+		}
+
+		pushInfos := make([]*mdm.Push, 0, len(relayReq.Pushes))
+		for _, pushInfo := range relayReq.Pushes {
+			p := &mdm.Push{PushMagic: pushInfo.PushMagic, Topic: pushInfo.Topic}
+			if err := p.SetTokenString(pushInfo.Token); err != nil {
+				logger.Info("msg", "decoding push token", "topic", pushInfo.Topic, "err", err)
+				writeResponse(w, key, ts, &Response{Error: "decoding push token: " + err.Error()}, http.StatusBadRequest, logger)
+				return
+			}
+			pushInfos = append(pushInfos, p)
+		}
+
+		resp := &Response{Responses: make(map[string]*PushResponse)}
+		status := http.StatusOK
+
+		responses, err := prov.Push(r.Context(), pushInfos)
+		if err != nil {
+			logger.Info("msg", "relaying pushes", "err", err)
+			resp.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+
+		for token, pushResp := range responses {
+			if pushResp == nil {
+				continue
+			}
+			resp.Responses[token] = &PushResponse{ID: pushResp.Id}
+			if pushResp.Err != nil {
+				resp.Responses[token].Error = pushResp.Err.Error()
+			}
+		}
+
+		logger.Debug("msg", "relayed pushes", "count", len(pushInfos))
+
+		writeResponse(w, key, ts, resp, status, logger)
+	})
+}
@@ -0,0 +1,211 @@
+// Package relay forwards MDM APNs push notifications to a central push relay.
+//
+// The push relay holds the APNs push certificates and private keys and
+// sends the actual pushes to APNs. NanoMDM instances without push
+// certificates forward "raw" pushes (token, push magic, and topic) to
+// the relay using [Provider]. The relay is served by [NewHandler].
+// Requests are authenticated with a SHA-256 HMAC of the Unix time in
+// the [TimestampHeader] header and the HTTP body in the [HMACHeader]
+// header. Responses carry an HMAC of the request timestamp and the
+// response body in the same header.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push"
+)
+
+const (
+	// HMACHeader is the HTTP header name used when including HMAC signatures.
+	HMACHeader = "X-Hmac-Signature"
+
+	// TimestampHeader is the HTTP header name of the Unix time a
+	// request was signed at.
+	TimestampHeader = "X-Hmac-Timestamp"
+
+	// MaxClockSkew is how far the timestamp of a request may be from
+	// the time of the relay. Older requests are rejected as replays.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// ErrInvalidHMAC is returned when a push relay response has an invalid HMAC.
+var ErrInvalidHMAC = errors.New("invalid push relay HMAC")
+
+// Doer is ostensibly an *http.Client
+type Doer interface {
+	// Do sends an HTTP request and returns an HTTP response.
+	Do(*http.Request) (*http.Response, error)
+}
+
+// PushInfo is a "raw" MDM push forwarded to the relay.
+type PushInfo struct {
+	Token     string `json:"token"`
+	PushMagic string `json:"push_magic"`
+	Topic     string `json:"topic"`
+}
+
+// Request is the push relay HTTP request body.
+type Request struct {
+	Pushes []PushInfo `json:"pushes"`
+}
+
+// PushResponse is the push relay response for a single push.
+type PushResponse struct {
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Response is the push relay HTTP response body.
+// Responses are keyed by push token.
+type Response struct {
+	Responses map[string]*PushResponse `json:"responses,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+// signature returns the Base-64 encoded SHA-256 HMAC of ts and body using key.
+func signature(key []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature reports whether sig is the signature of ts and body using key.
+func validSignature(key []byte, ts, sig string, body []byte) bool {
+	return hmac.Equal([]byte(sig), []byte(signature(key, ts, body)))
+}
+
+// Provider forwards pushes to a push relay.
+type Provider struct {
+	url  string
+	doer Doer
+	key  []byte
+}
+
+type Option func(*Provider)
+
+// WithClient configures an HTTP client to use when sending HTTP requests.
+// This option should be specified before other options that modify the client.
+func WithClient(client Doer) Option {
+	return func(p *Provider) {
+		p.doer = client
+	}
+}
+
+// WithHMACSecret will add a SHA-256 HMAC of the current time and the
+// push relay request body using key. The HMAC is provided in the
+// [HMACHeader] header and is Base-64 encoded. The time is provided in
+// the [TimestampHeader] header. The HMAC of responses is verified
+// using key and responses with an invalid HMAC are rejected.
+func WithHMACSecret(key []byte) Option {
+	return func(p *Provider) {
+		p.key = key
+	}
+}
+
+// New creates a new push relay provider that sends pushes to url.
+func New(url string, opts ...Option) *Provider {
+	p := &Provider{
+		url:  url,
+		doer: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Push forwards pushInfos to the push relay.
+func (p *Provider) Push(ctx context.Context, pushInfos []*mdm.Push) (map[string]*push.Response, error) {
+	if p.url == "" {
+		return nil, errors.New("empty push relay URL")
+	}
+	relayReq := &Request{Pushes: make([]PushInfo, 0, len(pushInfos))}
+	for _, pushInfo := range pushInfos {
+		if pushInfo == nil {
+			continue
+		}
+		relayReq.Pushes = append(relayReq.Pushes, PushInfo{
+			Token:     pushInfo.Token.String(),
+			PushMagic: pushInfo.PushMagic,
+			Topic:     pushInfo.Topic,
+		})
+	}
+	body, err := json.Marshal(relayReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal push relay request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	if p.key != nil {
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(HMACHeader, signature(p.key, ts, body))
+	}
+	resp, err := p.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading push relay response: %w", err)
+	}
+	if p.key != nil && !validSignature(p.key, ts, resp.Header.Get(HMACHeader), b) {
+		return nil, fmt.Errorf("push relay HTTP status: %d: %w", resp.StatusCode, ErrInvalidHMAC)
+	}
+	relayResp := new(Response)
+	if err = json.Unmarshal(b, relayResp); err != nil {
+		return nil, fmt.Errorf("push relay HTTP status: %d: decoding response: %w", resp.StatusCode, err)
+	}
+	responses := make(map[string]*push.Response, len(relayResp.Responses))
+	for token, pushResp := range relayResp.Responses {
+		if pushResp == nil {
+			continue
+		}
+		responses[token] = &push.Response{Id: pushResp.ID}
+		if pushResp.Error != "" {
+			responses[token].Err = errors.New(pushResp.Error)
+		}
+	}
+	if relayResp.Error != "" {
+		err = fmt.Errorf("push relay: %s", relayResp.Error)
+	} else if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("push relay HTTP status: %d", resp.StatusCode)
+	}
+	return responses, err
+}
+
+// Factory creates push relay providers.
+// Push certificates are not needed and are ignored.
+type Factory struct {
+	provider *Provider
+}
+
+// NewFactory creates a new push relay provider factory.
+// See [New] for the parameters.
+func NewFactory(url string, opts ...Option) *Factory {
+	return &Factory{provider: New(url, opts...)}
+}
+
+// NewPushProvider returns the push relay provider. The certificate is ignored.
+func (f *Factory) NewPushProvider(_ *tls.Certificate) (push.PushProvider, error) {
+	return f.provider, nil
+}
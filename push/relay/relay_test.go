@@ -0,0 +1,137 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/push"
+)
+
+const (
+	tokenOK   = "c2732227a1d8021cfaf781d71fb2f908c61f5861079a00954a5453f1d0281433"
+	tokenGone = "7f1839ca30d5c6d36d6ae426258c4306c14eca90afd709a07375a85ad5a11c69"
+)
+
+type mockProvider struct {
+	pushes []*mdm.Push
+}
+
+func (p *mockProvider) Push(_ context.Context, pushInfos []*mdm.Push) (map[string]*push.Response, error) {
+	p.pushes = append(p.pushes, pushInfos...)
+	return map[string]*push.Response{
+		tokenOK:   {Id: "922D9F1F-B82E-B337-EDC9-DB4FC8527676"},
+		tokenGone: {Err: errors.New("APNs push error: Unregistered")},
+	}, nil
+}
+
+func newPush(t *testing.T, token string) *mdm.Push {
+	p := &mdm.Push{PushMagic: "47250C9C-1B37-4381-98A9-0B8315A441C7", Topic: "com.apple.mgmt.External.example"}
+	if err := p.SetTokenString(token); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRelay(t *testing.T) {
+	key := []byte("secret")
+	mock := new(mockProvider)
+	srv := httptest.NewServer(NewHandler(mock, key, log.NopLogger))
+	defer srv.Close()
+
+	prov, err := NewFactory(srv.URL, WithHMACSecret(key)).NewPushProvider(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resps, err := prov.Push(context.Background(), []*mdm.Push{newPush(t, tokenOK), newPush(t, tokenGone)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := len(mock.pushes), 2; have != want {
+		t.Fatalf("relayed pushes: have %d, want %d", have, want)
+	}
+	if have, want := mock.pushes[0].Token.String(), tokenOK; have != want {
+		t.Errorf("token: have %q, want %q", have, want)
+	}
+
+	if resp := resps[tokenOK]; resp == nil || resp.Err != nil || resp.Id == "" {
+		t.Errorf("expected successful response: %v", resp)
+	}
+	if resp := resps[tokenGone]; resp == nil || resp.Err == nil {
+		t.Errorf("expected error response: %v", resp)
+	}
+
+	// a different HMAC key should be rejected
+	prov = New(srv.URL, WithHMACSecret([]byte("wrong")))
+	if _, err = prov.Push(context.Background(), []*mdm.Push{newPush(t, tokenOK)}); err == nil {
+		t.Error("expected error with invalid HMAC")
+	}
+}
+
+func TestRelayStaleRequest(t *testing.T) {
+	key := []byte("secret")
+	mock := new(mockProvider)
+	srv := httptest.NewServer(NewHandler(mock, key, log.NopLogger))
+	defer srv.Close()
+
+	body := []byte(`{"pushes":[{"token":"` + tokenOK + `","push_magic":"x","topic":"y"}]}`)
+	for _, tc := range []struct {
+		name   string
+		ts     time.Time
+		status int
+	}{
+		{"current", time.Now(), http.StatusOK},
+		{"stale", time.Now().Add(-2 * MaxClockSkew), http.StatusUnauthorized},
+		{"future", time.Now().Add(2 * MaxClockSkew), http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := strconv.FormatInt(tc.ts.Unix(), 10)
+			req, err := http.NewRequest("POST", srv.URL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(TimestampHeader, ts)
+			req.Header.Set(HMACHeader, signature(key, ts, body))
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if have, want := resp.StatusCode, tc.status; have != want {
+				t.Errorf("status: have %d, want %d", have, want)
+			}
+		})
+	}
+	if have, want := len(mock.pushes), 1; have != want {
+		t.Errorf("relayed pushes: have %d, want %d", have, want)
+	}
+}
+
+func TestRelayInvalidResponseHMAC(t *testing.T) {
+	// a relay with a different key signs responses with that key
+	srv := httptest.NewServer(NewHandler(new(mockProvider), []byte("other"), log.NopLogger))
+	defer srv.Close()
+	prov := New(srv.URL, WithHMACSecret([]byte("secret")))
+	if _, err := prov.Push(context.Background(), []*mdm.Push{newPush(t, tokenOK)}); !errors.Is(err, ErrInvalidHMAC) {
+		t.Errorf("expected invalid HMAC error, have: %v", err)
+	}
+
+	// unsigned responses are rejected
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"responses":{"` + tokenOK + `":{"id":"x"}}}`))
+	}))
+	defer srv2.Close()
+	prov = New(srv2.URL, WithHMACSecret([]byte("secret")))
+	if _, err := prov.Push(context.Background(), []*mdm.Push{newPush(t, tokenOK)}); !errors.Is(err, ErrInvalidHMAC) {
+		t.Errorf("expected invalid HMAC error, have: %v", err)
+	}
+}
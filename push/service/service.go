@@ -33,6 +33,10 @@ type PushService struct {
 }
 
 // NewPushService creates a new PushService.
+// If certStore is nil then push certificates are not retrieved and
+// providerFactory is called with a nil certificate (once per topic).
+// This supports push providers that do not need a push certificate
+// such as those that forward pushes elsewhere.
 func New(store storage.PushStore, certStore storage.PushCertStore, providerFactory push.PushProviderFactory, logger log.Logger) *PushService {
 	return &PushService{
 		logger:          logger,
@@ -53,6 +57,9 @@ func (s *PushService) getProvider(ctx context.Context, topic string) (push.PushP
 	s.providersMu.RLock()
 	prov, _ := s.providers[topic]
 	s.providersMu.RUnlock()
+	if s.certStore == nil {
+		return s.getCertlessProvider(topic, prov)
+	}
 	if prov != nil && prov.provider != nil {
 		stale, err = s.certStore.IsPushCertStale(ctx, topic, prov.staleToken)
 		if err != nil {
@@ -66,10 +73,14 @@ func (s *PushService) getProvider(ctx context.Context, topic string) (push.PushP
 	if err != nil {
 		return nil, fmt.Errorf("retrieving push cert for topic %q: %w", topic, err)
 	}
-	ctxlog.Logger(ctx, s.logger).Info(
+	logs := []interface{}{
 		"msg", "retrieved push cert",
 		"topic", topic,
-	)
+	}
+	if env, err := push.EnvironmentFromTLSCert(cert); err == nil {
+		logs = append(logs, "environment", env)
+	}
+	ctxlog.Logger(ctx, s.logger).Info(logs...)
 	newProvider, err := s.providerFactory.NewPushProvider(cert)
 	if err != nil {
 		return nil, fmt.Errorf("creating new push provider: %w", err)
@@ -84,6 +95,22 @@ func (s *PushService) getProvider(ctx context.Context, topic string) (push.PushP
 	return prov.provider, nil
 }
 
+// getCertlessProvider returns prov or creates a new PushProvider
+// without a push certificate.
+func (s *PushService) getCertlessProvider(topic string, prov *provider) (push.PushProvider, error) {
+	if prov != nil && prov.provider != nil {
+		return prov.provider, nil
+	}
+	newProvider, err := s.providerFactory.NewPushProvider(nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating new push provider: %w", err)
+	}
+	s.providersMu.Lock()
+	s.providers[topic] = &provider{provider: newProvider}
+	s.providersMu.Unlock()
+	return newProvider, nil
+}
+
 type pushFeedback struct {
 	Responses map[string]*push.Response
 	Err       error
@@ -205,3 +232,20 @@ func (s *PushService) Push(ctx context.Context, ids []string) (map[string]*push.
 
 	return idToResponse, err
 }
+
+// Provider returns a PushProvider that sends "raw" pushes using the
+// push provider (and push certificate) for the topic of each push.
+func (s *PushService) Provider() push.PushProvider {
+	return (*rawProvider)(s)
+}
+
+type rawProvider PushService
+
+// Push sends pushes to the push providers for each push topic.
+func (p *rawProvider) Push(ctx context.Context, pushInfos []*mdm.Push) (map[string]*push.Response, error) {
+	s := (*PushService)(p)
+	if len(pushInfos) == 1 {
+		return s.pushSingle(ctx, pushInfos[0])
+	}
+	return s.pushMulti(ctx, pushInfos)
+}
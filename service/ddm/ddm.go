@@ -0,0 +1,272 @@
+// Package ddm provides a built-in NanoMDM Declarative Management service.
+//
+// Declarations are stored in a [storage.DeclarationStore], grouped into
+// named sets, and the sets are assigned to enrollments. The service
+// answers the Declarative Management "tokens", "declaration-items", and
+// "declaration" endpoints of enrolled devices from that storage.
+//
+// Separately a [StatusRecorder] merges the "status" endpoint reports of
+// enrolled devices into a per-enrollment [Status] kept in a
+// [storage.DeclarationStatusStore].
+package ddm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// Declaration categories.
+// The category of a declaration is derived from its type.
+const (
+	CategoryActivation    = "activation"
+	CategoryAsset         = "asset"
+	CategoryConfiguration = "configuration"
+	CategoryManagement    = "management"
+)
+
+// Category returns the category of the declaration type typ.
+// For example "com.apple.configuration.passcode.settings" returns
+// [CategoryConfiguration]. An empty string is returned if typ is not a
+// known declaration type.
+func Category(typ string) string {
+	parts := strings.SplitN(typ, ".", 4)
+	if len(parts) < 4 || parts[0] != "com" || parts[1] != "apple" || parts[3] == "" {
+		return ""
+	}
+	switch parts[2] {
+	case CategoryActivation, CategoryAsset, CategoryConfiguration, CategoryManagement:
+		return parts[2]
+	}
+	return ""
+}
+
+// declaration is the JSON representation of a declaration.
+type declaration struct {
+	Type        string
+	Identifier  string
+	ServerToken string `json:",omitempty"`
+	Payload     json.RawMessage
+}
+
+// ParseDeclaration parses and validates the JSON declaration b.
+// Any ServerToken in b is ignored: the returned declaration's Raw JSON
+// excludes the ServerToken and its ServerToken is computed from Raw.
+// Identical declarations thus always have identical ServerTokens and
+// any change to a declaration changes its ServerToken.
+func ParseDeclaration(b []byte) (*storage.Declaration, error) {
+	var decl declaration
+	if err := json.Unmarshal(b, &decl); err != nil {
+		return nil, fmt.Errorf("unmarshal declaration: %w", err)
+	}
+	if decl.Identifier == "" {
+		return nil, errors.New("empty declaration identifier")
+	}
+	if strings.ContainsAny(decl.Identifier, `/\`) {
+		return nil, errors.New("invalid declaration identifier")
+	}
+	if Category(decl.Type) == "" {
+		return nil, fmt.Errorf("invalid declaration type: %q", decl.Type)
+	}
+	decl.ServerToken = ""
+
+	// canonicalize the payload
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, decl.Payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if buf.Len() < 1 || buf.Bytes()[0] != '{' {
+		return nil, errors.New("payload is not an object")
+	}
+	decl.Payload = buf.Bytes()
+
+	raw, err := json.Marshal(&decl)
+	if err != nil {
+		return nil, fmt.Errorf("marshal declaration: %w", err)
+	}
+	return &storage.Declaration{
+		Identifier:  decl.Identifier,
+		Type:        decl.Type,
+		ServerToken: ServerToken(raw),
+		Raw:         raw,
+	}, nil
+}
+
+// ServerToken returns the ServerToken of the JSON declaration raw
+// (without a ServerToken). It is the hex SHA-256 hash of raw.
+func ServerToken(raw []byte) string {
+	h := sha256.Sum256(raw)
+	return hex.EncodeToString(h[:])
+}
+
+// DeclarationJSON returns the JSON of d including its ServerToken.
+// This is the declaration as sent to devices.
+func DeclarationJSON(d *storage.Declaration) ([]byte, error) {
+	if d == nil {
+		return nil, errors.New("nil declaration")
+	}
+	var decl declaration
+	if err := json.Unmarshal(d.Raw, &decl); err != nil {
+		return nil, fmt.Errorf("unmarshal declaration: %w", err)
+	}
+	decl.ServerToken = d.ServerToken
+	return json.Marshal(&decl)
+}
+
+// EnrollmentDeclarations retrieves the declarations of all sets
+// assigned to enrollment id sorted by identifier. Declarations in
+// multiple sets are only returned once and declarations that do not
+// exist are skipped.
+func EnrollmentDeclarations(ctx context.Context, store storage.DeclarationStore, id string) ([]*storage.Declaration, error) {
+	sets, err := store.RetrieveEnrollmentDeclarationSets(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving enrollment sets: %w", err)
+	}
+	seen := make(map[string]struct{})
+	var decls []*storage.Declaration
+	for _, set := range sets {
+		identifiers, err := store.RetrieveDeclarationSet(ctx, set)
+		if err != nil {
+			return nil, fmt.Errorf("retrieving set %s: %w", set, err)
+		}
+		for _, identifier := range identifiers {
+			if _, ok := seen[identifier]; ok {
+				continue
+			}
+			seen[identifier] = struct{}{}
+			d, err := store.RetrieveDeclaration(ctx, identifier)
+			if err != nil {
+				return nil, fmt.Errorf("retrieving declaration %s: %w", identifier, err)
+			} else if d != nil {
+				decls = append(decls, d)
+			}
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Identifier < decls[j].Identifier })
+	return decls, nil
+}
+
+// DeclarationsToken returns the token of the set of declarations decls.
+// It is the hex SHA-256 hash of the sorted identifiers and ServerTokens
+// of decls and so changes whenever a declaration is added, removed, or
+// changed.
+func DeclarationsToken(decls []*storage.Declaration) string {
+	pairs := make([]string, 0, len(decls))
+	for _, d := range decls {
+		pairs = append(pairs, d.Identifier+"\x00"+d.ServerToken+"\n")
+	}
+	sort.Strings(pairs)
+	h := sha256.New()
+	for _, pair := range pairs {
+		h.Write([]byte(pair))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SyncTokens is the SyncTokens object of the "tokens" endpoint.
+// See https://developer.apple.com/documentation/devicemanagement/synchronizationtokens
+type SyncTokens struct {
+	DeclarationsToken string
+	Timestamp         time.Time
+}
+
+// TokensResponse is the response of the "tokens" endpoint.
+// See https://developer.apple.com/documentation/devicemanagement/tokensresponse
+type TokensResponse struct {
+	SyncTokens SyncTokens
+}
+
+// Tokens returns the tokens response of decls.
+// The timestamp is the latest update time of decls.
+func Tokens(decls []*storage.Declaration) *TokensResponse {
+	var ts time.Time
+	for _, d := range decls {
+		if d.UpdatedAt.After(ts) {
+			ts = d.UpdatedAt
+		}
+	}
+	if ts.IsZero() {
+		ts = time.Unix(0, 0)
+	}
+	return &TokensResponse{SyncTokens: SyncTokens{
+		DeclarationsToken: DeclarationsToken(decls),
+		Timestamp:         ts.UTC().Truncate(time.Second),
+	}}
+}
+
+// ManifestDeclaration is an item of the "declaration-items" endpoint.
+// See https://developer.apple.com/documentation/devicemanagement/manifestdeclaration
+type ManifestDeclaration struct {
+	Identifier  string
+	ServerToken string
+}
+
+// ManifestDeclarationItems are the declarations of the
+// "declaration-items" endpoint by category.
+type ManifestDeclarationItems struct {
+	Activations    []ManifestDeclaration
+	Assets         []ManifestDeclaration
+	Configurations []ManifestDeclaration
+	Management     []ManifestDeclaration
+}
+
+// DeclarationItemsResponse is the response of the "declaration-items" endpoint.
+// See https://developer.apple.com/documentation/devicemanagement/declarationitemsresponse
+type DeclarationItemsResponse struct {
+	Declarations      ManifestDeclarationItems
+	DeclarationsToken string
+}
+
+// DeclarationItems returns the declaration items response of decls.
+func DeclarationItems(decls []*storage.Declaration) *DeclarationItemsResponse {
+	resp := &DeclarationItemsResponse{
+		Declarations: ManifestDeclarationItems{
+			// devices expect empty arrays rather than nulls
+			Activations:    []ManifestDeclaration{},
+			Assets:         []ManifestDeclaration{},
+			Configurations: []ManifestDeclaration{},
+			Management:     []ManifestDeclaration{},
+		},
+		DeclarationsToken: DeclarationsToken(decls),
+	}
+	for _, d := range decls {
+		item := ManifestDeclaration{Identifier: d.Identifier, ServerToken: d.ServerToken}
+		switch Category(d.Type) {
+		case CategoryActivation:
+			resp.Declarations.Activations = append(resp.Declarations.Activations, item)
+		case CategoryAsset:
+			resp.Declarations.Assets = append(resp.Declarations.Assets, item)
+		case CategoryConfiguration:
+			resp.Declarations.Configurations = append(resp.Declarations.Configurations, item)
+		case CategoryManagement:
+			resp.Declarations.Management = append(resp.Declarations.Management, item)
+		}
+	}
+	return resp
+}
+
+// SyncCommand returns a new DeclarativeManagement command that tells
+// enrollment id to synchronize its declarations. The command includes
+// the current tokens of the enrollment.
+func SyncCommand(ctx context.Context, store storage.DeclarationStore, id string) (*mdm.Command, error) {
+	decls, err := EnrollmentDeclarations(ctx, store, id)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := json.Marshal(Tokens(decls))
+	if err != nil {
+		return nil, fmt.Errorf("marshal tokens: %w", err)
+	}
+	return commands.New(&commands.DeclarativeManagement{Data: tokens})
+}
@@ -0,0 +1,149 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/service"
+	"github.com/micromdm/nanomdm/storage/inmem"
+)
+
+const testDecl = `{
+	"Type": "com.apple.configuration.management.test",
+	"Identifier": "com.example.test",
+	"ServerToken": "ignored",
+	"Payload": {"Echo": "Foo"}
+}`
+
+func TestParseDeclaration(t *testing.T) {
+	d, err := ParseDeclaration([]byte(testDecl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(d.Raw), `{"Type":"com.apple.configuration.management.test","Identifier":"com.example.test","Payload":{"Echo":"Foo"}}`; have != want {
+		t.Errorf("raw: have: %v, want: %v", have, want)
+	}
+	if have, want := d.ServerToken, ServerToken(d.Raw); have != want {
+		t.Errorf("server token: have: %v, want: %v", have, want)
+	}
+
+	// a changed payload changes the server token
+	d2, err := ParseDeclaration([]byte(`{"Type":"com.apple.configuration.management.test","Identifier":"com.example.test","Payload":{"Echo":"Bar"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2.ServerToken == d.ServerToken {
+		t.Error("server token unchanged after changing payload")
+	}
+
+	for _, invalid := range []string{
+		`{"Type":"com.apple.configuration.management.test","Payload":{}}`,
+		`{"Type":"com.example.test","Identifier":"a","Payload":{}}`,
+		`{"Type":"com.apple.configuration.management.test","Identifier":"a","Payload":[]}`,
+		`{"Type":"com.apple.configuration.management.test","Identifier":"a/b","Payload":{}}`,
+	} {
+		if _, err = ParseDeclaration([]byte(invalid)); err == nil {
+			t.Errorf("expected error parsing: %s", invalid)
+		}
+	}
+}
+
+func TestDeclarativeManagement(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	d, err := ParseDeclaration([]byte(testDecl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.StoreDeclaration(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.StoreDeclarationSet(ctx, "set1", []string{d.Identifier}); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := New(store)
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111"}
+
+	dm := func(endpoint string) ([]byte, error) {
+		return svc.DeclarativeManagement(r, &mdm.DeclarativeManagement{Endpoint: endpoint})
+	}
+
+	// not yet assigned
+	respBytes, err := dm("declaration-items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := new(DeclarationItemsResponse)
+	if err = json.Unmarshal(respBytes, items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items.Declarations.Configurations) != 0 {
+		t.Error("expected no declarations before assignment")
+	}
+	emptyToken := items.DeclarationsToken
+
+	if err = store.StoreEnrollmentDeclarationSets(ctx, r.ID, []string{"set1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	respBytes, err = dm("tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := new(TokensResponse)
+	if err = json.Unmarshal(respBytes, tokens); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.SyncTokens.DeclarationsToken == emptyToken {
+		t.Error("declarations token unchanged after assignment")
+	}
+
+	respBytes, err = dm("declaration-items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items = new(DeclarationItemsResponse)
+	if err = json.Unmarshal(respBytes, items); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := items.DeclarationsToken, tokens.SyncTokens.DeclarationsToken; have != want {
+		t.Errorf("declarations token: have: %v, want: %v", have, want)
+	}
+	if have, want := len(items.Declarations.Configurations), 1; have != want {
+		t.Fatalf("configuration declarations: have: %v, want: %v", have, want)
+	}
+	if have, want := items.Declarations.Configurations[0], (ManifestDeclaration{Identifier: d.Identifier, ServerToken: d.ServerToken}); have != want {
+		t.Errorf("configuration declaration: have: %v, want: %v", have, want)
+	}
+
+	respBytes, err = dm("declaration/configuration/com.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl := new(declaration)
+	if err = json.Unmarshal(respBytes, decl); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := decl.ServerToken, d.ServerToken; have != want {
+		t.Errorf("server token: have: %v, want: %v", have, want)
+	}
+
+	for _, endpoint := range []string{
+		"declaration/management/com.example.test",
+		"declaration/configuration/com.example.missing",
+		"invalid",
+	} {
+		_, err = dm(endpoint)
+		var statusErr *service.HTTPStatusError
+		if !errors.As(err, &statusErr) || statusErr.Status != http.StatusNotFound {
+			t.Errorf("endpoint %s: expected not found error, have: %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/service"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// DDM is a NanoMDM Declarative Management service that serves
+// declarations from storage.
+type DDM struct {
+	store storage.DeclarationStore
+}
+
+// New creates a new built-in Declarative Management service.
+func New(store storage.DeclarationStore) *DDM {
+	return &DDM{store: store}
+}
+
+// errNotFound returns an HTTP 404 error for err.
+func errNotFound(err error) error {
+	return service.NewHTTPStatusError(http.StatusNotFound, err)
+}
+
+// DeclarativeManagement implements the Declarative Management protocol endpoints.
+func (d *DDM) DeclarativeManagement(r *mdm.Request, message *mdm.DeclarativeManagement) ([]byte, error) {
+	if d.store == nil {
+		return nil, errors.New("nil store")
+	}
+	if r.ID == "" {
+		return nil, errors.New("empty enrollment id")
+	}
+
+	switch {
+	case message.Endpoint == "tokens":
+		decls, err := EnrollmentDeclarations(r.Context(), d.store, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(Tokens(decls))
+	case message.Endpoint == "declaration-items":
+		decls, err := EnrollmentDeclarations(r.Context(), d.store, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(DeclarationItems(decls))
+	case message.Endpoint == "status":
+		return nil, nil
+	case strings.HasPrefix(message.Endpoint, "declaration/"):
+		return d.declaration(r, strings.TrimPrefix(message.Endpoint, "declaration/"))
+	}
+	return nil, errNotFound(fmt.Errorf("unknown endpoint: %s", message.Endpoint))
+}
+
+// declaration returns the declaration JSON of path. Path is the
+// declaration category and identifier separated by a slash.
+// Only declarations assigned to the enrollment are returned.
+func (d *DDM) declaration(r *mdm.Request, path string) ([]byte, error) {
+	category, identifier, ok := strings.Cut(path, "/")
+	if !ok || identifier == "" {
+		return nil, errNotFound(fmt.Errorf("invalid declaration endpoint: %s", path))
+	}
+	if unescaped, err := url.PathUnescape(identifier); err == nil {
+		identifier = unescaped
+	}
+	decls, err := EnrollmentDeclarations(r.Context(), d.store, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range decls {
+		if decl.Identifier == identifier && Category(decl.Type) == category {
+			return DeclarationJSON(decl)
+		}
+	}
+	return nil, errNotFound(fmt.Errorf("declaration not found: %s/%s", category, identifier))
+}
+
+// StatusRecorder is a Declarative Management service that records the
+// "status" endpoint reports of enrollments in storage before passing
+// every request on to the next Declarative Management service.
+type StatusRecorder struct {
+	next  service.DeclarativeManagement
+	store storage.DeclarationStatusStore
+	nowFn func() time.Time
+}
+
+// NewStatusRecorder creates a new status recorder in front of next.
+func NewStatusRecorder(next service.DeclarativeManagement, store storage.DeclarationStatusStore) *StatusRecorder {
+	if next == nil {
+		panic("nil declarative management service")
+	}
+	return &StatusRecorder{next: next, store: store, nowFn: time.Now}
+}
+
+// DeclarativeManagement records status reports and calls the next service.
+func (s *StatusRecorder) DeclarativeManagement(r *mdm.Request, message *mdm.DeclarativeManagement) ([]byte, error) {
+	if message.Endpoint == "status" {
+		if err := s.record(r, message.Data); err != nil {
+			return nil, fmt.Errorf("recording status: %w", err)
+		}
+	}
+	return s.next.DeclarativeManagement(r, message)
+}
+
+// record merges the status report data into the stored status of the enrollment.
+func (s *StatusRecorder) record(r *mdm.Request, data []byte) error {
+	if s.store == nil {
+		return errors.New("nil store")
+	}
+	if r.ID == "" {
+		return errors.New("empty enrollment id")
+	}
+	report, err := ParseStatusReport(data)
+	if err != nil {
+		return service.NewHTTPStatusError(http.StatusBadRequest, err)
+	}
+	prev, err := RetrieveStatus(r.Context(), s.store, r.ID)
+	if err != nil {
+		return err
+	}
+	status, err := MergeStatus(prev, report, s.nowFn().UTC())
+	if err != nil {
+		return err
+	}
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return s.store.StoreDeclarationStatus(r.Context(), r.ID, statusBytes)
+}
+
+// RetrieveStatus retrieves the status of enrollment id from store.
+// A nil status is returned if the enrollment has no status.
+func RetrieveStatus(ctx context.Context, store storage.DeclarationStatusStore, id string) (*Status, error) {
+	statusBytes, err := store.RetrieveDeclarationStatus(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving status: %w", err)
+	} else if statusBytes == nil {
+		return nil, nil
+	}
+	status := new(Status)
+	if err = json.Unmarshal(statusBytes, status); err != nil {
+		return nil, fmt.Errorf("unmarshal status: %w", err)
+	}
+	return status, nil
+}
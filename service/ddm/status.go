@@ -0,0 +1,306 @@
+package ddm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Declaration validity values of status reports.
+const (
+	ValidityValid   = "valid"
+	ValidityInvalid = "invalid"
+	ValidityUnknown = "unknown"
+)
+
+// statusItemDeclarations is the status item path of the declarations
+// status in status reports.
+var statusItemDeclarations = []string{"management", "declarations"}
+
+// StatusReason is the reason of a declaration or status item error.
+// See https://developer.apple.com/documentation/devicemanagement/statusreason
+type StatusReason struct {
+	Code        string                 `json:"code"`
+	Description string                 `json:"description,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+}
+
+// StatusError is an error of a status item.
+// See https://developer.apple.com/documentation/devicemanagement/statusreport/errors
+type StatusError struct {
+	StatusItem string         `json:"StatusItem"`
+	Reasons    []StatusReason `json:"Reasons"`
+}
+
+// StatusReport is the "status" endpoint report sent by devices.
+// See https://developer.apple.com/documentation/devicemanagement/statusreport
+type StatusReport struct {
+	StatusItems map[string]interface{} `json:"StatusItems"`
+	Errors      []StatusError          `json:"Errors"`
+	// FullReport is true if the report contains all status items
+	// rather than only the items that changed.
+	FullReport bool `json:"FullReport"`
+}
+
+// reportDeclarationStatus is a declaration of the
+// "management.declarations" status item.
+type reportDeclarationStatus struct {
+	Identifier  string         `json:"identifier"`
+	Active      bool           `json:"active"`
+	Valid       string         `json:"valid"`
+	ServerToken string         `json:"server-token"`
+	Reasons     []StatusReason `json:"reasons,omitempty"`
+}
+
+// DeclarationStatus is the status of a declaration on an enrollment.
+type DeclarationStatus struct {
+	Identifier  string         `json:"identifier"`
+	Category    string         `json:"category"`
+	Active      bool           `json:"active"`
+	Valid       string         `json:"valid"`
+	ServerToken string         `json:"server_token,omitempty"`
+	Reasons     []StatusReason `json:"reasons,omitempty"`
+}
+
+// Failed returns true if the declaration is invalid or has reasons.
+func (s *DeclarationStatus) Failed() bool {
+	return s.Valid == ValidityInvalid || len(s.Reasons) > 0
+}
+
+// Status is the Declarative Management status of an enrollment merged
+// from its status reports.
+type Status struct {
+	// Declarations are the declarations last reported by the
+	// enrollment sorted by category and identifier.
+	Declarations []DeclarationStatus `json:"declarations"`
+
+	// StatusItems are the remaining reported status items (such as
+	// device properties) with incremental reports merged in.
+	StatusItems map[string]interface{} `json:"status_items"`
+
+	// Errors are the current errors of status items.
+	Errors []StatusError `json:"errors,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ParseStatusReport parses the JSON status report b.
+func ParseStatusReport(b []byte) (*StatusReport, error) {
+	report := new(StatusReport)
+	if err := json.Unmarshal(b, report); err != nil {
+		return nil, fmt.Errorf("unmarshal status report: %w", err)
+	}
+	return report, nil
+}
+
+// statusCategories maps the category keys of the declarations status
+// item to declaration categories.
+var statusCategories = map[string]string{
+	"activations":    CategoryActivation,
+	"assets":         CategoryAsset,
+	"configurations": CategoryConfiguration,
+	"management":     CategoryManagement,
+}
+
+// Declarations returns the declarations of the report by category.
+// Only the categories included in the report are returned.
+func (r *StatusReport) Declarations() (map[string][]DeclarationStatus, error) {
+	item, ok := lookup(r.StatusItems, statusItemDeclarations)
+	if !ok {
+		return nil, nil
+	}
+	// round-trip the generic JSON into our structures
+	b, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var byKey map[string][]reportDeclarationStatus
+	if err = json.Unmarshal(b, &byKey); err != nil {
+		return nil, fmt.Errorf("unmarshal declarations status: %w", err)
+	}
+	ret := make(map[string][]DeclarationStatus)
+	for key, decls := range byKey {
+		category, ok := statusCategories[key]
+		if !ok {
+			continue
+		}
+		ret[category] = []DeclarationStatus{}
+		for _, d := range decls {
+			ret[category] = append(ret[category], DeclarationStatus{
+				Identifier:  d.Identifier,
+				Category:    category,
+				Active:      d.Active,
+				Valid:       d.Valid,
+				ServerToken: d.ServerToken,
+				Reasons:     d.Reasons,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// FailedDeclarations returns the declarations of the report that failed.
+func (r *StatusReport) FailedDeclarations() ([]DeclarationStatus, error) {
+	byCategory, err := r.Declarations()
+	if err != nil {
+		return nil, err
+	}
+	var failed []DeclarationStatus
+	for _, decls := range byCategory {
+		for _, d := range decls {
+			if d.Failed() {
+				failed = append(failed, d)
+			}
+		}
+	}
+	sortDeclarationStatuses(failed)
+	return failed, nil
+}
+
+// sortDeclarationStatuses sorts s by category and identifier.
+func sortDeclarationStatuses(s []DeclarationStatus) {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Category != s[j].Category {
+			return s[i].Category < s[j].Category
+		}
+		return s[i].Identifier < s[j].Identifier
+	})
+}
+
+// MergeStatus merges report into the status prev and returns the new
+// status. Prev may be nil. Prev is not modified.
+//
+// Reported status items are merged into the previous status items:
+// objects are merged recursively while other values replace the
+// previous value. Declarations are replaced per reported category.
+// Errors of status items are replaced by errors of the same status
+// item and are cleared when the status item is reported without error.
+// If the report is a full report it replaces prev entirely.
+func MergeStatus(prev *Status, report *StatusReport, now time.Time) (*Status, error) {
+	if report == nil {
+		return nil, errors.New("nil status report")
+	}
+	status := &Status{StatusItems: make(map[string]interface{})}
+	if prev != nil && !report.FullReport {
+		// deep copy via JSON to leave prev untouched
+		b, err := json.Marshal(prev)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, status); err != nil {
+			return nil, err
+		}
+		if status.StatusItems == nil {
+			status.StatusItems = make(map[string]interface{})
+		}
+	}
+
+	byCategory, err := report.Declarations()
+	if err != nil {
+		return nil, err
+	}
+	if len(byCategory) > 0 {
+		var decls []DeclarationStatus
+		for _, d := range status.Declarations {
+			if _, ok := byCategory[d.Category]; !ok {
+				decls = append(decls, d)
+			}
+		}
+		for _, reported := range byCategory {
+			decls = append(decls, reported...)
+		}
+		sortDeclarationStatuses(decls)
+		status.Declarations = decls
+	}
+	if status.Declarations == nil {
+		status.Declarations = []DeclarationStatus{}
+	}
+
+	mergeObjects(status.StatusItems, report.StatusItems)
+	// declarations are kept separately
+	remove(status.StatusItems, statusItemDeclarations)
+
+	// drop errors of reported items and then add the reported errors
+	reported := make(map[string]struct{})
+	for _, key := range paths(report.StatusItems, "") {
+		reported[key] = struct{}{}
+	}
+	for _, e := range report.Errors {
+		reported[e.StatusItem] = struct{}{}
+	}
+	var statusErrors []StatusError
+	for _, e := range status.Errors {
+		if _, ok := reported[e.StatusItem]; !ok {
+			statusErrors = append(statusErrors, e)
+		}
+	}
+	statusErrors = append(statusErrors, report.Errors...)
+	sort.SliceStable(statusErrors, func(i, j int) bool { return statusErrors[i].StatusItem < statusErrors[j].StatusItem })
+	status.Errors = statusErrors
+
+	status.UpdatedAt = now
+	return status, nil
+}
+
+// mergeObjects recursively merges src into dst.
+func mergeObjects(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcObj, srcOK := v.(map[string]interface{})
+		dstObj, dstOK := dst[k].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeObjects(dstObj, srcObj)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// lookup returns the value of the nested keys path in m.
+func lookup(m map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = m
+	for _, key := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// remove deletes the value of the nested keys path in m.
+// Objects left empty are removed as well.
+func remove(m map[string]interface{}, path []string) {
+	if len(path) < 1 {
+		return
+	}
+	if len(path) > 1 {
+		obj, ok := m[path[0]].(map[string]interface{})
+		if !ok {
+			return
+		}
+		remove(obj, path[1:])
+		if len(obj) > 0 {
+			return
+		}
+	}
+	delete(m, path[0])
+}
+
+// paths returns the dotted status item paths of all values in m,
+// including those of nested objects, prefixed by prefix.
+func paths(m map[string]interface{}, prefix string) []string {
+	var ret []string
+	for k, v := range m {
+		path := prefix + k
+		ret = append(ret, path)
+		if obj, ok := v.(map[string]interface{}); ok {
+			ret = append(ret, paths(obj, path+".")...)
+		}
+	}
+	return ret
+}
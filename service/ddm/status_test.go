@@ -0,0 +1,163 @@
+package ddm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/storage/inmem"
+)
+
+const testFullReport = `{
+	"StatusItems": {
+		"device": {
+			"model": {"family": "iPhone", "identifier": "iPhone16,1"},
+			"operating-system": {"version": "17.0"}
+		},
+		"management": {
+			"declarations": {
+				"activations": [
+					{"identifier": "com.example.act", "active": true, "valid": "valid", "server-token": "a1"}
+				],
+				"configurations": [
+					{"identifier": "com.example.cfg", "active": false, "valid": "invalid", "server-token": "c1",
+					 "reasons": [{"code": "Error.ConfigurationCannotBeApplied", "description": "bad"}]}
+				],
+				"assets": [],
+				"management": []
+			}
+		}
+	},
+	"Errors": [
+		{"StatusItem": "device.battery-health", "Reasons": [{"code": "Error.UnsupportedStatusValue"}]}
+	],
+	"FullReport": true
+}`
+
+const testIncrementalReport = `{
+	"StatusItems": {
+		"device": {"operating-system": {"version": "17.1"}},
+		"management": {
+			"declarations": {
+				"configurations": [
+					{"identifier": "com.example.cfg", "active": true, "valid": "valid", "server-token": "c2"}
+				]
+			}
+		}
+	},
+	"Errors": [],
+	"FullReport": false
+}`
+
+func TestMergeStatus(t *testing.T) {
+	full, err := ParseStatusReport([]byte(testFullReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := full.FailedDeclarations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Identifier != "com.example.cfg" || failed[0].Category != CategoryConfiguration {
+		t.Errorf("unexpected failed declarations: %v", failed)
+	}
+
+	now := time.Unix(1700000000, 0).UTC()
+	status, err := MergeStatus(nil, full, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(status.Declarations), 2; have != want {
+		t.Fatalf("declarations: have: %v, want: %v", have, want)
+	}
+	if _, ok := status.StatusItems["management"]; ok {
+		t.Error("declarations status item not removed from status items")
+	}
+	if have, want := len(status.Errors), 1; have != want {
+		t.Errorf("errors: have: %v, want: %v", have, want)
+	}
+
+	incr, err := ParseStatusReport([]byte(testIncrementalReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed, err = incr.FailedDeclarations(); err != nil {
+		t.Fatal(err)
+	} else if len(failed) > 0 {
+		t.Errorf("unexpected failed declarations: %v", failed)
+	}
+
+	merged, err := MergeStatus(status, incr, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the previous status is unchanged
+	if have, want := status.Declarations[1].Valid, ValidityInvalid; have != want {
+		t.Errorf("previous valid: have: %v, want: %v", have, want)
+	}
+
+	// declarations of unreported categories are kept
+	if have, want := len(merged.Declarations), 2; have != want {
+		t.Fatalf("merged declarations: have: %v, want: %v", have, want)
+	}
+	act, cfg := merged.Declarations[0], merged.Declarations[1]
+	if act.Identifier != "com.example.act" || !act.Active {
+		t.Errorf("unexpected activation status: %v", act)
+	}
+	if cfg.Identifier != "com.example.cfg" || !cfg.Active || cfg.Valid != ValidityValid || cfg.ServerToken != "c2" || cfg.Failed() {
+		t.Errorf("unexpected configuration status: %v", cfg)
+	}
+
+	// nested status items are merged
+	v, _ := lookup(merged.StatusItems, []string{"device", "operating-system", "version"})
+	if have, want := v, "17.1"; have != want {
+		t.Errorf("os version: have: %v, want: %v", have, want)
+	}
+	v, _ = lookup(merged.StatusItems, []string{"device", "model", "family"})
+	if have, want := v, "iPhone"; have != want {
+		t.Errorf("model family: have: %v, want: %v", have, want)
+	}
+
+	// errors of unreported status items are kept
+	if have, want := len(merged.Errors), 1; have != want {
+		t.Errorf("merged errors: have: %v, want: %v", have, want)
+	}
+	if have, want := merged.UpdatedAt, now.Add(time.Minute); !have.Equal(want) {
+		t.Errorf("updated at: have: %v, want: %v", have, want)
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	next := New(store)
+	rec := NewStatusRecorder(next, store)
+
+	r := mdm.NewRequestWithContext(ctx, nil)
+	r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111"}
+
+	for _, report := range []string{testFullReport, testIncrementalReport} {
+		if _, err := rec.DeclarativeManagement(r, &mdm.DeclarativeManagement{Endpoint: "status", Data: []byte(report)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := RetrieveStatus(ctx, store, "AAAA-1111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status == nil {
+		t.Fatal("nil status")
+	}
+	if have, want := len(status.Declarations), 2; have != want {
+		t.Errorf("declarations: have: %v, want: %v", have, want)
+	}
+
+	if _, err = rec.DeclarativeManagement(r, &mdm.DeclarativeManagement{Endpoint: "status", Data: []byte("invalid")}); err == nil {
+		t.Error("expected error for invalid status report")
+	}
+}
@@ -1,9 +1,21 @@
 package nanomdm
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/micromdm/nanomdm/digestauth"
 	"github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/service"
 	"github.com/micromdm/nanomdm/storage"
@@ -13,7 +25,7 @@ import (
 )
 
 // UAService is a basic UserAuthenticate service that optionally implements
-// the "zero-length" UserAuthenticate protocol.
+// the "zero-length" or the digest challenge UserAuthenticate protocol.
 // See https://developer.apple.com/documentation/devicemanagement/userauthenticate
 type UAService struct {
 	logger log.Logger
@@ -26,17 +38,67 @@ type UAService struct {
 	// https://developer.apple.com/documentation/devicemanagement/userauthenticate
 	sendEmptyDigestChallenge bool
 	storeRejectedUserAuth    bool
+
+	// digest challenge config, if configured
+	realm        string
+	creds        digestauth.Credentials
+	challengeTTL time.Duration
+	nonceKey     []byte
+	nonceKeyOnce sync.Once
+	nonceKeyErr  error
+	nowFn        func() time.Time
+}
+
+// UAOption configures the UserAuthenticate service.
+type UAOption func(*UAService)
+
+// WithDigestChallenge sends digest challenges in realm to the first
+// UserAuthenticate check-in message and verifies the DigestResponse
+// of the second against creds. Users that fail verification are
+// declined management. This supersedes the zero-length digest challenge.
+func WithDigestChallenge(realm string, creds digestauth.Credentials) UAOption {
+	return func(s *UAService) {
+		s.realm = realm
+		s.creds = creds
+	}
+}
+
+// WithDigestChallengeTTL sets how long digest challenges remain valid.
+func WithDigestChallengeTTL(ttl time.Duration) UAOption {
+	return func(s *UAService) {
+		s.challengeTTL = ttl
+	}
+}
+
+// WithDigestChallengeKey sets the HMAC key used to sign the nonces of
+// digest challenges. No challenge state is kept: services with the same
+// key accept each other's challenges, for example behind a load balancer.
+// By default a random key is used which only this service accepts.
+func WithDigestChallengeKey(key []byte) UAOption {
+	return func(s *UAService) {
+		s.nonceKey = key
+	}
 }
 
 // NewUAService creates a new UserAuthenticate check-in message handler.
-func NewUAService(store storage.UserAuthenticateStore, sendEmptyDigestChallenge bool) *UAService {
-	return &UAService{
+func NewUAService(store storage.UserAuthenticateStore, sendEmptyDigestChallenge bool, opts ...UAOption) *UAService {
+	s := &UAService{
 		logger:                   log.NopLogger,
 		store:                    store,
 		sendEmptyDigestChallenge: sendEmptyDigestChallenge,
+		challengeTTL:             5 * time.Minute,
+		nowFn:                    time.Now,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
+// DigestMethod is the HTTP method used for verifying digest responses.
+// UserAuthenticate check-in messages are sent with HTTP PUT.
+const DigestMethod = http.MethodPut
+
 const emptyDigestChallenge = `<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
 <plist version="1.0">
@@ -49,9 +111,12 @@ const emptyDigestChallenge = `<?xml version="1.0" encoding="UTF-8"?>
 var emptyDigestChallengeBytes = []byte(emptyDigestChallenge)
 
 // UserAuthenticate will decline management of a user unless configured
-// for the empty digest 2-step UserAuthenticate protocol.
+// for the empty or digest challenge 2-step UserAuthenticate protocol.
 // It implements the NanoMDM service method for UserAuthenticate check-in messages.
 func (s *UAService) UserAuthenticate(r *mdm.Request, message *mdm.UserAuthenticate) ([]byte, error) {
+	if s.creds != nil {
+		return s.digestUserAuthenticate(r, message)
+	}
 	logger := ctxlog.Logger(r.Context(), s.logger)
 	if s.sendEmptyDigestChallenge || s.storeRejectedUserAuth {
 		if err := s.store.StoreUserAuthenticate(r, message); err != nil {
@@ -77,3 +142,128 @@ func (s *UAService) UserAuthenticate(r *mdm.Request, message *mdm.UserAuthentica
 	)
 	return nil, nil
 }
+
+// declineUser returns an error that declines management of the user.
+func declineUser(r *mdm.Request, reason string) error {
+	return service.NewHTTPStatusError(
+		http.StatusGone,
+		fmt.Errorf("declining management of user: %s: %s", r.ID, reason),
+	)
+}
+
+// digestChallengeBytes returns the UserAuthenticate response plist of challenge.
+func digestChallengeBytes(challenge string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>DigestChallenge</key>
+	<string>`)
+	if err := xml.EscapeText(buf, []byte(challenge)); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`</string>
+</dict>
+</plist>`)
+	return buf.Bytes(), nil
+}
+
+// key returns the nonce HMAC key, generating a random one if not set.
+func (s *UAService) key() ([]byte, error) {
+	s.nonceKeyOnce.Do(func() {
+		if len(s.nonceKey) > 0 {
+			return
+		}
+		s.nonceKey = make([]byte, 32)
+		_, s.nonceKeyErr = rand.Read(s.nonceKey)
+	})
+	return s.nonceKey, s.nonceKeyErr
+}
+
+// nonceMAC returns the hex-encoded HMAC of the enrollment id and
+// hex-encoded timestamp ts of a nonce.
+func nonceMAC(key []byte, id, ts string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "\x00" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newNonce returns a nonce for enrollment id created at now.
+// The nonce is the hex-encoded Unix time and its HMAC with id.
+func newNonce(key []byte, id string, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 16)
+	return ts + "-" + nonceMAC(key, id, ts)
+}
+
+// checkNonce verifies that nonce was created for enrollment id
+// and has not expired at now.
+func checkNonce(key []byte, id, nonce string, now time.Time, ttl time.Duration) error {
+	ts, mac, ok := strings.Cut(nonce, "-")
+	if !ok || !hmac.Equal([]byte(mac), []byte(nonceMAC(key, id, ts))) {
+		return errors.New("invalid nonce")
+	}
+	unix, err := strconv.ParseInt(ts, 16, 64)
+	if err != nil {
+		return fmt.Errorf("parsing nonce timestamp: %w", err)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age < 0 || age > ttl {
+		return errors.New("nonce expired")
+	}
+	return nil
+}
+
+// digestUserAuthenticate implements the digest challenge 2-step
+// UserAuthenticate protocol. The first message is sent a new challenge
+// for the enrollment. The DigestResponse of the second message must
+// answer that challenge with valid credentials before it expires.
+// Nonces are signed rather than kept so any service with the same key
+// can verify the response. As a result a challenge may be answered
+// more than once until it expires.
+func (s *UAService) digestUserAuthenticate(r *mdm.Request, message *mdm.UserAuthenticate) ([]byte, error) {
+	logger := ctxlog.Logger(r.Context(), s.logger)
+	if r.ID == "" {
+		return nil, errors.New("empty enrollment id")
+	}
+	if err := s.store.StoreUserAuthenticate(r, message); err != nil {
+		return nil, err
+	}
+	key, err := s.key()
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce key: %w", err)
+	}
+	now := s.nowFn()
+
+	if message.DigestResponse == "" {
+		challenge := &digestauth.Challenge{Realm: s.realm, Nonce: newNonce(key, r.ID, now)}
+		respBytes, err := digestChallengeBytes(challenge.String())
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("msg", "sending DigestChallenge response to UserAuthenticate")
+		return respBytes, nil
+	}
+
+	resp, err := digestauth.ParseResponse(message.DigestResponse)
+	if err != nil {
+		return nil, declineUser(r, fmt.Sprintf("parsing digest response: %v", err))
+	}
+	if err = checkNonce(key, r.ID, resp.Nonce, now, s.challengeTTL); err != nil {
+		return nil, declineUser(r, fmt.Sprintf("digest challenge: %v", err))
+	}
+	if resp.Realm != s.realm {
+		return nil, declineUser(r, "digest response does not match challenge")
+	}
+	if message.UserShortName != "" && resp.Username != message.UserShortName {
+		return nil, declineUser(r, "digest username does not match user short name")
+	}
+	ha1, err := s.creds.HA1(r.Context(), s.realm, resp.Username)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving credentials: %w", err)
+	}
+	if ha1 == "" || !resp.Verify(DigestMethod, ha1) {
+		return nil, declineUser(r, "invalid credentials for "+resp.Username)
+	}
+	logger.Info("msg", "verified UserAuthenticate DigestResponse", "username", resp.Username)
+	return nil, nil
+}
@@ -2,11 +2,18 @@ package nanomdm
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/micromdm/nanomdm/digestauth"
 	"github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/service"
+
+	"github.com/micromdm/plist"
 )
 
 type fauxStore struct {
@@ -60,3 +67,84 @@ func TestUAService(t *testing.T) {
 	}
 
 }
+
+func TestUAServiceDigest(t *testing.T) {
+	const realm = "NanoMDM"
+	creds, err := digestauth.NewHTDigest(strings.NewReader("alice:" + realm + ":" + digestauth.HA1("alice", realm, "secret") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("test key")
+	s := NewUAService(&fauxStore{}, false, WithDigestChallenge(realm, creds), WithDigestChallengeKey(key))
+
+	// respond computes a DigestResponse to the challenge plist.
+	respond := func(t *testing.T, challengeBytes []byte, username, password string) string {
+		t.Helper()
+		var challenge struct{ DigestChallenge string }
+		if err := plist.Unmarshal(challengeBytes, &challenge); err != nil {
+			t.Fatal(err)
+		}
+		_, nonce, _ := strings.Cut(challenge.DigestChallenge, `nonce="`)
+		nonce, _, _ = strings.Cut(nonce, `"`)
+		if nonce == "" {
+			t.Fatalf("no nonce in challenge: %s", challenge.DigestChallenge)
+		}
+		ha1 := digestauth.HA1(username, realm, password)
+		ha2 := md5Hex(DigestMethod + ":/mdm")
+		response := md5Hex(ha1 + ":" + nonce + ":00000001:abc:auth:" + ha2)
+		return `Digest username="` + username + `", realm="` + realm + `", nonce="` + nonce + `", uri="/mdm", qop=auth, nc=00000001, cnonce="abc", response="` + response + `"`
+	}
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		password string
+		ok       bool
+	}{
+		{"valid", "alice", "secret", true},
+		{"wrong password", "alice", "wrong", false},
+		{"unknown user", "bob", "secret", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			challenge, err := s.UserAuthenticate(newMDMReq(), &mdm.UserAuthenticate{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			digestResponse := respond(t, challenge, tc.username, tc.password)
+			ret, err := s.UserAuthenticate(newMDMReq(), &mdm.UserAuthenticate{DigestResponse: digestResponse})
+			if tc.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ret != nil {
+					t.Error("response bytes not empty")
+				}
+				// another service with the same key accepts the response
+				s2 := NewUAService(&fauxStore{}, false, WithDigestChallenge(realm, creds), WithDigestChallengeKey(key))
+				if _, err = s2.UserAuthenticate(newMDMReq(), &mdm.UserAuthenticate{DigestResponse: digestResponse}); err != nil {
+					t.Errorf("other service: %v", err)
+				}
+				// but not for another enrollment
+				other := &mdm.Request{EnrollID: &mdm.EnrollID{ID: "<other>"}}
+				if _, err = s2.UserAuthenticate(other, &mdm.UserAuthenticate{DigestResponse: digestResponse}); err == nil {
+					t.Error("expected error for other enrollment")
+				}
+				// nor after the challenge expired
+				s2.nowFn = func() time.Time { return time.Now().Add(time.Hour) }
+				if _, err = s2.UserAuthenticate(newMDMReq(), &mdm.UserAuthenticate{DigestResponse: digestResponse}); err == nil {
+					t.Error("expected error for expired challenge")
+				}
+				return
+			}
+			var httpErr *service.HTTPStatusError
+			if !errors.As(err, &httpErr) || httpErr.Status != 410 {
+				t.Errorf("expected 410 status error, have: %v", err)
+			}
+		})
+	}
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
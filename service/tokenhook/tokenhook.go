@@ -0,0 +1,182 @@
+// Package tokenhook provides a NanoMDM GetToken service that calls out
+// to an HTTP endpoint for the token.
+package tokenhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/micromdm/nanomdm/http/hashbody"
+	"github.com/micromdm/nanomdm/mdm"
+)
+
+type Doer interface {
+	// Do sends an HTTP request and returns an HTTP response.
+	Do(*http.Request) (*http.Response, error)
+}
+
+const (
+	EnrollmentIDHeader       = "X-Enrollment-ID"
+	EnrollmentTypeHeader     = "X-Enrollment-Type"
+	EnrollmentParentIDHeader = "X-Enrollment-ParentID" // only if non-empty
+
+	// HTTP header name used when including HMAC signatures.
+	HMACHeader = "X-Hmac-Signature"
+)
+
+// TokenParameters are the parameters of a GetToken check-in message.
+type TokenParameters struct {
+	PhoneUDID     string `json:"phone_udid,omitempty"`
+	SecurityToken string `json:"security_token,omitempty"`
+	WatchUDID     string `json:"watch_udid,omitempty"`
+}
+
+// Request is the JSON body of the HTTP request sent for a GetToken
+// check-in message.
+type Request struct {
+	TokenServiceType string           `json:"token_service_type"`
+	TokenParameters  *TokenParameters `json:"token_parameters,omitempty"`
+	UDID             string           `json:"udid,omitempty"`
+	EnrollmentID     string           `json:"enrollment_id,omitempty"`
+}
+
+// TokenHook is a NanoMDM GetToken service that calls out to an HTTP
+// endpoint for the token.
+type TokenHook struct {
+	url  *url.URL
+	doer Doer
+}
+
+type Option func(*TokenHook)
+
+// WithClient configures an HTTP client to use when sending HTTP requests.
+// This option should be specified before other options that modify the client.
+func WithClient(client Doer) Option {
+	return func(t *TokenHook) {
+		t.doer = client
+	}
+}
+
+// WithSetHMACSecret will add a SHA-256 HMAC of the GetToken request body using key.
+// The HMAC is provided in the [HMACHeader] header and is Base-64 encoded.
+// This option wraps the existing configured HTTP client. Beware client ordering.
+func WithSetHMACSecret(key []byte) Option {
+	return func(t *TokenHook) {
+		t.doer = hashbody.NewSetBodyHashClient(
+			t.doer,
+			HMACHeader,
+			func() hash.Hash {
+				return hmac.New(sha256.New, key)
+			},
+			base64.StdEncoding.EncodeToString,
+		)
+	}
+}
+
+// WithVerifyHMACSecret will verify a SHA-256 HMAC of the GetToken response body using key.
+// The HMAC is read from the [HMACHeader] header and is assumed to be Base-64 encoded.
+// This option wraps the existing configured HTTP client. Beware client ordering.
+func WithVerifyHMACSecret(key []byte) Option {
+	return func(t *TokenHook) {
+		t.doer = hashbody.NewVerifyBodyHashClient(
+			t.doer,
+			HMACHeader,
+			func() hash.Hash {
+				return hmac.New(sha256.New, key)
+			},
+			base64.StdEncoding.DecodeString,
+		)
+	}
+}
+
+// New creates a new GetToken HTTP service that sends requests to tokenURL.
+func New(tokenURL string, opts ...Option) (*TokenHook, error) {
+	u, err := url.Parse(tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	t := &TokenHook{
+		url:  u,
+		doer: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+// GetToken sends the GetToken check-in message as a JSON [Request] to
+// the HTTP endpoint. The body of the HTTP response is the token data.
+func (t *TokenHook) GetToken(r *mdm.Request, message *mdm.GetToken) (*mdm.GetTokenResponse, error) {
+	if t.url == nil {
+		return nil, errors.New("nil URL")
+	}
+	if t.doer == nil {
+		return nil, errors.New("nil HTTP client")
+	}
+	if message == nil {
+		return nil, errors.New("nil GetToken")
+	}
+
+	tokenReq := &Request{
+		TokenServiceType: message.TokenServiceType,
+		UDID:             message.UDID,
+		EnrollmentID:     message.EnrollmentID,
+	}
+	if p := message.TokenParameters; p != nil {
+		tokenReq.TokenParameters = &TokenParameters{
+			PhoneUDID:     p.PhoneUDID,
+			SecurityToken: p.SecurityToken,
+			WatchUDID:     p.WatchUDID,
+		}
+	}
+	reqBytes, err := json.Marshal(tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		r.Context(),
+		http.MethodPost,
+		t.url.String(),
+		bytes.NewBuffer(reqBytes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if r.EnrollID != nil {
+		req.Header.Set(EnrollmentIDHeader, r.ID)
+		req.Header.Set(EnrollmentTypeHeader, r.Type.String())
+		if r.ParentID != "" {
+			req.Header.Set(EnrollmentParentIDHeader, r.ParentID)
+		}
+	}
+
+	resp, err := t.doer.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do token hook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token hook HTTP status: %s", resp.Status)
+	}
+
+	return &mdm.GetTokenResponse{TokenData: bodyBytes}, nil
+}
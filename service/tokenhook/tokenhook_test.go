@@ -0,0 +1,113 @@
+package tokenhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/micromdm/nanomdm/mdm"
+)
+
+type mockDoer struct {
+	lastRequest  *http.Request
+	nextResponse *http.Response
+	nextError    error
+}
+
+func (m *mockDoer) Do(r *http.Request) (*http.Response, error) {
+	m.lastRequest = r
+	return m.nextResponse, m.nextError
+}
+
+func makeResp(body, key []byte, header string, code int) *http.Response {
+	resp := &http.Response{
+		Body:       io.NopCloser(bytes.NewBuffer(body)),
+		Header:     make(http.Header),
+		StatusCode: code,
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+
+	if len(key) > 0 {
+		h := hmac.New(sha256.New, key)
+		h.Write(body)
+		resp.Header.Set(header, base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+
+	return resp
+}
+
+func TestTokenHook(t *testing.T) {
+	c := &mockDoer{}
+
+	s, err := New("http://example.com/token", WithClient(c), WithSetHMACSecret([]byte("pwOut")), WithVerifyHMACSecret([]byte("pwIn")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mdm.NewRequestWithContext(context.Background(), nil)
+	r.EnrollID = &mdm.EnrollID{
+		ID:   "ID",
+		Type: mdm.Device,
+	}
+
+	m := &mdm.GetToken{
+		Enrollment:       mdm.Enrollment{UDID: "ID"},
+		TokenServiceType: "com.apple.watch.pairing",
+		TokenParameters:  &mdm.TokenParameters{WatchUDID: "WATCH", PhoneUDID: "PHONE"},
+	}
+
+	tokenData := []byte("token")
+	c.nextResponse = makeResp(tokenData, []byte("pwIn"), HMACHeader, 200)
+
+	resp, err := s.GetToken(r, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := resp.TokenData, tokenData; !bytes.Equal(have, want) {
+		t.Errorf("token data: have: %s, want: %s", have, want)
+	}
+
+	if have, want := c.lastRequest.Header.Get(EnrollmentIDHeader), "ID"; have != want {
+		t.Errorf("enrollment id header: have: %q, want: %q", have, want)
+	}
+
+	// verify the HMAC and body of the request
+	reqBytes, err := io.ReadAll(c.lastRequest.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hmac.New(sha256.New, []byte("pwOut"))
+	h.Write(reqBytes)
+	if have, want := c.lastRequest.Header.Get(HMACHeader), base64.StdEncoding.EncodeToString(h.Sum(nil)); have != want {
+		t.Errorf("hmac: have: %q, want: %q", have, want)
+	}
+	tokenReq := new(Request)
+	if err = json.Unmarshal(reqBytes, tokenReq); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := tokenReq.TokenServiceType, m.TokenServiceType; have != want {
+		t.Errorf("token service type: have: %q, want: %q", have, want)
+	}
+	if tokenReq.TokenParameters == nil || tokenReq.TokenParameters.WatchUDID != "WATCH" {
+		t.Errorf("unexpected token parameters: %v", tokenReq.TokenParameters)
+	}
+
+	// an invalid response HMAC errors
+	c.nextResponse = makeResp(tokenData, []byte("pwInvalid"), HMACHeader, 200)
+	if _, err = s.GetToken(r, m); err == nil {
+		t.Error("should have errored for invalid hash")
+	}
+
+	// a non-200 response errors
+	c.nextResponse = makeResp(nil, []byte("pwIn"), HMACHeader, 500)
+	if _, err = s.GetToken(r, m); err == nil {
+		t.Error("should have errored for HTTP status")
+	}
+}
@@ -10,6 +10,10 @@ type AcknowledgeEvent struct {
 	// The command UUID parsed from the command report, if available.
 	CommandUuid *string `json:"command_uuid,omitempty"`
 
+	// The command report decoded to JSON for known command RequestTypes, if
+	// enabled. Keys are the Apple command report keys; data is base64-encoded.
+	DecodedPayload map[string]interface{} `json:"decoded_payload,omitempty"`
+
 	// The `EnrollmentID` of the MDM enrollment.
 	EnrollmentId *EnrollmentID `json:"enrollment_id,omitempty"`
 
@@ -19,6 +23,9 @@ type AcknowledgeEvent struct {
 	// The raw HTTP body of the MDM command report.
 	RawPayload RawPayload `json:"raw_payload"`
 
+	// The RequestType of the command of the decoded payload, if decoded.
+	RequestType *string `json:"request_type,omitempty"`
+
 	// The MDM status of the device. Can indicate command report status.
 	Status string `json:"status"`
 
@@ -53,6 +60,47 @@ type CheckinEvent struct {
 	UrlParams map[string]string `json:"url_params,omitempty"`
 }
 
+// The Declarative Management declaration failed event. Represents the
+// declarations reported as invalid or with errors in a Declarative Management
+// status report.
+type DeclarationFailedEvent struct {
+	// The failed declarations.
+	Declarations []DeclarationStatus `json:"declarations"`
+
+	// The `EnrollmentID` of the MDM enrollment.
+	EnrollmentId *EnrollmentID `json:"enrollment_id,omitempty"`
+
+	// NanoMDM enrollment IDs.
+	Ids *IDs `json:"ids,omitempty"`
+
+	// The `UDID` of the MDM device.
+	Udid *UDID `json:"udid,omitempty"`
+
+	// Query paramters of the Declarative Management MDM HTTP request.
+	UrlParams map[string]string `json:"url_params,omitempty"`
+}
+
+// The status of a declaration as reported by the MDM enrollment.
+type DeclarationStatus struct {
+	// Whether the declaration is active.
+	Active bool `json:"active"`
+
+	// The declaration category.
+	Category string `json:"category"`
+
+	// The declaration identifier.
+	Identifier string `json:"identifier"`
+
+	// The reasons the declaration failed, if any.
+	Reasons []StatusReason `json:"reasons,omitempty"`
+
+	// The server token of the declaration.
+	ServerToken *string `json:"server_token,omitempty"`
+
+	// The validity of the declaration: `valid`, `invalid`, or `unknown`.
+	Valid string `json:"valid"`
+}
+
 // An `EnrollmentID` of the MDM enrollment.
 type EnrollmentID string
 
@@ -68,6 +116,10 @@ type EventJson struct {
 	// The date and time the event was created at.
 	CreatedAt time.Time `json:"created_at"`
 
+	// If present, the Declarative Management declaration failed event. The topic
+	// name will be `ddm.DeclarationFailed`.
+	DeclarationFailedEvent *DeclarationFailedEvent `json:"declaration_failed_event,omitempty"`
+
 	// The unique identifier of the event.
 	EventId *string `json:"event_id,omitempty"`
 
@@ -77,6 +129,7 @@ type EventJson struct {
 
 type EventJsonTopic string
 
+const EventJsonTopicDdmDeclarationFailed EventJsonTopic = "ddm.DeclarationFailed"
 const EventJsonTopicMdmAuthenticate EventJsonTopic = "mdm.Authenticate"
 const EventJsonTopicMdmCheckOut EventJsonTopic = "mdm.CheckOut"
 const EventJsonTopicMdmConnect EventJsonTopic = "mdm.Connect"
@@ -113,5 +166,17 @@ const IDsTypeUserEnrollmentDevice IDsType = "User Enrollment (Device)"
 // A raw HTTP body of an MDM request.
 type RawPayload string
 
+// A Declarative Management status reason.
+type StatusReason struct {
+	// The error code.
+	Code string `json:"code"`
+
+	// The description of the error.
+	Description *string `json:"description,omitempty"`
+
+	// Additional details of the error.
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
 // A `UDID` identifier of the MDM enrollment.
 type UDID string
@@ -15,6 +15,8 @@ import (
 
 	"github.com/micromdm/nanomdm/http/hashbody"
 	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/mdm/commands"
+	"github.com/micromdm/nanomdm/service/ddm"
 	"github.com/micromdm/nanomdm/storage"
 )
 
@@ -57,13 +59,22 @@ func ids(eid *mdm.EnrollID) *IDs {
 	}
 }
 
+// Sender sends webhook events somewhere other than a webhook URL.
+type Sender interface {
+	// SendEvent sends event.
+	SendEvent(ctx context.Context, event *EventJson) error
+}
+
 // Webhook is a NanoMDM service for sending HTTP webhook events.
 type Webhook struct {
 	url       string
 	doer      Doer
+	sender    Sender
 	store     storage.TokenUpdateTallyStore
 	nowFn     func() time.Time
 	eventIDFn func(context.Context) string
+	decode    bool
+	reqTypes  storage.CommandRequestTypeRetriever
 }
 
 // Options configure webhook services.
@@ -92,6 +103,18 @@ func WithEventID(fn func(context.Context) string) Option {
 	}
 }
 
+// WithDecodedResults includes the JSON-decoded command report in
+// command results events for known command RequestTypes.
+// Command reports that do not include their RequestType (see
+// [commands.ReportRequestType]) are only decoded if reqTypes is not nil
+// and can retrieve the RequestType of the originating command.
+func WithDecodedResults(reqTypes storage.CommandRequestTypeRetriever) Option {
+	return func(w *Webhook) {
+		w.decode = true
+		w.reqTypes = reqTypes
+	}
+}
+
 // WithHMACSecret will add a SHA-256 HMAC of the webhook HTTP body using key.
 // The HMAC is provided in the [HMACHeader] header and is Base-64 encoded.
 func WithHMACSecret(key []byte) Option {
@@ -120,8 +143,24 @@ func New(url string, opts ...Option) *Webhook {
 	return w
 }
 
+// NewWithSender initializes a new [Webhook] sending events with sender
+// instead of to a webhook URL. HTTP-related options have no effect.
+func NewWithSender(sender Sender, opts ...Option) *Webhook {
+	if sender == nil {
+		panic("nil sender")
+	}
+	w := New("", opts...)
+	w.sender = sender
+	return w
+}
+
 // send the HTTP request to the webhook URL.
+// If a sender is configured the event is sent with it instead.
 func (w *Webhook) send(ctx context.Context, event *EventJson) error {
+	if w.sender != nil {
+		return w.sender.SendEvent(ctx, event)
+	}
+
 	jsonBytes, err := json.Marshal(event)
 	if err != nil {
 		return err
@@ -286,10 +325,40 @@ func (w *Webhook) CommandAndReportResults(r *mdm.Request, results *mdm.CommandRe
 	if w.eventIDFn != nil {
 		ev.EventId = stringPtr[string](w.eventIDFn(r.Context()))
 	}
+	if w.decode {
+		// the decoded payload is a convenience: the raw payload is
+		// always present so ignore any lookup or decoding errors.
+		requestType := commands.ReportRequestType(results)
+		if requestType == "" && w.reqTypes != nil && results.CommandUUID != "" {
+			requestType, _ = w.reqTypes.RetrieveCommandRequestType(r.Context(), r.ID, results.CommandUUID)
+		}
+		if requestType != "" {
+			if decoded, err := decodedPayload(requestType, results); err == nil {
+				ev.AcknowledgeEvent.RequestType = &requestType
+				ev.AcknowledgeEvent.DecodedPayload = decoded
+			}
+		}
+	}
 	return nil, w.send(r.Context(), ev)
 }
 
+// decodedPayload decodes results of a command of requestType into a
+// JSON object of its typed result.
+func decodedPayload(requestType string, results *mdm.CommandResults) (map[string]interface{}, error) {
+	result, err := commands.DecodeResult(requestType, results)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	return decoded, json.Unmarshal(jsonBytes, &decoded)
+}
+
 // DeclarativeManagement sends a webhook event of the NanoMDM DeclarativeManagement check-in message.
+// Status reports with failed declarations also send a declaration failed event.
 func (w *Webhook) DeclarativeManagement(r *mdm.Request, m *mdm.DeclarativeManagement) ([]byte, error) {
 	ev := &EventJson{
 		Topic:     EventJsonTopicMdmDeclarativeManagement,
@@ -305,7 +374,57 @@ func (w *Webhook) DeclarativeManagement(r *mdm.Request, m *mdm.DeclarativeManage
 	if w.eventIDFn != nil {
 		ev.EventId = stringPtr[string](w.eventIDFn(r.Context()))
 	}
-	return nil, w.send(r.Context(), ev)
+	if err := w.send(r.Context(), ev); err != nil {
+		return nil, err
+	}
+	if m.Endpoint != "status" {
+		return nil, nil
+	}
+	return nil, w.declarationFailed(r, m)
+}
+
+// declarationFailed sends a webhook event of the failed declarations
+// of the Declarative Management status report in m, if any.
+func (w *Webhook) declarationFailed(r *mdm.Request, m *mdm.DeclarativeManagement) error {
+	report, err := ddm.ParseStatusReport(m.Data)
+	if err != nil {
+		return err
+	}
+	failed, err := report.FailedDeclarations()
+	if err != nil || len(failed) < 1 {
+		return err
+	}
+	ev := &EventJson{
+		Topic:     EventJsonTopicDdmDeclarationFailed,
+		CreatedAt: w.nowFn(),
+		DeclarationFailedEvent: &DeclarationFailedEvent{
+			Ids:          ids(r.EnrollID),
+			EnrollmentId: stringPtr[EnrollmentID](m.EnrollmentID),
+			Udid:         stringPtr[UDID](m.UDID),
+			UrlParams:    r.Params,
+		},
+	}
+	for _, d := range failed {
+		status := DeclarationStatus{
+			Active:      d.Active,
+			Category:    d.Category,
+			Identifier:  d.Identifier,
+			ServerToken: stringPtr[string](d.ServerToken),
+			Valid:       d.Valid,
+		}
+		for _, reason := range d.Reasons {
+			status.Reasons = append(status.Reasons, StatusReason{
+				Code:        reason.Code,
+				Description: stringPtr[string](reason.Description),
+				Details:     reason.Details,
+			})
+		}
+		ev.DeclarationFailedEvent.Declarations = append(ev.DeclarationFailedEvent.Declarations, status)
+	}
+	if w.eventIDFn != nil {
+		ev.EventId = stringPtr[string](w.eventIDFn(r.Context()))
+	}
+	return w.send(r.Context(), ev)
 }
 
 // GetToken sends a webhook event of the NanoMDM GetToken check-in message.
@@ -191,3 +191,159 @@ func TestWebhook(t *testing.T) {
 		// os.WriteFile("testdata/output.DeviceInformation.1.json", reqBody, 0644)
 	}
 }
+
+func TestWebhookDecodedResults(t *testing.T) {
+	c := &mockDoer{}
+	w := New("", WithClient(c), WithDecodedResults(nil))
+
+	rawBytes, err := os.ReadFile("../../mdm/testdata/DeviceInformation.1.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := mdm.DecodeCommandResults(rawBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mdm.NewRequestWithContext(context.Background(), nil)
+	r.EnrollID = &mdm.EnrollID{ID: cr.UDID, Type: mdm.Device}
+
+	if _, err = w.CommandAndReportResults(r, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	event := new(EventJson)
+	if err = json.NewDecoder(c.lastRequest.Body).Decode(event); err != nil {
+		t.Fatal(err)
+	}
+	ev := event.AcknowledgeEvent
+	if ev.RequestType == nil || *ev.RequestType != "DeviceInformation" {
+		t.Errorf("request type: have: %v, want: DeviceInformation", ev.RequestType)
+	}
+	queryResponses, ok := ev.DecodedPayload["QueryResponses"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing QueryResponses: %v", ev.DecodedPayload)
+	}
+	if have, want := queryResponses["HostName"], "fruit.example.com"; have != want {
+		t.Errorf("HostName: have: %v, want: %v", have, want)
+	}
+
+	// reports without a RequestType are not decoded
+	cr.Raw = bytes.Replace(rawBytes, []byte("<key>RequestType</key>"), []byte("<key>OtherKey</key>"), 1)
+	if _, err = w.CommandAndReportResults(r, cr); err != nil {
+		t.Fatal(err)
+	}
+	event = new(EventJson)
+	if err = json.NewDecoder(c.lastRequest.Body).Decode(event); err != nil {
+		t.Fatal(err)
+	}
+	if ev = event.AcknowledgeEvent; ev.RequestType != nil || ev.DecodedPayload != nil {
+		t.Errorf("expected no decoded payload without request type: %v", ev.RequestType)
+	}
+
+	// unless the RequestType of the command can be retrieved
+	w = New("", WithClient(c), WithDecodedResults(reqTypeFunc(func(_ context.Context, id, uuid string) (string, error) {
+		if id != cr.UDID || uuid != cr.CommandUUID {
+			return "", nil
+		}
+		return "DeviceInformation", nil
+	})))
+	if _, err = w.CommandAndReportResults(r, cr); err != nil {
+		t.Fatal(err)
+	}
+	event = new(EventJson)
+	if err = json.NewDecoder(c.lastRequest.Body).Decode(event); err != nil {
+		t.Fatal(err)
+	}
+	if ev = event.AcknowledgeEvent; ev.RequestType == nil || *ev.RequestType != "DeviceInformation" {
+		t.Errorf("request type: have: %v, want: DeviceInformation", ev.RequestType)
+	}
+	if ev.DecodedPayload == nil {
+		t.Error("expected decoded payload with retrieved request type")
+	}
+}
+
+type reqTypeFunc func(ctx context.Context, id, uuid string) (string, error)
+
+func (f reqTypeFunc) RetrieveCommandRequestType(ctx context.Context, id, uuid string) (string, error) {
+	return f(ctx, id, uuid)
+}
+
+type senderFunc func(context.Context, *EventJson) error
+
+func (f senderFunc) SendEvent(ctx context.Context, ev *EventJson) error {
+	return f(ctx, ev)
+}
+
+func TestWebhookSender(t *testing.T) {
+	c := &mockDoer{}
+	var sent *EventJson
+	w := NewWithSender(senderFunc(func(_ context.Context, ev *EventJson) error {
+		sent = ev
+		return nil
+	}), WithClient(c))
+
+	r := mdm.NewRequestWithContext(context.Background(), nil)
+	r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111", Type: mdm.Device}
+
+	if err := w.CheckOut(r, &mdm.CheckOut{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.lastRequest != nil {
+		t.Error("unexpected HTTP request with sender")
+	}
+	if sent == nil {
+		t.Fatal("no event sent")
+	}
+	if have, want := sent.Topic, EventJsonTopicMdmCheckOut; have != want {
+		t.Errorf("topic: have: %v, want: %v", have, want)
+	}
+	if have, want := sent.CheckinEvent.Ids.Id, "AAAA-1111"; have != want {
+		t.Errorf("id: have: %v, want: %v", have, want)
+	}
+}
+
+func TestWebhookDeclarationFailed(t *testing.T) {
+	var sent []*EventJson
+	w := NewWithSender(senderFunc(func(_ context.Context, ev *EventJson) error {
+		sent = append(sent, ev)
+		return nil
+	}))
+
+	r := mdm.NewRequestWithContext(context.Background(), nil)
+	r.EnrollID = &mdm.EnrollID{ID: "AAAA-1111", Type: mdm.Device}
+
+	report := `{"StatusItems":{"management":{"declarations":{"configurations":[
+		{"identifier":"com.example.ok","active":true,"valid":"valid","server-token":"a"},
+		{"identifier":"com.example.bad","active":false,"valid":"invalid","server-token":"b",
+		 "reasons":[{"code":"Error.ConfigurationCannotBeApplied"}]}
+	]}}},"Errors":[]}`
+
+	m := &mdm.DeclarativeManagement{Endpoint: "status", Data: []byte(report)}
+	if _, err := w.DeclarativeManagement(r, m); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(sent), 2; have != want {
+		t.Fatalf("events: have: %v, want: %v", have, want)
+	}
+	ev := sent[1]
+	if have, want := ev.Topic, EventJsonTopicDdmDeclarationFailed; have != want {
+		t.Errorf("topic: have: %v, want: %v", have, want)
+	}
+	decls := ev.DeclarationFailedEvent.Declarations
+	if len(decls) != 1 || decls[0].Identifier != "com.example.bad" {
+		t.Fatalf("unexpected failed declarations: %v", decls)
+	}
+	if have, want := decls[0].Reasons[0].Code, "Error.ConfigurationCannotBeApplied"; have != want {
+		t.Errorf("reason code: have: %v, want: %v", have, want)
+	}
+
+	// other endpoints only send the check-in event
+	sent = nil
+	if _, err := w.DeclarativeManagement(r, &mdm.DeclarativeManagement{Endpoint: "tokens"}); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(sent), 1; have != want {
+		t.Errorf("events: have: %v, want: %v", have, want)
+	}
+}
@@ -0,0 +1,35 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) StoreAPICredential(ctx context.Context, cred *storage.APICredential) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreAPICredential(ctx, cred)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveAPICredential(ctx context.Context, name string) (*storage.APICredential, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveAPICredential(ctx, name)
+	})
+	return val.(*storage.APICredential), err
+}
+
+func (ms *MultiAllStorage) ListAPICredentials(ctx context.Context) ([]*storage.APICredential, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListAPICredentials(ctx)
+	})
+	return val.([]*storage.APICredential), err
+}
+
+func (ms *MultiAllStorage) DeleteAPICredential(ctx context.Context, name string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.DeleteAPICredential(ctx, name)
+	})
+	return err
+}
@@ -0,0 +1,21 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) StoreAuditEntry(ctx context.Context, e *storage.AuditEntry) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreAuditEntry(ctx, e)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveAuditEntries(ctx context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveAuditEntries(ctx, q)
+	})
+	return val.([]*storage.AuditEntry), err
+}
@@ -0,0 +1,91 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) StoreDeclaration(ctx context.Context, d *storage.Declaration) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreDeclaration(ctx, d)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveDeclaration(ctx context.Context, identifier string) (*storage.Declaration, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveDeclaration(ctx, identifier)
+	})
+	return val.(*storage.Declaration), err
+}
+
+func (ms *MultiAllStorage) ListDeclarations(ctx context.Context) ([]*storage.Declaration, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListDeclarations(ctx)
+	})
+	return val.([]*storage.Declaration), err
+}
+
+func (ms *MultiAllStorage) DeleteDeclaration(ctx context.Context, identifier string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.DeleteDeclaration(ctx, identifier)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) StoreDeclarationSet(ctx context.Context, name string, identifiers []string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreDeclarationSet(ctx, name, identifiers)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveDeclarationSet(ctx context.Context, name string) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveDeclarationSet(ctx, name)
+	})
+	return val.([]string), err
+}
+
+func (ms *MultiAllStorage) ListDeclarationSets(ctx context.Context) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListDeclarationSets(ctx)
+	})
+	return val.([]string), err
+}
+
+func (ms *MultiAllStorage) StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreEnrollmentDeclarationSets(ctx, id, sets)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveEnrollmentDeclarationSets(ctx, id)
+	})
+	return val.([]string), err
+}
+
+func (ms *MultiAllStorage) ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListDeclarationSetEnrollments(ctx, name)
+	})
+	return val.([]string), err
+}
+
+func (ms *MultiAllStorage) StoreDeclarationStatus(ctx context.Context, id string, status []byte) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreDeclarationStatus(ctx, id, status)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveDeclarationStatus(ctx context.Context, id string) ([]byte, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveDeclarationStatus(ctx, id)
+	})
+	return val.([]byte), err
+}
@@ -0,0 +1,29 @@
+package allmulti
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) RetrieveEnrollmentAttributes(ctx context.Context, ids []string) (map[string]*storage.EnrollmentAttributes, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveEnrollmentAttributes(ctx, ids)
+	})
+	return val.(map[string]*storage.EnrollmentAttributes), err
+}
+
+func (ms *MultiAllStorage) ResolveSerialNumber(ctx context.Context, serial string, sel storage.ChannelSelector) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ResolveSerialNumber(ctx, serial, sel)
+	})
+	return val.([]string), err
+}
+
+func (ms *MultiAllStorage) RetrieveIdentityCerts(ctx context.Context, ids []string) (map[string]*x509.Certificate, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveIdentityCerts(ctx, ids)
+	})
+	return val.(map[string]*x509.Certificate), err
+}
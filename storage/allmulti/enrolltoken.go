@@ -0,0 +1,21 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) StoreEnrollmentToken(ctx context.Context, t *storage.EnrollmentToken) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreEnrollmentToken(ctx, t)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) UseEnrollmentToken(ctx context.Context, hash string) (*storage.EnrollmentToken, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.UseEnrollmentToken(ctx, hash)
+	})
+	return val.(*storage.EnrollmentToken), err
+}
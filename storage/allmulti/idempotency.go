@@ -0,0 +1,35 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) CreateIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) (bool, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.CreateIdempotencyRecord(ctx, rec)
+	})
+	return val.(bool), err
+}
+
+func (ms *MultiAllStorage) StoreIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreIdempotencyRecord(ctx, rec)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveIdempotencyRecord(ctx context.Context, key string) (*storage.IdempotencyRecord, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveIdempotencyRecord(ctx, key)
+	})
+	return val.(*storage.IdempotencyRecord), err
+}
+
+func (ms *MultiAllStorage) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.DeleteIdempotencyRecord(ctx, key)
+	})
+	return err
+}
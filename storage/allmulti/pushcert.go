@@ -30,9 +30,37 @@ func (ms *MultiAllStorage) RetrievePushCert(ctx context.Context, topic string) (
 	return rets.cert, rets.staleToken, err
 }
 
+func (ms *MultiAllStorage) ListPushCertTopics(ctx context.Context) ([]string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListPushCertTopics(ctx)
+	})
+	return val.([]string), err
+}
+
 func (ms *MultiAllStorage) StorePushCert(ctx context.Context, pemCert, pemKey []byte) error {
 	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
 		return nil, s.StorePushCert(ctx, pemCert, pemKey)
 	})
 	return err
 }
+
+func (ms *MultiAllStorage) StorePushKey(ctx context.Context, hash string, pemKey []byte) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StorePushKey(ctx, hash, pemKey)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrievePushKey(ctx context.Context, hash string) ([]byte, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrievePushKey(ctx, hash)
+	})
+	return val.([]byte), err
+}
+
+func (ms *MultiAllStorage) DeletePushKey(ctx context.Context, hash string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.DeletePushKey(ctx, hash)
+	})
+	return err
+}
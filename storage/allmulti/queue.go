@@ -34,3 +34,24 @@ func (ms *MultiAllStorage) EnqueueCommand(ctx context.Context, id []string, cmd
 	})
 	return val.(map[string]error), err
 }
+
+func (ms *MultiAllStorage) EnqueueCommands(ctx context.Context, items []*storage.EnqueueItem) ([]error, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return storage.EnqueueCommands(ctx, s, items)
+	})
+	return val.([]error), err
+}
+
+func (ms *MultiAllStorage) RetrieveCommandResults(ctx context.Context, uuid string, ids []string) (map[string]*mdm.CommandResults, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveCommandResults(ctx, uuid, ids)
+	})
+	return val.(map[string]*mdm.CommandResults), err
+}
+
+func (ms *MultiAllStorage) RetrieveCommandRequestType(ctx context.Context, id, uuid string) (string, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveCommandRequestType(ctx, id, uuid)
+	})
+	return val.(string), err
+}
@@ -0,0 +1,35 @@
+package allmulti
+
+import (
+	"context"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func (ms *MultiAllStorage) StoreCommandTemplate(ctx context.Context, tmpl *storage.CommandTemplate) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.StoreCommandTemplate(ctx, tmpl)
+	})
+	return err
+}
+
+func (ms *MultiAllStorage) RetrieveCommandTemplate(ctx context.Context, name string) (*storage.CommandTemplate, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.RetrieveCommandTemplate(ctx, name)
+	})
+	return val.(*storage.CommandTemplate), err
+}
+
+func (ms *MultiAllStorage) ListCommandTemplates(ctx context.Context) ([]*storage.CommandTemplate, error) {
+	val, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return s.ListCommandTemplates(ctx)
+	})
+	return val.([]*storage.CommandTemplate), err
+}
+
+func (ms *MultiAllStorage) DeleteCommandTemplate(ctx context.Context, name string) error {
+	_, err := ms.execStores(ctx, func(s storage.AllStorage) (interface{}, error) {
+		return nil, s.DeleteCommandTemplate(ctx, name)
+	})
+	return err
+}
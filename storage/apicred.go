@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// APICredential is a named and scoped API credential.
+type APICredential struct {
+	// Name is the unique name of the credential.
+	// It is used as the username when authenticating.
+	Name string `json:"name"`
+
+	// SecretHash is the hex-encoded SHA-256 hash of the credential secret.
+	// The secret itself is never stored.
+	SecretHash string `json:"secret_hash"`
+
+	// Scopes are the API operations the credential is permitted to perform.
+	Scopes []string `json:"scopes"`
+
+	// EnrollmentIDs restricts the credential to operating on only
+	// these enrollment IDs. An empty list means no restriction.
+	EnrollmentIDs []string `json:"enrollment_ids,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// APICredentialStore stores and retrieves API credentials.
+type APICredentialStore interface {
+	// StoreAPICredential creates or replaces the API credential
+	// identified by cred.Name. Implementations may manage the
+	// CreatedAt and UpdatedAt timestamps themselves.
+	StoreAPICredential(ctx context.Context, cred *APICredential) error
+
+	// RetrieveAPICredential retrieves the API credential named name.
+	// If no credential is found then a nil credential and no error should be returned.
+	RetrieveAPICredential(ctx context.Context, name string) (*APICredential, error)
+
+	// ListAPICredentials retrieves all API credentials.
+	ListAPICredentials(ctx context.Context) ([]*APICredential, error)
+
+	// DeleteAPICredential deletes the API credential named name.
+	// Deleting a credential that does not exist should not return an error.
+	DeleteAPICredential(ctx context.Context, name string) error
+}
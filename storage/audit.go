@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Audit entry outcomes.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomePartial = "partial"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEntry records a single state-changing API call.
+type AuditEntry struct {
+	// ID uniquely identifies the entry.
+	ID string `json:"id"`
+
+	Time time.Time `json:"time"`
+
+	// Actor is the identity of the caller, typically an API credential name.
+	Actor string `json:"actor,omitempty"`
+
+	SourceIP string `json:"source_ip,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+
+	// Action is the API operation performed, such as "enqueue".
+	Action string `json:"action"`
+
+	// EnrollmentIDs are the targets of the action, if any.
+	EnrollmentIDs []string `json:"enrollment_ids,omitempty"`
+
+	CommandUUID string `json:"command_uuid,omitempty"`
+	RequestType string `json:"request_type,omitempty"`
+
+	// Topic is the APNs topic of the push certificate involved, if any.
+	Topic string `json:"topic,omitempty"`
+
+	// Details contains any other action-specific information.
+	Details map[string]string `json:"details,omitempty"`
+
+	// Outcome is one of the AuditOutcome constants.
+	Outcome string `json:"outcome"`
+
+	// Status is the HTTP status code of the response.
+	Status int `json:"status,omitempty"`
+}
+
+// AuditQuery filters audit entries. Empty fields match all entries.
+type AuditQuery struct {
+	Actor        string
+	Action       string
+	EnrollmentID string
+	CommandUUID  string
+
+	// Since and Until bound the entry time (inclusive).
+	Since, Until time.Time
+
+	// Limit is the maximum number of entries to return.
+	// Zero means no limit.
+	Limit int
+}
+
+// Match reports whether e matches q, ignoring the limit.
+func (q *AuditQuery) Match(e *AuditEntry) bool {
+	if q == nil {
+		return true
+	}
+	if e == nil ||
+		(q.Actor != "" && q.Actor != e.Actor) ||
+		(q.Action != "" && q.Action != e.Action) ||
+		(q.CommandUUID != "" && q.CommandUUID != e.CommandUUID) ||
+		(!q.Since.IsZero() && e.Time.Before(q.Since)) ||
+		(!q.Until.IsZero() && e.Time.After(q.Until)) {
+		return false
+	}
+	if q.EnrollmentID == "" {
+		return true
+	}
+	for _, id := range e.EnrollmentIDs {
+		if id == q.EnrollmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditStorer stores audit entries.
+type AuditStorer interface {
+	// StoreAuditEntry appends e to the audit log.
+	// Implementations may record their own timestamp for the entry.
+	StoreAuditEntry(ctx context.Context, e *AuditEntry) error
+}
+
+// AuditStore stores and queries audit entries.
+type AuditStore interface {
+	AuditStorer
+
+	// RetrieveAuditEntries retrieves the audit entries matching q,
+	// newest first.
+	RetrieveAuditEntries(ctx context.Context, q *AuditQuery) ([]*AuditEntry, error)
+}
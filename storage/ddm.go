@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Declaration is a Declarative Management declaration.
+type Declaration struct {
+	// Identifier is the unique identifier of the declaration.
+	Identifier string `json:"identifier"`
+
+	// Type is the declaration type (e.g. "com.apple.configuration.passcode.settings").
+	Type string `json:"type"`
+
+	// ServerToken changes whenever the declaration changes.
+	// See package ddm for how it is computed.
+	ServerToken string `json:"server_token"`
+
+	// Raw is the JSON declaration without its ServerToken.
+	Raw []byte `json:"raw"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeclarationStore stores Declarative Management declarations and
+// their assignment to enrollments. Declarations are grouped into named
+// sets which are in turn assigned to enrollments.
+type DeclarationStore interface {
+	// StoreDeclaration creates or replaces the declaration identified
+	// by d.Identifier. Implementations may manage the CreatedAt and
+	// UpdatedAt timestamps themselves.
+	StoreDeclaration(ctx context.Context, d *Declaration) error
+
+	// RetrieveDeclaration retrieves the declaration identifier.
+	// If no declaration is found then a nil declaration and no error should be returned.
+	RetrieveDeclaration(ctx context.Context, identifier string) (*Declaration, error)
+
+	// ListDeclarations retrieves all declarations.
+	ListDeclarations(ctx context.Context) ([]*Declaration, error)
+
+	// DeleteDeclaration deletes the declaration identifier.
+	// Deleting a declaration that does not exist should not return an error.
+	DeleteDeclaration(ctx context.Context, identifier string) error
+
+	// StoreDeclarationSet replaces the declaration identifiers of the
+	// set named name. An empty identifiers removes the set.
+	StoreDeclarationSet(ctx context.Context, name string, identifiers []string) error
+
+	// RetrieveDeclarationSet retrieves the sorted declaration
+	// identifiers of the set named name.
+	// An empty slice is returned if the set does not exist.
+	RetrieveDeclarationSet(ctx context.Context, name string) ([]string, error)
+
+	// ListDeclarationSets retrieves the sorted names of all sets.
+	ListDeclarationSets(ctx context.Context) ([]string, error)
+
+	// StoreEnrollmentDeclarationSets replaces the names of the sets
+	// assigned to enrollment id. An empty sets removes the assignments.
+	StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string) error
+
+	// RetrieveEnrollmentDeclarationSets retrieves the sorted names of
+	// the sets assigned to enrollment id.
+	RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) ([]string, error)
+
+	// ListDeclarationSetEnrollments retrieves the sorted enrollment
+	// IDs that are assigned the set named name.
+	ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error)
+}
+
+// DeclarationStatusStore stores the Declarative Management status of
+// enrollments. The status is an opaque JSON document maintained by the
+// Declarative Management service.
+type DeclarationStatusStore interface {
+	// StoreDeclarationStatus creates or replaces the status of enrollment id.
+	StoreDeclarationStatus(ctx context.Context, id string, status []byte) error
+
+	// RetrieveDeclarationStatus retrieves the status of enrollment id.
+	// If no status is found then a nil status and no error should be returned.
+	RetrieveDeclarationStatus(ctx context.Context, id string) ([]byte, error)
+}
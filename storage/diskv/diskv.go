@@ -60,5 +60,6 @@ func New(path string) *Diskv {
 		),
 		newBucket(path, "devices"),
 		newBucket(path, "enrollments"),
+		kv.WithAPIBucket(newBucket(path, "api")),
 	)}
 }
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/micromdm/nanomdm/mdm"
+)
+
+// EnrollmentAttributes are stored attributes of an enrollment.
+type EnrollmentAttributes struct {
+	// Enrollment is the enrollment data (e.g. UDID or UserShortName)
+	// from the most recent TokenUpdate of the enrollment.
+	mdm.Enrollment
+
+	// SerialNumber is the serial number of the enrollment's device.
+	// It is empty if the serial number is not known.
+	SerialNumber string
+}
+
+// EnrollmentAttributesRetriever retrieves stored enrollment attributes.
+type EnrollmentAttributesRetriever interface {
+	// RetrieveEnrollmentAttributes retrieves the attributes of enrollment ids.
+	// Enrollment IDs that are not found are omitted.
+	RetrieveEnrollmentAttributes(ctx context.Context, ids []string) (map[string]*EnrollmentAttributes, error)
+}
+
+// DecodeEnrollmentAttributes creates enrollment attributes from the
+// raw TokenUpdate check-in message rawTokenUpdate and serial number.
+func DecodeEnrollmentAttributes(rawTokenUpdate []byte, serial string) (*EnrollmentAttributes, error) {
+	msg, err := mdm.DecodeCheckin(rawTokenUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token update: %w", err)
+	}
+	tokUpd, ok := msg.(*mdm.TokenUpdate)
+	if !ok {
+		return nil, errors.New("not a token update")
+	}
+	return &EnrollmentAttributes{
+		Enrollment:   tokUpd.Enrollment,
+		SerialNumber: serial,
+	}, nil
+}
+
+// ChannelSelector selects the MDM channels (enrollments) of a device.
+// The zero value selects the device channel.
+type ChannelSelector struct {
+	// UserShortName selects the user channel of the user with this short name.
+	UserShortName string
+
+	// All selects the device channel and all user channels.
+	All bool
+}
+
+// isUserChannel reports whether attrs are of a user channel enrollment.
+func (attrs *EnrollmentAttributes) isUserChannel() bool {
+	return attrs.UserID != "" || attrs.EnrollmentUserID != ""
+}
+
+// Select returns the sorted enrollment IDs of the channels in attrs
+// selected by sel. The map key of attrs is the enrollment ID.
+func (sel ChannelSelector) Select(attrs map[string]*EnrollmentAttributes) []string {
+	var ids []string
+	for id, a := range attrs {
+		if a == nil {
+			continue
+		}
+		switch {
+		case sel.All:
+		case sel.UserShortName != "":
+			if !a.isUserChannel() || a.UserShortName != sel.UserShortName {
+				continue
+			}
+		case a.isUserChannel():
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SerialNumberResolver resolves device serial numbers to enrollment IDs.
+type SerialNumberResolver interface {
+	// ResolveSerialNumber resolves the enabled enrollment IDs of the
+	// channels selected by sel of devices with serial number serial.
+	// An empty slice is returned if no enrollments match.
+	ResolveSerialNumber(ctx context.Context, serial string, sel ChannelSelector) ([]string, error)
+}
+
+// IdentityCertRetriever retrieves stored MDM identity certificates.
+type IdentityCertRetriever interface {
+	// RetrieveIdentityCerts retrieves the identity certificates of
+	// enrollment ids. This is the identity certificate of the device
+	// for both device and user channel enrollments. Enrollment IDs
+	// without a stored identity certificate are omitted.
+	RetrieveIdentityCerts(ctx context.Context, ids []string) (map[string]*x509.Certificate, error)
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// EnrollmentToken is a one-time token for retrieving an enrollment profile.
+type EnrollmentToken struct {
+	// Hash is the hex-encoded SHA-256 digest of the token.
+	// The token itself is not stored.
+	Hash string `json:"hash"`
+
+	// Label optionally describes who or what the token was issued for.
+	Label string `json:"label,omitempty"`
+
+	// ExpiresAt is when the token is no longer valid.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EnrollmentTokenStore stores and uses one-time enrollment tokens.
+type EnrollmentTokenStore interface {
+	// StoreEnrollmentToken stores t identified by t.Hash.
+	// Implementations may remove expired tokens.
+	StoreEnrollmentToken(ctx context.Context, t *EnrollmentToken) error
+
+	// UseEnrollmentToken retrieves and removes the token identified by
+	// hash so that it can only be used once.
+	// If no token is found or it has expired then a nil token and no
+	// error should be returned.
+	UseEnrollmentToken(ctx context.Context, hash string) (*EnrollmentToken, error)
+}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	apiCredFilePrefix = "APICredential."
+	apiCredFileSuffix = ".json"
+)
+
+// apiCredFilename returns the file path of the API credential named name.
+func (s *FileStorage) apiCredFilename(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty credential name")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", errors.New("invalid credential name")
+	}
+	return path.Join(s.path, apiCredFilePrefix+name+apiCredFileSuffix), nil
+}
+
+// StoreAPICredential writes cred as JSON to disk.
+func (s *FileStorage) StoreAPICredential(_ context.Context, cred *storage.APICredential) error {
+	if cred == nil {
+		return errors.New("nil credential")
+	}
+	filename, err := s.apiCredFilename(cred.Name)
+	if err != nil {
+		return err
+	}
+	credBytes, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, credBytes, 0600)
+}
+
+// RetrieveAPICredential reads the API credential named name from disk.
+func (s *FileStorage) RetrieveAPICredential(_ context.Context, name string) (*storage.APICredential, error) {
+	filename, err := s.apiCredFilename(name)
+	if err != nil {
+		return nil, err
+	}
+	credBytes, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	cred := new(storage.APICredential)
+	return cred, json.Unmarshal(credBytes, cred)
+}
+
+// ListAPICredentials reads all API credentials from disk.
+func (s *FileStorage) ListAPICredentials(ctx context.Context) ([]*storage.APICredential, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var creds []*storage.APICredential
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, apiCredFilePrefix) || !strings.HasSuffix(name, apiCredFileSuffix) {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, apiCredFilePrefix), apiCredFileSuffix)
+		cred, err := s.RetrieveAPICredential(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading credential %s: %w", name, err)
+		} else if cred != nil {
+			creds = append(creds, cred)
+		}
+	}
+	return creds, nil
+}
+
+// DeleteAPICredential removes the API credential named name from disk.
+func (s *FileStorage) DeleteAPICredential(_ context.Context, name string) error {
+	filename, err := s.apiCredFilename(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
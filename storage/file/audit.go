@@ -0,0 +1,69 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const AuditFilename = "Audit.jsonl"
+
+// StoreAuditEntry appends e as a line of JSON to the audit file.
+func (s *FileStorage) StoreAuditEntry(_ context.Context, e *storage.AuditEntry) error {
+	if e == nil {
+		return errors.New("nil audit entry")
+	}
+	entryBytes, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path.Join(s.path, AuditFilename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(entryBytes, '\n'))
+	return err
+}
+
+// RetrieveAuditEntries reads the audit entries matching q from the audit file.
+func (s *FileStorage) RetrieveAuditEntries(_ context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	f, err := os.Open(path.Join(s.path, AuditFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*storage.AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		e := new(storage.AuditEntry)
+		if err = json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("decoding audit entry line %d: %w", line, err)
+		}
+		if q.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if q != nil && q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
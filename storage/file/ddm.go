@@ -0,0 +1,234 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	declFilePrefix       = "Declaration."
+	declSetFilePrefix    = "DeclarationSet."
+	enrDeclSetFilePrefix = "EnrollmentDeclarationSets."
+	declStatusFilePrefix = "DeclarationStatus."
+	ddmFileSuffix        = ".json"
+)
+
+// ddmFilename returns the file path of the DDM JSON file named name with prefix.
+func (s *FileStorage) ddmFilename(prefix, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid name: %s", name)
+	}
+	return path.Join(s.path, prefix+name+ddmFileSuffix), nil
+}
+
+// listDDMNames returns the sorted names of the DDM JSON files with prefix.
+func (s *FileStorage) listDDMNames(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ddmFileSuffix) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ddmFileSuffix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// writeDDMJSON writes v as JSON to the DDM file named name with prefix.
+func (s *FileStorage) writeDDMJSON(prefix, name string, v interface{}) error {
+	filename, err := s.ddmFilename(prefix, name)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0600)
+}
+
+// readDDMJSON reads JSON into v from the DDM file named name with prefix.
+// The returned bool is false if the file does not exist.
+func (s *FileStorage) readDDMJSON(prefix, name string, v interface{}) (bool, error) {
+	filename, err := s.ddmFilename(prefix, name)
+	if err != nil {
+		return false, err
+	}
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// removeDDMFile removes the DDM file named name with prefix.
+func (s *FileStorage) removeDDMFile(prefix, name string) error {
+	filename, err := s.ddmFilename(prefix, name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// sortUnique sorts s and removes empty and duplicate values.
+func sortUnique(s []string) []string {
+	out := make([]string, 0, len(s))
+	seen := make(map[string]struct{})
+	for _, v := range s {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// StoreDeclaration writes d as JSON to disk.
+func (s *FileStorage) StoreDeclaration(_ context.Context, d *storage.Declaration) error {
+	if d == nil {
+		return errors.New("nil declaration")
+	}
+	return s.writeDDMJSON(declFilePrefix, d.Identifier, d)
+}
+
+// RetrieveDeclaration reads the declaration identifier from disk.
+func (s *FileStorage) RetrieveDeclaration(_ context.Context, identifier string) (*storage.Declaration, error) {
+	d := new(storage.Declaration)
+	if ok, err := s.readDDMJSON(declFilePrefix, identifier, d); !ok || err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDeclarations reads all declarations from disk.
+func (s *FileStorage) ListDeclarations(ctx context.Context) ([]*storage.Declaration, error) {
+	identifiers, err := s.listDDMNames(declFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var decls []*storage.Declaration
+	for _, identifier := range identifiers {
+		d, err := s.RetrieveDeclaration(ctx, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("reading declaration %s: %w", identifier, err)
+		} else if d != nil {
+			decls = append(decls, d)
+		}
+	}
+	return decls, nil
+}
+
+// DeleteDeclaration removes the declaration identifier from disk.
+func (s *FileStorage) DeleteDeclaration(_ context.Context, identifier string) error {
+	return s.removeDDMFile(declFilePrefix, identifier)
+}
+
+// StoreDeclarationSet writes the declaration identifiers of the set
+// named name as JSON to disk.
+func (s *FileStorage) StoreDeclarationSet(_ context.Context, name string, identifiers []string) error {
+	identifiers = sortUnique(identifiers)
+	if len(identifiers) < 1 {
+		return s.removeDDMFile(declSetFilePrefix, name)
+	}
+	return s.writeDDMJSON(declSetFilePrefix, name, identifiers)
+}
+
+// RetrieveDeclarationSet reads the declaration identifiers of the set
+// named name from disk.
+func (s *FileStorage) RetrieveDeclarationSet(_ context.Context, name string) ([]string, error) {
+	var identifiers []string
+	_, err := s.readDDMJSON(declSetFilePrefix, name, &identifiers)
+	return identifiers, err
+}
+
+// ListDeclarationSets reads the names of all sets from disk.
+func (s *FileStorage) ListDeclarationSets(_ context.Context) ([]string, error) {
+	return s.listDDMNames(declSetFilePrefix)
+}
+
+// StoreEnrollmentDeclarationSets writes the set names assigned to
+// enrollment id as JSON to disk.
+func (s *FileStorage) StoreEnrollmentDeclarationSets(_ context.Context, id string, sets []string) error {
+	sets = sortUnique(sets)
+	if len(sets) < 1 {
+		return s.removeDDMFile(enrDeclSetFilePrefix, id)
+	}
+	return s.writeDDMJSON(enrDeclSetFilePrefix, id, sets)
+}
+
+// RetrieveEnrollmentDeclarationSets reads the set names assigned to
+// enrollment id from disk.
+func (s *FileStorage) RetrieveEnrollmentDeclarationSets(_ context.Context, id string) ([]string, error) {
+	var sets []string
+	_, err := s.readDDMJSON(enrDeclSetFilePrefix, id, &sets)
+	return sets, err
+}
+
+// ListDeclarationSetEnrollments reads the enrollment IDs assigned the
+// set named name from disk. Note this reads all enrollment assignments.
+func (s *FileStorage) ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error) {
+	ids, err := s.listDDMNames(enrDeclSetFilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, id := range ids {
+		sets, err := s.RetrieveEnrollmentDeclarationSets(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("reading enrollment sets %s: %w", id, err)
+		}
+		for _, set := range sets {
+			if set == name {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// StoreDeclarationStatus writes the status of enrollment id to disk.
+func (s *FileStorage) StoreDeclarationStatus(_ context.Context, id string, status []byte) error {
+	filename, err := s.ddmFilename(declStatusFilePrefix, id)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, status, 0600)
+}
+
+// RetrieveDeclarationStatus reads the status of enrollment id from disk.
+func (s *FileStorage) RetrieveDeclarationStatus(_ context.Context, id string) ([]byte, error) {
+	filename, err := s.ddmFilename(declStatusFilePrefix, id)
+	if err != nil {
+		return nil, err
+	}
+	status, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return status, err
+}
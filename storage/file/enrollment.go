@@ -0,0 +1,146 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// parentEnrollmentID finds the device enrollment ID that the user
+// enrollment id is associated with. An empty string is returned if
+// no association is found.
+func (s *FileStorage) parentEnrollmentID(id string) (string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		_, err = os.Stat(path.Join(s.path, entry.Name(), SubEnrollmentPathname, id))
+		if err == nil {
+			return entry.Name(), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// RetrieveEnrollmentAttributes reads the attributes of enrollment ids
+// from their TokenUpdate and device serial number files.
+func (s *FileStorage) RetrieveEnrollmentAttributes(_ context.Context, ids []string) (map[string]*storage.EnrollmentAttributes, error) {
+	attrs := make(map[string]*storage.EnrollmentAttributes)
+	for _, id := range ids {
+		e := s.newEnrollment(id)
+		tokUpd, err := e.readFile(TokenUpdateFilename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		serial, err := e.readFile(SerialNumberFilename)
+		if errors.Is(err, os.ErrNotExist) {
+			// user channel enrollments have the serial on their device
+			var parentID string
+			if parentID, err = s.parentEnrollmentID(id); err == nil && parentID != "" {
+				serial, err = s.newEnrollment(parentID).readFile(SerialNumberFilename)
+			}
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if attrs[id], err = storage.DecodeEnrollmentAttributes(tokUpd, string(serial)); err != nil {
+			return nil, fmt.Errorf("enrollment attributes for %s: %w", id, err)
+		}
+	}
+	return attrs, nil
+}
+
+// ResolveSerialNumber resolves the enabled enrollment IDs of the
+// channels selected by sel of devices with serial number serial.
+// Note this scans all enrollments.
+func (s *FileStorage) ResolveSerialNumber(ctx context.Context, serial string, sel storage.ChannelSelector) ([]string, error) {
+	if serial == "" {
+		return nil, errors.New("empty serial number")
+	}
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		e := s.newEnrollment(entry.Name())
+		deviceSerial, err := e.readFile(SerialNumberFilename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if string(deviceSerial) != serial {
+			continue
+		}
+		for _, id := range append([]string{entry.Name()}, e.listSubEnrollments()...) {
+			_, err = os.Stat(s.newEnrollment(id).dirPrefix(DisabledFilename))
+			if errors.Is(err, os.ErrNotExist) {
+				ids = append(ids, id)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(ids) < 1 {
+		return nil, nil
+	}
+
+	attrs, err := s.RetrieveEnrollmentAttributes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(attrs), nil
+}
+
+// RetrieveIdentityCerts reads the device identity certificates of
+// enrollment ids. User channel enrollments use their device's certificate.
+func (s *FileStorage) RetrieveIdentityCerts(_ context.Context, ids []string) (map[string]*x509.Certificate, error) {
+	certs := make(map[string]*x509.Certificate)
+	for _, id := range ids {
+		certPEM, err := s.newEnrollment(id).readFile(IdentityCertFilename)
+		if errors.Is(err, os.ErrNotExist) {
+			// user channel enrollments have the certificate on their device
+			var parentID string
+			if parentID, err = s.parentEnrollmentID(id); err == nil {
+				if parentID == "" {
+					continue
+				}
+				certPEM, err = s.newEnrollment(parentID).readFile(IdentityCertFilename)
+			}
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if certs[id], err = cryptoutil.DecodePEMCertificate(certPEM); err != nil {
+			return nil, fmt.Errorf("decoding identity certificate for %s: %w", id, err)
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,74 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	enrollTokenFilePrefix = "EnrollmentToken."
+	enrollTokenFileSuffix = ".json"
+)
+
+// enrollTokenFilename returns the file path of the enrollment token hash.
+func (s *FileStorage) enrollTokenFilename(hash string) (string, error) {
+	if hash == "" {
+		return "", errors.New("empty enrollment token hash")
+	}
+	if strings.ContainsAny(hash, `/\`) {
+		return "", errors.New("invalid enrollment token hash")
+	}
+	return path.Join(s.path, enrollTokenFilePrefix+hash+enrollTokenFileSuffix), nil
+}
+
+// StoreEnrollmentToken writes t as JSON to disk.
+func (s *FileStorage) StoreEnrollmentToken(_ context.Context, t *storage.EnrollmentToken) error {
+	if t == nil {
+		return errors.New("nil enrollment token")
+	}
+	filename, err := s.enrollTokenFilename(t.Hash)
+	if err != nil {
+		return err
+	}
+	tBytes, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, tBytes, 0600)
+}
+
+// UseEnrollmentToken reads and removes the enrollment token hash from disk.
+func (s *FileStorage) UseEnrollmentToken(_ context.Context, hash string) (*storage.EnrollmentToken, error) {
+	filename, err := s.enrollTokenFilename(hash)
+	if err != nil {
+		return nil, err
+	}
+	tBytes, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		// used concurrently
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t := new(storage.EnrollmentToken)
+	if err = json.Unmarshal(tBytes, t); err != nil {
+		return nil, err
+	}
+	if !t.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return t, nil
+}
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	idempotencyFilePrefix = "Idempotency."
+	idempotencyFileSuffix = ".json"
+)
+
+// idempotencyFilename returns the file path of the idempotency record for key.
+func (s *FileStorage) idempotencyFilename(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("empty idempotency key")
+	}
+	if strings.ContainsAny(key, `/\`) {
+		return "", errors.New("invalid idempotency key")
+	}
+	return path.Join(s.path, idempotencyFilePrefix+key+idempotencyFileSuffix), nil
+}
+
+// CreateIdempotencyRecord writes rec as JSON to disk if no unexpired
+// record for rec.Key exists. The record is written to a temporary
+// file and then hard linked into place so that creation is atomic.
+func (s *FileStorage) CreateIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) (bool, error) {
+	if rec == nil {
+		return false, errors.New("nil idempotency record")
+	}
+	filename, err := s.idempotencyFilename(rec.Key)
+	if err != nil {
+		return false, err
+	}
+	recBytes, err := json.Marshal(rec)
+	if err != nil {
+		return false, err
+	}
+	tmp, err := ioutil.TempFile(s.path, idempotencyFilePrefix+"tmp.")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(recBytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.Link(tmp.Name(), filename)
+	if errors.Is(err, os.ErrExist) {
+		// an expired record is removed when retrieved
+		var existing *storage.IdempotencyRecord
+		existing, err = s.RetrieveIdempotencyRecord(ctx, rec.Key)
+		if err != nil || existing != nil {
+			return false, err
+		}
+		err = os.Link(tmp.Name(), filename)
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+	}
+	return err == nil, err
+}
+
+// StoreIdempotencyRecord writes rec as JSON to disk.
+func (s *FileStorage) StoreIdempotencyRecord(_ context.Context, rec *storage.IdempotencyRecord) error {
+	if rec == nil {
+		return errors.New("nil idempotency record")
+	}
+	filename, err := s.idempotencyFilename(rec.Key)
+	if err != nil {
+		return err
+	}
+	recBytes, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, recBytes, 0600)
+}
+
+// RetrieveIdempotencyRecord reads the idempotency record for key from disk.
+// An expired record is removed.
+func (s *FileStorage) RetrieveIdempotencyRecord(_ context.Context, key string) (*storage.IdempotencyRecord, error) {
+	filename, err := s.idempotencyFilename(key)
+	if err != nil {
+		return nil, err
+	}
+	recBytes, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rec := new(storage.IdempotencyRecord)
+	if err = json.Unmarshal(recBytes, rec); err != nil {
+		return nil, err
+	}
+	if !rec.ExpiresAt.After(time.Now()) {
+		if err = os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return rec, nil
+}
+
+// DeleteIdempotencyRecord removes the idempotency record for key from disk.
+func (s *FileStorage) DeleteIdempotencyRecord(_ context.Context, key string) error {
+	filename, err := s.idempotencyFilename(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(filename); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/micromdm/nanomdm/cryptoutil"
 )
@@ -42,6 +43,30 @@ func (s *FileStorage) StorePushCert(ctx context.Context, pemCert, pemKey []byte)
 	return ps.StorePushCert(ctx, pemCert, pemKey)
 }
 
+// ListPushCertTopics lists the topics of the push certs on disk.
+func (s *FileStorage) ListPushCertTopics(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var topics []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == IdentityCertFilename || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+		pemCert, err := ioutil.ReadFile(path.Join(s.path, name))
+		if err != nil {
+			return nil, err
+		}
+		// only consider files named for the topic of their certificate
+		if topic, err := cryptoutil.TopicFromPEMCert(pemCert); err == nil && topic+".pem" == name {
+			topics = append(topics, topic)
+		}
+	}
+	return topics, nil
+}
+
 // PushCertFileStorage is a filesystem-based PushCertStore
 type PushCertFileStorage struct {
 	certFilepath string
@@ -106,3 +131,40 @@ func (s *PushCertFileStorage) StorePushCert(_ context.Context, pemCert, pemKey [
 	}
 	return ioutil.WriteFile(s.keyFilepath, pemKey, 0600)
 }
+
+// pushKeyFilename returns the file path of the push key identified by hash.
+func (s *FileStorage) pushKeyFilename(hash string) string {
+	return path.Join(s.path, "PushKey."+hash+".key")
+}
+
+// StorePushKey writes the PEM private key of an in-progress push certificate request to disk.
+func (s *FileStorage) StorePushKey(_ context.Context, hash string, pemKey []byte) error {
+	if hash == "" {
+		return errors.New("empty hash")
+	}
+	return ioutil.WriteFile(s.pushKeyFilename(hash), pemKey, 0600)
+}
+
+// RetrievePushKey reads the PEM private key of an in-progress push certificate request from disk.
+func (s *FileStorage) RetrievePushKey(_ context.Context, hash string) ([]byte, error) {
+	if hash == "" {
+		return nil, errors.New("empty hash")
+	}
+	pemKey, err := ioutil.ReadFile(s.pushKeyFilename(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return pemKey, err
+}
+
+// DeletePushKey removes the PEM private key of a push certificate request from disk.
+func (s *FileStorage) DeletePushKey(_ context.Context, hash string) error {
+	if hash == "" {
+		return errors.New("empty hash")
+	}
+	err := os.Remove(s.pushKeyFilename(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package file
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"strings"
@@ -82,6 +83,28 @@ func (q *queue) writeResults(uuid string, raw []byte) error {
 	)
 }
 
+// readResults reads the command results for uuid.
+// Nil is returned if no results exist.
+func (q *queue) readResults(uuid string) ([]byte, error) {
+	raw, err := os.ReadFile(path.Join(q.dir(), uuid+".result.plist"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return raw, err
+}
+
+// readCommand reads the command uuid.
+// Nil is returned if the command does not exist.
+func (q *queue) readCommand(uuid string) (*mdm.Command, error) {
+	raw, err := os.ReadFile(path.Join(q.dir(), uuid+".plist"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return mdm.DecodeCommand(raw)
+}
+
 func (q *queue) getNext() (*mdm.Command, error) {
 	entries, err := os.ReadDir(q.dir())
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -196,3 +219,42 @@ func (s *FileStorage) ClearQueue(r *mdm.Request) error {
 	}
 	return nil
 }
+
+// RetrieveCommandResults reads the command results of enrollment ids
+// from the done and NotNow queue directories.
+func (s *FileStorage) RetrieveCommandResults(_ context.Context, uuid string, ids []string) (map[string]*mdm.CommandResults, error) {
+	results := make(map[string]*mdm.CommandResults)
+	for _, id := range ids {
+		e := s.newEnrollment(id)
+		for _, sub := range []string{subDone, subNotNow} {
+			raw, err := e.newQueue(sub).readResults(uuid)
+			if err != nil {
+				return nil, err
+			} else if raw == nil {
+				continue
+			}
+			report, err := mdm.DecodeCommandResults(raw)
+			if err != nil {
+				return nil, fmt.Errorf("decoding results for %s: %w", id, err)
+			}
+			results[id] = report
+			break
+		}
+	}
+	return results, nil
+}
+
+// RetrieveCommandRequestType reads the RequestType of the command with
+// uuid from the queue directories of enrollment id.
+func (s *FileStorage) RetrieveCommandRequestType(_ context.Context, id, uuid string) (string, error) {
+	e := s.newEnrollment(id)
+	for _, sub := range []string{subDone, subQueue, subNotNow, subInactive} {
+		cmd, err := e.newQueue(sub).readCommand(uuid)
+		if err != nil {
+			return "", fmt.Errorf("reading command %s: %w", uuid, err)
+		} else if cmd != nil {
+			return cmd.Command.RequestType, nil
+		}
+	}
+	return "", nil
+}
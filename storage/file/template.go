@@ -0,0 +1,98 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const (
+	cmdTmplFilePrefix = "CommandTemplate."
+	cmdTmplFileSuffix = ".json"
+)
+
+// cmdTmplFilename returns the file path of the command template named name.
+func (s *FileStorage) cmdTmplFilename(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty template name")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", errors.New("invalid template name")
+	}
+	return path.Join(s.path, cmdTmplFilePrefix+name+cmdTmplFileSuffix), nil
+}
+
+// StoreCommandTemplate writes tmpl as JSON to disk.
+func (s *FileStorage) StoreCommandTemplate(_ context.Context, tmpl *storage.CommandTemplate) error {
+	if tmpl == nil {
+		return errors.New("nil template")
+	}
+	filename, err := s.cmdTmplFilename(tmpl.Name)
+	if err != nil {
+		return err
+	}
+	tmplBytes, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, tmplBytes, 0600)
+}
+
+// RetrieveCommandTemplate reads the command template named name from disk.
+func (s *FileStorage) RetrieveCommandTemplate(_ context.Context, name string) (*storage.CommandTemplate, error) {
+	filename, err := s.cmdTmplFilename(name)
+	if err != nil {
+		return nil, err
+	}
+	tmplBytes, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	tmpl := new(storage.CommandTemplate)
+	return tmpl, json.Unmarshal(tmplBytes, tmpl)
+}
+
+// ListCommandTemplates reads all command templates from disk.
+func (s *FileStorage) ListCommandTemplates(ctx context.Context) ([]*storage.CommandTemplate, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var tmpls []*storage.CommandTemplate
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, cmdTmplFilePrefix) || !strings.HasSuffix(name, cmdTmplFileSuffix) {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, cmdTmplFilePrefix), cmdTmplFileSuffix)
+		tmpl, err := s.RetrieveCommandTemplate(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading template %s: %w", name, err)
+		} else if tmpl != nil {
+			tmpls = append(tmpls, tmpl)
+		}
+	}
+	return tmpls, nil
+}
+
+// DeleteCommandTemplate removes the command template named name from disk.
+func (s *FileStorage) DeleteCommandTemplate(_ context.Context, name string) error {
+	filename, err := s.cmdTmplFilename(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
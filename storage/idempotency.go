@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyRecord is the stored result of an API request made with
+// an idempotency key.
+type IdempotencyRecord struct {
+	// Key uniquely identifies the request. It is typically a hash of
+	// the caller-supplied idempotency key and the caller identity.
+	Key string `json:"key"`
+
+	// RequestHash is a hash of the request. It is used to detect the
+	// re-use of a key with a different request.
+	RequestHash string `json:"request_hash"`
+
+	// Status is the HTTP status of the response.
+	// A zero status means the request is still in progress.
+	Status int `json:"status"`
+
+	// Response is the body of the response.
+	Response []byte `json:"response,omitempty"`
+
+	// ExpiresAt is when the record is no longer valid.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IdempotencyStore stores and retrieves the results of API requests
+// made with idempotency keys.
+type IdempotencyStore interface {
+	// CreateIdempotencyRecord stores rec only if no unexpired record
+	// identified by rec.Key exists. Created reports whether rec was
+	// stored. Implementations must make this atomic so that only one
+	// of concurrent callers with the same key creates the record.
+	CreateIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) (created bool, err error)
+
+	// StoreIdempotencyRecord creates or replaces the record identified
+	// by rec.Key. Implementations may remove expired records.
+	StoreIdempotencyRecord(ctx context.Context, rec *IdempotencyRecord) error
+
+	// RetrieveIdempotencyRecord retrieves the record identified by key.
+	// If no record is found or it has expired then a nil record and no
+	// error should be returned.
+	RetrieveIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// DeleteIdempotencyRecord deletes the record identified by key.
+	// Deleting a record that does not exist is not an error.
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+}
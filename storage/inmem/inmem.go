@@ -22,5 +22,6 @@ func New() *InMem {
 		kvtxn.New(kvmap.New()),
 		kvtxn.New(kvmap.New()),
 		kvtxn.New(kvmap.New()),
+		kv.WithAPIBucket(kvtxn.New(kvmap.New())),
 	)}
 }
@@ -0,0 +1,74 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyAPICredPrefix = "apicred"
+
+// StoreAPICredential stores cred as JSON in the API KV store.
+func (s *KV) StoreAPICredential(ctx context.Context, cred *storage.APICredential) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if cred == nil || cred.Name == "" {
+		return errors.New("empty credential name")
+	}
+	credBytes, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, join(keyAPICredPrefix, cred.Name), credBytes)
+}
+
+// RetrieveAPICredential retrieves the API credential named name from the API KV store.
+func (s *KV) RetrieveAPICredential(ctx context.Context, name string) (*storage.APICredential, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	credBytes, err := s.api.Get(ctx, join(keyAPICredPrefix, name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	cred := new(storage.APICredential)
+	return cred, json.Unmarshal(credBytes, cred)
+}
+
+// ListAPICredentials retrieves all API credentials from the API KV store.
+func (s *KV) ListAPICredentials(ctx context.Context) ([]*storage.APICredential, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var creds []*storage.APICredential
+	for _, key := range kv.AllKeysPrefix(ctx, s.api, keyAPICredPrefix+keySep) {
+		cred, err := s.RetrieveAPICredential(ctx, strings.TrimPrefix(key, keyAPICredPrefix+keySep))
+		if err != nil {
+			return nil, fmt.Errorf("retrieving credential: %w", err)
+		} else if cred != nil {
+			creds = append(creds, cred)
+		}
+	}
+	return creds, nil
+}
+
+// DeleteAPICredential deletes the API credential named name from the API KV store.
+func (s *KV) DeleteAPICredential(ctx context.Context, name string) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	err := s.api.Delete(ctx, join(keyAPICredPrefix, name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const keyAuditPrefix = "audit"
+
+// auditKey returns the key of e which sorts by time.
+func auditKey(e *storage.AuditEntry) string {
+	return join(keyAuditPrefix, fmt.Sprintf("%020d", e.Time.UnixNano()), e.ID)
+}
+
+// StoreAuditEntry stores e as JSON in the API KV store.
+func (s *KV) StoreAuditEntry(ctx context.Context, e *storage.AuditEntry) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if e == nil || e.ID == "" {
+		return errors.New("empty audit entry id")
+	}
+	entryBytes, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, auditKey(e), entryBytes)
+}
+
+// RetrieveAuditEntries retrieves audit entries matching q from the API KV store.
+// Note all audit keys are traversed to find matching entries.
+func (s *KV) RetrieveAuditEntries(ctx context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var keys []string
+	for key := range s.api.KeysPrefix(ctx, keyAuditPrefix+keySep, nil) {
+		keys = append(keys, key)
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	var entries []*storage.AuditEntry
+	for _, key := range keys {
+		if q != nil && q.Limit > 0 && len(entries) >= q.Limit {
+			break
+		}
+		entryBytes, err := s.api.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("getting audit entry %s: %w", key, err)
+		}
+		e := new(storage.AuditEntry)
+		if err = json.Unmarshal(entryBytes, e); err != nil {
+			return nil, fmt.Errorf("decoding audit entry %s: %w", key, err)
+		}
+		if q.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,221 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const (
+	keyDeclarationPrefix           = "ddmdecl"
+	keyDeclarationSetPrefix        = "ddmset"
+	keyEnrollmentDeclarationSetPfx = "ddmenrset"
+	keyDeclarationStatusPrefix     = "ddmstatus"
+)
+
+// StoreDeclaration stores d as JSON in the API KV store.
+func (s *KV) StoreDeclaration(ctx context.Context, d *storage.Declaration) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if d == nil || d.Identifier == "" {
+		return errors.New("empty declaration identifier")
+	}
+	dBytes, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, join(keyDeclarationPrefix, d.Identifier), dBytes)
+}
+
+// RetrieveDeclaration retrieves the declaration identifier from the API KV store.
+func (s *KV) RetrieveDeclaration(ctx context.Context, identifier string) (*storage.Declaration, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	dBytes, err := s.api.Get(ctx, join(keyDeclarationPrefix, identifier))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	d := new(storage.Declaration)
+	return d, json.Unmarshal(dBytes, d)
+}
+
+// ListDeclarations retrieves all declarations from the API KV store.
+func (s *KV) ListDeclarations(ctx context.Context) ([]*storage.Declaration, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var decls []*storage.Declaration
+	for _, key := range kv.AllKeysPrefix(ctx, s.api, keyDeclarationPrefix+keySep) {
+		d, err := s.RetrieveDeclaration(ctx, strings.TrimPrefix(key, keyDeclarationPrefix+keySep))
+		if err != nil {
+			return nil, fmt.Errorf("retrieving declaration: %w", err)
+		} else if d != nil {
+			decls = append(decls, d)
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Identifier < decls[j].Identifier })
+	return decls, nil
+}
+
+// DeleteDeclaration deletes the declaration identifier from the API KV store.
+func (s *KV) DeleteDeclaration(ctx context.Context, identifier string) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	err := s.api.Delete(ctx, join(keyDeclarationPrefix, identifier))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+// setList stores the sorted, de-duplicated list as JSON at key in the
+// API KV store. An empty list deletes key.
+func (s *KV) setList(ctx context.Context, key string, list []string) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	list = sortUnique(list)
+	if len(list) < 1 {
+		err := s.api.Delete(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, key, listBytes)
+}
+
+// getList retrieves the JSON list at key in the API KV store.
+func (s *KV) getList(ctx context.Context, key string) ([]string, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	listBytes, err := s.api.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var list []string
+	return list, json.Unmarshal(listBytes, &list)
+}
+
+// sortUnique sorts s and removes empty and duplicate values.
+func sortUnique(s []string) []string {
+	out := make([]string, 0, len(s))
+	seen := make(map[string]struct{})
+	for _, v := range s {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// StoreDeclarationSet stores the declaration identifiers of the set
+// named name as a JSON list in the API KV store.
+func (s *KV) StoreDeclarationSet(ctx context.Context, name string, identifiers []string) error {
+	if name == "" {
+		return errors.New("empty set name")
+	}
+	return s.setList(ctx, join(keyDeclarationSetPrefix, name), identifiers)
+}
+
+// RetrieveDeclarationSet retrieves the declaration identifiers of the
+// set named name from the API KV store.
+func (s *KV) RetrieveDeclarationSet(ctx context.Context, name string) ([]string, error) {
+	return s.getList(ctx, join(keyDeclarationSetPrefix, name))
+}
+
+// ListDeclarationSets retrieves the names of all sets from the API KV store.
+func (s *KV) ListDeclarationSets(ctx context.Context) ([]string, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var names []string
+	for _, key := range kv.AllKeysPrefix(ctx, s.api, keyDeclarationSetPrefix+keySep) {
+		names = append(names, strings.TrimPrefix(key, keyDeclarationSetPrefix+keySep))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// StoreEnrollmentDeclarationSets stores the set names assigned to
+// enrollment id as a JSON list in the API KV store.
+func (s *KV) StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string) error {
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	return s.setList(ctx, join(keyEnrollmentDeclarationSetPfx, id), sets)
+}
+
+// RetrieveEnrollmentDeclarationSets retrieves the set names assigned
+// to enrollment id from the API KV store.
+func (s *KV) RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) ([]string, error) {
+	return s.getList(ctx, join(keyEnrollmentDeclarationSetPfx, id))
+}
+
+// ListDeclarationSetEnrollments retrieves the enrollment IDs assigned
+// the set named name. Note this scans all enrollment assignments.
+func (s *KV) ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var ids []string
+	for _, key := range kv.AllKeysPrefix(ctx, s.api, keyEnrollmentDeclarationSetPfx+keySep) {
+		sets, err := s.getList(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, set := range sets {
+			if set == name {
+				ids = append(ids, strings.TrimPrefix(key, keyEnrollmentDeclarationSetPfx+keySep))
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// StoreDeclarationStatus stores the status of enrollment id in the API KV store.
+func (s *KV) StoreDeclarationStatus(ctx context.Context, id string, status []byte) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	return s.api.Set(ctx, join(keyDeclarationStatusPrefix, id), status)
+}
+
+// RetrieveDeclarationStatus retrieves the status of enrollment id from the API KV store.
+func (s *KV) RetrieveDeclarationStatus(ctx context.Context, id string) ([]byte, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	status, err := s.api.Get(ctx, join(keyDeclarationStatusPrefix, id))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return status, err
+}
@@ -0,0 +1,123 @@
+package kv
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+// RetrieveEnrollmentAttributes retrieves the attributes of enrollment
+// ids from their stored TokenUpdate and device serial number.
+func (s *KV) RetrieveEnrollmentAttributes(ctx context.Context, ids []string) (map[string]*storage.EnrollmentAttributes, error) {
+	attrs := make(map[string]*storage.EnrollmentAttributes)
+	for _, id := range ids {
+		deviceID := id
+		var tokUpd []byte
+		parentID, err := s.users.Get(ctx, join(id, keyUserDeviceChannel))
+		if err == nil {
+			// a user channel enrollment
+			deviceID = string(parentID)
+			tokUpd, err = s.users.Get(ctx, join(id, keyUserTokenUpdate))
+		} else if errors.Is(err, kv.ErrKeyNotFound) {
+			tokUpd, err = s.devices.Get(ctx, join(id, keyDeviceTokenUpdate))
+		}
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("getting token update for %s: %w", id, err)
+		}
+
+		serial, err := s.devices.Get(ctx, join(deviceID, keyDeviceSerial))
+		if err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return nil, fmt.Errorf("getting serial number for %s: %w", id, err)
+		}
+
+		if attrs[id], err = storage.DecodeEnrollmentAttributes(tokUpd, string(serial)); err != nil {
+			return nil, fmt.Errorf("enrollment attributes for %s: %w", id, err)
+		}
+	}
+	return attrs, nil
+}
+
+// ResolveSerialNumber resolves the enabled enrollment IDs of the
+// channels selected by sel of devices with serial number serial.
+// Note this scans all devices.
+func (s *KV) ResolveSerialNumber(ctx context.Context, serial string, sel storage.ChannelSelector) ([]string, error) {
+	if serial == "" {
+		return nil, errors.New("empty serial number")
+	}
+	var deviceIDs []string
+	for key := range s.devices.Keys(ctx, nil) {
+		if !strings.HasSuffix(key, keySep+keyDeviceSerial) {
+			continue
+		}
+		id := key[0 : len(key)-(len(keySep)+len(keyDeviceSerial))]
+		deviceSerial, err := s.devices.Get(ctx, key)
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("getting serial number for %s: %w", id, err)
+		}
+		if string(deviceSerial) == serial {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+
+	var ids []string
+	for _, id := range deviceIDs {
+		candidates := []string{id}
+		pfx := join(id, keyEnrollmentUserChannel) + keySep
+		for key := range s.enrollments.KeysPrefix(ctx, pfx, nil) {
+			candidates = append(candidates, key[len(pfx):])
+		}
+		for _, id := range candidates {
+			if disabled, err := s.enrollments.Has(ctx, join(id, keyEnrollmentDisabled)); err != nil {
+				return nil, fmt.Errorf("checking for disablement for %s: %w", id, err)
+			} else if !disabled {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) < 1 {
+		return nil, nil
+	}
+
+	attrs, err := s.RetrieveEnrollmentAttributes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(attrs), nil
+}
+
+// RetrieveIdentityCerts retrieves the device identity certificates of
+// enrollment ids. User channel enrollments use their device's certificate.
+func (s *KV) RetrieveIdentityCerts(ctx context.Context, ids []string) (map[string]*x509.Certificate, error) {
+	certs := make(map[string]*x509.Certificate)
+	for _, id := range ids {
+		deviceID := id
+		parentID, err := s.users.Get(ctx, join(id, keyUserDeviceChannel))
+		if err == nil {
+			deviceID = string(parentID)
+		} else if !errors.Is(err, kv.ErrKeyNotFound) {
+			return nil, fmt.Errorf("getting device channel for %s: %w", id, err)
+		}
+
+		certDER, err := s.devices.Get(ctx, join(deviceID, keyDeviceCert))
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("getting identity certificate for %s: %w", id, err)
+		}
+
+		if certs[id], err = x509.ParseCertificate(certDER); err != nil {
+			return nil, fmt.Errorf("parsing identity certificate for %s: %w", id, err)
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,59 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyEnrollmentTokenPrefix = "enrolltoken"
+
+// StoreEnrollmentToken stores t as JSON in the API KV store.
+func (s *KV) StoreEnrollmentToken(ctx context.Context, t *storage.EnrollmentToken) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if t == nil || t.Hash == "" {
+		return errors.New("empty enrollment token hash")
+	}
+	tBytes, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, join(keyEnrollmentTokenPrefix, t.Hash), tBytes)
+}
+
+// UseEnrollmentToken retrieves and deletes the enrollment token hash
+// from the API KV store.
+// The retrieval and deletion are serialized so that concurrent uses of
+// the same token can not both succeed.
+func (s *KV) UseEnrollmentToken(ctx context.Context, hash string) (*storage.EnrollmentToken, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	s.enrollTokenMu.Lock()
+	defer s.enrollTokenMu.Unlock()
+	key := join(keyEnrollmentTokenPrefix, hash)
+	tBytes, err := s.api.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = s.api.Delete(ctx, key); err != nil {
+		return nil, err
+	}
+	t := new(storage.EnrollmentToken)
+	if err = json.Unmarshal(tBytes, t); err != nil {
+		return nil, err
+	}
+	if !t.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return t, nil
+}
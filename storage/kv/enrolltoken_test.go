@@ -0,0 +1,65 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+	"github.com/micromdm/nanolib/storage/kv/kvmap"
+	"github.com/micromdm/nanolib/storage/kv/kvtxn"
+)
+
+// slowGetBucket delays returning from Get so that concurrent callers overlap.
+type slowGetBucket struct {
+	kv.TxnBucketWithCRUD
+}
+
+func (b *slowGetBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return b.TxnBucketWithCRUD.Get(ctx, key)
+}
+
+func TestUseEnrollmentTokenConcurrently(t *testing.T) {
+	ctx := context.Background()
+	newBucket := func() kv.TxnBucketWithCRUD { return kvtxn.New(kvmap.New()) }
+	s := New(
+		newBucket(), newBucket(), newBucket(), newBucket(), newBucket(), newBucket(),
+		WithAPIBucket(&slowGetBucket{newBucket()}),
+	)
+
+	tok := &storage.EnrollmentToken{Hash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.StoreEnrollmentToken(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	used := make(chan bool, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := s.UseEnrollmentToken(ctx, "hash")
+			if err != nil {
+				t.Error(err)
+			}
+			used <- tok != nil
+		}()
+	}
+	wg.Wait()
+	close(used)
+
+	var uses int
+	for u := range used {
+		if u {
+			uses++
+		}
+	}
+	if have, want := uses, 1; have != want {
+		t.Errorf("uses: have: %v, want: %v", have, want)
+	}
+}
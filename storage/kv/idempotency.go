@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyIdempotencyPrefix = "idempotency"
+
+// CreateIdempotencyRecord stores rec as JSON in the API KV store if
+// no unexpired record for rec.Key exists.
+func (s *KV) CreateIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) (bool, error) {
+	if s.api == nil {
+		return false, ErrNoAPIBucket
+	}
+	if rec == nil || rec.Key == "" {
+		return false, errors.New("empty idempotency key")
+	}
+	s.idemMu.Lock()
+	defer s.idemMu.Unlock()
+	existing, err := s.RetrieveIdempotencyRecord(ctx, rec.Key)
+	if err != nil || existing != nil {
+		return false, err
+	}
+	return true, s.StoreIdempotencyRecord(ctx, rec)
+}
+
+// StoreIdempotencyRecord stores rec as JSON in the API KV store.
+func (s *KV) StoreIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if rec == nil || rec.Key == "" {
+		return errors.New("empty idempotency key")
+	}
+	recBytes, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, join(keyIdempotencyPrefix, rec.Key), recBytes)
+}
+
+// RetrieveIdempotencyRecord retrieves the idempotency record for key
+// from the API KV store. An expired record is deleted.
+func (s *KV) RetrieveIdempotencyRecord(ctx context.Context, key string) (*storage.IdempotencyRecord, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	recBytes, err := s.api.Get(ctx, join(keyIdempotencyPrefix, key))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rec := new(storage.IdempotencyRecord)
+	if err = json.Unmarshal(recBytes, rec); err != nil {
+		return nil, err
+	}
+	if !rec.ExpiresAt.After(time.Now()) {
+		err = s.api.Delete(ctx, join(keyIdempotencyPrefix, key))
+		if err != nil && !errors.Is(err, kv.ErrKeyNotFound) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return rec, nil
+}
+
+// DeleteIdempotencyRecord deletes the idempotency record for key from
+// the API KV store.
+func (s *KV) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	err := s.api.Delete(ctx, join(keyIdempotencyPrefix, key))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -2,8 +2,10 @@
 package kv
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/micromdm/nanolib/storage/kv"
@@ -25,14 +27,39 @@ func join(s ...string) string {
 type KV struct {
 	certAuth, queue, pushCert, users kv.TxnCRUDBucket
 	devices, enrollments             kv.TxnBucketWithCRUD
+
+	// api stores API-related data such as API credentials.
+	api kv.TxnBucketWithCRUD
+
+	// enrollTokenMu serializes using one-time enrollment tokens.
+	enrollTokenMu sync.Mutex
+
+	// idemMu serializes creating idempotency records.
+	idemMu sync.Mutex
 }
 
+// Option configures the key-value storage backend.
+type Option func(*KV)
+
+// WithAPIBucket configures the bucket used for storing API-related
+// data such as API credentials. Without it those operations return
+// [ErrNoAPIBucket].
+func WithAPIBucket(api kv.TxnBucketWithCRUD) Option {
+	return func(s *KV) {
+		s.api = api
+	}
+}
+
+// ErrNoAPIBucket is returned by API-related storage operations when
+// no API bucket is configured.
+var ErrNoAPIBucket = errors.New("no API bucket configured")
+
 // New creates a new NanoMDM storage backend that uses key-value stores.
-func New(users, certAuth, queue, pushCert kv.TxnCRUDBucket, devices, enrollments kv.TxnBucketWithCRUD) *KV {
+func New(users, certAuth, queue, pushCert kv.TxnCRUDBucket, devices, enrollments kv.TxnBucketWithCRUD, opts ...Option) *KV {
 	if devices == nil || users == nil || certAuth == nil || queue == nil || pushCert == nil || enrollments == nil {
 		panic("nil bucket")
 	}
-	return &KV{
+	s := &KV{
 		devices:     devices,
 		users:       users,
 		enrollments: enrollments,
@@ -40,6 +67,10 @@ func New(users, certAuth, queue, pushCert kv.TxnCRUDBucket, devices, enrollments
 		queue:       queue,
 		pushCert:    pushCert,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // timeFmt returns a string representation of microseconds since Unix epoch.
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/micromdm/nanolib/storage/kv"
 	"github.com/micromdm/nanomdm/cryptoutil"
@@ -15,6 +16,8 @@ const (
 	keyPushCertPEM        = "pem"
 	keyPushCertKey        = "key"
 	keyPushCertStaleToken = "stale_token"
+
+	keyPushKeyPrefix = "push_key"
 )
 
 // RetrievePushCert validates the freshness of the APNs push cert with topic from the KV store.
@@ -74,3 +77,42 @@ func (s *KV) StorePushCert(ctx context.Context, pemCert, pemKey []byte) error {
 		})
 	})
 }
+
+// StorePushKey stores the PEM private key of an in-progress push certificate request.
+func (s *KV) StorePushKey(ctx context.Context, hash string, pemKey []byte) error {
+	return s.pushCert.Set(ctx, join(keyPushKeyPrefix, hash), pemKey)
+}
+
+// RetrievePushKey retrieves the PEM private key of an in-progress push certificate request.
+func (s *KV) RetrievePushKey(ctx context.Context, hash string) ([]byte, error) {
+	pemKey, err := s.pushCert.Get(ctx, join(keyPushKeyPrefix, hash))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return pemKey, err
+}
+
+// DeletePushKey deletes the PEM private key of a push certificate request.
+func (s *KV) DeletePushKey(ctx context.Context, hash string) error {
+	err := s.pushCert.Delete(ctx, join(keyPushKeyPrefix, hash))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ListPushCertTopics lists the topics of the push certs in the KV store.
+// The push cert bucket must support traversing keys.
+func (s *KV) ListPushCertTopics(ctx context.Context) ([]string, error) {
+	b, ok := s.pushCert.(kv.KeysPrefixTraverser)
+	if !ok {
+		return nil, errors.New("push cert bucket does not support listing keys")
+	}
+	var topics []string
+	for _, key := range kv.AllKeysPrefix(ctx, b, "") {
+		if topic := strings.TrimSuffix(key, keySep+keyPushCertPEM); topic != key {
+			topics = append(topics, topic)
+		}
+	}
+	return topics, nil
+}
@@ -136,3 +136,34 @@ func (s *KV) EnqueueCommand(ctx context.Context, ids []string, cmd *mdm.Command)
 	})
 	return errs, err
 }
+
+// RetrieveCommandResults retrieves the command results of enrollment ids
+// from the raw reports kept in each enrollment queue.
+func (s *KV) RetrieveCommandResults(ctx context.Context, uuid string, ids []string) (map[string]*mdm.CommandResults, error) {
+	results := make(map[string]*mdm.CommandResults)
+	for _, id := range ids {
+		q := newQueue(s.queue, id, primaryQueue)
+		raw, err := s.queue.Get(ctx, q.itemKeyName(uuid, keyQueueReport))
+		if errors.Is(err, kv.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("getting command report: %s: %w", uuid, err)
+		}
+		report, err := mdm.DecodeCommandResults(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decoding results for %s: %w", id, err)
+		}
+		results[id] = report
+	}
+	return results, nil
+}
+
+// RetrieveCommandRequestType retrieves the RequestType of the command
+// with uuid. Commands are stored once for all enrollments so id is unused.
+func (s *KV) RetrieveCommandRequestType(ctx context.Context, _, uuid string) (string, error) {
+	reqType, err := s.queue.Get(ctx, join(uuid, keyQueueRequestType))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return "", nil
+	}
+	return string(reqType), err
+}
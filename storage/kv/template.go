@@ -0,0 +1,74 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyCommandTemplatePrefix = "cmdtemplate"
+
+// StoreCommandTemplate stores tmpl as JSON in the API KV store.
+func (s *KV) StoreCommandTemplate(ctx context.Context, tmpl *storage.CommandTemplate) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	if tmpl == nil || tmpl.Name == "" {
+		return errors.New("empty template name")
+	}
+	tmplBytes, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	return s.api.Set(ctx, join(keyCommandTemplatePrefix, tmpl.Name), tmplBytes)
+}
+
+// RetrieveCommandTemplate retrieves the command template named name from the API KV store.
+func (s *KV) RetrieveCommandTemplate(ctx context.Context, name string) (*storage.CommandTemplate, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	tmplBytes, err := s.api.Get(ctx, join(keyCommandTemplatePrefix, name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	tmpl := new(storage.CommandTemplate)
+	return tmpl, json.Unmarshal(tmplBytes, tmpl)
+}
+
+// ListCommandTemplates retrieves all command templates from the API KV store.
+func (s *KV) ListCommandTemplates(ctx context.Context) ([]*storage.CommandTemplate, error) {
+	if s.api == nil {
+		return nil, ErrNoAPIBucket
+	}
+	var tmpls []*storage.CommandTemplate
+	for _, key := range kv.AllKeysPrefix(ctx, s.api, keyCommandTemplatePrefix+keySep) {
+		tmpl, err := s.RetrieveCommandTemplate(ctx, strings.TrimPrefix(key, keyCommandTemplatePrefix+keySep))
+		if err != nil {
+			return nil, fmt.Errorf("retrieving template: %w", err)
+		} else if tmpl != nil {
+			tmpls = append(tmpls, tmpl)
+		}
+	}
+	return tmpls, nil
+}
+
+// DeleteCommandTemplate deletes the command template named name from the API KV store.
+func (s *KV) DeleteCommandTemplate(ctx context.Context, name string) error {
+	if s.api == nil {
+		return ErrNoAPIBucket
+	}
+	err := s.api.Delete(ctx, join(keyCommandTemplatePrefix, name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// StoreAuditEntry stores e. The entry time is recorded by the database.
+func (s *MySQLStorage) StoreAuditEntry(ctx context.Context, e *storage.AuditEntry) error {
+	if e == nil || e.ID == "" {
+		return errors.New("empty audit entry id")
+	}
+	ids := e.EnrollmentIDs
+	if ids == nil {
+		ids = []string{}
+	}
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	details := e.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx, `
+INSERT INTO audit_log
+    (id, actor, source_ip, trace_id, action, enrollment_ids, command_uuid, request_type, topic, details, outcome, status)
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		e.ID, e.Actor, e.SourceIP, e.TraceID, e.Action, string(idsJSON),
+		e.CommandUUID, e.RequestType, e.Topic, string(detailsJSON), e.Outcome, e.Status,
+	)
+	return err
+}
+
+func (s *MySQLStorage) RetrieveAuditEntries(ctx context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	if q == nil {
+		q = new(storage.AuditQuery)
+	}
+	var where []string
+	var args []interface{}
+	if q.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, q.Action)
+	}
+	if q.CommandUUID != "" {
+		where = append(where, "command_uuid = ?")
+		args = append(args, q.CommandUUID)
+	}
+	if q.EnrollmentID != "" {
+		where = append(where, "JSON_CONTAINS(enrollment_ids, JSON_QUOTE(?))")
+		args = append(args, q.EnrollmentID)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "created_at >= FROM_UNIXTIME(?)")
+		args = append(args, q.Since.Unix())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "created_at <= FROM_UNIXTIME(?)")
+		args = append(args, q.Until.Unix())
+	}
+	query := `SELECT id, UNIX_TIMESTAMP(created_at), actor, source_ip, trace_id, action, enrollment_ids, command_uuid, request_type, topic, details, outcome, status FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY seq DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*storage.AuditEntry
+	for rows.Next() {
+		e := new(storage.AuditEntry)
+		var createdAt int64
+		var ids, details []byte
+		if err = rows.Scan(
+			&e.ID, &createdAt, &e.Actor, &e.SourceIP, &e.TraceID, &e.Action, &ids,
+			&e.CommandUUID, &e.RequestType, &e.Topic, &details, &e.Outcome, &e.Status,
+		); err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(createdAt, 0)
+		if err = json.Unmarshal(ids, &e.EnrollmentIDs); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+		if len(e.EnrollmentIDs) < 1 {
+			e.EnrollmentIDs = nil
+		}
+		if len(e.Details) < 1 {
+			e.Details = nil
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,206 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const declSelect = `SELECT identifier, type, server_token, declaration, UNIX_TIMESTAMP(created_at), UNIX_TIMESTAMP(updated_at) FROM ddm_declarations`
+
+// StoreDeclaration stores d. The created_at and updated_at
+// timestamps are managed by the database.
+func (s *MySQLStorage) StoreDeclaration(ctx context.Context, d *storage.Declaration) error {
+	if d == nil || d.Identifier == "" {
+		return errors.New("empty declaration identifier")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO ddm_declarations
+    (identifier, type, server_token, declaration)
+VALUES
+    (?, ?, ?, ?) AS new
+ON DUPLICATE KEY
+UPDATE
+    type = new.type,
+    server_token = new.server_token,
+    declaration = new.declaration;`,
+		d.Identifier, d.Type, d.ServerToken, d.Raw,
+	)
+	return err
+}
+
+// scanDeclaration scans a row selected with declSelect.
+func scanDeclaration(scan func(...interface{}) error) (*storage.Declaration, error) {
+	d := new(storage.Declaration)
+	var createdAt, updatedAt int64
+	if err := scan(&d.Identifier, &d.Type, &d.ServerToken, &d.Raw, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = time.Unix(createdAt, 0)
+	d.UpdatedAt = time.Unix(updatedAt, 0)
+	return d, nil
+}
+
+func (s *MySQLStorage) RetrieveDeclaration(ctx context.Context, identifier string) (*storage.Declaration, error) {
+	d, err := scanDeclaration(s.db.QueryRowContext(
+		ctx,
+		declSelect+` WHERE identifier = ?;`,
+		identifier,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (s *MySQLStorage) ListDeclarations(ctx context.Context) ([]*storage.Declaration, error) {
+	rows, err := s.db.QueryContext(ctx, declSelect+` ORDER BY identifier;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var decls []*storage.Declaration
+	for rows.Next() {
+		d, err := scanDeclaration(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, d)
+	}
+	return decls, rows.Err()
+}
+
+func (s *MySQLStorage) DeleteDeclaration(ctx context.Context, identifier string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ddm_declarations WHERE identifier = ?;`, identifier)
+	return err
+}
+
+// replaceRows replaces the values of valueCol for rows where keyCol is
+// key in table in a single transaction.
+func (s *MySQLStorage) replaceRows(ctx context.Context, table, keyCol, valueCol, key string, values []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+keyCol+` = ?;`, key)
+		if err != nil || len(values) < 1 {
+			return err
+		}
+		args := make([]interface{}, 0, len(values)*2)
+		for _, v := range values {
+			args = append(args, key, v)
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT IGNORE INTO `+table+` (`+keyCol+`, `+valueCol+`) VALUES (?, ?)`+
+				strings.Repeat(", (?, ?)", len(values)-1)+`;`,
+			args...,
+		)
+		return err
+	}()
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("rollback error: %w; while trying to handle error: %v", rbErr, err)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryStrings returns the single string column of the rows of query.
+func (s *MySQLStorage) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (s *MySQLStorage) StoreDeclarationSet(ctx context.Context, name string, identifiers []string) error {
+	if name == "" {
+		return errors.New("empty set name")
+	}
+	return s.replaceRows(ctx, "ddm_set_declarations", "set_name", "declaration_identifier", name, identifiers)
+}
+
+func (s *MySQLStorage) RetrieveDeclarationSet(ctx context.Context, name string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT declaration_identifier FROM ddm_set_declarations WHERE set_name = ? ORDER BY declaration_identifier;`,
+		name,
+	)
+}
+
+func (s *MySQLStorage) ListDeclarationSets(ctx context.Context) ([]string, error) {
+	return s.queryStrings(ctx, `SELECT DISTINCT set_name FROM ddm_set_declarations ORDER BY set_name;`)
+}
+
+func (s *MySQLStorage) StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string) error {
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	return s.replaceRows(ctx, "ddm_enrollment_sets", "enrollment_id", "set_name", id, sets)
+}
+
+func (s *MySQLStorage) RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT set_name FROM ddm_enrollment_sets WHERE enrollment_id = ? ORDER BY set_name;`,
+		id,
+	)
+}
+
+func (s *MySQLStorage) ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT enrollment_id FROM ddm_enrollment_sets WHERE set_name = ? ORDER BY enrollment_id;`,
+		name,
+	)
+}
+
+func (s *MySQLStorage) StoreDeclarationStatus(ctx context.Context, id string, status []byte) error {
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO ddm_statuses
+    (enrollment_id, status)
+VALUES
+    (?, ?) AS new
+ON DUPLICATE KEY
+UPDATE
+    status = new.status;`,
+		id, status,
+	)
+	return err
+}
+
+func (s *MySQLStorage) RetrieveDeclarationStatus(ctx context.Context, id string) ([]byte, error) {
+	var status []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT status FROM ddm_statuses WHERE enrollment_id = ?;`,
+		id,
+	).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return status, err
+}
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// StoreEnrollmentToken stores t. Expired tokens are removed.
+func (s *MySQLStorage) StoreEnrollmentToken(ctx context.Context, t *storage.EnrollmentToken) error {
+	if t == nil || t.Hash == "" {
+		return errors.New("empty enrollment token hash")
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM enrollment_tokens WHERE expires_at <= CURRENT_TIMESTAMP;`,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO enrollment_tokens (token_hash, label, expires_at) VALUES (?, ?, FROM_UNIXTIME(?));`,
+		t.Hash, nullEmptyString(t.Label), t.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+// UseEnrollmentToken retrieves and deletes the token identified by hash.
+func (s *MySQLStorage) UseEnrollmentToken(ctx context.Context, hash string) (*storage.EnrollmentToken, error) {
+	t := &storage.EnrollmentToken{Hash: hash}
+	var label sql.NullString
+	var expiresAt int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT label, UNIX_TIMESTAMP(expires_at) FROM enrollment_tokens WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP;`,
+		hash,
+	).Scan(&label, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM enrollment_tokens WHERE token_hash = ?;`, hash)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n < 1 {
+		// used concurrently
+		return nil, nil
+	}
+	t.Label = label.String
+	t.ExpiresAt = time.Unix(expiresAt, 0)
+	return t, nil
+}
@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// idempotencyPurgeInterval is the minimum time between removals of
+// expired idempotency records.
+const idempotencyPurgeInterval = time.Hour
+
+// purgeExpiredIdempotencyRecords removes expired idempotency records
+// at most once every idempotencyPurgeInterval.
+func (s *MySQLStorage) purgeExpiredIdempotencyRecords(ctx context.Context) {
+	s.idemPurgeMu.Lock()
+	if time.Since(s.idemPurgedAt) < idempotencyPurgeInterval {
+		s.idemPurgeMu.Unlock()
+		return
+	}
+	s.idemPurgedAt = time.Now()
+	s.idemPurgeMu.Unlock()
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE expires_at <= CURRENT_TIMESTAMP;`,
+	)
+	if err != nil {
+		ctxlog.Logger(ctx, s.logger).Info("msg", "purging expired idempotency records", "err", err)
+	}
+}
+
+// CreateIdempotencyRecord stores rec if no unexpired record for rec.Key exists.
+func (s *MySQLStorage) CreateIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) (bool, error) {
+	if rec == nil || rec.Key == "" {
+		return false, errors.New("empty idempotency key")
+	}
+	go s.purgeExpiredIdempotencyRecords(context.Background())
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE idempotency_key = ? AND expires_at <= CURRENT_TIMESTAMP;`,
+		rec.Key,
+	)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(
+		ctx, `
+INSERT IGNORE INTO idempotency_records
+    (idempotency_key, request_hash, status, response, expires_at)
+VALUES
+    (?, ?, ?, ?, FROM_UNIXTIME(?));`,
+		rec.Key, rec.RequestHash, rec.Status, rec.Response, rec.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// StoreIdempotencyRecord stores rec.
+func (s *MySQLStorage) StoreIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) error {
+	if rec == nil || rec.Key == "" {
+		return errors.New("empty idempotency key")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO idempotency_records
+    (idempotency_key, request_hash, status, response, expires_at)
+VALUES
+    (?, ?, ?, ?, FROM_UNIXTIME(?)) AS new
+ON DUPLICATE KEY
+UPDATE
+    request_hash = new.request_hash,
+    status = new.status,
+    response = new.response,
+    expires_at = new.expires_at;`,
+		rec.Key, rec.RequestHash, rec.Status, rec.Response, rec.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+func (s *MySQLStorage) RetrieveIdempotencyRecord(ctx context.Context, key string) (*storage.IdempotencyRecord, error) {
+	rec := &storage.IdempotencyRecord{Key: key}
+	var expiresAt int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT request_hash, status, response, UNIX_TIMESTAMP(expires_at) FROM idempotency_records WHERE idempotency_key = ? AND expires_at > CURRENT_TIMESTAMP;`,
+		key,
+	).Scan(&rec.RequestHash, &rec.Status, &rec.Response, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rec.ExpiresAt = time.Unix(expiresAt, 0)
+	return rec, nil
+}
+
+func (s *MySQLStorage) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE idempotency_key = ?;`,
+		key,
+	)
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/micromdm/nanomdm/cryptoutil"
@@ -36,6 +37,9 @@ type MySQLStorage struct {
 	logger log.Logger
 	db     *sql.DB
 	rm     bool
+
+	idemPurgeMu  sync.Mutex
+	idemPurgedAt time.Time
 }
 
 type config struct {
@@ -3,6 +3,8 @@ package mysql
 import (
 	"context"
 	"crypto/tls"
+	"database/sql"
+	"errors"
 	"strconv"
 
 	"github.com/micromdm/nanomdm/cryptoutil"
@@ -40,6 +42,23 @@ func (s *MySQLStorage) IsPushCertStale(ctx context.Context, topic, staleToken st
 	return dbStaleToken != staleTokenInt, err
 }
 
+func (s *MySQLStorage) ListPushCertTopics(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT topic FROM push_certs;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var topics []string
+	for rows.Next() {
+		var topic string
+		if err = rows.Scan(&topic); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	return topics, rows.Err()
+}
+
 func (s *MySQLStorage) StorePushCert(ctx context.Context, pemCert, pemKey []byte) error {
 	topic, err := cryptoutil.TopicFromPEMCert(pemCert)
 	if err != nil {
@@ -60,3 +79,40 @@ UPDATE
 	)
 	return err
 }
+
+func (s *MySQLStorage) StorePushKey(ctx context.Context, hash string, pemKey []byte) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO push_keys
+    (pubkey_sha256, key_pem)
+VALUES
+    (?, ?) AS new
+ON DUPLICATE KEY
+UPDATE
+    key_pem = new.key_pem;`,
+		hash, pemKey,
+	)
+	return err
+}
+
+func (s *MySQLStorage) RetrievePushKey(ctx context.Context, hash string) ([]byte, error) {
+	var keyPEM []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT key_pem FROM push_keys WHERE pubkey_sha256 = ?;`,
+		hash,
+	).Scan(&keyPEM)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return keyPEM, err
+}
+
+func (s *MySQLStorage) DeletePushKey(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM push_keys WHERE pubkey_sha256 = ?;`,
+		hash,
+	)
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/micromdm/nanomdm/mdm"
+	"github.com/micromdm/nanomdm/storage"
 )
 
 func enqueue(ctx context.Context, tx *sql.Tx, ids []string, cmd *mdm.Command) error {
@@ -47,6 +48,41 @@ func (m *MySQLStorage) EnqueueCommand(ctx context.Context, ids []string, cmd *md
 	return nil, tx.Commit()
 }
 
+// EnqueueCommands enqueues items in a single transaction.
+// Each item is enqueued within a savepoint so that an item that fails
+// to enqueue (e.g. a duplicate command UUID) does not fail the others.
+func (m *MySQLStorage) EnqueueCommands(ctx context.Context, items []*storage.EnqueueItem) ([]error, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	rollback := func(err error) ([]error, error) {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return nil, fmt.Errorf("rollback error: %w; while trying to handle error: %v", rbErr, err)
+		}
+		return nil, err
+	}
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Command == nil {
+			errs[i] = errors.New("nil command")
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, `SAVEPOINT enqueue_item;`); err != nil {
+			return rollback(err)
+		}
+		if errs[i] = enqueue(ctx, tx, item.IDs, item.Command); errs[i] != nil {
+			if _, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT enqueue_item;`); err != nil {
+				return rollback(err)
+			}
+		}
+		if _, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT enqueue_item;`); err != nil {
+			return rollback(err)
+		}
+	}
+	return errs, tx.Commit()
+}
+
 func (s *MySQLStorage) deleteCommand(ctx context.Context, tx *sql.Tx, id, uuid string) error {
 	// first, place a record lock on the command so that multiple devices
 	// trying to each delete it do not race
@@ -205,3 +241,62 @@ WHERE
 	)
 	return err
 }
+
+// RetrieveCommandResults retrieves the command results of enrollment ids.
+// Results are not retained if commands are deleted after they are
+// acknowledged (see [WithDeleteCommands]) in which case
+// [storage.ErrCommandResultsNotRetained] is returned.
+func (s *MySQLStorage) RetrieveCommandResults(ctx context.Context, uuid string, ids []string) (map[string]*mdm.CommandResults, error) {
+	if s.rm {
+		return nil, storage.ErrCommandResultsNotRetained
+	}
+	if len(ids) < 1 {
+		return nil, errors.New("no ids provided")
+	}
+	qs := "?" + strings.Repeat(", ?", len(ids)-1)
+	args := make([]interface{}, len(ids)+1)
+	args[0] = uuid
+	for i, v := range ids {
+		args[i+1] = v
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, result FROM command_results WHERE command_uuid = ? AND id IN (`+qs+`);`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make(map[string]*mdm.CommandResults)
+	for rows.Next() {
+		var id string
+		var raw []byte
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		report, err := mdm.DecodeCommandResults(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decoding results for %s: %w", id, err)
+		}
+		results[id] = report
+	}
+	return results, rows.Err()
+}
+
+// RetrieveCommandRequestType retrieves the RequestType of the command
+// with uuid. Commands are stored once for all enrollments so id is unused.
+// Commands may already be deleted if they are deleted after they are
+// acknowledged (see [WithDeleteCommands]).
+func (s *MySQLStorage) RetrieveCommandRequestType(ctx context.Context, _, uuid string) (string, error) {
+	var reqType string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT request_type FROM commands WHERE command_uuid = ?;`,
+		uuid,
+	).Scan(&reqType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return reqType, err
+}
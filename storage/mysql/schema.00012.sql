@@ -0,0 +1,15 @@
+/* Private keys of in-progress APNs push certificate requests (CSRs).
+ * Keyed by the SHA-256 hash of the (PKIX) public key so that Apple-issued
+ * push certificates can be paired with their private key. */
+CREATE TABLE push_keys (
+    pubkey_sha256 CHAR(64) NOT NULL,
+
+    key_pem TEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (pubkey_sha256),
+
+    CHECK (SUBSTRING(key_pem FROM 1 FOR 5) = '-----')
+);
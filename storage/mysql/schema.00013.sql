@@ -0,0 +1,17 @@
+/* Named and scoped API credentials. Only a hash of the secret is stored.
+ * Scopes and enrollment ID restrictions are JSON arrays of strings. */
+CREATE TABLE api_credentials (
+    name VARCHAR(255) NOT NULL,
+
+    secret_hash    CHAR(64) NOT NULL,
+    scopes         TEXT     NOT NULL,
+    enrollment_ids TEXT     NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != ''),
+    CHECK (secret_hash != '')
+);
@@ -0,0 +1,29 @@
+/* Audit log of state-changing API calls. Enrollment IDs are a JSON
+ * array of strings and details a JSON object of strings. */
+CREATE TABLE audit_log (
+    seq BIGINT NOT NULL AUTO_INCREMENT,
+    id  VARCHAR(255) NOT NULL,
+
+    actor          VARCHAR(255) NOT NULL,
+    source_ip      VARCHAR(255) NOT NULL,
+    trace_id       VARCHAR(255) NOT NULL,
+    action         VARCHAR(255) NOT NULL,
+    enrollment_ids JSON         NOT NULL,
+    command_uuid   VARCHAR(127) NOT NULL,
+    request_type   VARCHAR(63)  NOT NULL,
+    topic          VARCHAR(255) NOT NULL,
+    details        JSON         NOT NULL,
+    outcome        VARCHAR(31)  NOT NULL,
+    status         INTEGER      NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (seq),
+    UNIQUE (id),
+
+    CHECK (id != ''),
+    CHECK (action != ''),
+    INDEX idx_actor (actor),
+    INDEX idx_command_uuid (command_uuid),
+    INDEX idx_created_at (created_at)
+);
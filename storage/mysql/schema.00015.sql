@@ -0,0 +1,18 @@
+/* Stored results of API requests made with idempotency keys. A zero
+ * status is a request that is still in progress. */
+CREATE TABLE idempotency_records (
+    idempotency_key VARCHAR(255) NOT NULL,
+
+    request_hash VARCHAR(255) NOT NULL,
+    status       INTEGER      NOT NULL,
+    response     MEDIUMBLOB   NULL,
+    expires_at   TIMESTAMP    NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (idempotency_key),
+
+    CHECK (idempotency_key != ''),
+    INDEX idx_expires_at (expires_at)
+);
@@ -0,0 +1,14 @@
+/* Named MDM command templates. The body is a command plist which may
+ * contain variable placeholders. */
+CREATE TABLE command_templates (
+    name VARCHAR(255) NOT NULL,
+
+    body MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != '')
+);
@@ -0,0 +1,43 @@
+/* Declarative Management declarations. The declaration is the JSON
+ * declaration without its ServerToken. */
+CREATE TABLE ddm_declarations (
+    identifier   VARCHAR(255) NOT NULL,
+    type         VARCHAR(255) NOT NULL,
+    server_token VARCHAR(255) NOT NULL,
+
+    declaration MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (identifier),
+
+    CHECK (identifier != ''),
+    CHECK (type != '')
+);
+
+/* Named sets of Declarative Management declarations. */
+CREATE TABLE ddm_set_declarations (
+    set_name               VARCHAR(255) NOT NULL,
+    declaration_identifier VARCHAR(255) NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (set_name, declaration_identifier),
+
+    CHECK (set_name != ''),
+    INDEX idx_declaration_identifier (declaration_identifier)
+);
+
+/* Declaration sets assigned to enrollments. */
+CREATE TABLE ddm_enrollment_sets (
+    enrollment_id VARCHAR(255) NOT NULL,
+    set_name      VARCHAR(255) NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id, set_name),
+
+    CHECK (enrollment_id != ''),
+    INDEX idx_set_name (set_name)
+);
@@ -0,0 +1,14 @@
+/* Declarative Management status of enrollments. The status is the
+ * JSON status document merged from device status reports. */
+CREATE TABLE ddm_statuses (
+    enrollment_id VARCHAR(255) NOT NULL,
+
+    status MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id),
+
+    CHECK (enrollment_id != '')
+);
@@ -0,0 +1,16 @@
+/* One-time tokens for retrieving an enrollment profile. Only the
+ * SHA-256 hash of the token is stored. */
+CREATE TABLE enrollment_tokens (
+    token_hash CHAR(64)     NOT NULL,
+
+    label      VARCHAR(255) NULL,
+    expires_at TIMESTAMP    NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (token_hash),
+
+    CHECK (token_hash != ''),
+    INDEX idx_expires_at (expires_at)
+);
@@ -269,6 +269,23 @@ CREATE TABLE push_certs (
 );
 
 
+/* Private keys of in-progress APNs push certificate requests (CSRs).
+ * Keyed by the SHA-256 hash of the (PKIX) public key so that Apple-issued
+ * push certificates can be paired with their private key. */
+CREATE TABLE push_keys (
+    pubkey_sha256 CHAR(64) NOT NULL,
+
+    key_pem TEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (pubkey_sha256),
+
+    CHECK (SUBSTRING(key_pem FROM 1 FOR 5) = '-----')
+);
+
+
 CREATE TABLE cert_auth_associations (
     id     VARCHAR(255) NOT NULL,
     sha256 CHAR(64)     NOT NULL,
@@ -282,3 +299,167 @@ CREATE TABLE cert_auth_associations (
     CHECK (sha256 != ''),
     INDEX idx_sha256 (sha256)
 );
+
+
+/* Named and scoped API credentials. Only a hash of the secret is stored.
+ * Scopes and enrollment ID restrictions are JSON arrays of strings. */
+CREATE TABLE api_credentials (
+    name VARCHAR(255) NOT NULL,
+
+    secret_hash    CHAR(64) NOT NULL,
+    scopes         TEXT     NOT NULL,
+    enrollment_ids TEXT     NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != ''),
+    CHECK (secret_hash != '')
+);
+
+
+/* Audit log of state-changing API calls. Enrollment IDs are a JSON
+ * array of strings and details a JSON object of strings. */
+CREATE TABLE audit_log (
+    seq BIGINT NOT NULL AUTO_INCREMENT,
+    id  VARCHAR(255) NOT NULL,
+
+    actor          VARCHAR(255) NOT NULL,
+    source_ip      VARCHAR(255) NOT NULL,
+    trace_id       VARCHAR(255) NOT NULL,
+    action         VARCHAR(255) NOT NULL,
+    enrollment_ids JSON         NOT NULL,
+    command_uuid   VARCHAR(127) NOT NULL,
+    request_type   VARCHAR(63)  NOT NULL,
+    topic          VARCHAR(255) NOT NULL,
+    details        JSON         NOT NULL,
+    outcome        VARCHAR(31)  NOT NULL,
+    status         INTEGER      NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (seq),
+    UNIQUE (id),
+
+    CHECK (id != ''),
+    CHECK (action != ''),
+    INDEX idx_actor (actor),
+    INDEX idx_command_uuid (command_uuid),
+    INDEX idx_created_at (created_at)
+);
+
+
+/* Stored results of API requests made with idempotency keys. A zero
+ * status is a request that is still in progress. */
+CREATE TABLE idempotency_records (
+    idempotency_key VARCHAR(255) NOT NULL,
+
+    request_hash VARCHAR(255) NOT NULL,
+    status       INTEGER      NOT NULL,
+    response     MEDIUMBLOB   NULL,
+    expires_at   TIMESTAMP    NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (idempotency_key),
+
+    CHECK (idempotency_key != ''),
+    INDEX idx_expires_at (expires_at)
+);
+
+
+/* Named MDM command templates. The body is a command plist which may
+ * contain variable placeholders. */
+CREATE TABLE command_templates (
+    name VARCHAR(255) NOT NULL,
+
+    body MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != '')
+);
+
+
+/* Declarative Management declarations. The declaration is the JSON
+ * declaration without its ServerToken. */
+CREATE TABLE ddm_declarations (
+    identifier   VARCHAR(255) NOT NULL,
+    type         VARCHAR(255) NOT NULL,
+    server_token VARCHAR(255) NOT NULL,
+
+    declaration MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (identifier),
+
+    CHECK (identifier != ''),
+    CHECK (type != '')
+);
+
+/* Named sets of Declarative Management declarations. */
+CREATE TABLE ddm_set_declarations (
+    set_name               VARCHAR(255) NOT NULL,
+    declaration_identifier VARCHAR(255) NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (set_name, declaration_identifier),
+
+    CHECK (set_name != ''),
+    INDEX idx_declaration_identifier (declaration_identifier)
+);
+
+/* Declaration sets assigned to enrollments. */
+CREATE TABLE ddm_enrollment_sets (
+    enrollment_id VARCHAR(255) NOT NULL,
+    set_name      VARCHAR(255) NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id, set_name),
+
+    CHECK (enrollment_id != ''),
+    INDEX idx_set_name (set_name)
+);
+
+/* Declarative Management status of enrollments. The status is the
+ * JSON status document merged from device status reports. */
+CREATE TABLE ddm_statuses (
+    enrollment_id VARCHAR(255) NOT NULL,
+
+    status MEDIUMTEXT NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id),
+
+    CHECK (enrollment_id != '')
+);
+
+
+/* One-time tokens for retrieving an enrollment profile. Only the
+ * SHA-256 hash of the token is stored. */
+CREATE TABLE enrollment_tokens (
+    token_hash CHAR(64)     NOT NULL,
+
+    label      VARCHAR(255) NULL,
+    expires_at TIMESTAMP    NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (token_hash),
+
+    CHECK (token_hash != ''),
+    INDEX idx_expires_at (expires_at)
+);
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const cmdTmplSelect = `SELECT name, body, UNIX_TIMESTAMP(created_at), UNIX_TIMESTAMP(updated_at) FROM command_templates`
+
+// StoreCommandTemplate stores tmpl. The created_at and updated_at
+// timestamps are managed by the database.
+func (s *MySQLStorage) StoreCommandTemplate(ctx context.Context, tmpl *storage.CommandTemplate) error {
+	if tmpl == nil || tmpl.Name == "" {
+		return errors.New("empty template name")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO command_templates
+    (name, body)
+VALUES
+    (?, ?) AS new
+ON DUPLICATE KEY
+UPDATE
+    body = new.body;`,
+		tmpl.Name, tmpl.Body,
+	)
+	return err
+}
+
+// scanCommandTemplate scans a row selected with cmdTmplSelect.
+func scanCommandTemplate(scan func(...interface{}) error) (*storage.CommandTemplate, error) {
+	tmpl := new(storage.CommandTemplate)
+	var createdAt, updatedAt int64
+	if err := scan(&tmpl.Name, &tmpl.Body, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	tmpl.CreatedAt = time.Unix(createdAt, 0)
+	tmpl.UpdatedAt = time.Unix(updatedAt, 0)
+	return tmpl, nil
+}
+
+func (s *MySQLStorage) RetrieveCommandTemplate(ctx context.Context, name string) (*storage.CommandTemplate, error) {
+	tmpl, err := scanCommandTemplate(s.db.QueryRowContext(
+		ctx,
+		cmdTmplSelect+` WHERE name = ?;`,
+		name,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return tmpl, err
+}
+
+func (s *MySQLStorage) ListCommandTemplates(ctx context.Context) ([]*storage.CommandTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, cmdTmplSelect+` ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tmpls []*storage.CommandTemplate
+	for rows.Next() {
+		tmpl, err := scanCommandTemplate(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, rows.Err()
+}
+
+func (s *MySQLStorage) DeleteCommandTemplate(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM command_templates WHERE name = ?;`, name)
+	return err
+}
@@ -0,0 +1,96 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const apiCredSelect = `SELECT name, secret_hash, scopes, enrollment_ids, EXTRACT(EPOCH FROM created_at)::BIGINT, EXTRACT(EPOCH FROM updated_at)::BIGINT FROM api_credentials`
+
+// StoreAPICredential stores cred. The created_at and updated_at
+// timestamps are managed by the database.
+func (s *PgSQLStorage) StoreAPICredential(ctx context.Context, cred *storage.APICredential) error {
+	if cred == nil || cred.Name == "" {
+		return errors.New("empty credential name")
+	}
+	scopes, err := json.Marshal(cred.Scopes)
+	if err != nil {
+		return err
+	}
+	ids, err := json.Marshal(cred.EnrollmentIDs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx, `
+INSERT INTO api_credentials
+    (name, secret_hash, scopes, enrollment_ids)
+VALUES
+    ($1, $2, $3, $4)
+ON CONFLICT (name) DO
+UPDATE SET
+    secret_hash = EXCLUDED.secret_hash,
+    scopes = EXCLUDED.scopes,
+    enrollment_ids = EXCLUDED.enrollment_ids;`,
+		cred.Name, cred.SecretHash, string(scopes), string(ids),
+	)
+	return err
+}
+
+// scanAPICredential scans a row selected with apiCredSelect.
+func scanAPICredential(scan func(...interface{}) error) (*storage.APICredential, error) {
+	cred := new(storage.APICredential)
+	var scopes, ids []byte
+	var createdAt, updatedAt int64
+	if err := scan(&cred.Name, &cred.SecretHash, &scopes, &ids, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &cred.Scopes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ids, &cred.EnrollmentIDs); err != nil {
+		return nil, err
+	}
+	cred.CreatedAt = time.Unix(createdAt, 0)
+	cred.UpdatedAt = time.Unix(updatedAt, 0)
+	return cred, nil
+}
+
+func (s *PgSQLStorage) RetrieveAPICredential(ctx context.Context, name string) (*storage.APICredential, error) {
+	cred, err := scanAPICredential(s.db.QueryRowContext(
+		ctx,
+		apiCredSelect+` WHERE name = $1;`,
+		name,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return cred, err
+}
+
+func (s *PgSQLStorage) ListAPICredentials(ctx context.Context) ([]*storage.APICredential, error) {
+	rows, err := s.db.QueryContext(ctx, apiCredSelect+` ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var creds []*storage.APICredential
+	for rows.Next() {
+		cred, err := scanAPICredential(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, rows.Err()
+}
+
+func (s *PgSQLStorage) DeleteAPICredential(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM api_credentials WHERE name = $1;`, name)
+	return err
+}
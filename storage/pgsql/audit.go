@@ -0,0 +1,114 @@
+package pgsql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// StoreAuditEntry stores e. The entry time is recorded by the database.
+func (s *PgSQLStorage) StoreAuditEntry(ctx context.Context, e *storage.AuditEntry) error {
+	if e == nil || e.ID == "" {
+		return errors.New("empty audit entry id")
+	}
+	ids := e.EnrollmentIDs
+	if ids == nil {
+		ids = []string{}
+	}
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	details := e.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx, `
+INSERT INTO audit_log
+    (id, actor, source_ip, trace_id, action, enrollment_ids, command_uuid, request_type, topic, details, outcome, status)
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`,
+		e.ID, e.Actor, e.SourceIP, e.TraceID, e.Action, string(idsJSON),
+		e.CommandUUID, e.RequestType, e.Topic, string(detailsJSON), e.Outcome, e.Status,
+	)
+	return err
+}
+
+func (s *PgSQLStorage) RetrieveAuditEntries(ctx context.Context, q *storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	if q == nil {
+		q = new(storage.AuditQuery)
+	}
+	var where []string
+	var args []interface{}
+	// arg appends v to args and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if q.Actor != "" {
+		where = append(where, "actor = "+arg(q.Actor))
+	}
+	if q.Action != "" {
+		where = append(where, "action = "+arg(q.Action))
+	}
+	if q.CommandUUID != "" {
+		where = append(where, "command_uuid = "+arg(q.CommandUUID))
+	}
+	if q.EnrollmentID != "" {
+		where = append(where, "enrollment_ids @> to_jsonb("+arg(q.EnrollmentID)+"::TEXT)")
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "created_at >= "+arg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "created_at <= "+arg(q.Until))
+	}
+	query := `SELECT id, created_at, actor, source_ip, trace_id, action, enrollment_ids, command_uuid, request_type, topic, details, outcome, status FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY seq DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*storage.AuditEntry
+	for rows.Next() {
+		e := new(storage.AuditEntry)
+		var ids, details []byte
+		if err = rows.Scan(
+			&e.ID, &e.Time, &e.Actor, &e.SourceIP, &e.TraceID, &e.Action, &ids,
+			&e.CommandUUID, &e.RequestType, &e.Topic, &details, &e.Outcome, &e.Status,
+		); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(ids, &e.EnrollmentIDs); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+		if len(e.EnrollmentIDs) < 1 {
+			e.EnrollmentIDs = nil
+		}
+		if len(e.Details) < 1 {
+			e.Details = nil
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,208 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+const declSelect = `SELECT identifier, type, server_token, declaration, EXTRACT(EPOCH FROM created_at)::BIGINT, EXTRACT(EPOCH FROM updated_at)::BIGINT FROM ddm_declarations`
+
+// StoreDeclaration stores d. The created_at and updated_at
+// timestamps are managed by the database.
+func (s *PgSQLStorage) StoreDeclaration(ctx context.Context, d *storage.Declaration) error {
+	if d == nil || d.Identifier == "" {
+		return errors.New("empty declaration identifier")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO ddm_declarations
+    (identifier, type, server_token, declaration)
+VALUES
+    ($1, $2, $3, $4)
+ON CONFLICT (identifier) DO
+UPDATE SET
+    type = EXCLUDED.type,
+    server_token = EXCLUDED.server_token,
+    declaration = EXCLUDED.declaration;`,
+		d.Identifier, d.Type, d.ServerToken, d.Raw,
+	)
+	return err
+}
+
+// scanDeclaration scans a row selected with declSelect.
+func scanDeclaration(scan func(...interface{}) error) (*storage.Declaration, error) {
+	d := new(storage.Declaration)
+	var createdAt, updatedAt int64
+	if err := scan(&d.Identifier, &d.Type, &d.ServerToken, &d.Raw, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = time.Unix(createdAt, 0)
+	d.UpdatedAt = time.Unix(updatedAt, 0)
+	return d, nil
+}
+
+func (s *PgSQLStorage) RetrieveDeclaration(ctx context.Context, identifier string) (*storage.Declaration, error) {
+	d, err := scanDeclaration(s.db.QueryRowContext(
+		ctx,
+		declSelect+` WHERE identifier = $1;`,
+		identifier,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (s *PgSQLStorage) ListDeclarations(ctx context.Context) ([]*storage.Declaration, error) {
+	rows, err := s.db.QueryContext(ctx, declSelect+` ORDER BY identifier;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var decls []*storage.Declaration
+	for rows.Next() {
+		d, err := scanDeclaration(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, d)
+	}
+	return decls, rows.Err()
+}
+
+func (s *PgSQLStorage) DeleteDeclaration(ctx context.Context, identifier string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ddm_declarations WHERE identifier = $1;`, identifier)
+	return err
+}
+
+// replaceRows replaces the values of valueCol for rows where keyCol is
+// key in table in a single transaction.
+func (s *PgSQLStorage) replaceRows(ctx context.Context, table, keyCol, valueCol, key string, values []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+keyCol+` = $1;`, key)
+		if err != nil || len(values) < 1 {
+			return err
+		}
+		args := []interface{}{key}
+		placeholders := make([]string, 0, len(values))
+		for _, v := range values {
+			args = append(args, v)
+			placeholders = append(placeholders, fmt.Sprintf("($1, $%d)", len(args)))
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO `+table+` (`+keyCol+`, `+valueCol+`) VALUES `+
+				strings.Join(placeholders, ", ")+` ON CONFLICT DO NOTHING;`,
+			args...,
+		)
+		return err
+	}()
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("rollback error: %w; while trying to handle error: %v", rbErr, err)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryStrings returns the single string column of the rows of query.
+func (s *PgSQLStorage) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (s *PgSQLStorage) StoreDeclarationSet(ctx context.Context, name string, identifiers []string) error {
+	if name == "" {
+		return errors.New("empty set name")
+	}
+	return s.replaceRows(ctx, "ddm_set_declarations", "set_name", "declaration_identifier", name, identifiers)
+}
+
+func (s *PgSQLStorage) RetrieveDeclarationSet(ctx context.Context, name string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT declaration_identifier FROM ddm_set_declarations WHERE set_name = $1 ORDER BY declaration_identifier;`,
+		name,
+	)
+}
+
+func (s *PgSQLStorage) ListDeclarationSets(ctx context.Context) ([]string, error) {
+	return s.queryStrings(ctx, `SELECT DISTINCT set_name FROM ddm_set_declarations ORDER BY set_name;`)
+}
+
+func (s *PgSQLStorage) StoreEnrollmentDeclarationSets(ctx context.Context, id string, sets []string) error {
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	return s.replaceRows(ctx, "ddm_enrollment_sets", "enrollment_id", "set_name", id, sets)
+}
+
+func (s *PgSQLStorage) RetrieveEnrollmentDeclarationSets(ctx context.Context, id string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT set_name FROM ddm_enrollment_sets WHERE enrollment_id = $1 ORDER BY set_name;`,
+		id,
+	)
+}
+
+func (s *PgSQLStorage) ListDeclarationSetEnrollments(ctx context.Context, name string) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT enrollment_id FROM ddm_enrollment_sets WHERE set_name = $1 ORDER BY enrollment_id;`,
+		name,
+	)
+}
+
+func (s *PgSQLStorage) StoreDeclarationStatus(ctx context.Context, id string, status []byte) error {
+	if id == "" {
+		return errors.New("empty enrollment id")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO ddm_statuses
+    (enrollment_id, status)
+VALUES
+    ($1, $2)
+ON CONFLICT (enrollment_id) DO
+UPDATE SET
+    status = EXCLUDED.status;`,
+		id, status,
+	)
+	return err
+}
+
+func (s *PgSQLStorage) RetrieveDeclarationStatus(ctx context.Context, id string) ([]byte, error) {
+	var status []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT status FROM ddm_statuses WHERE enrollment_id = $1;`,
+		id,
+	).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return status, err
+}
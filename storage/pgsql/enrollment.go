@@ -0,0 +1,135 @@
+package pgsql
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/micromdm/nanomdm/cryptoutil"
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// queryEnrollmentAttributes queries the attributes of the enrollments
+// matching where from their stored TokenUpdate and device serial number.
+func (s *PgSQLStorage) queryEnrollmentAttributes(ctx context.Context, where string, args ...interface{}) (map[string]*storage.EnrollmentAttributes, error) {
+	rows, err := s.db.QueryContext(
+		ctx, `
+SELECT
+    e.id,
+    COALESCE(u.token_update, d.token_update),
+    d.serial_number
+FROM
+    enrollments AS e
+    INNER JOIN devices AS d
+        ON d.id = e.device_id
+    LEFT JOIN users AS u
+        ON u.id = e.user_id AND u.device_id = e.device_id
+WHERE
+    `+where+`;`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attrs := make(map[string]*storage.EnrollmentAttributes)
+	for rows.Next() {
+		var id string
+		var tokUpd, serial sql.NullString
+		if err := rows.Scan(&id, &tokUpd, &serial); err != nil {
+			return nil, err
+		}
+		if !tokUpd.Valid {
+			continue
+		}
+		if attrs[id], err = storage.DecodeEnrollmentAttributes([]byte(tokUpd.String), serial.String); err != nil {
+			return nil, fmt.Errorf("enrollment attributes for %s: %w", id, err)
+		}
+	}
+	return attrs, rows.Err()
+}
+
+// RetrieveEnrollmentAttributes retrieves the attributes of enrollment
+// ids from their stored TokenUpdate and device serial number.
+func (s *PgSQLStorage) RetrieveEnrollmentAttributes(ctx context.Context, ids []string) (map[string]*storage.EnrollmentAttributes, error) {
+	if len(ids) < 1 {
+		return nil, errors.New("no ids provided")
+	}
+	var where strings.Builder
+	where.WriteString("e.id IN (")
+	args := make([]interface{}, len(ids))
+	for i, v := range ids {
+		args[i] = v
+		if i > 0 {
+			where.WriteString(",")
+		}
+		where.WriteString("$")
+		where.WriteString(strconv.Itoa(i + 1))
+	}
+	where.WriteString(")")
+	return s.queryEnrollmentAttributes(ctx, where.String(), args...)
+}
+
+// ResolveSerialNumber resolves the enabled enrollment IDs of the
+// channels selected by sel of devices with serial number serial.
+func (s *PgSQLStorage) ResolveSerialNumber(ctx context.Context, serial string, sel storage.ChannelSelector) ([]string, error) {
+	if serial == "" {
+		return nil, errors.New("empty serial number")
+	}
+	attrs, err := s.queryEnrollmentAttributes(ctx, `d.serial_number = $1 AND e.enabled`, serial)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(attrs), nil
+}
+
+// RetrieveIdentityCerts retrieves the device identity certificates of
+// enrollment ids. User channel enrollments use their device's certificate.
+func (s *PgSQLStorage) RetrieveIdentityCerts(ctx context.Context, ids []string) (map[string]*x509.Certificate, error) {
+	if len(ids) < 1 {
+		return nil, errors.New("no ids provided")
+	}
+	var where strings.Builder
+	args := make([]interface{}, len(ids))
+	for i, v := range ids {
+		args[i] = v
+		if i > 0 {
+			where.WriteString(",")
+		}
+		where.WriteString("$")
+		where.WriteString(strconv.Itoa(i + 1))
+	}
+	rows, err := s.db.QueryContext(
+		ctx, `
+SELECT
+    e.id,
+    d.identity_cert
+FROM
+    enrollments AS e
+    INNER JOIN devices AS d
+        ON d.id = e.device_id
+WHERE
+    e.id IN (`+where.String()+`) AND
+    d.identity_cert IS NOT NULL;`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	certs := make(map[string]*x509.Certificate)
+	for rows.Next() {
+		var id, certPEM string
+		if err := rows.Scan(&id, &certPEM); err != nil {
+			return nil, err
+		}
+		if certs[id], err = cryptoutil.DecodePEMCertificate([]byte(certPEM)); err != nil {
+			return nil, fmt.Errorf("decoding identity certificate for %s: %w", id, err)
+		}
+	}
+	return certs, rows.Err()
+}
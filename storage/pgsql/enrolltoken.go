@@ -0,0 +1,53 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+// StoreEnrollmentToken stores t. Expired tokens are removed.
+func (s *PgSQLStorage) StoreEnrollmentToken(ctx context.Context, t *storage.EnrollmentToken) error {
+	if t == nil || t.Hash == "" {
+		return errors.New("empty enrollment token hash")
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM enrollment_tokens WHERE expires_at <= CURRENT_TIMESTAMP;`,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO enrollment_tokens (token_hash, label, expires_at) VALUES ($1, $2, TO_TIMESTAMP($3));`,
+		t.Hash, nullEmptyString(t.Label), t.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+// UseEnrollmentToken retrieves and deletes the token identified by hash.
+func (s *PgSQLStorage) UseEnrollmentToken(ctx context.Context, hash string) (*storage.EnrollmentToken, error) {
+	t := &storage.EnrollmentToken{Hash: hash}
+	var label sql.NullString
+	var expiresAt int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`DELETE FROM enrollment_tokens WHERE token_hash = $1 RETURNING label, EXTRACT(EPOCH FROM expires_at)::BIGINT;`,
+		hash,
+	).Scan(&label, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t.Label = label.String
+	t.ExpiresAt = time.Unix(expiresAt, 0)
+	if !t.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return t, nil
+}
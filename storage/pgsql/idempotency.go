@@ -0,0 +1,113 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// idempotencyPurgeInterval is the minimum time between removals of
+// expired idempotency records.
+const idempotencyPurgeInterval = time.Hour
+
+// purgeExpiredIdempotencyRecords removes expired idempotency records
+// at most once every idempotencyPurgeInterval.
+func (s *PgSQLStorage) purgeExpiredIdempotencyRecords(ctx context.Context) {
+	s.idemPurgeMu.Lock()
+	if time.Since(s.idemPurgedAt) < idempotencyPurgeInterval {
+		s.idemPurgeMu.Unlock()
+		return
+	}
+	s.idemPurgedAt = time.Now()
+	s.idemPurgeMu.Unlock()
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE expires_at <= CURRENT_TIMESTAMP;`,
+	)
+	if err != nil {
+		ctxlog.Logger(ctx, s.logger).Info("msg", "purging expired idempotency records", "err", err)
+	}
+}
+
+// CreateIdempotencyRecord stores rec if no unexpired record for rec.Key exists.
+func (s *PgSQLStorage) CreateIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) (bool, error) {
+	if rec == nil || rec.Key == "" {
+		return false, errors.New("empty idempotency key")
+	}
+	go s.purgeExpiredIdempotencyRecords(context.Background())
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE idempotency_key = $1 AND expires_at <= CURRENT_TIMESTAMP;`,
+		rec.Key,
+	)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO idempotency_records
+    (idempotency_key, request_hash, status, response, expires_at)
+VALUES
+    ($1, $2, $3, $4, TO_TIMESTAMP($5))
+ON CONFLICT (idempotency_key) DO NOTHING;`,
+		rec.Key, rec.RequestHash, rec.Status, rec.Response, rec.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// StoreIdempotencyRecord stores rec.
+func (s *PgSQLStorage) StoreIdempotencyRecord(ctx context.Context, rec *storage.IdempotencyRecord) error {
+	if rec == nil || rec.Key == "" {
+		return errors.New("empty idempotency key")
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO idempotency_records
+    (idempotency_key, request_hash, status, response, expires_at)
+VALUES
+    ($1, $2, $3, $4, TO_TIMESTAMP($5))
+ON CONFLICT (idempotency_key) DO
+UPDATE SET
+    request_hash = EXCLUDED.request_hash,
+    status = EXCLUDED.status,
+    response = EXCLUDED.response,
+    expires_at = EXCLUDED.expires_at;`,
+		rec.Key, rec.RequestHash, rec.Status, rec.Response, rec.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+func (s *PgSQLStorage) RetrieveIdempotencyRecord(ctx context.Context, key string) (*storage.IdempotencyRecord, error) {
+	rec := &storage.IdempotencyRecord{Key: key}
+	var expiresAt int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT request_hash, status, response, EXTRACT(EPOCH FROM expires_at)::BIGINT FROM idempotency_records WHERE idempotency_key = $1 AND expires_at > CURRENT_TIMESTAMP;`,
+		key,
+	).Scan(&rec.RequestHash, &rec.Status, &rec.Response, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rec.ExpiresAt = time.Unix(expiresAt, 0)
+	return rec, nil
+}
+
+func (s *PgSQLStorage) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_records WHERE idempotency_key = $1;`,
+		key,
+	)
+	return err
+}
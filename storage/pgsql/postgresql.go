@@ -7,6 +7,8 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/micromdm/nanomdm/cryptoutil"
 	"github.com/micromdm/nanomdm/mdm"
@@ -26,6 +28,9 @@ type PgSQLStorage struct {
 	logger log.Logger
 	db     *sql.DB
 	rm     bool
+
+	idemPurgeMu  sync.Mutex
+	idemPurgedAt time.Time
 }
 
 type config struct {
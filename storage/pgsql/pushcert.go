@@ -3,6 +3,8 @@ package pgsql
 import (
 	"context"
 	"crypto/tls"
+	"database/sql"
+	"errors"
 	"strconv"
 
 	"github.com/micromdm/nanomdm/cryptoutil"
@@ -40,6 +42,23 @@ func (s *PgSQLStorage) IsPushCertStale(ctx context.Context, topic, staleToken st
 	return dbStaleToken != staleTokenInt, err
 }
 
+func (s *PgSQLStorage) ListPushCertTopics(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT topic FROM push_certs;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var topics []string
+	for rows.Next() {
+		var topic string
+		if err = rows.Scan(&topic); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	return topics, rows.Err()
+}
+
 func (s *PgSQLStorage) StorePushCert(ctx context.Context, pemCert, pemKey []byte) error {
 	topic, err := cryptoutil.TopicFromPEMCert(pemCert)
 	if err != nil {
@@ -60,3 +79,40 @@ UPDATE SET
 	)
 	return err
 }
+
+func (s *PgSQLStorage) StorePushKey(ctx context.Context, hash string, pemKey []byte) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO push_keys
+    (pubkey_sha256, key_pem)
+VALUES
+    ($1, $2)
+ON CONFLICT (pubkey_sha256) DO
+UPDATE SET
+    key_pem = EXCLUDED.key_pem;`,
+		hash, pemKey,
+	)
+	return err
+}
+
+func (s *PgSQLStorage) RetrievePushKey(ctx context.Context, hash string) ([]byte, error) {
+	var keyPEM []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT key_pem FROM push_keys WHERE pubkey_sha256 = $1;`,
+		hash,
+	).Scan(&keyPEM)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return keyPEM, err
+}
+
+func (s *PgSQLStorage) DeletePushKey(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM push_keys WHERE pubkey_sha256 = $1;`,
+		hash,
+	)
+	return err
+}
@@ -264,6 +264,206 @@ CREATE TABLE push_certs
 );
 
 
+/* Private keys of in-progress APNs push certificate requests (CSRs).
+ * Keyed by the SHA-256 hash of the (PKIX) public key so that Apple-issued
+ * push certificates can be paired with their private key. */
+CREATE TABLE push_keys
+(
+    pubkey_sha256 CHAR(64)  NOT NULL,
+
+    key_pem       TEXT      NOT NULL,
+
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (pubkey_sha256),
+
+    CHECK (SUBSTRING(key_pem FROM 1 FOR 5) = '-----')
+);
+
+
+/* Named and scoped API credentials. Only a hash of the secret is stored.
+ * Scopes and enrollment ID restrictions are JSON arrays of strings. */
+CREATE TABLE api_credentials
+(
+    name           VARCHAR(255) NOT NULL,
+
+    secret_hash    CHAR(64)     NOT NULL,
+    scopes         TEXT         NOT NULL,
+    enrollment_ids TEXT         NOT NULL,
+
+    created_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != ''),
+    CHECK (secret_hash != '')
+);
+
+
+/* Audit log of state-changing API calls. Enrollment IDs are a JSON
+ * array of strings and details a JSON object of strings. Note the
+ * time zone-aware created_at so that entry times are unambiguous. */
+CREATE TABLE audit_log
+(
+    seq            BIGSERIAL    NOT NULL,
+    id             VARCHAR(255) NOT NULL,
+
+    actor          VARCHAR(255) NOT NULL,
+    source_ip      VARCHAR(255) NOT NULL,
+    trace_id       VARCHAR(255) NOT NULL,
+    action         VARCHAR(255) NOT NULL,
+    enrollment_ids JSONB        NOT NULL,
+    command_uuid   VARCHAR(127) NOT NULL,
+    request_type   VARCHAR(63)  NOT NULL,
+    topic          VARCHAR(255) NOT NULL,
+    details        JSONB        NOT NULL,
+    outcome        VARCHAR(31)  NOT NULL,
+    status         INTEGER      NOT NULL,
+
+    created_at     TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (seq),
+    UNIQUE (id),
+
+    CHECK (id != ''),
+    CHECK (action != '')
+);
+
+CREATE INDEX idx_audit_log_actor ON audit_log (actor);
+CREATE INDEX idx_audit_log_command_uuid ON audit_log (command_uuid);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
+
+
+/* Stored results of API requests made with idempotency keys. A zero
+ * status is a request that is still in progress. */
+CREATE TABLE idempotency_records
+(
+    idempotency_key VARCHAR(255) NOT NULL,
+
+    request_hash    VARCHAR(255) NOT NULL,
+    status          INTEGER      NOT NULL,
+    response        BYTEA        NULL,
+    expires_at      TIMESTAMPTZ  NOT NULL,
+
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (idempotency_key),
+
+    CHECK (idempotency_key != '')
+);
+
+CREATE INDEX idx_idempotency_records_expires_at ON idempotency_records (expires_at);
+
+
+/* Named MDM command templates. The body is a command plist which may
+ * contain variable placeholders. */
+CREATE TABLE command_templates
+(
+    name       VARCHAR(255) NOT NULL,
+
+    body       TEXT         NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (name != '')
+);
+
+
+/* Declarative Management declarations. The declaration is the JSON
+ * declaration without its ServerToken. */
+CREATE TABLE ddm_declarations
+(
+    identifier   VARCHAR(255) NOT NULL,
+    type         VARCHAR(255) NOT NULL,
+    server_token VARCHAR(255) NOT NULL,
+
+    declaration  TEXT         NOT NULL,
+
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (identifier),
+
+    CHECK (identifier != ''),
+    CHECK (type != '')
+);
+
+
+/* Named sets of Declarative Management declarations. */
+CREATE TABLE ddm_set_declarations
+(
+    set_name               VARCHAR(255) NOT NULL,
+    declaration_identifier VARCHAR(255) NOT NULL,
+
+    created_at             TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (set_name, declaration_identifier),
+
+    CHECK (set_name != '')
+);
+
+CREATE INDEX idx_ddm_set_declarations_identifier ON ddm_set_declarations (declaration_identifier);
+
+
+/* Declaration sets assigned to enrollments. */
+CREATE TABLE ddm_enrollment_sets
+(
+    enrollment_id VARCHAR(255) NOT NULL,
+    set_name      VARCHAR(255) NOT NULL,
+
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id, set_name),
+
+    CHECK (enrollment_id != '')
+);
+
+CREATE INDEX idx_ddm_enrollment_sets_set_name ON ddm_enrollment_sets (set_name);
+
+
+/* Declarative Management status of enrollments. The status is the
+ * JSON status document merged from device status reports. */
+CREATE TABLE ddm_statuses
+(
+    enrollment_id VARCHAR(255) NOT NULL,
+
+    status        TEXT         NOT NULL,
+
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id),
+
+    CHECK (enrollment_id != '')
+);
+
+
+/* One-time tokens for retrieving an enrollment profile. Only the
+ * SHA-256 hash of the token is stored. */
+CREATE TABLE enrollment_tokens
+(
+    token_hash CHAR(64)     NOT NULL,
+
+    label      VARCHAR(255) NULL,
+    expires_at TIMESTAMPTZ  NOT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (token_hash),
+
+    CHECK (token_hash != '')
+);
+
+CREATE INDEX idx_enrollment_tokens_expires_at ON enrollment_tokens (expires_at);
+
+
 CREATE TABLE cert_auth_associations
 (
     id         VARCHAR(255) NOT NULL,
@@ -313,5 +513,23 @@ CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON enrollment_queue
 CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON push_certs
     FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
 
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON push_keys
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
 CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON cert_auth_associations
     FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON api_credentials
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON command_templates
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON ddm_declarations
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON ddm_statuses
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
+
+CREATE TRIGGER update_at_to_current_timestamp BEFORE UPDATE ON enrollment_tokens
+    FOR EACH ROW EXECUTE PROCEDURE update_current_timestamp();
@@ -15,6 +15,13 @@ type PushCertStore interface {
 	RetrievePushCert(ctx context.Context, topic string) (cert *tls.Certificate, staleToken string, err error)
 }
 
+// PushCertTopicLister lists the topics of stored APNs push certificates.
+type PushCertTopicLister interface {
+	// ListPushCertTopics returns the APNs topics of the stored push
+	// certificates in no particular order.
+	ListPushCertTopics(ctx context.Context) ([]string, error)
+}
+
 // PushCertStorer stores APNs push certificates.
 type PushCertStorer interface {
 	// StorePushCert stores the PEM certificate and private key.
@@ -22,3 +29,23 @@ type PushCertStorer interface {
 	// need to use as a key, is decoded from the from the PEM certificate.
 	StorePushCert(ctx context.Context, pemCert, pemKey []byte) error
 }
+
+// PushKeyStore stores and retrieves the private keys of in-progress
+// APNs push certificate requests (that is: CSRs that have not yet been
+// issued by Apple). This allows the server to generate and hold the
+// private key of a push certificate.
+type PushKeyStore interface {
+	// StorePushKey stores the PEM private key.
+	// The hash is the hex-encoded SHA-256 digest of the PKIX
+	// public key of the private key (see cryptoutil.PublicKeyHash).
+	StorePushKey(ctx context.Context, hash string, pemKey []byte) error
+
+	// RetrievePushKey retrieves the PEM private key by its public key hash.
+	// If no key is found then a nil key and no error should be returned.
+	RetrievePushKey(ctx context.Context, hash string) ([]byte, error)
+
+	// DeletePushKey deletes the PEM private key by its public key hash.
+	// This is done once the push certificate of the key is stored.
+	// Deleting a key that does not exist is not an error.
+	DeletePushKey(ctx context.Context, hash string) error
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/micromdm/nanomdm/mdm"
 )
@@ -17,3 +19,68 @@ type CommandAndReportResultsStore interface {
 type CommandEnqueuer interface {
 	EnqueueCommand(ctx context.Context, id []string, cmd *mdm.Command) (map[string]error, error)
 }
+
+// ErrCommandResultsNotRetained is returned when retrieving command
+// results from storage that deletes commands (and their results) once
+// they are acknowledged.
+var ErrCommandResultsNotRetained = errors.New("command results not retained")
+
+// CommandResultsRetriever retrieves the reported results of MDM commands.
+type CommandResultsRetriever interface {
+	// RetrieveCommandResults retrieves the most recent results reported
+	// for the command with uuid by each of the enrollment ids.
+	// Enrollment IDs that have not reported results are omitted.
+	// Note that results may be "NotNow" results.
+	// [ErrCommandResultsNotRetained] is returned if results are not kept.
+	RetrieveCommandResults(ctx context.Context, uuid string, ids []string) (map[string]*mdm.CommandResults, error)
+}
+
+// EnqueueItem is an MDM command to enqueue to enrollment IDs.
+type EnqueueItem struct {
+	IDs     []string
+	Command *mdm.Command
+}
+
+// CommandRequestTypeRetriever retrieves the RequestType of commands.
+type CommandRequestTypeRetriever interface {
+	// RetrieveCommandRequestType retrieves the RequestType of the
+	// command with uuid enqueued for enrollment id.
+	// An empty RequestType is returned if the command is not found.
+	RetrieveCommandRequestType(ctx context.Context, id, uuid string) (string, error)
+}
+
+// BatchCommandEnqueuer is able to enqueue multiple MDM commands at once.
+type BatchCommandEnqueuer interface {
+	// EnqueueCommands enqueues each of items using as few storage
+	// transactions as possible. A failure to enqueue one item should not
+	// prevent enqueueing the others. The returned errors are parallel
+	// to items with a nil error for each successfully enqueued item.
+	// A non-nil error is returned if the batch as a whole failed.
+	EnqueueCommands(ctx context.Context, items []*EnqueueItem) ([]error, error)
+}
+
+// EnqueueCommands enqueues items using enqueuer.
+// If enqueuer is a [BatchCommandEnqueuer] then items are enqueued with it.
+// Otherwise each item is enqueued individually and any per-enrollment
+// ID errors are combined into the item error.
+// See [BatchCommandEnqueuer] for the return value semantics.
+func EnqueueCommands(ctx context.Context, enqueuer CommandEnqueuer, items []*EnqueueItem) ([]error, error) {
+	if batcher, ok := enqueuer.(BatchCommandEnqueuer); ok {
+		return batcher.EnqueueCommands(ctx, items)
+	}
+	errs := make([]error, len(items))
+	for i, item := range items {
+		idErrs, err := enqueuer.EnqueueCommand(ctx, item.IDs, item.Command)
+		if err == nil && len(idErrs) > 0 {
+			for id, idErr := range idErrs {
+				err = fmt.Errorf("id %s: %w", id, idErr)
+				break
+			}
+			if len(idErrs) > 1 {
+				err = fmt.Errorf("%w (and %d more id errors)", err, len(idErrs)-1)
+			}
+		}
+		errs[i] = err
+	}
+	return errs, nil
+}
@@ -14,12 +14,26 @@ type AllStorage interface {
 	ServiceStore
 	PushStore
 	PushCertStore
+	PushCertTopicLister
 	CommandEnqueuer
+	CommandResultsRetriever
+	CommandRequestTypeRetriever
 	CertAuthStore
 	CertAuthRetriever
 	StoreMigrator
 	TokenUpdateTallyStore
 	PushCertStorer
+	PushKeyStore
+	APICredentialStore
+	AuditStore
+	IdempotencyStore
+	CommandTemplateStore
+	EnrollmentAttributesRetriever
+	SerialNumberResolver
+	IdentityCertRetriever
+	DeclarationStore
+	DeclarationStatusStore
+	EnrollmentTokenStore
 }
 
 // ServiceStore stores & retrieves both command and check-in data.
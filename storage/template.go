@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// CommandTemplate is a named MDM command template.
+type CommandTemplate struct {
+	// Name is the unique name of the template.
+	Name string `json:"name"`
+
+	// Body is the MDM command plist with placeholders.
+	// See package cmdtemplate for the placeholder syntax.
+	Body []byte `json:"body"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CommandTemplateStore stores and retrieves MDM command templates.
+type CommandTemplateStore interface {
+	// StoreCommandTemplate creates or replaces the template identified
+	// by tmpl.Name. Implementations may manage the CreatedAt and
+	// UpdatedAt timestamps themselves.
+	StoreCommandTemplate(ctx context.Context, tmpl *CommandTemplate) error
+
+	// RetrieveCommandTemplate retrieves the template named name.
+	// If no template is found then a nil template and no error should be returned.
+	RetrieveCommandTemplate(ctx context.Context, name string) (*CommandTemplate, error)
+
+	// ListCommandTemplates retrieves all templates.
+	ListCommandTemplates(ctx context.Context) ([]*CommandTemplate, error)
+
+	// DeleteCommandTemplate deletes the template named name.
+	// Deleting a template that does not exist should not return an error.
+	DeleteCommandTemplate(ctx context.Context, name string) error
+}
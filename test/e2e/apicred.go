@@ -0,0 +1,87 @@
+package e2e
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func apicred(t *testing.T, ctx context.Context, store storage.APICredentialStore) {
+	const name = "e2e-test-cred"
+
+	if err := store.DeleteAPICredential(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := store.RetrieveAPICredential(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred != nil {
+		t.Fatal("expected nil credential before storing")
+	}
+
+	cred = &storage.APICredential{
+		Name:          name,
+		SecretHash:    "3bc51062973c458d5a6f2d8d64a023246354ad7e064b1e4e009ec8a0699a3043",
+		Scopes:        []string{"push", "enqueue:ProfileList"},
+		EnrollmentIDs: []string{"AAAA-1111", "BBBB-2222"},
+	}
+	if err = store.StoreAPICredential(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+
+	cred2, err := store.RetrieveAPICredential(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred2 == nil {
+		t.Fatal("nil credential after storing")
+	}
+	if have, want := cred2.SecretHash, cred.SecretHash; have != want {
+		t.Errorf("secret hash: have: %v, want: %v", have, want)
+	}
+	if have, want := cred2.Scopes, cred.Scopes; !reflect.DeepEqual(have, want) {
+		t.Errorf("scopes: have: %v, want: %v", have, want)
+	}
+	if have, want := cred2.EnrollmentIDs, cred.EnrollmentIDs; !reflect.DeepEqual(have, want) {
+		t.Errorf("enrollment ids: have: %v, want: %v", have, want)
+	}
+
+	// replace (e.g. rotate) the credential
+	cred.SecretHash = "a0e5ba0c7bd07a9a2a1e3c4ba4a0e1e0a1f1b8bb4e4b5e1a8b2e4e0c3b5e4a1f"
+	if err = store.StoreAPICredential(ctx, cred); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := store.ListAPICredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, c := range creds {
+		if c.Name == name {
+			found = true
+			if have, want := c.SecretHash, cred.SecretHash; have != want {
+				t.Errorf("listed secret hash: have: %v, want: %v", have, want)
+			}
+		}
+	}
+	if !found {
+		t.Error("credential not listed")
+	}
+
+	if err = store.DeleteAPICredential(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err = store.RetrieveAPICredential(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred != nil {
+		t.Error("expected nil credential after deleting")
+	}
+}
@@ -0,0 +1,87 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func auditlog(t *testing.T, ctx context.Context, store storage.AuditStore) {
+	// use a unique actor so as to only find our own entries
+	actor := "e2e-" + time.Now().Format("20060102150405.000000000")
+
+	for i, e := range []*storage.AuditEntry{
+		{
+			Action:        "enqueue",
+			EnrollmentIDs: []string{"AAAA-1111", "BBBB-2222"},
+			CommandUUID:   "CMD-AUDIT-1",
+			RequestType:   "ProfileList",
+			Outcome:       storage.AuditOutcomeSuccess,
+			Status:        200,
+		},
+		{
+			Action:        "push",
+			EnrollmentIDs: []string{"BBBB-2222"},
+			Outcome:       storage.AuditOutcomeFailure,
+			Status:        500,
+		},
+		{
+			Action:  "escrowkeyunlock",
+			Topic:   "com.apple.mgmt.External.e2e",
+			Details: map[string]string{"serial": "C8TJ500QF1MN"},
+			Outcome: storage.AuditOutcomeSuccess,
+			Status:  200,
+		},
+	} {
+		e.ID = actor + "-" + string(rune('a'+i))
+		e.Time = time.Now()
+		e.Actor = actor
+		e.SourceIP = "192.0.2.1"
+		e.TraceID = "trace-" + e.ID
+		if err := store.StoreAuditEntry(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		// make sure time-ordered backends order our entries
+		time.Sleep(time.Millisecond)
+	}
+
+	entries, err := store.RetrieveAuditEntries(ctx, &storage.AuditQuery{Actor: actor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 3; have != want {
+		t.Fatalf("entries: have: %v, want: %v", have, want)
+	}
+	if have, want := entries[0].Action, "escrowkeyunlock"; have != want {
+		t.Errorf("newest action: have: %v, want: %v", have, want)
+	}
+	if have, want := entries[0].Details["serial"], "C8TJ500QF1MN"; have != want {
+		t.Errorf("details: have: %v, want: %v", have, want)
+	}
+
+	entries, err = store.RetrieveAuditEntries(ctx, &storage.AuditQuery{Actor: actor, EnrollmentID: "BBBB-2222"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 2; have != want {
+		t.Errorf("enrollment id entries: have: %v, want: %v", have, want)
+	}
+
+	entries, err = store.RetrieveAuditEntries(ctx, &storage.AuditQuery{Actor: actor, CommandUUID: "CMD-AUDIT-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].RequestType != "ProfileList" || entries[0].SourceIP != "192.0.2.1" {
+		t.Errorf("unexpected command uuid entries: %v", entries)
+	}
+
+	entries, err = store.RetrieveAuditEntries(ctx, &storage.AuditQuery{Actor: actor, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(entries), 1; have != want {
+		t.Errorf("limited entries: have: %v, want: %v", have, want)
+	}
+}
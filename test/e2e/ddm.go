@@ -0,0 +1,181 @@
+package e2e
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func declarations(t *testing.T, ctx context.Context, store storage.DeclarationStore) {
+	const (
+		ident1  = "com.example.e2e.test.1"
+		ident2  = "com.example.e2e.test.2"
+		setName = "e2e-test-set"
+		enrID   = "e2e-test-ddm-enrollment"
+	)
+
+	for _, ident := range []string{ident1, ident2} {
+		if err := store.DeleteDeclaration(ctx, ident); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := store.RetrieveDeclaration(ctx, ident1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != nil {
+		t.Fatal("expected nil declaration before storing")
+	}
+
+	for _, ident := range []string{ident1, ident2} {
+		d = &storage.Declaration{
+			Identifier:  ident,
+			Type:        "com.apple.configuration.management.test",
+			ServerToken: "token-" + ident,
+			Raw:         []byte(`{"Identifier":"` + ident + `","Payload":{"Echo":"Foo"},"Type":"com.apple.configuration.management.test"}`),
+		}
+		if err = store.StoreDeclaration(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// replace the declaration
+	d.ServerToken = "token-2-" + ident2
+	if err = store.StoreDeclaration(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+
+	d2, err := store.RetrieveDeclaration(ctx, ident2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2 == nil {
+		t.Fatal("nil declaration after storing")
+	}
+	if have, want := d2.ServerToken, d.ServerToken; have != want {
+		t.Errorf("server token: have: %v, want: %v", have, want)
+	}
+	if have, want := string(d2.Raw), string(d.Raw); have != want {
+		t.Errorf("raw: have: %v, want: %v", have, want)
+	}
+	if have, want := d2.Type, d.Type; have != want {
+		t.Errorf("type: have: %v, want: %v", have, want)
+	}
+
+	decls, err := store.ListDeclarations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, d := range decls {
+		if d.Identifier == ident1 || d.Identifier == ident2 {
+			found++
+		}
+	}
+	if have, want := found, 2; have != want {
+		t.Errorf("listed declarations: have: %v, want: %v", have, want)
+	}
+
+	// sets
+	if err = store.StoreDeclarationSet(ctx, setName, []string{ident2, ident1}); err != nil {
+		t.Fatal(err)
+	}
+	idents, err := store.RetrieveDeclarationSet(ctx, setName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := idents, []string{ident1, ident2}; !reflect.DeepEqual(have, want) {
+		t.Errorf("set declarations: have: %v, want: %v", have, want)
+	}
+
+	sets, err := store.ListDeclarationSets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(sets, setName) {
+		t.Errorf("set not listed: %v", sets)
+	}
+
+	// enrollment assignments
+	if err = store.StoreEnrollmentDeclarationSets(ctx, enrID, []string{setName}); err != nil {
+		t.Fatal(err)
+	}
+	sets, err = store.RetrieveEnrollmentDeclarationSets(ctx, enrID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := sets, []string{setName}; !reflect.DeepEqual(have, want) {
+		t.Errorf("enrollment sets: have: %v, want: %v", have, want)
+	}
+	ids, err := store.ListDeclarationSetEnrollments(ctx, setName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := ids, []string{enrID}; !reflect.DeepEqual(have, want) {
+		t.Errorf("set enrollments: have: %v, want: %v", have, want)
+	}
+
+	// remove everything
+	if err = store.StoreEnrollmentDeclarationSets(ctx, enrID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sets, err = store.RetrieveEnrollmentDeclarationSets(ctx, enrID); err != nil {
+		t.Fatal(err)
+	} else if len(sets) > 0 {
+		t.Errorf("expected no enrollment sets after removing: %v", sets)
+	}
+	if err = store.StoreDeclarationSet(ctx, setName, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sets, err = store.ListDeclarationSets(ctx); err != nil {
+		t.Fatal(err)
+	} else if contains(sets, setName) {
+		t.Error("set listed after removing")
+	}
+	for _, ident := range []string{ident1, ident2} {
+		if err = store.DeleteDeclaration(ctx, ident); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, err = store.RetrieveDeclaration(ctx, ident1); err != nil {
+		t.Fatal(err)
+	} else if d != nil {
+		t.Error("expected nil declaration after deleting")
+	}
+}
+
+func declarationStatus(t *testing.T, ctx context.Context, store storage.DeclarationStatusStore) {
+	const enrID = "e2e-test-ddm-status-enrollment"
+
+	status, err := store.RetrieveDeclarationStatus(ctx, "e2e-test-ddm-status-missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != nil {
+		t.Errorf("expected nil status: %s", status)
+	}
+
+	for _, want := range []string{`{"status":1}`, `{"status":2}`} {
+		if err = store.StoreDeclarationStatus(ctx, enrID, []byte(want)); err != nil {
+			t.Fatal(err)
+		}
+		if status, err = store.RetrieveDeclarationStatus(ctx, enrID); err != nil {
+			t.Fatal(err)
+		}
+		if have := string(status); have != want {
+			t.Errorf("status: have: %q, want: %q", have, want)
+		}
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, sv := range s {
+		if sv == v {
+			return true
+		}
+	}
+	return false
+}
@@ -71,6 +71,14 @@ func TestE2E(t *testing.T, ctx context.Context, store storage.AllStorage) {
 	c := NewHandlerClient(mux)
 
 	t.Run("pushcert", func(t *testing.T) { pushcert(t, ctx, &api{doer: c, urlPushCert: pushCertURl}, store) })
+	t.Run("pushkey", func(t *testing.T) { pushkey(t, ctx, store) })
+	t.Run("apicred", func(t *testing.T) { apicred(t, ctx, store) })
+	t.Run("audit", func(t *testing.T) { auditlog(t, ctx, store) })
+	t.Run("idempotency", func(t *testing.T) { idempotency(t, ctx, store) })
+	t.Run("cmdtemplate", func(t *testing.T) { cmdTemplate(t, ctx, store) })
+	t.Run("declarations", func(t *testing.T) { declarations(t, ctx, store) })
+	t.Run("declarationstatus", func(t *testing.T) { declarationStatus(t, ctx, store) })
+	t.Run("enrollmenttokens", func(t *testing.T) { enrollmentTokens(t, ctx, store) })
 
 	// create our new device for testing
 	d, err := newDeviceFromCheckins(
@@ -100,6 +108,12 @@ func TestE2E(t *testing.T, ctx context.Context, store storage.AllStorage) {
 
 	t.Run("tally", func(t *testing.T) { tally(t, ctx, d, store, 1) })
 
+	t.Run("enrollment-attributes", func(t *testing.T) { enrollmentAttributes(t, ctx, d, store) })
+
+	t.Run("serial-number", func(t *testing.T) { serialNumber(t, ctx, d, store) })
+
+	t.Run("identity-certs", func(t *testing.T) { identityCerts(t, ctx, d, store) })
+
 	t.Run("bstoken", func(t *testing.T) { bstoken(t, ctx, d.Enrollment) })
 
 	// re-enroll device
@@ -125,5 +139,9 @@ func TestE2E(t *testing.T, ctx context.Context, store storage.AllStorage) {
 
 	t.Run("queue", func(t *testing.T) { queue(t, ctx, d, &api{doer: c, urlEnqueue: enqueueURL}, store) })
 
+	t.Run("queue-batch", func(t *testing.T) { queueBatch(t, ctx, d, store) })
+
+	t.Run("command-results", func(t *testing.T) { commandResults(t, ctx, d, store) })
+
 	t.Run("migrate", func(t *testing.T) { migrate(t, ctx, store, d) })
 }
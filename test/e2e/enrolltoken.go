@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func enrollmentTokens(t *testing.T, ctx context.Context, store storage.EnrollmentTokenStore) {
+	// unique per run as tokens can not be replaced
+	hash := func(s string) string {
+		h := sha256.Sum256([]byte(s + strconv.FormatInt(time.Now().UnixNano(), 10)))
+		return hex.EncodeToString(h[:])
+	}
+
+	tok := &storage.EnrollmentToken{
+		Hash:      hash("e2e-test-token"),
+		Label:     "e2e-test",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := store.StoreEnrollmentToken(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	tok2, err := store.UseEnrollmentToken(ctx, tok.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok2 == nil {
+		t.Fatal("nil enrollment token after storing")
+	}
+	if have, want := tok2.Label, tok.Label; have != want {
+		t.Errorf("label: have: %v, want: %v", have, want)
+	}
+	if have, want := tok2.ExpiresAt.Unix(), tok.ExpiresAt.Unix(); have != want {
+		t.Errorf("expires at: have: %v, want: %v", have, want)
+	}
+
+	// one-time use
+	tok2, err = store.UseEnrollmentToken(ctx, tok.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok2 != nil {
+		t.Error("expected nil enrollment token after use")
+	}
+
+	// concurrent uses of the same token
+	tok = &storage.EnrollmentToken{
+		Hash:      hash("e2e-test-concurrent-token"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err = store.StoreEnrollmentToken(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	used := make(chan bool, n)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			tok2, err := store.UseEnrollmentToken(ctx, tok.Hash)
+			if err != nil {
+				t.Error(err)
+			}
+			used <- tok2 != nil
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(used)
+	var uses int
+	for u := range used {
+		if u {
+			uses++
+		}
+	}
+	if have, want := uses, 1; have != want {
+		t.Errorf("concurrent uses: have: %v, want: %v", have, want)
+	}
+
+	// expired
+	tok = &storage.EnrollmentToken{
+		Hash:      hash("e2e-test-expired-token"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err = store.StoreEnrollmentToken(ctx, tok); err != nil {
+		t.Fatal(err)
+	}
+	tok2, err = store.UseEnrollmentToken(ctx, tok.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok2 != nil {
+		t.Error("expected nil enrollment token after expiry")
+	}
+}
@@ -0,0 +1,113 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func idempotency(t *testing.T, ctx context.Context, store storage.IdempotencyStore) {
+	const key = "e2e-test-idempotency-key"
+
+	// remove any record left over from a previous run
+	err := store.DeleteIdempotencyRecord(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in progress
+	rec := &storage.IdempotencyRecord{
+		Key:         key,
+		RequestHash: "pending",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	created, err := store.CreateIdempotencyRecord(ctx, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("expected idempotency record to be created")
+	}
+	if created, err = store.CreateIdempotencyRecord(ctx, rec); err != nil {
+		t.Fatal(err)
+	} else if created {
+		t.Error("expected existing idempotency record to not be created again")
+	}
+	rec2, err := store.RetrieveIdempotencyRecord(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec2 == nil {
+		t.Fatal("nil idempotency record after storing")
+	}
+	if have, want := rec2.Status, 0; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+
+	// completed
+	rec.RequestHash = "e2e-request-hash"
+	rec.Status = 200
+	rec.Response = []byte(`{"command_uuid":"CMD-E2E"}`)
+	if err = store.StoreIdempotencyRecord(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec2, err = store.RetrieveIdempotencyRecord(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec2 == nil {
+		t.Fatal("nil idempotency record after storing")
+	}
+	if have, want := rec2.RequestHash, rec.RequestHash; have != want {
+		t.Errorf("request hash: have: %v, want: %v", have, want)
+	}
+	if have, want := rec2.Status, rec.Status; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+	if have, want := rec2.Response, rec.Response; !bytes.Equal(have, want) {
+		t.Errorf("response: have: %s, want: %s", have, want)
+	}
+	if have, want := rec2.ExpiresAt.Unix(), rec.ExpiresAt.Unix(); have != want {
+		t.Errorf("expires at: have: %v, want: %v", have, want)
+	}
+
+	// expired
+	rec.ExpiresAt = time.Now().Add(-time.Minute)
+	if err = store.StoreIdempotencyRecord(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	rec2, err = store.RetrieveIdempotencyRecord(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec2 != nil {
+		t.Error("expected nil idempotency record after expiry")
+	}
+
+	// an expired record may be created again
+	rec.ExpiresAt = time.Now().Add(time.Hour)
+	if created, err = store.CreateIdempotencyRecord(ctx, rec); err != nil {
+		t.Fatal(err)
+	} else if !created {
+		t.Error("expected idempotency record to be created after expiry")
+	}
+
+	// deleted
+	if err = store.DeleteIdempotencyRecord(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	rec2, err = store.RetrieveIdempotencyRecord(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec2 != nil {
+		t.Error("expected nil idempotency record after delete")
+	}
+	// deleting a missing record is not an error
+	if err = store.DeleteIdempotencyRecord(ctx, key); err != nil {
+		t.Error(err)
+	}
+}
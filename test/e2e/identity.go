@@ -0,0 +1,30 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func identityCerts(t *testing.T, ctx context.Context, d *device, store storage.IdentityCertRetriever) {
+	cert, _, err := d.GetIdentity(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := store.RetrieveIdentityCerts(ctx, []string{d.ID(), "INVALID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := certs["INVALID"]; ok {
+		t.Error("identity certificate for invalid enrollment id")
+	}
+
+	if have := certs[d.ID()]; have == nil {
+		t.Fatal("no identity certificate")
+	} else if !have.Equal(cert) {
+		t.Error("identity certificate mismatch")
+	}
+}
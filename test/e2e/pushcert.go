@@ -19,6 +19,7 @@ type pushCertUploader interface {
 
 type pushStore interface {
 	storage.PushCertStore
+	storage.PushCertTopicLister
 	storage.PushCertStorer
 }
 
@@ -84,4 +85,76 @@ func pushcert(t *testing.T, ctx context.Context, a pushCertUploader, store pushS
 		t.Error("stale tokens should not match after storing twice")
 	}
 
+	topics, err := store.ListPushCertTopics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, listed := range topics {
+		if listed == topic {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("topic %s not in listed topics: %v", topic, topics)
+	}
+
+}
+
+func pushkey(t *testing.T, ctx context.Context, store storage.PushKeyStore) {
+	key, _, err := test.SimpleSelfSignedRSAKeypair("pushkey", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := cryptoutil.PublicKeyHash(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemKey, err := store.RetrievePushKey(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pemKey != nil {
+		t.Fatal("expected nil key before storing")
+	}
+
+	pemKey = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	err = store.StorePushKey(ctx, hash, pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemKey2, err := store.RetrievePushKey(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(pemKey)) != strings.TrimSpace(string(pemKey2)) {
+		t.Error("mismatched keys")
+	}
+
+	err = store.DeletePushKey(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemKey2, err = store.RetrievePushKey(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pemKey2 != nil {
+		t.Error("expected nil key after deleting")
+	}
+
+	// deleting a missing key is not an error
+	err = store.DeletePushKey(ctx, hash)
+	if err != nil {
+		t.Error(err)
+	}
 }
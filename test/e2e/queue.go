@@ -8,6 +8,8 @@ import (
 
 	"github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/storage"
+
+	"github.com/micromdm/plist"
 )
 
 type enqueuer interface {
@@ -117,3 +119,104 @@ func queue(t *testing.T, ctx context.Context, d queueDevice, a enqueuer, s stora
 	})
 
 }
+
+// rawSimpleCmd makes a simple command with its raw plist.
+func rawSimpleCmd(t *testing.T, cmdID string) *mdm.Command {
+	t.Helper()
+	cmd := simpleCmd(cmdID)
+	var err error
+	if cmd.Raw, err = plist.Marshal(cmd); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func queueBatch(t *testing.T, ctx context.Context, d queueDevice, s storage.CommandEnqueuer) {
+	errs, err := storage.EnqueueCommands(ctx, s, []*storage.EnqueueItem{
+		{IDs: []string{d.ID()}, Command: rawSimpleCmd(t, "CMD5")},
+		{IDs: []string{d.ID()}, Command: rawSimpleCmd(t, "CMD6")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(errs), 2; have != want {
+		t.Fatalf("errors: have: %v, want: %v", have, want)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("item %d: %v", i, err)
+		}
+	}
+	// report Idle.
+	// expect the batch commands in order.
+	sendReportExpectCommandReply(t, ctx, d, "", "Idle", "CMD5")
+	sendReportExpectCommandReply(t, ctx, d, "CMD5", "Acknowledged", "CMD6")
+	sendReportExpectCommandReply(t, ctx, d, "CMD6", "Acknowledged", "")
+}
+
+// commandResultsStore can enqueue commands and retrieve their results.
+type commandResultsStore interface {
+	storage.CommandEnqueuer
+	storage.CommandResultsRetriever
+	storage.CommandRequestTypeRetriever
+}
+
+// retrieveResults retrieves the command results of cmdUUID for d and an unknown enrollment.
+func retrieveResults(t *testing.T, ctx context.Context, d queueDevice, s storage.CommandResultsRetriever, cmdUUID string) *mdm.CommandResults {
+	t.Helper()
+	results, err := s.RetrieveCommandResults(ctx, cmdUUID, []string{d.ID(), "unknown-enrollment-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results["unknown-enrollment-id"]; ok {
+		t.Error("unexpected results for unknown enrollment id")
+	}
+	return results[d.ID()]
+}
+
+func commandResults(t *testing.T, ctx context.Context, d queueDevice, s commandResultsStore) {
+	_, err := s.EnqueueCommand(ctx, []string{d.ID()}, rawSimpleCmd(t, "CMD7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// report Idle.
+	// expect CMD7 but no results yet.
+	sendReportExpectCommandReply(t, ctx, d, "", "Idle", "CMD7")
+	if results := retrieveResults(t, ctx, d, s, "CMD7"); results != nil {
+		t.Errorf("unexpected results: %v", results.Status)
+	}
+	reqType, err := s.RetrieveCommandRequestType(ctx, d.ID(), "CMD7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := reqType, "CMD7"; have != want {
+		t.Errorf("request type: have: %v, want: %v", have, want)
+	}
+	if reqType, err = s.RetrieveCommandRequestType(ctx, d.ID(), "unknown-command"); err != nil {
+		t.Fatal(err)
+	} else if reqType != "" {
+		t.Errorf("unexpected request type for unknown command: %v", reqType)
+	}
+	// report NotNow for CMD7.
+	sendReportExpectCommandReply(t, ctx, d, "CMD7", "NotNow", "")
+	results := retrieveResults(t, ctx, d, s, "CMD7")
+	if results == nil {
+		t.Fatal("no results")
+	}
+	if have, want := results.Status, "NotNow"; have != want {
+		t.Errorf("status: have: %v, want: %v", have, want)
+	}
+	if have, want := results.CommandUUID, "CMD7"; have != want {
+		t.Errorf("command uuid: have: %v, want: %v", have, want)
+	}
+	// report Idle then ack CMD7.
+	sendReportExpectCommandReply(t, ctx, d, "", "Idle", "CMD7")
+	sendReportExpectCommandReply(t, ctx, d, "CMD7", "Acknowledged", "")
+	// storage that deletes commands once acknowledged does not retain
+	// their results. otherwise the results must be the final results.
+	if results = retrieveResults(t, ctx, d, s, "CMD7"); results != nil {
+		if have, want := results.Status, "Acknowledged"; have != want {
+			t.Errorf("status: have: %v, want: %v", have, want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package e2e
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func serialNumber(t *testing.T, ctx context.Context, d *device, store storage.SerialNumberResolver) {
+	for _, tc := range []struct {
+		name   string
+		serial string
+		sel    storage.ChannelSelector
+		want   []string
+	}{
+		{"device", d.SerialNumber(), storage.ChannelSelector{}, []string{d.ID()}},
+		{"all", d.SerialNumber(), storage.ChannelSelector{All: true}, []string{d.ID()}},
+		{"user", d.SerialNumber(), storage.ChannelSelector{UserShortName: "nobody"}, nil},
+		{"unknown", "INVALID", storage.ChannelSelector{}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ids, err := store.ResolveSerialNumber(ctx, tc.serial, tc.sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if have, want := ids, tc.want; !reflect.DeepEqual(have, want) {
+				t.Errorf("ids: have: %v, want: %v", have, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micromdm/nanomdm/storage"
+)
+
+func cmdTemplate(t *testing.T, ctx context.Context, store storage.CommandTemplateStore) {
+	const name = "e2e-test-template"
+
+	if err := store.DeleteCommandTemplate(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := store.RetrieveCommandTemplate(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl != nil {
+		t.Fatal("expected nil template before storing")
+	}
+
+	tmpl = &storage.CommandTemplate{
+		Name: name,
+		Body: []byte(`<plist version="1.0"><dict><key>Command</key><dict><key>RequestType</key><string>{{request_type}}</string></dict></dict></plist>`),
+	}
+	if err = store.StoreCommandTemplate(ctx, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl2, err := store.RetrieveCommandTemplate(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl2 == nil {
+		t.Fatal("nil template after storing")
+	}
+	if have, want := string(tmpl2.Body), string(tmpl.Body); have != want {
+		t.Errorf("body: have: %v, want: %v", have, want)
+	}
+
+	// replace the template
+	tmpl.Body = []byte(`<plist version="1.0"><dict><key>Command</key><dict><key>RequestType</key><string>ProfileList</string></dict></dict></plist>`)
+	if err = store.StoreCommandTemplate(ctx, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls, err := store.ListCommandTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, tmpl2 := range tmpls {
+		if tmpl2.Name == name {
+			found = true
+			if have, want := string(tmpl2.Body), string(tmpl.Body); have != want {
+				t.Errorf("listed body: have: %v, want: %v", have, want)
+			}
+		}
+	}
+	if !found {
+		t.Error("template not listed")
+	}
+
+	if err = store.DeleteCommandTemplate(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err = store.RetrieveCommandTemplate(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl != nil {
+		t.Error("expected nil template after deleting")
+	}
+}
+
+func enrollmentAttributes(t *testing.T, ctx context.Context, d *device, store storage.EnrollmentAttributesRetriever) {
+	attrs, err := store.RetrieveEnrollmentAttributes(ctx, []string{d.ID(), "INVALID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(attrs), 1; have != want {
+		t.Fatalf("len(attrs): have: %v, want: %v", have, want)
+	}
+	a := attrs[d.ID()]
+	if a == nil {
+		t.Fatal("no enrollment attributes")
+	}
+	if have, want := a.UDID, d.ID(); have != want {
+		t.Errorf("udid: have: %v, want: %v", have, want)
+	}
+	if have, want := a.SerialNumber, d.SerialNumber(); have != want {
+		t.Errorf("serial number: have: %v, want: %v", have, want)
+	}
+}